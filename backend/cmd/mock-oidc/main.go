@@ -0,0 +1,31 @@
+// mock-oidc 本地开发和联调用的最小 OIDC 身份提供方，实现见 oidc/oidctest
+//
+// 授权页是一个表单，可以填写任意 sub/email/用户名/角色组；
+// 授权请求里直接带上 sub 参数时跳过表单，便于用 curl 走完整个流程。
+//
+//	go run ./cmd/mock-oidc -addr :9000 -client-id food-ordering
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"food-ordering/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, must match OIDC_ISSUER")
+	clientID := flag.String("client-id", "food-ordering", "accepted client_id")
+	clientSecret := flag.String("client-secret", "", "client secret, empty for a public client")
+	flag.Parse()
+
+	s, err := oidctest.New(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal("Failed to generate signing key:", err)
+	}
+
+	log.Printf("Mock OIDC provider %s listening on %s", s.Issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
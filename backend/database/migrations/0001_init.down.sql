@@ -0,0 +1,11 @@
+-- 回滚初始表结构（会删除全部业务数据）
+DROP TABLE IF EXISTS system_config;
+DROP TABLE IF EXISTS user_favorites;
+DROP TABLE IF EXISTS recommendation_dishes;
+DROP TABLE IF EXISTS recommendations;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS dish_nutrition;
+DROP TABLE IF EXISTS dishes;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
@@ -116,15 +116,19 @@ CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
 CREATE INDEX IF NOT EXISTS idx_order_items_order ON order_items(order_id);
 
 -- 插入初始数据
-INSERT INTO categories (name, description) VALUES 
-('肉类', '各种肉类菜品'),
-('蔬菜类', '新鲜蔬菜菜品'),
-('汤类', '营养汤品'),
-('主食', '米饭面食'),
-('甜品', '餐后甜点'),
-('饮品', '各种饮料');
+-- 种子数据按自然键去重，已手动执行过旧版 schema.sql 的库可以安全地跑这条迁移
+INSERT INTO categories (name, description)
+SELECT v.name, v.description FROM (VALUES
+    ('肉类', '各种肉类菜品'),
+    ('蔬菜类', '新鲜蔬菜菜品'),
+    ('汤类', '营养汤品'),
+    ('主食', '米饭面食'),
+    ('甜品', '餐后甜点'),
+    ('饮品', '各种饮料')
+) AS v(name, description)
+WHERE NOT EXISTS (SELECT 1 FROM categories c WHERE c.name = v.name);
 
-INSERT INTO system_config (config_key, config_value, description) VALUES 
+INSERT INTO system_config (config_key, config_value, description) VALUES
 ('default_meat_count', '1', '默认荤菜数量'),
 ('default_vegetable_count', '2', '默认素菜数量'),
 ('max_dish_count', '6', '菜品最大数量'),
@@ -132,15 +136,20 @@ INSERT INTO system_config (config_key, config_value, description) VALUES
 ('s3_access_key', '', 'S3访问密钥'),
 ('s3_secret_key', '', 'S3密钥'),
 ('s3_bucket', '', 'S3存储桶'),
-('s3_region', '', 'S3区域');
+('s3_region', '', 'S3区域')
+ON CONFLICT (config_key) DO NOTHING;
 
 -- 创建默认管理员用户 (密码: admin123)
-INSERT INTO users (username, password_hash, email, role) VALUES 
-('admin', '$2a$10$92IXUNpkjO0rOQ5byMi.Ye4oKoEa3Ro9llC/.og/at2.uheWG/igi', 'admin@example.com', 'admin');
+INSERT INTO users (username, password_hash, email, role) VALUES
+('admin', '$2a$10$92IXUNpkjO0rOQ5byMi.Ye4oKoEa3Ro9llC/.og/at2.uheWG/igi', 'admin@example.com', 'admin')
+ON CONFLICT (username) DO NOTHING;
 
 -- 创建默认推荐配置
-INSERT INTO recommendations (name, description, meat_count, vegetable_count) VALUES 
-('经典搭配', '一荤两素的经典搭配', 1, 2),
-('丰盛套餐', '两荤两素的丰盛搭配', 2, 2),
-('素食套餐', '三素一汤的健康搭配', 0, 3),
-('家庭套餐', '三荤三素的家庭分享', 3, 3);
\ No newline at end of file
+INSERT INTO recommendations (name, description, meat_count, vegetable_count)
+SELECT v.name, v.description, v.meat_count, v.vegetable_count FROM (VALUES
+    ('经典搭配', '一荤两素的经典搭配', 1, 2),
+    ('丰盛套餐', '两荤两素的丰盛搭配', 2, 2),
+    ('素食套餐', '三素一汤的健康搭配', 0, 3),
+    ('家庭套餐', '三荤三素的家庭分享', 3, 3)
+) AS v(name, description, meat_count, vegetable_count)
+WHERE NOT EXISTS (SELECT 1 FROM recommendations r WHERE r.name = v.name);
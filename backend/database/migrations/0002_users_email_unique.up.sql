@@ -0,0 +1,2 @@
+-- 邮箱不区分大小写唯一，作为注册和修改邮箱时并发写入的兜底
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email)) WHERE email IS NOT NULL AND email <> '';
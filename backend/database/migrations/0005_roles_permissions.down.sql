@@ -0,0 +1,9 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+UPDATE users SET role = 'user' WHERE role <> 'admin';
+ALTER TABLE users ALTER COLUMN role DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
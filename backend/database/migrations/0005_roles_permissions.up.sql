@@ -0,0 +1,55 @@
+-- 角色与权限：路由按权限名授权，角色到权限的映射存放在数据库中
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role VARCHAR(50) REFERENCES roles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    permission VARCHAR(100) REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+('customer', '普通用户'),
+('cook', '厨师，可以查看和推进订单'),
+('menu_editor', '菜单编辑，可以维护菜品和分类'),
+('admin', '管理员，拥有全部权限')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+('users:read', '查看用户列表'),
+('users:manage', '创建、修改、禁用和删除用户'),
+('roles:manage', '维护角色及其权限'),
+('dishes:manage', '创建、修改和删除菜品'),
+('categories:manage', '创建、修改和删除分类'),
+('orders:read', '查看所有用户的订单'),
+('orders:update', '推进订单状态'),
+('config:read', '查看系统配置'),
+('config:manage', '修改系统配置')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+('cook', 'orders:read'),
+('cook', 'orders:update'),
+('menu_editor', 'dishes:manage'),
+('menu_editor', 'categories:manage'),
+('menu_editor', 'orders:read')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions
+ON CONFLICT DO NOTHING;
+
+-- 原来的 user 角色更名为 customer，角色改为引用 roles 表
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+UPDATE users SET role = 'customer' WHERE role = 'user' OR role IS NULL;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'customer';
+ALTER TABLE users ALTER COLUMN role SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
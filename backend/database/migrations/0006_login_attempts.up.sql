@@ -0,0 +1,8 @@
+-- 登录失败记录，多副本部署时共享（LOGIN_ATTEMPT_STORE=postgres）
+-- key 形如 user:<用户名> 或 ip:<地址>
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(255) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
@@ -0,0 +1,21 @@
+-- TOTP 两步验证：totp_secret 在启用前先保存待确认的密钥
+-- totp_last_step 记录最近一次使用的时间步，防止验证码被重放
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- 恢复码只保存哈希，每个只能使用一次
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) UNIQUE NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);
+
+-- 开启后所有拥有管理权限的角色都必须启用两步验证才能登录
+INSERT INTO system_config (config_key, config_value, description) VALUES
+('require_admin_2fa', 'false', '管理角色必须启用两步验证')
+ON CONFLICT (config_key) DO NOTHING;
@@ -0,0 +1,22 @@
+-- 外部身份提供方的账号与本地用户的关联，同一个 provider 下 subject 唯一
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(100),
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+-- 进行中的 OIDC 登录，回调时按 state 取出 nonce 和 PKCE code_verifier，用后即删
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash VARCHAR(64) PRIMARY KEY,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,15 @@
+-- 个人 API 密钥：prefix 用于查找，secret 只保存 SHA-256 摘要
+-- scopes 为权限名，密钥实际拥有的权限是 scopes 与用户角色权限的交集
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) UNIQUE NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);
@@ -0,0 +1,19 @@
+-- 订单状态变更历史：记录谁在什么时间把订单从什么状态改成什么状态
+-- from_status 为 NULL 表示订单创建；操作人被删除后 changed_by 置空，历史保留
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history(order_id, created_at);
+
+-- 已有订单补一条创建记录，状态为迁移时的当前状态
+INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, note, created_at)
+SELECT o.id, NULL, o.status, o.user_id, '迁移前的订单', o.created_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_status_history h WHERE h.order_id = o.id);
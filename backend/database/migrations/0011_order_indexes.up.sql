@@ -0,0 +1,3 @@
+-- 订单管理列表的筛选和排序：按下单时间范围、按菜品查找订单
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_items_dish ON order_items(dish_id);
@@ -0,0 +1,12 @@
+-- 订单事件：实时推送使用的事件序列，多副本通过 LISTEN/NOTIFY 共享
+-- payload 保存完整事件（含订单快照），id 即客户端续传使用的 Last-Event-ID；过期事件由服务定期清理
+CREATE TABLE IF NOT EXISTS order_events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    order_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_created_at ON order_events(created_at);
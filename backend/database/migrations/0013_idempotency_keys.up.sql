@@ -0,0 +1,13 @@
+-- 幂等键：保存 POST 请求的响应，重试时直接返回（IDEMPOTENCY_STORE=postgres 时使用）
+-- key 形如 <用户ID>:<Idempotency-Key>；status_code 为 NULL 表示第一次请求仍在处理
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(300) PRIMARY KEY,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INTEGER,
+    content_type VARCHAR(255),
+    response_body BYTEA,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
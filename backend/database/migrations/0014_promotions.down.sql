@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE name = 'promotions:manage';
+DROP TABLE IF EXISTS order_adjustments;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount_amount;
+ALTER TABLE orders DROP COLUMN IF EXISTS subtotal;
+DROP TABLE IF EXISTS promotions;
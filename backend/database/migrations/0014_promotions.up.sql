@@ -0,0 +1,49 @@
+-- 优惠活动：code 为空时自动生效，否则为下单时填写的优惠券
+-- dish_id、category_id 限定参与优惠的菜品；usage_limit_per_user 为 0 表示不限
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    code VARCHAR(50) UNIQUE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('percentage', 'fixed_amount', 'buy_n_get_one')),
+    percent_off INTEGER NOT NULL DEFAULT 0,
+    amount_off DECIMAL(10,2) NOT NULL DEFAULT 0,
+    buy_quantity INTEGER NOT NULL DEFAULT 0,
+    dish_id INTEGER REFERENCES dishes(id) ON DELETE CASCADE,
+    category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+    min_spend DECIMAL(10,2) NOT NULL DEFAULT 0,
+    usage_limit_per_user INTEGER NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 订单价格明细：subtotal 为原价合计，total_amount = subtotal - discount_amount
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal DECIMAL(10,2);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0;
+UPDATE orders SET subtotal = total_amount WHERE subtotal IS NULL;
+ALTER TABLE orders ALTER COLUMN subtotal SET NOT NULL;
+
+-- 订单调整项：下单时应用的优惠，amount 为负数；优惠被删除后 promotion_id 置空，金额保留
+CREATE TABLE IF NOT EXISTS order_adjustments (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    promotion_id INTEGER REFERENCES promotions(id) ON DELETE SET NULL,
+    code VARCHAR(50) NOT NULL DEFAULT '',
+    description VARCHAR(100) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_adjustments_order ON order_adjustments(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_adjustments_promotion ON order_adjustments(promotion_id);
+
+INSERT INTO permissions (name, description) VALUES
+('promotions:manage', '创建、修改和删除优惠活动与优惠券')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+('admin', 'promotions:manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS note;
+DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS carts;
@@ -0,0 +1,23 @@
+-- 购物车：每个用户一个，updated_at 为最后一次修改时间，长时间未修改的购物车由后台任务清理
+CREATE TABLE IF NOT EXISTS carts (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_carts_updated_at ON carts(updated_at);
+
+-- 购物车明细：added_price 为加入或修改时的菜品价格，用于提示价格变动
+CREATE TABLE IF NOT EXISTS cart_items (
+    user_id INTEGER NOT NULL REFERENCES carts(user_id) ON DELETE CASCADE,
+    dish_id INTEGER NOT NULL REFERENCES dishes(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    note VARCHAR(200) NOT NULL DEFAULT '',
+    added_price DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, dish_id)
+);
+
+-- 订单明细备注，来自购物车或下单请求
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS note VARCHAR(200) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+DELETE FROM system_config WHERE config_key LIKE 'schedule\_%' OR config_key LIKE 'slot\_%';
+DROP INDEX IF EXISTS idx_orders_requested_for;
+ALTER TABLE orders DROP COLUMN IF EXISTS meal_slot;
+ALTER TABLE orders DROP COLUMN IF EXISTS requested_for;
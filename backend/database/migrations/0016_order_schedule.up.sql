@@ -0,0 +1,20 @@
+-- 预约订单：requested_for 为预约的用餐时间，meal_slot 为所在的用餐时段；立即下单的订单两者都为 NULL
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS requested_for TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS meal_slot VARCHAR(20) CHECK (meal_slot IN ('breakfast', 'lunch', 'dinner'));
+
+CREATE INDEX IF NOT EXISTS idx_orders_requested_for ON orders(requested_for) WHERE requested_for IS NOT NULL;
+
+-- 用餐时段设置：时间窗口、每天最多接单数（0 表示不限）和开始前多久截单
+INSERT INTO system_config (config_key, config_value, description) VALUES
+('schedule_timezone', 'Asia/Shanghai', '预约时段所在的时区'),
+('schedule_max_days_ahead', '7', '最多提前几天预约，0 表示不限'),
+('slot_breakfast_window', '07:00-09:30', '早餐时段'),
+('slot_breakfast_capacity', '20', '早餐时段每天最多接单数，0 表示不限'),
+('slot_breakfast_cutoff', '10h', '早餐开始前多久截单'),
+('slot_lunch_window', '11:00-13:30', '午餐时段'),
+('slot_lunch_capacity', '30', '午餐时段每天最多接单数，0 表示不限'),
+('slot_lunch_cutoff', '2h', '午餐开始前多久截单'),
+('slot_dinner_window', '17:30-20:00', '晚餐时段'),
+('slot_dinner_capacity', '30', '晚餐时段每天最多接单数，0 表示不限'),
+('slot_dinner_cutoff', '3h', '晚餐开始前多久截单')
+ON CONFLICT (config_key) DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE name = 'payments:refund';
+DROP TABLE IF EXISTS payment_events;
+DROP TABLE IF EXISTS payment_refunds;
+DROP TABLE IF EXISTS payments;
@@ -0,0 +1,52 @@
+-- 订单支付：每次发起支付对应渠道的一个支付意图；失败或撤销后可以重新发起，
+-- 因此一个订单可以有多条记录，但最多一条处于进行中或已扣款的状态
+CREATE TABLE IF NOT EXISTS payments (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    intent_id VARCHAR(255) NOT NULL,
+    client_secret VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'authorized', 'captured', 'partially_refunded', 'refunded', 'failed', 'cancelled')),
+    amount DECIMAL(10,2) NOT NULL,
+    refunded_amount DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (refunded_amount >= 0 AND refunded_amount <= amount),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, intent_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(order_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_order_open ON payments(order_id)
+    WHERE status NOT IN ('failed', 'cancelled');
+
+-- 退款记录：created_by 为空表示系统操作，如取消订单时自动退款
+CREATE TABLE IF NOT EXISTS payment_refunds (
+    id SERIAL PRIMARY KEY,
+    payment_id INTEGER NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    provider_refund_id VARCHAR(255) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    reason VARCHAR(200) NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_refunds_payment ON payment_refunds(payment_id);
+
+-- 支付渠道的回调事件，按渠道和事件 ID 去重，同时保留原始内容便于对账
+CREATE TABLE IF NOT EXISTS payment_events (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    intent_id VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, event_id)
+);
+
+INSERT INTO permissions (name, description) VALUES
+('payments:refund', '为已支付的订单退款')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+('admin', 'payments:refund')
+ON CONFLICT DO NOTHING;
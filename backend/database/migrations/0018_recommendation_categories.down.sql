@@ -0,0 +1 @@
+DELETE FROM system_config WHERE config_key IN ('recommendation_meat_categories', 'recommendation_vegetable_categories');
@@ -0,0 +1,10 @@
+-- 生成推荐菜单时哪些分类算荤菜、素菜，按种子数据中的分类名称初始化，之后可在系统配置中修改
+INSERT INTO system_config (config_key, config_value, description)
+SELECT 'recommendation_meat_categories', COALESCE(string_agg(id::text, ',' ORDER BY id), ''), '生成推荐菜单时作为荤菜的分类 ID，逗号分隔'
+FROM categories WHERE name = '肉类'
+ON CONFLICT (config_key) DO NOTHING;
+
+INSERT INTO system_config (config_key, config_value, description)
+SELECT 'recommendation_vegetable_categories', COALESCE(string_agg(id::text, ',' ORDER BY id), ''), '生成推荐菜单时作为素菜的分类 ID，逗号分隔'
+FROM categories WHERE name = '蔬菜类'
+ON CONFLICT (config_key) DO NOTHING;
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'recommendations:manage';
+ALTER TABLE recommendations DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE recommendations DROP COLUMN IF EXISTS type;
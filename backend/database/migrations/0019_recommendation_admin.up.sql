@@ -0,0 +1,19 @@
+-- 推荐配置分为规则模板（template，按荤素数量随机挑选）和固定菜单（curated，菜品保存在 recommendation_dishes）
+ALTER TABLE recommendations ADD COLUMN IF NOT EXISTS type VARCHAR(20) NOT NULL DEFAULT 'template'
+    CHECK (type IN ('template', 'curated'));
+ALTER TABLE recommendations ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+UPDATE recommendations SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE recommendations ALTER COLUMN updated_at SET DEFAULT CURRENT_TIMESTAMP;
+
+-- 已经手工维护了菜品的推荐配置视为固定菜单
+UPDATE recommendations r SET type = 'curated'
+WHERE EXISTS (SELECT 1 FROM recommendation_dishes rd WHERE rd.recommendation_id = r.id);
+
+INSERT INTO permissions (name, description) VALUES
+('recommendations:manage', '创建、修改和删除推荐配置与固定菜单')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+('admin', 'recommendations:manage'),
+('menu_editor', 'recommendations:manage')
+ON CONFLICT DO NOTHING;
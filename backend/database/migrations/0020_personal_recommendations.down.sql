@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_user_favorites_user_created;
+DROP INDEX IF EXISTS idx_orders_user_updated;
+DROP TABLE IF EXISTS personal_recommendation_runs;
+DROP TABLE IF EXISTS personal_recommendations;
@@ -0,0 +1,17 @@
+-- 个性化推荐：后台任务按用户的订单和收藏为菜品打分，接口只读取这里的结果
+CREATE TABLE IF NOT EXISTS personal_recommendations (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    dish_id INTEGER NOT NULL REFERENCES dishes(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    reasons TEXT[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (user_id, dish_id)
+);
+
+-- 每个用户上次计算的时间，之后有新订单、订单状态变化或新收藏的用户需要重新计算
+CREATE TABLE IF NOT EXISTS personal_recommendation_runs (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    computed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user_updated ON orders(user_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_user_favorites_user_created ON user_favorites(user_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS dish_order_counts;
+DROP TABLE IF EXISTS dish_similarities;
@@ -0,0 +1,14 @@
+-- 菜品相似度：后台任务按订单中菜品的共同出现定期全量统计，两个方向各保存一条
+CREATE TABLE IF NOT EXISTS dish_similarities (
+    dish_id INTEGER NOT NULL REFERENCES dishes(id) ON DELETE CASCADE,
+    related_dish_id INTEGER NOT NULL REFERENCES dishes(id) ON DELETE CASCADE,
+    co_orders INTEGER NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (dish_id, related_dish_id)
+);
+
+-- 同一次统计中每道菜出现在多少个订单中，购物车推荐缺少的分类时按它排序
+CREATE TABLE IF NOT EXISTS dish_order_counts (
+    dish_id INTEGER PRIMARY KEY REFERENCES dishes(id) ON DELETE CASCADE,
+    orders INTEGER NOT NULL
+);
@@ -0,0 +1,28 @@
+-- 按带 meat、vegetable 标签的菜品所在的分类恢复推荐设置
+INSERT INTO system_config (config_key, config_value, description)
+SELECT 'recommendation_meat_categories', COALESCE(string_agg(DISTINCT d.category_id::text, ','), ''), '生成推荐菜单时作为荤菜的分类 ID，逗号分隔'
+FROM dishes d
+JOIN dish_tags dt ON dt.dish_id = d.id
+JOIN tags t ON t.id = dt.tag_id AND t.slug = 'meat'
+WHERE d.category_id IS NOT NULL
+ON CONFLICT (config_key) DO NOTHING;
+
+INSERT INTO system_config (config_key, config_value, description)
+SELECT 'recommendation_vegetable_categories', COALESCE(string_agg(DISTINCT d.category_id::text, ','), ''), '生成推荐菜单时作为素菜的分类 ID，逗号分隔'
+FROM dishes d
+JOIN dish_tags dt ON dt.dish_id = d.id
+JOIN tags t ON t.id = dt.tag_id AND t.slug = 'vegetable'
+WHERE d.category_id IS NOT NULL AND d.category_id NOT IN (
+    -- 同一个分类不能既是荤菜又是素菜
+    SELECT d2.category_id FROM dishes d2
+    JOIN dish_tags dt2 ON dt2.dish_id = d2.id
+    JOIN tags t2 ON t2.id = dt2.tag_id AND t2.slug = 'meat'
+    WHERE d2.category_id IS NOT NULL
+)
+ON CONFLICT (config_key) DO NOTHING;
+
+UPDATE permissions SET description = '创建、修改和删除分类' WHERE name = 'categories:manage';
+
+DROP INDEX IF EXISTS idx_dish_tags_tag;
+DROP TABLE IF EXISTS dish_tags;
+DROP TABLE IF EXISTS tags;
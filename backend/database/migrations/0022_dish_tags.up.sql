@@ -0,0 +1,64 @@
+-- 菜品标签：一道菜可以有多个标签，生成推荐菜单时按 meat、vegetable 标签区分荤菜和素菜
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(30) UNIQUE NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS dish_tags (
+    dish_id INTEGER NOT NULL REFERENCES dishes(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (dish_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_dish_tags_tag ON dish_tags(tag_id);
+
+-- 标签与分类一样由 categories:manage 管理
+UPDATE permissions SET description = '创建、修改和删除分类和标签' WHERE name = 'categories:manage';
+
+INSERT INTO tags (slug, name, description) VALUES
+('meat', '荤菜', '生成推荐菜单时作为荤菜'),
+('vegetable', '素菜', '生成推荐菜单时作为素菜'),
+('soup', '汤', '汤品'),
+('staple', '主食', '米饭面食'),
+('dessert', '甜品', '餐后甜点'),
+('drink', '饮品', '各种饮料'),
+('spicy', '辣', '含辣味'),
+('vegetarian', '素食', '不含肉类')
+ON CONFLICT (slug) DO NOTHING;
+
+-- 原来按分类区分荤素：推荐设置中的荤菜、素菜分类下的菜品分别打上 meat、vegetable 标签
+INSERT INTO dish_tags (dish_id, tag_id)
+SELECT d.id, t.id
+FROM dishes d, tags t
+WHERE t.slug = 'meat' AND d.category_id IN (
+    SELECT trim(v)::int
+    FROM system_config, unnest(string_to_array(config_value, ',')) AS v
+    WHERE config_key = 'recommendation_meat_categories' AND trim(v) <> ''
+)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO dish_tags (dish_id, tag_id)
+SELECT d.id, t.id
+FROM dishes d, tags t
+WHERE t.slug = 'vegetable' AND d.category_id IN (
+    SELECT trim(v)::int
+    FROM system_config, unnest(string_to_array(config_value, ',')) AS v
+    WHERE config_key = 'recommendation_vegetable_categories' AND trim(v) <> ''
+)
+ON CONFLICT DO NOTHING;
+
+-- 种子数据中的其他分类对应同名的标签
+INSERT INTO dish_tags (dish_id, tag_id)
+SELECT d.id, t.id
+FROM dishes d
+JOIN categories c ON c.id = d.category_id
+JOIN (VALUES ('汤类', 'soup'), ('主食', 'staple'), ('甜品', 'dessert'), ('饮品', 'drink')) AS m(category, slug) ON m.category = c.name
+JOIN tags t ON t.slug = m.slug
+ON CONFLICT DO NOTHING;
+
+-- 荤素改由标签决定，不再需要按分类的推荐设置
+DELETE FROM system_config
+WHERE config_key IN ('recommendation_meat_categories', 'recommendation_vegetable_categories');
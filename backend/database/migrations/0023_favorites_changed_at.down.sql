@@ -0,0 +1 @@
+ALTER TABLE personal_recommendation_runs DROP COLUMN IF EXISTS favorites_changed_at;
@@ -0,0 +1,2 @@
+-- 取消收藏不会留下记录，在这里记下时间，使这些用户也按新的收藏重新计算个性化推荐
+ALTER TABLE personal_recommendation_runs ADD COLUMN IF NOT EXISTS favorites_changed_at TIMESTAMP;
@@ -0,0 +1,41 @@
+// Package events 订单事件的发布与订阅，用于厨房显示屏等实时推送
+//
+// Hub 在进程内把事件分发给订阅者，并保留最近的事件用于断线续传。
+// 单实例部署时事件只在本进程内流转；多副本部署时配置 PostgresBackend，
+// 事件写入 order_events 表并通过 LISTEN/NOTIFY 送达每个副本的 Hub。
+package events
+
+import (
+	"context"
+	"time"
+
+	"food-ordering/models"
+)
+
+// 事件类型
+const (
+	OrderCreated        = "order.created"
+	OrderStatusChanged  = "order.status_changed"
+	OrderPaymentChanged = "order.payment_changed"
+)
+
+// Event 订单事件，ID 全局递增，客户端断线重连时通过 Last-Event-ID 续传
+type Event struct {
+	ID        int64         `json:"id"`
+	Type      string        `json:"type"`
+	OrderID   int           `json:"order_id"`
+	UserID    int           `json:"user_id"`
+	Status    string        `json:"status"`
+	Order     *models.Order `json:"order,omitempty"` // 事件发生时的订单快照
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// Backend 多副本部署时负责分配事件 ID、持久化事件并把事件送达所有副本
+type Backend interface {
+	// Publish 发布事件，事件随后经由 Listen 回到每个副本（包括自己）
+	Publish(ctx context.Context, e Event) error
+	// Since 按 ID 顺序返回 afterID 之后的事件，最多 limit 条
+	Since(ctx context.Context, afterID int64, limit int) ([]Event, error)
+	// Listen 持续接收事件并交给 deliver，直到 ctx 结束
+	Listen(ctx context.Context, deliver func(Event)) error
+}
@@ -0,0 +1,160 @@
+package events
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 订阅者的缓冲区大小，积压超过这个数量的慢订阅者会被断开，由客户端带着 Last-Event-ID 重连
+const subscriberBuffer = 64
+
+// Hub 进程内的事件分发中心
+type Hub struct {
+	backend Backend
+	size    int
+
+	mu     sync.Mutex
+	lastID int64
+	recent []Event // 最近的事件，按 ID 升序，最多 size 条
+	subs   map[*Subscription]struct{}
+}
+
+// Subscription 一个订阅，C 被关闭表示订阅已结束（慢订阅者被断开或调用了 Close）
+type Subscription struct {
+	C <-chan Event
+
+	ch    chan Event
+	match func(Event) bool
+	hub   *Hub
+}
+
+// NewHub 创建 Hub，保留最近 bufferSize 条事件用于续传；backend 为 nil 时只在本进程内分发
+func NewHub(bufferSize int, backend Backend) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+	return &Hub{
+		backend: backend,
+		size:    bufferSize,
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Run 配置了 Backend 时持续接收其他副本（以及本副本）发布的事件，直到 ctx 结束
+func (h *Hub) Run(ctx context.Context) error {
+	if h.backend == nil {
+		return nil
+	}
+	return h.backend.Listen(ctx, h.deliver)
+}
+
+// Publish 发布事件
+func (h *Hub) Publish(ctx context.Context, e Event) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+	if h.backend != nil {
+		return h.backend.Publish(ctx, e)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	e.ID = h.lastID
+	h.dispatch(e)
+	return nil
+}
+
+// deliver 接收 Backend 送达的事件，重连后补发可能导致重复，已分发过的事件忽略
+func (h *Hub) deliver(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := sort.Search(len(h.recent), func(i int) bool { return h.recent[i].ID >= e.ID })
+	if i < len(h.recent) && h.recent[i].ID == e.ID {
+		return
+	}
+	if len(h.recent) > 0 && e.ID < h.recent[0].ID {
+		return
+	}
+	h.dispatch(e)
+}
+
+// dispatch 记录事件并推送给订阅者，调用方需持有锁
+func (h *Hub) dispatch(e Event) {
+	// 并发事务的提交顺序不一定与 ID 顺序一致，按 ID 插入保持有序
+	i := sort.Search(len(h.recent), func(i int) bool { return h.recent[i].ID > e.ID })
+	h.recent = append(h.recent, Event{})
+	copy(h.recent[i+1:], h.recent[i:])
+	h.recent[i] = e
+	if len(h.recent) > h.size {
+		h.recent = append(h.recent[:0], h.recent[len(h.recent)-h.size:]...)
+	}
+	if e.ID > h.lastID {
+		h.lastID = e.ID
+	}
+
+	for sub := range h.subs {
+		if sub.match != nil && !sub.match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Subscribe 订阅 match 为 true 的事件（match 为 nil 表示全部），
+// 同时返回 ID 大于 afterID 的历史事件供断线续传，afterID 为 0 表示不需要历史事件。
+// 本进程保留的事件不够时从 Backend 补齐；未配置 Backend 时只能续传本进程保留的事件
+func (h *Hub) Subscribe(ctx context.Context, afterID int64, match func(Event) bool) (*Subscription, []Event, error) {
+	sub := &Subscription{ch: make(chan Event, subscriberBuffer), match: match, hub: h}
+	sub.C = sub.ch
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	var backlog []Event
+	var oldest int64
+	if len(h.recent) > 0 {
+		oldest = h.recent[0].ID
+	}
+	if afterID > 0 {
+		for _, e := range h.recent {
+			if e.ID > afterID && (match == nil || match(e)) {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	if afterID <= 0 || h.backend == nil || (oldest != 0 && oldest <= afterID+1) {
+		return sub, backlog, nil
+	}
+
+	older, err := h.backend.Since(ctx, afterID, h.size)
+	if err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+	var replay []Event
+	for _, e := range older {
+		if (oldest == 0 || e.ID < oldest) && (match == nil || match(e)) {
+			replay = append(replay, e)
+		}
+	}
+	return sub, append(replay, backlog...), nil
+}
+
+// Close 取消订阅，可以重复调用
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		close(s.ch)
+	}
+}
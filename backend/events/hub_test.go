@@ -0,0 +1,291 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBackend 内存中的 Backend，Publish 分配 ID 并保存事件，通过 Listen 注册的回调送达（模拟 NOTIFY）
+type fakeBackend struct {
+	mu      sync.Mutex
+	events  []Event
+	deliver func(Event)
+}
+
+func (b *fakeBackend) Publish(ctx context.Context, e Event) error {
+	b.mu.Lock()
+	e.ID = int64(len(b.events) + 1)
+	b.events = append(b.events, e)
+	deliver := b.deliver
+	b.mu.Unlock()
+	if deliver != nil {
+		deliver(e)
+	}
+	return nil
+}
+
+func (b *fakeBackend) Since(ctx context.Context, afterID int64, limit int) ([]Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var result []Event
+	for _, e := range b.events {
+		if e.ID > afterID && len(result) < limit {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (b *fakeBackend) Listen(ctx context.Context, deliver func(Event)) error {
+	b.mu.Lock()
+	b.deliver = deliver
+	b.mu.Unlock()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// eventIDs 事件 ID 列表
+func eventIDs(events []Event) []int64 {
+	ids := []int64{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+// receive 读出订阅中已经到达的事件，订阅被关闭时 closed 为 true
+func receive(sub *Subscription) (events []Event, closed bool) {
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return events, true
+			}
+			events = append(events, e)
+		default:
+			return events, false
+		}
+	}
+}
+
+func publish(t *testing.T, h *Hub, userIDs ...int) {
+	t.Helper()
+	for _, userID := range userIDs {
+		if err := h.Publish(context.Background(), Event{Type: OrderCreated, UserID: userID, Status: "pending"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSubscribeResume(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		size      int
+		published int
+		afterID   int64
+		match     func(Event) bool
+		want      []int64
+	}{
+		{"no Last-Event-ID", 10, 4, 0, nil, []int64{}},
+		{"replays missed events", 10, 4, 2, nil, []int64{3, 4}},
+		{"up to date", 10, 4, 4, nil, []int64{}},
+		{"only what the hub retains", 3, 5, 1, nil, []int64{3, 4, 5}},
+		{"replay is filtered", 10, 4, 1, func(e Event) bool { return e.UserID == 1 }, []int64{2, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub(tt.size, nil)
+			for i := 0; i < tt.published; i++ {
+				publish(t, h, i%2) // 奇数 ID 属于用户 0，偶数 ID 属于用户 1
+			}
+			sub, backlog, err := h.Subscribe(ctx, tt.afterID, tt.match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sub.Close()
+			if got := eventIDs(backlog); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("backlog = %v, want %v", got, tt.want)
+			}
+
+			// 订阅之后发布的事件直接送达
+			publish(t, h, 1)
+			live, _ := receive(sub)
+			if got := eventIDs(live); !reflect.DeepEqual(got, []int64{int64(tt.published + 1)}) {
+				t.Errorf("live events = %v, want [%d]", got, tt.published+1)
+			}
+		})
+	}
+}
+
+func TestSubscribeResumeFromBackend(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeBackend{}
+	h := NewHub(3, backend)
+	backend.deliver = h.deliver
+	for i := 0; i < 6; i++ {
+		publish(t, h, i%2)
+	}
+
+	tests := []struct {
+		name    string
+		afterID int64
+		match   func(Event) bool
+		want    []int64
+	}{
+		{"older events come from the backend", 1, nil, []int64{2, 3, 4, 5, 6}},
+		{"retained events only", 3, nil, []int64{4, 5, 6}},
+		{"filtered", 1, func(e Event) bool { return e.UserID == 0 }, []int64{3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, backlog, err := h.Subscribe(ctx, tt.afterID, tt.match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sub.Close()
+			if got := eventIDs(backlog); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("backlog = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliverDeduplicates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := &fakeBackend{}
+	h := NewHub(10, backend)
+	go h.Run(ctx)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		backend.mu.Lock()
+		listening := backend.deliver != nil
+		backend.mu.Unlock()
+		if listening {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hub did not start listening")
+		}
+	}
+
+	sub, _, err := h.Subscribe(ctx, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	publish(t, h, 1, 2, 3)
+	// 重连后补发和重复的 NOTIFY 会再次送达同一事件；晚提交的事件可能比更大的 ID 后到
+	event := func(id int64) Event { return Event{ID: id, Type: OrderCreated} }
+	h.deliver(event(2))
+	h.deliver(event(3))
+	h.deliver(event(5))
+	h.deliver(event(4))
+	h.deliver(event(5))
+
+	got, _ := receive(sub)
+	if want := []int64{1, 2, 3, 5, 4}; !reflect.DeepEqual(eventIDs(got), want) {
+		t.Errorf("received %v, want %v", eventIDs(got), want)
+	}
+	if want := []int64{1, 2, 3, 4, 5}; !reflect.DeepEqual(eventIDs(h.recent), want) {
+		t.Errorf("retained %v, want %v in ID order", eventIDs(h.recent), want)
+	}
+
+	// 比保留窗口更早的事件无法判断是否重复，直接忽略
+	small := NewHub(2, nil)
+	small.deliver(event(5))
+	small.deliver(event(6))
+	small.deliver(event(7))
+	small.deliver(event(4))
+	if want := []int64{6, 7}; !reflect.DeepEqual(eventIDs(small.recent), want) {
+		t.Errorf("retained %v after a stale delivery, want %v", eventIDs(small.recent), want)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	ctx := context.Background()
+	h := NewHub(10, nil)
+	slow, _, err := h.Subscribe(ctx, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, _, err := h.Subscribe(ctx, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	var received []Event
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i <= subscriberBuffer; i++ {
+			if err := h.Publish(ctx, Event{Type: OrderCreated, UserID: 1}); err != nil {
+				t.Error(err)
+			}
+			events, _ := receive(fast)
+			received = append(received, events...)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	if len(received) != subscriberBuffer+1 {
+		t.Errorf("fast subscriber received %d events, want %d", len(received), subscriberBuffer+1)
+	}
+	buffered, closed := receive(slow)
+	if len(buffered) != subscriberBuffer || !closed {
+		t.Errorf("slow subscriber: %d buffered events, closed = %v; want %d and closed", len(buffered), closed, subscriberBuffer)
+	}
+	if len(h.subs) != 1 {
+		t.Errorf("%d subscriptions left, want only the fast one", len(h.subs))
+	}
+	slow.Close() // 已被断开的订阅可以再次关闭
+	fast.Close()
+	fast.Close()
+}
+
+func TestSubscriptionMatch(t *testing.T) {
+	ctx := context.Background()
+	h := NewHub(10, nil)
+	// 顾客只订阅自己订单的事件，与 handlers 中按用户过滤的方式一致
+	subs := map[int]*Subscription{}
+	for _, userID := range []int{1, 2} {
+		userID := userID
+		sub, _, err := h.Subscribe(ctx, 0, func(e Event) bool { return e.UserID == userID })
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+		subs[userID] = sub
+	}
+	all, _, err := h.Subscribe(ctx, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Close()
+
+	publish(t, h, 1, 2, 2, 1)
+	for userID, sub := range subs {
+		events, _ := receive(sub)
+		for _, e := range events {
+			if e.UserID != userID {
+				t.Errorf("user %d received event %d of user %d", userID, e.ID, e.UserID)
+			}
+		}
+		if len(events) != 2 {
+			t.Errorf("user %d received %d events, want 2", userID, len(events))
+		}
+	}
+	if events, _ := receive(all); fmt.Sprint(eventIDs(events)) != "[1 2 3 4]" {
+		t.Errorf("unfiltered subscription received %v", eventIDs(events))
+	}
+}
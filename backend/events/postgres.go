@@ -0,0 +1,150 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// NOTIFY 使用的频道
+const notifyChannel = "order_events"
+
+// PostgresBackend 基于 order_events 表和 LISTEN/NOTIFY 的 Backend，多副本共享同一事件序列
+// NOTIFY 只携带事件 ID（payload 有 8000 字节的限制），副本收到通知后再读取事件内容
+type PostgresBackend struct {
+	db        *sql.DB
+	dsn       string        // LISTEN 需要独立的连接
+	Retention time.Duration // 事件保留时长，过期的事件不能再续传
+}
+
+func NewPostgresBackend(db *sql.DB, dsn string) *PostgresBackend {
+	return &PostgresBackend{db: db, dsn: dsn, Retention: 24 * time.Hour}
+}
+
+func (b *PostgresBackend) Publish(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// 通知在事务提交后才发出，收到通知时事件一定已经可读
+	_, err = b.db.ExecContext(ctx, `
+		WITH ins AS (
+			INSERT INTO order_events (type, order_id, user_id, payload, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		)
+		SELECT pg_notify('`+notifyChannel+`', id::text) FROM ins
+	`, e.Type, e.OrderID, e.UserID, payload, e.CreatedAt.UTC())
+	return err
+}
+
+func (b *PostgresBackend) Since(ctx context.Context, afterID int64, limit int) ([]Event, error) {
+	rows, err := b.db.QueryContext(ctx, `
+		SELECT id, payload FROM order_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+func (b *PostgresBackend) get(ctx context.Context, id int64) (Event, error) {
+	return scanEvent(b.db.QueryRowContext(ctx, "SELECT id, payload FROM order_events WHERE id = $1", id))
+}
+
+func scanEvent(row interface{ Scan(...interface{}) error }) (Event, error) {
+	var e Event
+	var id int64
+	var payload []byte
+	if err := row.Scan(&id, &payload); err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return e, err
+	}
+	e.ID = id
+	return e, nil
+}
+
+// Listen 监听通知并把事件交给 deliver
+// 连接断开期间的通知会丢失，重连后按最后收到的 ID 从表中补齐
+func (b *PostgresBackend) Listen(ctx context.Context, deliver func(Event)) error {
+	listener := pq.NewListener(b.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Order event listener: %v", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(notifyChannel); err != nil {
+		return err
+	}
+
+	// 只接收启动之后的事件，更早的事件由 Since 按需续传
+	var lastID int64
+	if err := b.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM order_events").Scan(&lastID); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-listener.Notify:
+			if n == nil {
+				// 连接已重建
+				events, err := b.Since(ctx, lastID, 1000)
+				if err != nil {
+					log.Printf("Failed to resync order events: %v", err)
+					continue
+				}
+				for _, e := range events {
+					deliver(e)
+					lastID = e.ID
+				}
+				continue
+			}
+			id, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				continue
+			}
+			e, err := b.get(ctx, id)
+			if err != nil {
+				log.Printf("Failed to load order event %d: %v", id, err)
+				continue
+			}
+			deliver(e)
+			if id > lastID {
+				lastID = id
+			}
+		case <-ping.C:
+			go listener.Ping()
+		case <-prune.C:
+			if _, err := b.db.ExecContext(ctx, "DELETE FROM order_events WHERE created_at < $1", time.Now().UTC().Add(-b.Retention)); err != nil {
+				log.Printf("Failed to prune order events: %v", err)
+			}
+		}
+	}
+}
@@ -1,14 +1,17 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"food-ordering/models"
+	"food-ordering/recommend"
+	"food-ordering/schedule"
+	"food-ordering/store"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 )
 
 // 获取用户列表（管理员）
@@ -19,50 +22,11 @@ func (h *Handler) GetUsers(c *gin.Context) {
 	
 	offset := (page - 1) * limit
 
-	query := `
-		SELECT id, username, email, role, created_at, updated_at
-		FROM users
-	`
-	args := []interface{}{}
-	argIndex := 1
-
-	if search != "" {
-		query += ` WHERE username ILIKE $1 OR email ILIKE $2`
-		args = append(args, "%"+search+"%", "%"+search+"%")
-		argIndex = 3
-	}
-
-	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
-	args = append(args, limit, offset)
-
-	rows, err := h.db.Query(query, args...)
+	users, total, err := h.store.Users.List(c.Request.Context(), search, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
-	defer rows.Close()
-
-	var users []models.User
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan user"})
-			return
-		}
-		users = append(users, user)
-	}
-
-	// 获取总数
-	countQuery := "SELECT COUNT(*) FROM users"
-	countArgs := []interface{}{}
-	if search != "" {
-		countQuery += " WHERE username ILIKE $1 OR email ILIKE $2"
-		countArgs = append(countArgs, "%"+search+"%", "%"+search+"%")
-	}
-
-	var total int
-	h.db.QueryRow(countQuery, countArgs...).Scan(&total)
 
 	c.JSON(http.StatusOK, gin.H{
 		"users": users,
@@ -80,32 +44,26 @@ func (h *Handler) CreateDish(c *gin.Context) {
 		return
 	}
 
+	if !req.Price.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be greater than 0"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
 	// 验证分类是否存在
-	var exists bool
-	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", req.CategoryID).Scan(&exists)
+	exists, err := h.store.Categories.Exists(ctx, req.CategoryID)
 	if err != nil || !exists {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
 		return
 	}
-
-	var dishID int
-	err = h.db.QueryRow(`
-		INSERT INTO dishes (name, description, category_id, price, image_url, video_url, 
-			cooking_steps, is_seasonal, is_active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, true, NOW(), NOW())
-		RETURNING id
-	`, req.Name, req.Description, req.CategoryID, req.Price, req.ImageURL, 
-		req.VideoURL, req.CookingSteps, req.IsSeasonal).Scan(&dishID)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dish"})
+	if !h.checkDishTags(c, req.Tags) {
 		return
 	}
 
-	// 返回创建的菜品
-	dish, err := h.getDishByID(dishID)
+	dish, err := h.store.Dishes.Create(ctx, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Dish created but failed to fetch details"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dish"})
 		return
 	}
 
@@ -126,93 +84,39 @@ func (h *Handler) UpdateDish(c *gin.Context) {
 		return
 	}
 
-	// 构建动态更新查询
-	updates := []string{}
-	args := []interface{}{}
-	argIndex := 1
-
-	if req.Name != nil {
-		updates = append(updates, "name = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.Name)
-		argIndex++
+	if req == (models.UpdateDishRequest{}) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
 	}
-	if req.Description != nil {
-		updates = append(updates, "description = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.Description)
-		argIndex++
+	if req.Price != nil && !req.Price.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be greater than 0"})
+		return
 	}
+
+	ctx := c.Request.Context()
+
 	if req.CategoryID != nil {
 		// 验证分类是否存在
-		var exists bool
-		err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", *req.CategoryID).Scan(&exists)
+		exists, err := h.store.Categories.Exists(ctx, *req.CategoryID)
 		if err != nil || !exists {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
 			return
 		}
-		updates = append(updates, "category_id = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.CategoryID)
-		argIndex++
-	}
-	if req.Price != nil {
-		updates = append(updates, "price = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.Price)
-		argIndex++
-	}
-	if req.ImageURL != nil {
-		updates = append(updates, "image_url = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.ImageURL)
-		argIndex++
 	}
-	if req.VideoURL != nil {
-		updates = append(updates, "video_url = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.VideoURL)
-		argIndex++
-	}
-	if req.CookingSteps != nil {
-		updates = append(updates, "cooking_steps = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.CookingSteps)
-		argIndex++
-	}
-	if req.IsSeasonal != nil {
-		updates = append(updates, "is_seasonal = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.IsSeasonal)
-		argIndex++
-	}
-	if req.IsActive != nil {
-		updates = append(updates, "is_active = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.IsActive)
-		argIndex++
-	}
-
-	if len(updates) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+	if req.Tags != nil && !h.checkDishTags(c, *req.Tags) {
 		return
 	}
 
-	updates = append(updates, "updated_at = NOW()")
-
-	query := "UPDATE dishes SET " + join(updates, ", ") + " WHERE id = $" + strconv.Itoa(argIndex)
-	args = append(args, id)
-
-	result, err := h.db.Exec(query, args...)
+	dish, err := h.store.Dishes.Update(ctx, id, req)
 	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update dish"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
-		return
-	}
-
-	// 返回更新后的菜品
-	dish, err := h.getDishByID(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Dish updated but failed to fetch details"})
-		return
-	}
-
 	c.JSON(http.StatusOK, dish)
 }
 
@@ -225,18 +129,15 @@ func (h *Handler) DeleteDish(c *gin.Context) {
 	}
 
 	// 软删除：设置为不活跃
-	result, err := h.db.Exec("UPDATE dishes SET is_active = false, updated_at = NOW() WHERE id = $1", id)
-	if err != nil {
+	if err := h.store.Dishes.Deactivate(c.Request.Context(), id); err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dish"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "Dish deleted successfully"})
 }
 
@@ -248,25 +149,12 @@ func (h *Handler) CreateCategory(c *gin.Context) {
 		return
 	}
 
-	var categoryID int
-	err := h.db.QueryRow(`
-		INSERT INTO categories (name, description, created_at)
-		VALUES ($1, $2, NOW())
-		RETURNING id
-	`, req.Name, req.Description).Scan(&categoryID)
-
+	category, err := h.store.Categories.Create(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
 		return
 	}
 
-	// 返回创建的分类
-	category, err := h.getCategoryByID(categoryID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Category created but failed to fetch details"})
-		return
-	}
-
 	c.JSON(http.StatusCreated, category)
 }
 
@@ -284,48 +172,21 @@ func (h *Handler) UpdateCategory(c *gin.Context) {
 		return
 	}
 
-	updates := []string{}
-	args := []interface{}{}
-	argIndex := 1
-
-	if req.Name != nil {
-		updates = append(updates, "name = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.Name)
-		argIndex++
-	}
-	if req.Description != nil {
-		updates = append(updates, "description = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.Description)
-		argIndex++
-	}
-
-	if len(updates) == 0 {
+	if req.Name == nil && req.Description == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
 		return
 	}
 
-	query := "UPDATE categories SET " + join(updates, ", ") + " WHERE id = $" + strconv.Itoa(argIndex)
-	args = append(args, id)
-
-	result, err := h.db.Exec(query, args...)
+	category, err := h.store.Categories.Update(c.Request.Context(), id, req)
 	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
-		return
-	}
-
-	// 返回更新后的分类
-	category, err := h.getCategoryByID(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Category updated but failed to fetch details"})
-		return
-	}
-
 	c.JSON(http.StatusOK, category)
 }
 
@@ -337,28 +198,17 @@ func (h *Handler) DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	// 检查是否有菜品使用此分类
-	var count int
-	err = h.db.QueryRow("SELECT COUNT(*) FROM dishes WHERE category_id = $1 AND is_active = true", id).Scan(&count)
+	// 分类下仍有上架菜品时不允许删除
+	err = h.store.Categories.Delete(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check category usage"})
-		return
-	}
-
-	if count > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete category with active dishes"})
-		return
-	}
-
-	result, err := h.db.Exec("DELETE FROM categories WHERE id = $1", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		switch err {
+		case store.ErrInUse:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete category with active dishes"})
+		case store.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		}
 		return
 	}
 
@@ -367,23 +217,11 @@ func (h *Handler) DeleteCategory(c *gin.Context) {
 
 // 获取配置（管理员）
 func (h *Handler) GetConfig(c *gin.Context) {
-	rows, err := h.db.Query("SELECT id, config_key, config_value, description, updated_at FROM system_config ORDER BY config_key")
+	configs, err := h.store.Config.List(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch config"})
 		return
 	}
-	defer rows.Close()
-
-	var configs []models.SystemConfig
-	for rows.Next() {
-		var config models.SystemConfig
-		err := rows.Scan(&config.ID, &config.ConfigKey, &config.ConfigValue, &config.Description, &config.UpdatedAt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan config"})
-			return
-		}
-		configs = append(configs, config)
-	}
 
 	c.JSON(http.StatusOK, configs)
 }
@@ -396,89 +234,47 @@ func (h *Handler) UpdateConfig(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
-		return
+	// 修改预约或推荐设置时，先用修改后的全部配置校验一遍，避免无效的设置导致无法预约或生成菜单
+	var scheduleChanged, recommendChanged bool
+	for key := range configs {
+		scheduleChanged = scheduleChanged || schedule.IsKey(key)
+		recommendChanged = recommendChanged || recommend.IsKey(key)
 	}
-	defer tx.Rollback()
-
-	for key, value := range configs {
-		_, err := tx.Exec(`
-			UPDATE system_config 
-			SET config_value = $1, updated_at = NOW() 
-			WHERE config_key = $2
-		`, value, key)
-
+	if scheduleChanged || recommendChanged {
+		values, err := h.configValues(c.Request.Context())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update config: " + key})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch config"})
+			return
+		}
+		for key, value := range configs {
+			values[key] = value
+		}
+		if _, err := schedule.Load(values); scheduleChanged && err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule config: " + err.Error()})
+			return
+		}
+		if _, err := recommend.Load(values); recommendChanged && err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recommendation config: " + err.Error()})
 			return
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+	if err := h.store.Config.Update(c.Request.Context(), configs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update config"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Config updated successfully"})
 }
 
-// 辅助方法
-func (h *Handler) getDishByID(id int) (*models.Dish, error) {
-	var dish models.Dish
-	var categoryName sql.NullString
-
-	err := h.db.QueryRow(`
-		SELECT d.id, d.name, d.description, d.category_id, c.name as category_name,
-			   d.price, d.image_url, d.video_url, d.cooking_steps, d.is_seasonal, d.is_active,
-			   d.created_at, d.updated_at
-		FROM dishes d
-		LEFT JOIN categories c ON d.category_id = c.id
-		WHERE d.id = $1
-	`, id).Scan(
-		&dish.ID, &dish.Name, &dish.Description, &dish.CategoryID, &categoryName,
-		&dish.Price, &dish.ImageURL, &dish.VideoURL, &dish.CookingSteps,
-		&dish.IsSeasonal, &dish.IsActive, &dish.CreatedAt, &dish.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if categoryName.Valid {
-		dish.Category = &models.Category{
-			ID:   dish.CategoryID,
-			Name: categoryName.String,
-		}
-	}
-
-	return &dish, nil
-}
-
-func (h *Handler) getCategoryByID(id int) (*models.Category, error) {
-	var category models.Category
-	err := h.db.QueryRow("SELECT id, name, description, created_at FROM categories WHERE id = $1", id).
-		Scan(&category.ID, &category.Name, &category.Description, &category.CreatedAt)
-	
-	if err != nil {
-		return nil, err
-	}
-
-	return &category, nil
+// isUniqueViolation 判断是否为唯一约束冲突
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
 
-func join(strs []string, sep string) string {
-	if len(strs) == 0 {
-		return ""
-	}
-	if len(strs) == 1 {
-		return strs[0]
-	}
-	
-	result := strs[0]
-	for i := 1; i < len(strs); i++ {
-		result += sep + strs[i]
-	}
-	return result
+// isForeignKeyViolation 判断是否为外键约束冲突
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
 }
\ No newline at end of file
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"food-ordering/events"
+	"food-ordering/models"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 获取全部订单（管理员/厨师），支持按状态、用户、菜品和下单时间筛选
+func (h *Handler) GetAllOrders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	userID, _ := strconv.Atoi(c.DefaultQuery("user_id", "0"))
+	dishID, _ := strconv.Atoi(c.DefaultQuery("dish_id", "0"))
+
+	filter := store.OrderFilter{
+		UserID: userID,
+		DishID: dishID,
+		Status: c.Query("status"),
+		Sort:   c.DefaultQuery("sort", store.OrderSortCreatedAt),
+		Asc:    c.Query("order") == "asc",
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	}
+
+	if filter.Status != "" && !models.IsOrderStatus(filter.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order status"})
+		return
+	}
+	switch filter.Sort {
+	case store.OrderSortCreatedAt, store.OrderSortTotalAmount, store.OrderSortStatus:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort field"})
+		return
+	}
+
+	var err error
+	if filter.From, err = parseDateParam(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return
+	}
+	if filter.To, err = parseDateParam(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return
+	}
+
+	orders, total, err := h.store.Orders.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": orders,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// 获取任意订单详情（管理员/厨师）
+func (h *Handler) GetAdminOrder(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := h.store.Orders.Get(c.Request.Context(), orderID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// parseDateParam 解析 RFC3339 时间或 YYYY-MM-DD 日期（按 UTC）
+// 作为结束时间的纯日期包含当天，返回次日零点作为开区间的上界
+func parseDateParam(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// 修改订单状态（管理员/厨师），只允许状态机中定义的流转
+func (h *Handler) UpdateOrderStatus(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req models.UpdateOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsOrderStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order status"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	change := store.StatusChange{
+		OrderID:   orderID,
+		To:        req.Status,
+		ChangedBy: c.GetInt("user_id"),
+		Note:      req.Note,
+	}
+	// 接单时扣款，取消时撤销支付或退款
+	var order *models.Order
+	err = h.settlePayment(ctx, change)
+	if err == nil {
+		order, err = h.store.Orders.ChangeStatus(ctx, change)
+	}
+	if err != nil {
+		var invalid *store.InvalidTransitionError
+		switch {
+		case err == store.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusConflict, gin.H{"error": invalid.Error()})
+		default:
+			respondPaymentError(c, err, "Failed to update order status")
+		}
+		return
+	}
+
+	h.publishOrderEvent(c, events.OrderStatusChanged, order)
+	c.JSON(http.StatusOK, order)
+}
+
+// 获取订单状态变更历史（管理员/厨师）
+func (h *Handler) GetOrderStatusHistory(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	history, err := h.store.Orders.History(c.Request.Context(), orderID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
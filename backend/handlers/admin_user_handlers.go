@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"food-ordering/middleware"
+	"food-ordering/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 创建用户（管理员）
+func (h *Handler) CreateUser(c *gin.Context) {
+	var req models.AdminCreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+
+	if !usernamePattern.MatchString(req.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username may only contain letters, digits, '_' and '-'"})
+		return
+	}
+	if err := validatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// 管理员创建的账号首次登录后需要修改密码
+	var user models.User
+	err = h.db.QueryRow(`
+		INSERT INTO users (username, password_hash, email, role, must_change_password, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, true, NOW(), NOW())
+		RETURNING id, username, email, role, status, must_change_password, created_at, updated_at
+	`, req.Username, string(passwordHash), req.Email, req.Role).Scan(
+		&user.ID, &user.Username, &user.Email, &user.Role, &user.Status, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
+			return
+		}
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// 修改用户角色（管理员）
+func (h *Handler) UpdateUserRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// 新角色仍可管理用户或角色时不会减少管理员
+	var keepsAdmin bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM role_permissions WHERE role = $1 AND permission IN ('users:manage', 'roles:manage'))
+	`, req.Role).Scan(&keepsAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !keepsAdmin && !h.guardAdminChange(c, tx, id, "change your own role") {
+		return
+	}
+
+	h.updateUserField(c, tx, id, "role", req.Role)
+}
+
+// 启用/禁用用户（管理员）
+// 禁用后立即吊销该用户的全部会话
+func (h *Handler) UpdateUserStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UpdateUserStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if req.Status == "disabled" {
+		if !h.guardAdminChange(c, tx, id, "disable your own account") {
+			return
+		}
+		if err := revokeSessions(tx, "user_id = $1", id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+	}
+
+	h.updateUserField(c, tx, id, "status", req.Status)
+}
+
+// 重置用户密码（管理员）
+// 未指定新密码时生成临时密码返回给管理员，用户下次登录后需要修改密码
+func (h *Handler) ResetUserPassword(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	password := req.Password
+	generated := password == ""
+	if generated {
+		password, err = generateTemporaryPassword()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate password"})
+			return
+		}
+	} else if err := validatePassword(password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users SET password_hash = $1, must_change_password = true, updated_at = NOW()
+		WHERE id = $2
+	`, string(passwordHash), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := revokeSessions(tx, "user_id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	resp := gin.H{"message": "Password reset successfully"}
+	if generated {
+		resp["temporary_password"] = password
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// 删除用户（管理员）
+// 收藏和会话随用户一起删除；订单保留用于对账，user_id 置空
+func (h *Handler) DeleteUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if !h.guardAdminChange(c, tx, id, "delete your own account") {
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM users WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// guardAdminChange 在降级、禁用或删除用户前检查：
+// 不能对自己执行该操作，也不能移除最后一个可用的管理员（角色持有 users:manage 或 roles:manage 的可用账号）。
+// 检查在调用方的事务中锁住全部管理员，同时互相降级的两个请求会先后执行，后一个看到的是前一个提交后的结果
+func (h *Handler) guardAdminChange(c *gin.Context, tx *sql.Tx, targetID int, selfAction string) bool {
+	currentUserID, _ := c.Get("user_id")
+	if currentUserID == targetID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot " + selfAction})
+		return false
+	}
+
+	rows, err := tx.Query(`
+		SELECT u.id FROM users u
+		WHERE u.status = 'active' AND EXISTS(
+			SELECT 1 FROM role_permissions rp
+			WHERE rp.role = u.role AND rp.permission IN ('users:manage', 'roles:manage')
+		)
+		ORDER BY u.id
+		FOR UPDATE OF u
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	var admins []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return false
+		}
+		admins = append(admins, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	var id int
+	err = tx.QueryRow("SELECT id FROM users WHERE id = $1 FOR UPDATE", targetID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	if len(admins) == 1 && admins[0] == targetID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last active admin"})
+		return false
+	}
+
+	return true
+}
+
+// updateUserField 在事务中更新单个字段，提交后返回更新后的用户
+func (h *Handler) updateUserField(c *gin.Context, tx *sql.Tx, id int, column string, value interface{}) {
+	var user models.User
+	err := tx.QueryRow(`
+		UPDATE users SET `+column+` = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING id, username, email, role, status, must_change_password, created_at, updated_at
+	`, value, id).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Status, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// generateTemporaryPassword 生成满足密码策略的临时密码
+func generateTemporaryPassword() (string, error) {
+	for {
+		password, err := middleware.RandomToken(6)
+		if err != nil {
+			return "", err
+		}
+		if validatePassword(password) == nil {
+			return password, nil
+		}
+	}
+}
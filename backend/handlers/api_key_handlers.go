@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"food-ordering/middleware"
+	"food-ordering/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// 获取当前用户的 API 密钥
+func (h *Handler) GetAPIKeys(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	rows, err := h.db.Query(`
+		SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var expiresAt, lastUsedAt sql.NullTime
+		err := rows.Scan(&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &expiresAt, &lastUsedAt, &key.CreatedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan API key"})
+			return
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// 创建 API 密钥，scopes 只能是当前用户拥有的权限
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !middleware.HasPermission(c, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scope not granted to your role: " + scope})
+			return
+		}
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+		expiresAt := req.ExpiresAt.UTC()
+		req.ExpiresAt = &expiresAt
+	}
+
+	key, prefix, secretHash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	apiKey := models.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		Key:       key,
+	}
+	err = h.db.QueryRow(`
+		INSERT INTO api_keys (user_id, name, prefix, secret_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, userID, req.Name, prefix, secretHash, pq.Array(req.Scopes), req.ExpiresAt).Scan(&apiKey.ID, &apiKey.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, apiKey)
+}
+
+// 删除 API 密钥，立即失效
+func (h *Handler) DeleteAPIKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM api_keys WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API key"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key deleted successfully"})
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"food-ordering/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用户名只允许字母、数字、下划线和短横线
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// 用户注册
+func (h *Handler) Register(c *gin.Context) {
+	var req models.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+
+	if !usernamePattern.MatchString(req.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username may only contain letters, digits, '_' and '-'"})
+		return
+	}
+	if err := validatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 检查用户名和邮箱是否已被占用
+	var usernameTaken, emailTaken bool
+	err := h.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1)),
+			   EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($2))
+	`, req.Username, req.Email).Scan(&usernameTaken, &emailTaken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if usernameTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+	if emailTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var user models.User
+	err = h.db.QueryRow(`
+		INSERT INTO users (username, password_hash, email, role, created_at, updated_at)
+		VALUES ($1, $2, $3, 'customer', NOW(), NOW())
+		RETURNING id, username, email, role, status, must_change_password, created_at, updated_at
+	`, req.Username, string(passwordHash), req.Email).Scan(
+		&user.ID, &user.Username, &user.Email, &user.Role, &user.Status, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		// 并发注册时由唯一索引兜底
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	resp, err := h.issueTokens(h.db, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// 修改密码
+func (h *Handler) ChangePassword(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var passwordHash string
+	err := h.db.QueryRow("SELECT password_hash FROM users WHERE id = $1", userID).Scan(&passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.OldPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Old password is incorrect"})
+		return
+	}
+	if req.OldPassword == req.NewPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the old password"})
+		return
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	newHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	_, err = h.db.Exec("UPDATE users SET password_hash = $1, must_change_password = false, updated_at = NOW() WHERE id = $2", string(newHash), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// 修改密码后让其他设备上的会话失效
+	sessionID, _ := c.Get("session_id")
+	if err := revokeSessions(h.db, "user_id = $1 AND family_id <> $2", userID, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke other sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
+}
+
+// 更新个人资料
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Email == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	email := strings.TrimSpace(*req.Email)
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email cannot be empty"})
+		return
+	}
+
+	var emailTaken bool
+	err := h.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)",
+		email, userID,
+	).Scan(&emailTaken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if emailTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	var user models.User
+	err = h.db.QueryRow(`
+		UPDATE users SET email = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING id, username, email, role, status, must_change_password, created_at, updated_at
+	`, email, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Status, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// validatePassword 密码策略：8-72位，至少包含一个字母和一个数字
+// bcrypt 只使用前72字节，更长的密码会被静默截断
+func validatePassword(password string) error {
+	if len(password) < 8 {
+		return errors.New("Password must be at least 8 characters")
+	}
+	if len(password) > 72 {
+		return errors.New("Password must be at most 72 bytes")
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("Password must contain both letters and digits")
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"food-ordering/models"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondCart 返回购物车，并按 CART_TTL 计算过期时间
+func (h *Handler) respondCart(c *gin.Context, cart *models.Cart) {
+	if cart.UpdatedAt != nil {
+		expiresAt := cart.UpdatedAt.Add(h.cfg.CartTTL)
+		cart.ExpiresAt = &expiresAt
+	}
+	c.JSON(http.StatusOK, cart)
+}
+
+// 获取购物车
+func (h *Handler) GetCart(c *gin.Context) {
+	cart, err := h.store.Carts.Get(c.Request.Context(), c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+	h.respondCart(c, cart)
+}
+
+// 加入购物车
+func (h *Handler) AddCartItem(c *gin.Context) {
+	var req models.AddCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.store.Carts.AddItem(c.Request.Context(), c.GetInt("user_id"), req)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add to cart"})
+		return
+	}
+	h.respondCart(c, cart)
+}
+
+// 修改购物车中菜品的数量或备注
+func (h *Handler) UpdateCartItem(c *gin.Context) {
+	dishID, err := strconv.Atoi(c.Param("dishId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dish ID"})
+		return
+	}
+
+	var req models.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.store.Carts.UpdateItem(c.Request.Context(), c.GetInt("user_id"), dishID, req)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dish not in cart"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+		return
+	}
+	h.respondCart(c, cart)
+}
+
+// 从购物车中移除菜品
+func (h *Handler) RemoveCartItem(c *gin.Context) {
+	dishID, err := strconv.Atoi(c.Param("dishId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dish ID"})
+		return
+	}
+
+	cart, err := h.store.Carts.RemoveItem(c.Request.Context(), c.GetInt("user_id"), dishID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dish not in cart"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+		return
+	}
+	h.respondCart(c, cart)
+}
+
+// 清空购物车
+func (h *Handler) ClearCart(c *gin.Context) {
+	if err := h.store.Carts.Clear(c.Request.Context(), c.GetInt("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cart cleared"})
+}
+
+// 结算购物车：按菜品当前价格下单，成功后清空购物车
+func (h *Handler) Checkout(c *gin.Context) {
+	// 请求体可以为空
+	var req models.CheckoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	req.CouponCode = normalizeCouponCode(req.CouponCode)
+	order, err := h.store.Carts.Checkout(c.Request.Context(), c.GetInt("user_id"), req)
+	if err == store.ErrCartEmpty {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	}
+	h.respondOrderCreated(c, order, err)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"food-ordering/models"
+)
+
+func TestCart(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	bob := s.user("bob")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	greens := s.dish("清炒时蔬", mains, "18.50")
+
+	var cart models.Cart
+	s.expect(http.StatusOK, "GET", "/api/v1/cart", alice, nil, &cart)
+	if len(cart.Items) != 0 || !cart.Subtotal.IsZero() || cart.UpdatedAt != nil || cart.ExpiresAt != nil {
+		t.Errorf("empty cart = %+v", cart)
+	}
+
+	// 重复加入同一菜品时累加数量，没有新备注时保留原备注，数量不超过上限
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", alice, models.AddCartItemRequest{DishID: pork.ID, Quantity: 2, Note: "少辣"}, nil)
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", alice, models.AddCartItemRequest{DishID: pork.ID, Quantity: 1}, nil)
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", alice, models.AddCartItemRequest{DishID: greens.ID, Quantity: 50}, nil)
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", alice, models.AddCartItemRequest{DishID: greens.ID, Quantity: 50}, &cart)
+	if len(cart.Items) != 2 || cart.Items[0].DishID != pork.ID || cart.Items[0].Quantity != 3 || cart.Items[0].Note != "少辣" ||
+		cart.Items[1].Quantity != models.MaxCartItemQuantity {
+		t.Fatalf("cart items = %+v, want 3 pork with note and 99 greens", cart.Items)
+	}
+	if cart.Subtotal.String() != "1945.50" || len(cart.Warnings) != 0 {
+		t.Errorf("cart subtotal = %s warnings = %v, want 1945.50 and no warnings", cart.Subtotal, cart.Warnings)
+	}
+	if cart.UpdatedAt == nil || cart.ExpiresAt == nil || !cart.ExpiresAt.Equal(cart.UpdatedAt.Add(s.handler.cfg.CartTTL)) {
+		t.Errorf("cart updated_at = %v expires_at = %v, want expiry one CART_TTL later", cart.UpdatedAt, cart.ExpiresAt)
+	}
+
+	quantity, tooMany := 2, 100
+	note := "不要葱"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"add zero", "POST", "/api/v1/cart/items", models.AddCartItemRequest{DishID: pork.ID}, http.StatusBadRequest},
+		{"add too many", "POST", "/api/v1/cart/items", models.AddCartItemRequest{DishID: pork.ID, Quantity: 100}, http.StatusBadRequest},
+		{"add note too long", "POST", "/api/v1/cart/items",
+			models.AddCartItemRequest{DishID: pork.ID, Quantity: 1, Note: strings.Repeat("a", 201)}, http.StatusBadRequest},
+		{"add unknown dish", "POST", "/api/v1/cart/items", models.AddCartItemRequest{DishID: 999, Quantity: 1}, http.StatusNotFound},
+		{"update too many", "PUT", fmt.Sprintf("/api/v1/cart/items/%d", pork.ID),
+			models.UpdateCartItemRequest{Quantity: &tooMany}, http.StatusBadRequest},
+		{"update dish not in cart", "PUT", "/api/v1/cart/items/999", models.UpdateCartItemRequest{Quantity: &quantity}, http.StatusNotFound},
+		{"update invalid dish ID", "PUT", "/api/v1/cart/items/abc", models.UpdateCartItemRequest{Quantity: &quantity}, http.StatusBadRequest},
+		{"remove dish not in cart", "DELETE", "/api/v1/cart/items/999", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := s.do(tt.method, tt.path, alice, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	s.expect(http.StatusOK, "PUT", fmt.Sprintf("/api/v1/cart/items/%d", greens.ID), alice,
+		models.UpdateCartItemRequest{Quantity: &quantity, Note: &note}, &cart)
+	if cart.Items[1].Quantity != 2 || cart.Items[1].Note != "不要葱" || cart.Items[0].Quantity != 3 {
+		t.Errorf("cart items after update = %+v", cart.Items)
+	}
+
+	// 购物车按菜品当前价格计算，价格变动和下架都有提示
+	price := mustMoney(t, "40.00")
+	s.expect(http.StatusOK, "PUT", fmt.Sprintf("/api/v1/admin/dishes/%d", pork.ID), 0, models.UpdateDishRequest{Price: &price}, nil)
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", greens.ID), 0, nil, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/cart", alice, nil, &cart)
+	wantWarnings := []string{"Price of 红烧肉 changed from 38.00 to 40.00", "Dish 清炒时蔬 is no longer available"}
+	if cart.Subtotal.String() != "120.00" || fmt.Sprint(cart.Warnings) != fmt.Sprint(wantWarnings) || cart.Items[1].Available {
+		t.Errorf("cart subtotal = %s warnings = %q, want 120.00 and %q", cart.Subtotal, cart.Warnings, wantWarnings)
+	}
+
+	// 含已下架菜品时不能结算，购物车保持不变
+	s.expect(http.StatusBadRequest, "POST", "/api/v1/cart/checkout", alice, nil, nil)
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/cart/items/%d", greens.ID), alice, nil, &cart)
+	if len(cart.Items) != 1 {
+		t.Fatalf("cart has %d items after removal, want 1", len(cart.Items))
+	}
+
+	var order models.Order
+	s.expect(http.StatusCreated, "POST", "/api/v1/cart/checkout", alice, nil, &order)
+	if order.UserID != alice || len(order.Items) != 1 || order.Items[0].Quantity != 3 ||
+		order.Items[0].Note != "少辣" || order.TotalAmount.String() != "120.00" {
+		t.Errorf("checkout order = %+v", order)
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/cart", alice, nil, &cart)
+	if len(cart.Items) != 0 {
+		t.Errorf("cart after checkout has %d items, want 0", len(cart.Items))
+	}
+	w := s.do("POST", "/api/v1/cart/checkout", alice, nil)
+	if w.Code != http.StatusBadRequest || errorMessage(w) != "Cart is empty" {
+		t.Errorf("checkout empty cart: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+
+	// 购物车按用户隔离
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", bob, models.AddCartItemRequest{DishID: pork.ID, Quantity: 1}, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/cart", alice, nil, &cart)
+	if len(cart.Items) != 0 {
+		t.Errorf("alice sees %d items from bob's cart", len(cart.Items))
+	}
+	s.expect(http.StatusOK, "DELETE", "/api/v1/cart", bob, nil, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/cart", bob, nil, &cart)
+	if len(cart.Items) != 0 || cart.UpdatedAt != nil {
+		t.Errorf("cleared cart = %+v", cart)
+	}
+}
+
+func TestCheckoutWithCoupon(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	s.promotion(models.PromotionRequest{Name: "立减五元", Code: "SAVE5", Type: models.PromotionFixedAmount, AmountOff: mustMoney(t, "5")})
+
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", alice, models.AddCartItemRequest{DishID: pork.ID, Quantity: 1}, nil)
+
+	// 优惠券不可用时结算失败，购物车保留
+	w := s.do("POST", "/api/v1/cart/checkout", alice, models.CheckoutRequest{CouponCode: "nope"})
+	if w.Code != http.StatusBadRequest || errorMessage(w) != "Coupon NOPE cannot be used: not found" {
+		t.Errorf("checkout with unknown coupon: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+
+	var order models.Order
+	s.expect(http.StatusCreated, "POST", "/api/v1/cart/checkout", alice, models.CheckoutRequest{CouponCode: "save5"}, &order)
+	if order.TotalAmount.String() != "33.00" {
+		t.Errorf("checkout total = %s, want 33.00", order.TotalAmount)
+	}
+}
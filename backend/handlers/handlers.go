@@ -2,30 +2,49 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/json"
-	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 
 	"food-ordering/config"
+	"food-ordering/events"
+	"food-ordering/lockout"
 	"food-ordering/middleware"
 	"food-ordering/models"
+	"food-ordering/oidc"
+	"food-ordering/payment"
+	"food-ordering/store"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Handler struct {
-	db  *sql.DB
-	cfg *config.Config
+	db       *sql.DB
+	store    *store.Store
+	cfg      *config.Config
+	tokens   *middleware.TokenService
+	guard    *lockout.Guard
+	sso      *oidc.Provider // 未配置单点登录时为 nil
+	events   *events.Hub
+	payments payment.Provider // 未配置支付渠道时为 nil
 }
 
-func NewHandler(db *sql.DB, cfg *config.Config) *Handler {
-	return &Handler{db: db, cfg: cfg}
+func NewHandler(db *sql.DB, st *store.Store, cfg *config.Config, tokens *middleware.TokenService, guard *lockout.Guard, sso *oidc.Provider, hub *events.Hub, payments payment.Provider) *Handler {
+	return &Handler{db: db, store: st, cfg: cfg, tokens: tokens, guard: guard, sso: sso, events: hub, payments: payments}
 }
 
+// dummyPasswordHash 用于用户不存在时的密码比较，使其耗时与真实用户一致
+var dummyPasswordHash = func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return string(hash)
+}()
+
 // 登录处理
 func (h *Handler) Login(c *gin.Context) {
 	var req models.LoginRequest
@@ -34,63 +53,101 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	// 查询用户
-	var user models.User
-	err := h.db.QueryRow(
-		"SELECT id, username, email, role, created_at, updated_at FROM users WHERE username = $1",
-		req.Username,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
 
+	// 用户名或IP处于退避/锁定期时直接拒绝，不再校验密码
+	wait, err := h.guard.Check(ctx, req.Username, ip)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, please try again later"})
 		return
 	}
 
-	// 验证密码
-	var passwordHash string
-	err = h.db.QueryRow("SELECT password_hash FROM users WHERE username = $1", req.Username).Scan(&passwordHash)
-	if err != nil {
+	// 查询用户
+	user, passwordHash, err := h.store.Users.GetByUsername(ctx, req.Username)
+	if err != nil && err != store.ErrNotFound {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+	// 用户不存在时也执行一次 bcrypt 比较，避免通过响应时间判断用户名是否存在
+	found := err == nil
+	if !found {
+		passwordHash = dummyPasswordHash
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil || !found {
+		if err := h.guard.Fail(ctx, req.Username, ip); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// 生成JWT令牌
-	token, err := middleware.GenerateJWT(user)
+	if err := h.guard.Succeed(ctx, req.Username); err != nil {
+		log.Printf("Failed to reset login failures: %v", err)
+	}
+
+	h.completeLogin(c, *user)
+}
+
+// completeLogin 身份验证通过后的公共流程：密码登录和单点登录都经过这里
+// 检查账号状态，需要两步验证时返回挑战令牌，否则签发访问令牌和刷新令牌
+func (h *Handler) completeLogin(c *gin.Context, user models.User) {
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	// 已启用两步验证，或角色被要求启用两步验证时，先返回挑战令牌
+	required, err := h.twoFactorRequired(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor policy"})
+		return
+	}
+	if user.TwoFactorEnabled || required {
+		challenge, err := h.tokens.GenerateChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{
+			TwoFactorRequired:  true,
+			EnrollmentRequired: !user.TwoFactorEnabled,
+			ChallengeToken:     challenge,
+			ExpiresIn:          int(middleware.ChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	// 生成访问令牌和刷新令牌
+	resp, err := h.issueTokens(h.db, user, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, models.LoginResponse{
-		Token: token,
-		User:  user,
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
 // 获取用户信息
 func (h *Handler) GetProfile(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	
-	var user models.User
-	err := h.db.QueryRow(
-		"SELECT id, username, email, role, created_at, updated_at FROM users WHERE id = $1",
-		userID,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	userID := c.GetInt("user_id")
 
+	user, err := h.store.Users.Get(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
 		return
 	}
 
+	if permissions, ok := c.Get("permissions"); ok {
+		user.Permissions, _ = permissions.([]string)
+	}
+
 	c.JSON(http.StatusOK, user)
 }
 
@@ -100,85 +157,27 @@ func (h *Handler) GetDishes(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	categoryID, _ := strconv.Atoi(c.DefaultQuery("category_id", "0"))
 	search := c.Query("search")
-
-	offset := (page - 1) * limit
-
-	query := `
-		SELECT d.id, d.name, d.description, d.category_id, c.name as category_name,
-			   d.price, d.image_url, d.video_url, d.cooking_steps, d.is_seasonal, d.is_active,
-			   d.created_at, d.updated_at
-		FROM dishes d
-		LEFT JOIN categories c ON d.category_id = c.id
-		WHERE d.is_active = true
-	`
-	args := []interface{}{}
-	argIndex := 1
-
-	if categoryID > 0 {
-		query += fmt.Sprintf(" AND d.category_id = $%d", argIndex)
-		args = append(args, categoryID)
-		argIndex++
-	}
-
-	if search != "" {
-		query += fmt.Sprintf(" AND (d.name ILIKE $%d OR d.description ILIKE $%d)", argIndex, argIndex+1)
-		args = append(args, "%"+search+"%", "%"+search+"%")
-		argIndex += 2
+	// ?tag=spicy,vegetarian 只返回同时带有这些标签的菜品
+	var tags []string
+	for _, tag := range strings.Split(c.Query("tag"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
 	}
 
-	query += fmt.Sprintf(" ORDER BY d.created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
-	args = append(args, limit, offset)
+	offset := (page - 1) * limit
 
-	rows, err := h.db.Query(query, args...)
+	dishes, total, err := h.store.Dishes.List(c.Request.Context(), store.DishFilter{
+		CategoryID: categoryID,
+		Search:     search,
+		Tags:       tags,
+		Limit:      limit,
+		Offset:     offset,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dishes"})
 		return
 	}
-	defer rows.Close()
-
-	var dishes []models.Dish
-	for rows.Next() {
-		var dish models.Dish
-		var categoryName sql.NullString
-		
-		err := rows.Scan(
-			&dish.ID, &dish.Name, &dish.Description, &dish.CategoryID, &categoryName,
-			&dish.Price, &dish.ImageURL, &dish.VideoURL, &dish.CookingSteps,
-			&dish.IsSeasonal, &dish.IsActive, &dish.CreatedAt, &dish.UpdatedAt,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan dish"})
-			return
-		}
-
-		if categoryName.Valid {
-			dish.Category = &models.Category{
-				ID:   dish.CategoryID,
-				Name: categoryName.String,
-			}
-		}
-
-		dishes = append(dishes, dish)
-	}
-
-	// 获取总数
-	countQuery := "SELECT COUNT(*) FROM dishes WHERE is_active = true"
-	countArgs := []interface{}{}
-	countArgIndex := 1
-
-	if categoryID > 0 {
-		countQuery += fmt.Sprintf(" AND category_id = $%d", countArgIndex)
-		countArgs = append(countArgs, categoryID)
-		countArgIndex++
-	}
-
-	if search != "" {
-		countQuery += fmt.Sprintf(" AND (name ILIKE $%d OR description ILIKE $%d)", countArgIndex, countArgIndex+1)
-		countArgs = append(countArgs, "%"+search+"%", "%"+search+"%")
-	}
-
-	var total int
-	h.db.QueryRow(countQuery, countArgs...).Scan(&total)
 
 	c.JSON(http.StatusOK, gin.H{
 		"dishes": dishes,
@@ -196,24 +195,9 @@ func (h *Handler) GetDish(c *gin.Context) {
 		return
 	}
 
-	var dish models.Dish
-	var categoryName sql.NullString
-
-	err = h.db.QueryRow(`
-		SELECT d.id, d.name, d.description, d.category_id, c.name as category_name,
-			   d.price, d.image_url, d.video_url, d.cooking_steps, d.is_seasonal, d.is_active,
-			   d.created_at, d.updated_at
-		FROM dishes d
-		LEFT JOIN categories c ON d.category_id = c.id
-		WHERE d.id = $1
-	`, id).Scan(
-		&dish.ID, &dish.Name, &dish.Description, &dish.CategoryID, &categoryName,
-		&dish.Price, &dish.ImageURL, &dish.VideoURL, &dish.CookingSteps,
-		&dish.IsSeasonal, &dish.IsActive, &dish.CreatedAt, &dish.UpdatedAt,
-	)
-
+	dish, err := h.store.Dishes.Get(c.Request.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == store.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
 			return
 		}
@@ -221,122 +205,30 @@ func (h *Handler) GetDish(c *gin.Context) {
 		return
 	}
 
-	if categoryName.Valid {
-		dish.Category = &models.Category{
-			ID:   dish.CategoryID,
-			Name: categoryName.String,
-		}
-	}
-
-	// 获取营养信息
-	var nutrition models.DishNutrition
-	err = h.db.QueryRow(`
-		SELECT id, calories, protein, fat, carbohydrates, fiber, created_at
-		FROM dish_nutrition WHERE dish_id = $1
-	`, id).Scan(&nutrition.ID, &nutrition.Calories, &nutrition.Protein, &nutrition.Fat, 
-		&nutrition.Carbohydrates, &nutrition.Fiber, &nutrition.CreatedAt)
-
-	if err == nil {
-		// 可以将营养信息添加到响应中
-	}
-
 	c.JSON(http.StatusOK, dish)
 }
 
 // 获取分类列表
 func (h *Handler) GetCategories(c *gin.Context) {
-	rows, err := h.db.Query("SELECT id, name, description, created_at FROM categories ORDER BY name")
+	categories, err := h.store.Categories.List(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
 		return
 	}
-	defer rows.Close()
-
-	var categories []models.Category
-	for rows.Next() {
-		var category models.Category
-		err := rows.Scan(&category.ID, &category.Name, &category.Description, &category.CreatedAt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan category"})
-			return
-		}
-		categories = append(categories, category)
-	}
 
 	c.JSON(http.StatusOK, categories)
 }
 
-// 获取推荐列表
-func (h *Handler) GetRecommendations(c *gin.Context) {
-	rows, err := h.db.Query(`
-		SELECT r.id, r.name, r.description, r.meat_count, r.vegetable_count, r.is_active, r.created_at
-		FROM recommendations r
-		WHERE r.is_active = true
-		ORDER BY r.created_at
-	`)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
-		return
-	}
-	defer rows.Close()
-
-	var recommendations []models.Recommendation
-	for rows.Next() {
-		var rec models.Recommendation
-		err := rows.Scan(&rec.ID, &rec.Name, &rec.Description, &rec.MeatCount, 
-			&rec.VegetableCount, &rec.IsActive, &rec.CreatedAt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan recommendation"})
-			return
-		}
-		recommendations = append(recommendations, rec)
-	}
-
-	c.JSON(http.StatusOK, recommendations)
-}
-
 // 获取应季菜品
 func (h *Handler) GetSeasonalDishes(c *gin.Context) {
-	rows, err := h.db.Query(`
-		SELECT d.id, d.name, d.description, d.category_id, c.name as category_name,
-			   d.price, d.image_url, d.video_url, d.cooking_steps, d.is_seasonal, d.is_active,
-			   d.created_at, d.updated_at
-		FROM dishes d
-		LEFT JOIN categories c ON d.category_id = c.id
-		WHERE d.is_seasonal = true AND d.is_active = true
-		ORDER BY d.created_at DESC
-		LIMIT 10
-	`)
+	dishes, _, err := h.store.Dishes.List(c.Request.Context(), store.DishFilter{
+		SeasonalOnly: true,
+		Limit:        10,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch seasonal dishes"})
 		return
 	}
-	defer rows.Close()
-
-	var dishes []models.Dish
-	for rows.Next() {
-		var dish models.Dish
-		var categoryName sql.NullString
-		
-		err := rows.Scan(
-			&dish.ID, &dish.Name, &dish.Description, &dish.CategoryID, &categoryName,
-			&dish.Price, &dish.ImageURL, &dish.VideoURL, &dish.CookingSteps,
-			&dish.IsSeasonal, &dish.IsActive, &dish.CreatedAt, &dish.UpdatedAt,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan dish"})
-			return
-		}
-
-		if categoryName.Valid {
-			dish.Category = &models.Category{
-				ID:   dish.CategoryID,
-				Name: categoryName.String,
-			}
-		}
-
-		dishes = append(dishes, dish)
-	}
 
 	c.JSON(http.StatusOK, dishes)
 }
\ No newline at end of file
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"food-ordering/config"
+	"food-ordering/events"
+	"food-ordering/models"
+	"food-ordering/money"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testUserHeader 测试请求中携带的用户 ID，代替访问令牌
+const testUserHeader = "X-Test-User"
+
+// testServer 基于内存存储的处理器测试环境，路由与 main.go 保持一致，
+// 但不做令牌认证和权限检查，账号相关的路由依赖 *sql.DB，不在这里注册
+type testServer struct {
+	t       *testing.T
+	mem     *store.Memory
+	store   *store.Store
+	handler *Handler
+	router  *gin.Engine
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	mem := store.NewMemory()
+	st := mem.Store()
+	cfg := &config.Config{CartTTL: 7 * 24 * time.Hour, OrderStreamHeartbeat: time.Minute}
+	handler := NewHandler(nil, st, cfg, nil, nil, nil, events.NewHub(10, nil), nil)
+
+	// 与迁移 0022 写入的标签一致
+	for _, tag := range []struct{ slug, name string }{
+		{"meat", "荤菜"}, {"vegetable", "素菜"}, {"soup", "汤"}, {"staple", "主食"},
+		{"dessert", "甜品"}, {"drink", "饮品"}, {"spicy", "辣"}, {"vegetarian", "素食"},
+	} {
+		if _, err := st.Tags.Create(context.Background(), models.CreateTagRequest{Slug: tag.slug, Name: tag.name}); err != nil {
+			t.Fatalf("seed tag %s: %v", tag.slug, err)
+		}
+	}
+
+	r := gin.New()
+	api := r.Group("/api/v1")
+	api.Use(func(c *gin.Context) {
+		if id, err := strconv.Atoi(c.GetHeader(testUserHeader)); err == nil {
+			c.Set("user_id", id)
+		}
+		c.Next()
+	})
+
+	api.GET("/dishes", handler.GetDishes)
+	api.GET("/dishes/:id", handler.GetDish)
+	api.GET("/dishes/:id/related", handler.GetRelatedDishes)
+	api.GET("/categories", handler.GetCategories)
+	api.GET("/tags", handler.GetTags)
+	api.GET("/recommendations", handler.GetRecommendations)
+	api.GET("/recommendations/:id/generate", handler.GenerateRecommendation)
+	api.GET("/seasonal-dishes", handler.GetSeasonalDishes)
+	api.POST("/payments/webhook", handler.PaymentWebhook)
+	api.POST("/payments/fake/pay", handler.FakePay)
+
+	api.POST("/orders", handler.CreateOrder)
+	api.GET("/orders", handler.GetOrders)
+	api.GET("/orders/:id", handler.GetOrder)
+	api.POST("/orders/:id/cancel", handler.CancelOrder)
+	api.POST("/orders/:id/pay", handler.CreatePayment)
+	api.GET("/orders/:id/payment", handler.GetPayment)
+	api.GET("/cart", handler.GetCart)
+	api.DELETE("/cart", handler.ClearCart)
+	api.POST("/cart/items", handler.AddCartItem)
+	api.PUT("/cart/items/:dishId", handler.UpdateCartItem)
+	api.DELETE("/cart/items/:dishId", handler.RemoveCartItem)
+	api.POST("/cart/checkout", handler.Checkout)
+	api.GET("/cart/suggestions", handler.GetCartSuggestions)
+	api.POST("/favorites/:dishId", handler.AddToFavorites)
+	api.DELETE("/favorites/:dishId", handler.RemoveFromFavorites)
+	api.GET("/favorites", handler.GetFavorites)
+	api.GET("/recommendations/personal", handler.GetPersonalRecommendations)
+	api.GET("/schedule", handler.GetSchedule)
+	api.GET("/orders/stream", handler.StreamOrderEvents)
+
+	admin := api.Group("/admin")
+	admin.POST("/dishes", handler.CreateDish)
+	admin.PUT("/dishes/:id", handler.UpdateDish)
+	admin.DELETE("/dishes/:id", handler.DeleteDish)
+	admin.POST("/categories", handler.CreateCategory)
+	admin.PUT("/categories/:id", handler.UpdateCategory)
+	admin.DELETE("/categories/:id", handler.DeleteCategory)
+	admin.POST("/tags", handler.CreateTag)
+	admin.PUT("/tags/:id", handler.UpdateTag)
+	admin.DELETE("/tags/:id", handler.DeleteTag)
+	admin.GET("/promotions", handler.GetPromotions)
+	admin.POST("/promotions", handler.CreatePromotion)
+	admin.GET("/promotions/:id", handler.GetPromotion)
+	admin.PUT("/promotions/:id", handler.UpdatePromotion)
+	admin.DELETE("/promotions/:id", handler.DeletePromotion)
+	admin.GET("/recommendations", handler.GetAdminRecommendations)
+	admin.POST("/recommendations", handler.CreateRecommendation)
+	admin.GET("/recommendations/:id", handler.GetAdminRecommendation)
+	admin.PUT("/recommendations/:id", handler.UpdateRecommendation)
+	admin.DELETE("/recommendations/:id", handler.DeleteRecommendation)
+	admin.PUT("/recommendations/:id/dishes", handler.UpdateRecommendationDishes)
+	admin.POST("/recommendations/:id/activate", handler.ActivateRecommendation)
+	admin.POST("/recommendations/:id/deactivate", handler.DeactivateRecommendation)
+	admin.GET("/orders", handler.GetAllOrders)
+	admin.GET("/orders/:id", handler.GetAdminOrder)
+	admin.PUT("/orders/:id/status", handler.UpdateOrderStatus)
+	admin.GET("/orders/:id/history", handler.GetOrderStatusHistory)
+	admin.GET("/orders/:id/payment", handler.GetAdminPayment)
+	admin.POST("/orders/:id/refund", handler.RefundPayment)
+	admin.GET("/config", handler.GetConfig)
+	admin.PUT("/config", handler.UpdateConfig)
+	admin.GET("/orders/stream", grantPermissions("orders:read"), handler.StreamOrderEvents)
+
+	return &testServer{t: t, mem: mem, store: st, handler: handler, router: r}
+}
+
+// grantPermissions 代替权限中间件，给请求加上 permissions
+func grantPermissions(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("permissions", permissions)
+		c.Next()
+	}
+}
+
+// do 以 userID 的身份发送请求，userID 为 0 时不带用户；body 为 nil 时不带请求体
+func (s *testServer) do(method, path string, userID int, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("marshal request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if userID != 0 {
+		req.Header.Set(testUserHeader, strconv.Itoa(userID))
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// expect 发送请求并检查状态码，响应体解析到 out（可以为 nil）
+func (s *testServer) expect(status int, method, path string, userID int, body, out interface{}) {
+	s.t.Helper()
+
+	w := s.do(method, path, userID, body)
+	if w.Code != status {
+		s.t.Fatalf("%s %s: status = %d, want %d; body: %s", method, path, w.Code, status, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: decode response: %v; body: %s", method, path, err, w.Body.String())
+		}
+	}
+}
+
+// user 写入一个普通用户并返回其 ID
+func (s *testServer) user(username string) int {
+	return s.mem.SeedUser(models.User{Username: username, Role: "user"}, "").ID
+}
+
+// category 通过管理接口创建分类
+func (s *testServer) category(name string) int {
+	s.t.Helper()
+
+	var category models.Category
+	s.expect(http.StatusCreated, "POST", "/api/v1/admin/categories", 0, models.CreateCategoryRequest{Name: name}, &category)
+	return category.ID
+}
+
+// dish 通过管理接口创建菜品，price 为元，如 "12.50"
+func (s *testServer) dish(name string, categoryID int, price string, tags ...string) models.Dish {
+	s.t.Helper()
+
+	amount, err := money.Parse(price, "")
+	if err != nil {
+		s.t.Fatalf("parse price %q: %v", price, err)
+	}
+	var dish models.Dish
+	s.expect(http.StatusCreated, "POST", "/api/v1/admin/dishes", 0, models.CreateDishRequest{
+		Name:       name,
+		CategoryID: categoryID,
+		Price:      amount,
+		Tags:       tags,
+	}, &dish)
+	return dish
+}
+
+// order 下单并返回订单
+func (s *testServer) order(userID int, req models.CreateOrderRequest) models.Order {
+	s.t.Helper()
+
+	var order models.Order
+	s.expect(http.StatusCreated, "POST", "/api/v1/orders", userID, req, &order)
+	return order
+}
+
+// setStatus 通过管理接口修改订单状态
+func (s *testServer) setStatus(orderID int, status string) {
+	s.t.Helper()
+	s.expect(http.StatusOK, "PUT", fmt.Sprintf("/api/v1/admin/orders/%d/status", orderID), 1,
+		models.UpdateOrderStatusRequest{Status: status}, nil)
+}
+
+// errorMessage 取出错误响应中的 error 字段
+func errorMessage(w *httptest.ResponseRecorder) string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return body.Error
+}
+
+func mustMoney(t *testing.T, s string) money.Money {
+	t.Helper()
+	m, err := money.Parse(s, "")
+	if err != nil {
+		t.Fatalf("parse %q: %v", s, err)
+	}
+	return m
+}
+
+func TestDishes(t *testing.T) {
+	s := newTestServer(t)
+	mains := s.category("主菜")
+	soups := s.category("汤类")
+	s.dish("红烧肉", mains, "38.00", models.TagMeat)
+	s.dish("清炒时蔬", mains, "18.50", models.TagVegetable)
+	soup := s.dish("番茄蛋汤", soups, "12.00", "soup")
+
+	var list struct {
+		Dishes []models.Dish `json:"dishes"`
+		Total  int           `json:"total"`
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/dishes", 0, nil, &list)
+	if list.Total != 3 || len(list.Dishes) != 3 {
+		t.Fatalf("GET /dishes returned %d of %d dishes, want 3", len(list.Dishes), list.Total)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?category_id=" + strconv.Itoa(soups), []string{"番茄蛋汤"}},
+		{"?search=炒", []string{"清炒时蔬"}},
+		{"?tag=meat", []string{"红烧肉"}},
+		{"?tag=meat,soup", nil},
+		{"?limit=1&page=2", []string{"清炒时蔬"}},
+	}
+	for _, tt := range tests {
+		s.expect(http.StatusOK, "GET", "/api/v1/dishes"+tt.query, 0, nil, &list)
+		var got []string
+		for _, dish := range list.Dishes {
+			got = append(got, dish.Name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("GET /dishes%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	var dish models.Dish
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/dishes/%d", soup.ID), 0, nil, &dish)
+	if dish.Name != "番茄蛋汤" || dish.Price.String() != "12.00" || fmt.Sprint(dish.Tags) != "[soup]" {
+		t.Errorf("GET /dishes/%d = %+v", soup.ID, dish)
+	}
+	s.expect(http.StatusNotFound, "GET", "/api/v1/dishes/999", 0, nil, nil)
+	s.expect(http.StatusBadRequest, "GET", "/api/v1/dishes/abc", 0, nil, nil)
+
+	// 下架后不再出现在列表中
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", soup.ID), 0, nil, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/dishes", 0, nil, &list)
+	if list.Total != 2 {
+		t.Errorf("after delete GET /dishes total = %d, want 2", list.Total)
+	}
+}
+
+func TestCreateDishValidation(t *testing.T) {
+	s := newTestServer(t)
+	mains := s.category("主菜")
+
+	tests := []struct {
+		name string
+		req  models.CreateDishRequest
+		want string
+	}{
+		{"zero price", models.CreateDishRequest{Name: "a", CategoryID: mains}, "Price must be greater than 0"},
+		{"unknown category", models.CreateDishRequest{Name: "a", CategoryID: 999, Price: money.New(100)}, "Invalid category ID"},
+		{"unknown tag", models.CreateDishRequest{Name: "a", CategoryID: mains, Price: money.New(100), Tags: []string{"nope"}}, "Unknown tags: nope"},
+		{"meat and vegetable", models.CreateDishRequest{Name: "a", CategoryID: mains, Price: money.New(100),
+			Tags: []string{models.TagMeat, models.TagVegetable}}, "Dish cannot be tagged both meat and vegetable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("POST", "/api/v1/admin/dishes", 0, tt.req)
+			if w.Code != http.StatusBadRequest || errorMessage(w) != tt.want {
+				t.Errorf("status = %d, error = %q; want 400 %q", w.Code, errorMessage(w), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"food-ordering/lockout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 获取登录失败与锁定记录（管理员）
+func (h *Handler) GetLockouts(c *gin.Context) {
+	attempts, err := h.guard.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+	if attempts == nil {
+		attempts = []lockout.Attempt{}
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
+
+// 解除锁定（管理员），通过 username 或 ip 查询参数指定
+func (h *Handler) ClearLockout(c *gin.Context) {
+	var key string
+	switch {
+	case c.Query("username") != "":
+		key = lockout.UsernameKey(c.Query("username"))
+	case c.Query("ip") != "":
+		key = lockout.IPKey(c.Query("ip"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username or ip is required"})
+		return
+	}
+
+	if err := h.guard.Clear(c.Request.Context(), key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear lockout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared successfully"})
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"food-ordering/middleware"
+	"food-ordering/models"
+	"food-ordering/oidc"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 单点登录从发起到回调的最长时间
+const ssoStateTTL = 10 * time.Minute
+
+// 保存 state 哈希的 Cookie，把 state 绑定到发起登录的浏览器，防止登录 CSRF
+const (
+	ssoStateCookie     = "sso_state"
+	ssoStateCookiePath = "/api/v1/auth/sso"
+)
+
+// 自动创建用户时，用户名中不允许的字符
+var usernameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// errSSO 解析单点登录用户时可以直接返回给客户端的错误
+type errSSO struct {
+	status  int
+	message string
+}
+
+func (e *errSSO) Error() string {
+	return e.message
+}
+
+// 获取单点登录配置，前端据此决定是否显示单点登录按钮
+func (h *Handler) GetSSOConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  h.sso != nil,
+		"provider": h.cfg.OIDCProviderName,
+	})
+}
+
+// 发起单点登录，返回身份提供方的授权地址
+// state 的哈希同时写入 HttpOnly Cookie，回调时必须由同一个浏览器带回
+func (h *Handler) StartSSOLogin(c *gin.Context) {
+	if h.sso == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSO is not configured"})
+		return
+	}
+
+	state, err1 := middleware.RandomToken(16)
+	nonce, err2 := middleware.RandomToken(16)
+	codeVerifier, err3 := middleware.RandomToken(32)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+
+	authURL, err := h.sso.AuthCodeURL(c.Request.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("SSO discovery failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	stateHash := hashToken(state)
+	err = h.store.LoginStates.Save(c.Request.Context(), stateHash, store.LoginState{
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().UTC().Add(ssoStateTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+
+	h.setSSOStateCookie(c, stateHash, int(ssoStateTTL/time.Second))
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authURL,
+		"state":             state,
+	})
+}
+
+// 完成单点登录：用授权码换取 ID Token，找到或创建对应的本地用户后按普通登录流程签发令牌
+func (h *Handler) SSOCallback(c *gin.Context) {
+	if h.sso == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSO is not configured"})
+		return
+	}
+
+	var req models.SSOCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// state 必须与发起登录的浏览器 Cookie 中的哈希一致，且只能使用一次
+	stateHash := hashToken(req.State)
+	cookie, err := c.Cookie(ssoStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(stateHash)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SSO state does not match this browser"})
+		return
+	}
+	h.setSSOStateCookie(c, "", -1)
+
+	loginState, err := h.store.LoginStates.Take(c.Request.Context(), stateHash)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired SSO state"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if time.Now().UTC().After(loginState.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired SSO state"})
+		return
+	}
+
+	claims, err := h.sso.Exchange(c.Request.Context(), req.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("SSO code exchange failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "SSO login failed"})
+		return
+	}
+
+	user, err := h.resolveSSOUser(claims)
+	if err != nil {
+		var ssoErr *errSSO
+		if errors.As(err, &ssoErr) {
+			c.JSON(ssoErr.status, gin.H{"error": ssoErr.message})
+			return
+		}
+		log.Printf("SSO user resolution failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve SSO user"})
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// setSSOStateCookie 写入或清除（maxAge < 0）state Cookie
+// 回调由前端同源的 XHR 发起，SameSite=Lax 足够；回调地址是 HTTPS 时只在 HTTPS 下发送
+func (h *Handler) setSSOStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    value,
+		Path:     ssoStateCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.cfg.OIDCRedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// resolveSSOUser 按 provider + subject 找到关联的本地用户
+// 没有关联时，按配置通过已验证的邮箱关联已有用户，或者自动创建用户
+// 配置了角色声明时，每次登录都会按映射同步用户的角色
+func (h *Handler) resolveSSOUser(claims *oidc.Claims) (models.User, error) {
+	var user models.User
+	provider := h.cfg.OIDCProviderName
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return user, err
+	}
+	defer tx.Rollback()
+
+	const userColumns = "u.id, u.username, u.email, u.role, u.status, u.must_change_password, u.totp_enabled, u.created_at, u.updated_at"
+	scan := func(row *sql.Row) error {
+		return row.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Status, &user.MustChangePassword, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt)
+	}
+
+	err = scan(tx.QueryRow(`
+		SELECT `+userColumns+`
+		FROM users u
+		JOIN user_identities i ON i.user_id = u.id
+		WHERE i.provider = $1 AND i.subject = $2
+	`, provider, claims.Subject))
+	if err != nil && err != sql.ErrNoRows {
+		return user, err
+	}
+
+	if err == sql.ErrNoRows {
+		linked := false
+		if h.cfg.OIDCLinkByEmail && claims.EmailVerified && claims.Email != "" {
+			err = scan(tx.QueryRow("SELECT "+userColumns+" FROM users u WHERE LOWER(u.email) = LOWER($1)", claims.Email))
+			if err != nil && err != sql.ErrNoRows {
+				return user, err
+			}
+			linked = err == nil
+		}
+
+		if !linked {
+			if !h.cfg.OIDCAutoProvision {
+				return user, &errSSO{http.StatusForbidden, "No local account is linked to this identity"}
+			}
+			if user, err = h.provisionSSOUser(tx, claims); err != nil {
+				return user, err
+			}
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)",
+			user.ID, provider, claims.Subject, claims.Email,
+		)
+		if err != nil {
+			return user, err
+		}
+	}
+
+	if h.cfg.OIDCRoleClaim != "" {
+		role := h.ssoRole(claims)
+		if role != user.Role {
+			_, err = tx.Exec("UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2", role, user.ID)
+			if err != nil {
+				return user, err
+			}
+			user.Role = role
+		}
+	}
+
+	_, err = tx.Exec("UPDATE user_identities SET last_login_at = NOW() WHERE provider = $1 AND subject = $2", provider, claims.Subject)
+	if err != nil {
+		return user, err
+	}
+
+	return user, tx.Commit()
+}
+
+// provisionSSOUser 为首次登录的外部账号创建本地用户
+// 本地密码设为随机值，该用户只能通过单点登录，除非管理员重置密码
+func (h *Handler) provisionSSOUser(tx *sql.Tx, claims *oidc.Claims) (models.User, error) {
+	var user models.User
+
+	if claims.Email != "" {
+		var emailTaken bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))", claims.Email).Scan(&emailTaken)
+		if err != nil {
+			return user, err
+		}
+		if emailTaken {
+			return user, &errSSO{http.StatusConflict, "An account with this email already exists"}
+		}
+	}
+
+	username, err := availableUsername(tx, ssoUsername(claims))
+	if err != nil {
+		return user, err
+	}
+
+	password, err := middleware.RandomToken(32)
+	if err != nil {
+		return user, err
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user, err
+	}
+
+	role := h.cfg.OIDCDefaultRole
+	if h.cfg.OIDCRoleClaim != "" {
+		role = h.ssoRole(claims)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO users (username, password_hash, email, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING id, username, email, role, status, must_change_password, totp_enabled, created_at, updated_at
+	`, username, string(passwordHash), claims.Email, role).Scan(
+		&user.ID, &user.Username, &user.Email, &user.Role, &user.Status, &user.MustChangePassword, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt,
+	)
+	return user, err
+}
+
+// ssoRole 按 OIDC_ROLE_MAP 把角色声明映射为本地角色，声明为数组时取第一个能映射的值
+func (h *Handler) ssoRole(claims *oidc.Claims) string {
+	var values []string
+	switch v := claims.Raw[h.cfg.OIDCRoleClaim].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	for _, value := range values {
+		if role, ok := h.cfg.OIDCRoleMap[value]; ok {
+			return role
+		}
+	}
+	return h.cfg.OIDCDefaultRole
+}
+
+// ssoUsername 从声明中推导本地用户名
+func ssoUsername(claims *oidc.Claims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" && claims.Email != "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+	candidate = usernameInvalidChars.ReplaceAllString(candidate, "")
+	if len(candidate) < 3 {
+		candidate = "sso_" + hashToken(claims.Subject)[:8]
+	}
+	if len(candidate) > 40 {
+		candidate = candidate[:40]
+	}
+	return candidate
+}
+
+// availableUsername 用户名已被占用时追加随机后缀
+func availableUsername(tx *sql.Tx, base string) (string, error) {
+	username := base
+	for i := 0; i < 5; i++ {
+		var taken bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)", username).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return username, nil
+		}
+		suffix, err := middleware.RandomToken(2)
+		if err != nil {
+			return "", err
+		}
+		username = base + "-" + suffix
+	}
+	return "", errors.New("could not find an available username")
+}
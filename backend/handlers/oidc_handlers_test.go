@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"food-ordering/config"
+	"food-ordering/events"
+	"food-ordering/models"
+	"food-ordering/oidc"
+	"food-ordering/oidc/oidctest"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ssoTestServer 单点登录处理器的测试环境，身份提供方是 oidctest 启动的模拟服务
+// 回调成功后的用户解析依赖 *sql.DB，这里只覆盖到用授权码换取 ID Token 之前的部分
+type ssoTestServer struct {
+	t       *testing.T
+	store   *store.Store
+	handler *Handler
+	router  *gin.Engine
+	sso     *oidc.Provider
+}
+
+func newSSOTestServer(t *testing.T) *ssoTestServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	idp, err := oidctest.New("", "food-ordering", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(idp)
+	t.Cleanup(server.Close)
+	idp.Issuer = server.URL
+
+	cfg := &config.Config{
+		OIDCIssuer:       server.URL,
+		OIDCClientID:     "food-ordering",
+		OIDCRedirectURL:  "http://localhost:3000/auth/callback",
+		OIDCProviderName: "mock",
+		OIDCRoleClaim:    "groups",
+		OIDCRoleMap:      map[string]string{"kitchen": "staff", "admins": "admin"},
+		OIDCDefaultRole:  "customer",
+	}
+	sso := oidc.NewProvider(oidc.Config{
+		Issuer:      cfg.OIDCIssuer,
+		ClientID:    cfg.OIDCClientID,
+		RedirectURL: cfg.OIDCRedirectURL,
+	})
+	st := store.NewMemory().Store()
+	handler := NewHandler(nil, st, cfg, nil, nil, sso, events.NewHub(10, nil), nil)
+
+	r := gin.New()
+	public := r.Group("/api/v1")
+	public.GET("/auth/sso", handler.GetSSOConfig)
+	public.POST("/auth/sso/login", handler.StartSSOLogin)
+	public.POST("/auth/sso/callback", handler.SSOCallback)
+
+	return &ssoTestServer{t: t, store: st, handler: handler, router: r, sso: sso}
+}
+
+// ssoLogin 一次已发起的单点登录
+type ssoLogin struct {
+	authURL string
+	state   string
+	cookie  *http.Cookie
+}
+
+// start 发起单点登录
+func (s *ssoTestServer) start() ssoLogin {
+	s.t.Helper()
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/auth/sso/login", nil))
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("start SSO login: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		AuthorizationURL string `json:"authorization_url"`
+		State            string `json:"state"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		s.t.Fatalf("decode response: %v; body: %s", err, w.Body.String())
+	}
+
+	login := ssoLogin{authURL: resp.AuthorizationURL, state: resp.State}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == ssoStateCookie {
+			login.cookie = cookie
+		}
+	}
+	if login.cookie == nil {
+		s.t.Fatal("start SSO login did not set the state cookie")
+	}
+	return login
+}
+
+// callback 以带有 cookie 的浏览器提交回调，cookie 为 nil 时不带
+func (s *ssoTestServer) callback(code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	s.t.Helper()
+	body, err := json.Marshal(models.SSOCallbackRequest{Code: code, State: state})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/api/v1/auth/sso/callback", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestStartSSOLogin(t *testing.T) {
+	s := newSSOTestServer(t)
+	login := s.start()
+
+	cookie := login.cookie
+	if cookie.Value != hashToken(login.state) || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode ||
+		cookie.Path != ssoStateCookiePath || cookie.MaxAge != int(ssoStateTTL/time.Second) || cookie.Secure {
+		t.Errorf("state cookie = %+v", cookie)
+	}
+
+	// 保存的 PKCE 参数和 nonce 与授权地址中的一致，且能在身份提供方完成整个流程
+	authURL, err := url.Parse(login.authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authURL.Query().Get("state"); got != login.state {
+		t.Errorf("authorization URL state = %q, want %q", got, login.state)
+	}
+	saved, err := s.store.LoginStates.Take(context.Background(), hashToken(login.state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authURL.Query().Get("code_challenge"); got != oidc.CodeChallenge(saved.CodeVerifier) {
+		t.Errorf("code_challenge = %q does not match the saved verifier", got)
+	}
+	if got := authURL.Query().Get("nonce"); got != saved.Nonce {
+		t.Errorf("nonce = %q, want the saved %q", got, saved.Nonce)
+	}
+
+	code, state := ssoAuthorize(t, login.authURL, url.Values{"sub": {"alice-id"}, "groups": {"guests,kitchen"}})
+	if state != login.state {
+		t.Errorf("callback state = %q, want %q", state, login.state)
+	}
+	claims, err := s.sso.Exchange(context.Background(), code, saved.CodeVerifier, saved.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := s.handler.ssoRole(claims); role != "staff" {
+		t.Errorf("role from the ID token = %q, want staff", role)
+	}
+}
+
+func TestSSOCallbackState(t *testing.T) {
+	s := newSSOTestServer(t)
+	login := s.start()
+	other := s.start()
+
+	tests := []struct {
+		name    string
+		state   string
+		cookie  *http.Cookie
+		status  int
+		message string
+	}{
+		{"no cookie", login.state, nil, http.StatusBadRequest, "SSO state does not match this browser"},
+		{"cookie from another login", login.state, other.cookie, http.StatusBadRequest, "SSO state does not match this browser"},
+		{"made-up state with its own cookie", "forged", &http.Cookie{Name: ssoStateCookie, Value: hashToken("forged")}, http.StatusBadRequest, "Invalid or expired SSO state"},
+		// 前面的请求没有消耗 state；这次通过校验并消耗 state，但授权码无效
+		{"bad authorization code", login.state, login.cookie, http.StatusUnauthorized, "SSO login failed"},
+		{"replayed state", login.state, login.cookie, http.StatusBadRequest, "Invalid or expired SSO state"},
+	}
+	for _, tt := range tests {
+		w := s.callback("bad-code", tt.state, tt.cookie)
+		if w.Code != tt.status || errorMessage(w) != tt.message {
+			t.Errorf("%s: status = %d, error = %q; want %d %q", tt.name, w.Code, errorMessage(w), tt.status, tt.message)
+		}
+	}
+
+	// 校验通过后清除浏览器中的 state cookie
+	w := s.callback("bad-code", other.state, other.cookie)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	cleared := false
+	for _, cookie := range w.Result().Cookies() {
+		cleared = cleared || cookie.Name == ssoStateCookie && cookie.MaxAge < 0
+	}
+	if !cleared {
+		t.Error("callback did not clear the state cookie")
+	}
+}
+
+func TestSSOCallbackExpiredState(t *testing.T) {
+	s := newSSOTestServer(t)
+	err := s.store.LoginStates.Save(context.Background(), hashToken("stale"), store.LoginState{
+		Nonce:        "nonce",
+		CodeVerifier: "verifier",
+		ExpiresAt:    time.Now().UTC().Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := s.callback("code", "stale", &http.Cookie{Name: ssoStateCookie, Value: hashToken("stale")})
+	if w.Code != http.StatusBadRequest || errorMessage(w) != "Invalid or expired SSO state" {
+		t.Errorf("status = %d, error = %q; want 400 for an expired state", w.Code, errorMessage(w))
+	}
+	if _, err := s.store.LoginStates.Take(context.Background(), hashToken("stale")); err != store.ErrNotFound {
+		t.Errorf("expired state was not consumed: %v", err)
+	}
+}
+
+func TestSSORole(t *testing.T) {
+	h := &Handler{cfg: &config.Config{
+		OIDCRoleClaim:   "groups",
+		OIDCRoleMap:     map[string]string{"kitchen": "staff", "admins": "admin"},
+		OIDCDefaultRole: "customer",
+	}}
+	tests := []struct {
+		name  string
+		claim interface{}
+		want  string
+	}{
+		{"string claim", "admins", "admin"},
+		{"first mapped value of an array", []interface{}{"guests", "kitchen", "admins"}, "staff"},
+		{"nothing mapped", []interface{}{"guests"}, "customer"},
+		{"non-string items are ignored", []interface{}{42, "admins"}, "admin"},
+		{"missing claim", nil, "customer"},
+		{"unexpected type", true, "customer"},
+	}
+	for _, tt := range tests {
+		raw := map[string]interface{}{}
+		if tt.claim != nil {
+			raw["groups"] = tt.claim
+		}
+		if got := h.ssoRole(&oidc.Claims{Raw: raw}); got != tt.want {
+			t.Errorf("%s: ssoRole() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// ssoAuthorize 在模拟身份提供方完成授权，返回回调地址中的授权码和 state
+func ssoAuthorize(t *testing.T, authURL string, identity url.Values) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL + "&" + identity.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil {
+		t.Fatalf("authorize: status = %d, location = %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
@@ -1,21 +1,20 @@
 package handlers
 
 import (
-	"database/sql"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
+	"food-ordering/events"
 	"food-ordering/models"
+	"food-ordering/store"
 
 	"github.com/gin-gonic/gin"
 )
 
 // 创建订单
 func (h *Handler) CreateOrder(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	userID := c.GetInt("user_id")
 	
 	var req models.CreateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -23,115 +22,61 @@ func (h *Handler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	if len(req.Items) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order must contain at least one item"})
-		return
-	}
+	req.CouponCode = normalizeCouponCode(req.CouponCode)
+	order, err := h.store.Orders.Create(c.Request.Context(), userID, req)
+	h.respondOrderCreated(c, order, err)
+}
 
-	// 开始事务
-	tx, err := h.db.Begin()
+// respondOrderCreated 返回新建的订单并发布事件，下单和购物车结算共用
+func (h *Handler) respondOrderCreated(c *gin.Context, order *models.Order, err error) {
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
-		return
-	}
-	defer tx.Rollback()
-
-	// 计算总金额并验证菜品
-	var totalAmount float64
-	for _, item := range req.Items {
-		var price float64
-		err := tx.QueryRow("SELECT price FROM dishes WHERE id = $1 AND is_active = true", item.DishID).Scan(&price)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Dish %d not found", item.DishID)})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dish price"})
+		var unavailable *store.DishUnavailableError
+		var quantity *store.InvalidQuantityError
+		var coupon *store.CouponError
+		var unschedulable *store.ScheduleError
+		var full *store.SlotFullError
+		switch {
+		case errors.As(err, &unavailable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": unavailable.Error()})
 			return
-		}
-		totalAmount += price * float64(item.Quantity)
-	}
-
-	// 创建订单
-	var orderID int
-	err = tx.QueryRow(`
-		INSERT INTO orders (user_id, total_amount, status) 
-		VALUES ($1, $2, 'pending') 
-		RETURNING id
-	`, userID, totalAmount).Scan(&orderID)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
-		return
-	}
-
-	// 创建订单明细
-	for _, item := range req.Items {
-		var price float64
-		tx.QueryRow("SELECT price FROM dishes WHERE id = $1", item.DishID).Scan(&price)
-		
-		_, err = tx.Exec(`
-			INSERT INTO order_items (order_id, dish_id, quantity, price) 
-			VALUES ($1, $2, $3, $4)
-		`, orderID, item.DishID, item.Quantity, price)
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order item"})
+		case errors.As(err, &quantity):
+			c.JSON(http.StatusBadRequest, gin.H{"error": quantity.Error()})
+			return
+		case errors.As(err, &coupon):
+			c.JSON(http.StatusBadRequest, gin.H{"error": coupon.Error()})
+			return
+		case errors.As(err, &unschedulable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": unschedulable.Error()})
+			return
+		case errors.As(err, &full):
+			c.JSON(http.StatusConflict, gin.H{"error": full.Error()})
 			return
 		}
-	}
-
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
-	}
-
-	// 返回创建的订单
-	order, err := h.getOrderWithItems(orderID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order created but failed to fetch details"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
 
+	h.publishOrderEvent(c, events.OrderCreated, order)
 	c.JSON(http.StatusCreated, order)
 }
 
 // 获取用户订单
 func (h *Handler) GetOrders(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	userID := c.GetInt("user_id")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	
 	offset := (page - 1) * limit
 
-	rows, err := h.db.Query(`
-		SELECT id, user_id, total_amount, status, created_at, updated_at
-		FROM orders 
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`, userID, limit, offset)
+	orders, total, err := h.store.Orders.List(c.Request.Context(), store.OrderFilter{
+		UserID: userID,
+		Limit:  limit,
+		Offset: offset,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
-	defer rows.Close()
-
-	var orders []models.Order
-	for rows.Next() {
-		var order models.Order
-		err := rows.Scan(&order.ID, &order.UserID, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan order"})
-			return
-		}
-		orders = append(orders, order)
-	}
-
-	// 获取总数
-	var total int
-	h.db.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = $1", userID).Scan(&total)
 
 	c.JSON(http.StatusOK, gin.H{
 		"orders": orders,
@@ -141,99 +86,98 @@ func (h *Handler) GetOrders(c *gin.Context) {
 	})
 }
 
-// 获取订单详情（辅助方法）
-func (h *Handler) getOrderWithItems(orderID int) (*models.Order, error) {
-	var order models.Order
-	
-	// 获取订单基本信息
-	err := h.db.QueryRow(`
-		SELECT id, user_id, total_amount, status, created_at, updated_at
-		FROM orders WHERE id = $1
-	`, orderID).Scan(&order.ID, &order.UserID, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt)
-	
+// 获取订单详情，只能查看自己的订单
+func (h *Handler) GetOrder(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	orderID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return nil, err
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
 	}
 
-	// 获取订单明细
-	rows, err := h.db.Query(`
-		SELECT oi.id, oi.order_id, oi.dish_id, oi.quantity, oi.price, oi.created_at,
-			   d.name, d.image_url
-		FROM order_items oi
-		LEFT JOIN dishes d ON oi.dish_id = d.id
-		WHERE oi.order_id = $1
-	`, orderID)
-	if err != nil {
-		return nil, err
+	order, err := h.store.Orders.Get(c.Request.Context(), orderID)
+	if err != nil && err != store.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var item models.OrderItem
-		var dishName sql.NullString
-		var dishImageURL sql.NullString
-		
-		err := rows.Scan(&item.ID, &item.OrderID, &item.DishID, &item.Quantity, 
-			&item.Price, &item.CreatedAt, &dishName, &dishImageURL)
-		if err != nil {
-			return nil, err
-		}
-
-		if dishName.Valid {
-			item.Dish = &models.Dish{
-				ID:       item.DishID,
-				Name:     dishName.String,
-				ImageURL: dishImageURL.String,
-			}
-		}
-
-		order.Items = append(order.Items, item)
+	// 别人的订单与不存在的订单返回相同的结果
+	if err == store.ErrNotFound || order.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
 	}
 
-	return &order, nil
+	c.JSON(http.StatusOK, order)
 }
 
-// 添加到收藏
-func (h *Handler) AddToFavorites(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	dishID, err := strconv.Atoi(c.Param("dishId"))
+// 取消自己的订单，只允许在待确认或已确认时取消
+func (h *Handler) CancelOrder(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	orderID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dish ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
 		return
 	}
 
-	// 检查菜品是否存在
-	var exists bool
-	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM dishes WHERE id = $1 AND is_active = true)", dishID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
-		return
+	// 请求体可以为空
+	var req models.CancelOrderRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	// 检查是否已经收藏
-	var alreadyExists bool
-	err = h.db.QueryRow(`
-		SELECT EXISTS(SELECT 1 FROM user_favorites WHERE user_id = $1 AND dish_id = $2)
-	`, userID, dishID).Scan(&alreadyExists)
-	
+	ctx := c.Request.Context()
+	change := store.StatusChange{
+		OrderID:   orderID,
+		To:        models.OrderStatusCancelled,
+		ChangedBy: userID,
+		Note:      req.Reason,
+		OwnerID:   userID,
+		From:      []string{models.OrderStatusPending, models.OrderStatusConfirmed},
+	}
+	// 已支付的订单先撤销支付或退款
+	var order *models.Order
+	err = h.settlePayment(ctx, change)
+	if err == nil {
+		order, err = h.store.Orders.ChangeStatus(ctx, change)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		var invalid *store.InvalidTransitionError
+		switch {
+		case err == store.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusConflict, gin.H{"error": "Order can only be cancelled while pending or confirmed"})
+		default:
+			respondPaymentError(c, err, "Failed to cancel order")
+		}
 		return
 	}
 
-	if alreadyExists {
-		c.JSON(http.StatusConflict, gin.H{"error": "Dish already in favorites"})
+	h.publishOrderEvent(c, events.OrderStatusChanged, order)
+	c.JSON(http.StatusOK, order)
+}
+
+// 添加到收藏
+func (h *Handler) AddToFavorites(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	dishID, err := strconv.Atoi(c.Param("dishId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dish ID"})
 		return
 	}
 
-	// 添加到收藏
-	_, err = h.db.Exec(`
-		INSERT INTO user_favorites (user_id, dish_id) 
-		VALUES ($1, $2)
-	`, userID, dishID)
-
+	err = h.store.Favorites.Add(c.Request.Context(), userID, dishID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add to favorites"})
+		switch err {
+		case store.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
+		case store.ErrConflict:
+			c.JSON(http.StatusConflict, gin.H{"error": "Dish already in favorites"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add to favorites"})
+		}
 		return
 	}
 
@@ -242,97 +186,39 @@ func (h *Handler) AddToFavorites(c *gin.Context) {
 
 // 从收藏中移除
 func (h *Handler) RemoveFromFavorites(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	userID := c.GetInt("user_id")
 	dishID, err := strconv.Atoi(c.Param("dishId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dish ID"})
 		return
 	}
 
-	result, err := h.db.Exec(`
-		DELETE FROM user_favorites 
-		WHERE user_id = $1 AND dish_id = $2
-	`, userID, dishID)
-
+	err = h.store.Favorites.Remove(c.Request.Context(), userID, dishID)
 	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Favorite not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove from favorites"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Favorite not found"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "Removed from favorites"})
 }
 
 // 获取用户收藏
 func (h *Handler) GetFavorites(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	userID := c.GetInt("user_id")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	
 	offset := (page - 1) * limit
 
-	rows, err := h.db.Query(`
-		SELECT uf.id, uf.user_id, uf.dish_id, uf.created_at,
-			   d.name, d.description, d.price, d.image_url, d.is_seasonal,
-			   c.name as category_name
-		FROM user_favorites uf
-		LEFT JOIN dishes d ON uf.dish_id = d.id
-		LEFT JOIN categories c ON d.category_id = c.id
-		WHERE uf.user_id = $1 AND d.is_active = true
-		ORDER BY uf.created_at DESC
-		LIMIT $2 OFFSET $3
-	`, userID, limit, offset)
+	favorites, total, err := h.store.Favorites.List(c.Request.Context(), userID, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favorites"})
 		return
 	}
-	defer rows.Close()
-
-	var favorites []models.UserFavorite
-	for rows.Next() {
-		var fav models.UserFavorite
-		var dishName, dishDesc, dishImageURL, categoryName sql.NullString
-		var dishPrice sql.NullFloat64
-		var isSeasonal sql.NullBool
-		
-		err := rows.Scan(
-			&fav.ID, &fav.UserID, &fav.DishID, &fav.CreatedAt,
-			&dishName, &dishDesc, &dishPrice, &dishImageURL, &isSeasonal, &categoryName,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan favorite"})
-			return
-		}
-
-		if dishName.Valid {
-			fav.Dish = &models.Dish{
-				ID:          fav.DishID,
-				Name:        dishName.String,
-				Description: dishDesc.String,
-				Price:       dishPrice.Float64,
-				ImageURL:    dishImageURL.String,
-				IsSeasonal:  isSeasonal.Bool,
-			}
-			if categoryName.Valid {
-				fav.Dish.Category = &models.Category{Name: categoryName.String}
-			}
-		}
-
-		favorites = append(favorites, fav)
-	}
-
-	// 获取总数
-	var total int
-	h.db.QueryRow(`
-		SELECT COUNT(*) FROM user_favorites uf
-		LEFT JOIN dishes d ON uf.dish_id = d.id
-		WHERE uf.user_id = $1 AND d.is_active = true
-	`, userID).Scan(&total)
 
 	c.JSON(http.StatusOK, gin.H{
 		"favorites": favorites,
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"food-ordering/models"
+)
+
+func TestCreateOrder(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00", models.TagMeat)
+	greens := s.dish("清炒时蔬", mains, "18.50", models.TagVegetable)
+
+	order := s.order(alice, models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{
+		{DishID: pork.ID, Quantity: 2, Note: "少辣"},
+		{DishID: greens.ID, Quantity: 1},
+	}})
+	if order.UserID != alice || order.Status != models.OrderStatusPending {
+		t.Errorf("order = user %d status %s, want user %d pending", order.UserID, order.Status, alice)
+	}
+	if order.Subtotal.String() != "94.50" || order.TotalAmount.String() != "94.50" || !order.DiscountAmount.IsZero() {
+		t.Errorf("order amounts = %s - %s = %s, want 94.50 - 0.00 = 94.50",
+			order.Subtotal, order.DiscountAmount, order.TotalAmount)
+	}
+	if len(order.Items) != 2 {
+		t.Fatalf("order has %d items, want 2", len(order.Items))
+	}
+	for _, item := range order.Items {
+		if item.DishID == pork.ID && (item.Quantity != 2 || item.Price.String() != "38.00" || item.Note != "少辣") {
+			t.Errorf("pork item = %+v", item)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		req    models.CreateOrderRequest
+		status int
+		want   string
+	}{
+		{"no items", models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{}}, http.StatusBadRequest, ""},
+		{"unknown dish", models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{{DishID: 999, Quantity: 1}}},
+			http.StatusBadRequest, "Dish 999 not found"},
+		{"unknown coupon", models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}},
+			CouponCode: "nope"}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("POST", "/api/v1/orders", alice, tt.req)
+			if w.Code != tt.status || tt.want != "" && errorMessage(w) != tt.want {
+				t.Errorf("status = %d, error = %q; want %d %q", w.Code, errorMessage(w), tt.status, tt.want)
+			}
+		})
+	}
+
+	// 已下架的菜品不能下单
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", greens.ID), 0, nil, nil)
+	w := s.do("POST", "/api/v1/orders", alice, models.CreateOrderRequest{
+		Items: []models.CreateOrderItemRequest{{DishID: greens.ID, Quantity: 1}},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("ordering an inactive dish: status = %d, want 400", w.Code)
+	}
+}
+
+func TestCreateOrderItemValidation(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+
+	tests := []struct {
+		name string
+		item models.CreateOrderItemRequest
+		want int
+	}{
+		{"note at limit", models.CreateOrderItemRequest{DishID: pork.ID, Quantity: 1, Note: strings.Repeat("辣", 200)}, http.StatusCreated},
+		{"note too long", models.CreateOrderItemRequest{DishID: pork.ID, Quantity: 1, Note: strings.Repeat("a", 201)}, http.StatusBadRequest},
+		{"missing quantity", models.CreateOrderItemRequest{DishID: pork.ID}, http.StatusBadRequest},
+		{"negative quantity", models.CreateOrderItemRequest{DishID: pork.ID, Quantity: -1}, http.StatusBadRequest},
+		{"missing dish", models.CreateOrderItemRequest{Quantity: 1}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("POST", "/api/v1/orders", alice, models.CreateOrderRequest{
+				Items: []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}, tt.item},
+			})
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// 被拒绝的请求不会留下订单
+	var list struct {
+		Total int `json:"total"`
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/orders", alice, nil, &list)
+	if list.Total != 1 {
+		t.Errorf("GET /orders total = %d, want 1", list.Total)
+	}
+}
+
+func TestOrdersAreScopedToUser(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	bob := s.user("bob")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	items := []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}
+
+	first := s.order(alice, models.CreateOrderRequest{Items: items})
+	second := s.order(alice, models.CreateOrderRequest{Items: items})
+	bobs := s.order(bob, models.CreateOrderRequest{Items: items})
+
+	var list struct {
+		Orders []models.Order `json:"orders"`
+		Total  int            `json:"total"`
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/orders", alice, nil, &list)
+	if list.Total != 2 || len(list.Orders) != 2 || list.Orders[0].ID != second.ID || list.Orders[1].ID != first.ID {
+		t.Errorf("GET /orders = %d orders (total %d), want alice's two orders newest first", len(list.Orders), list.Total)
+	}
+
+	var got models.Order
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/orders/%d", first.ID), alice, nil, &got)
+	if got.ID != first.ID || len(got.Items) != 1 {
+		t.Errorf("GET /orders/%d = %+v", first.ID, got)
+	}
+	// 别人的订单与不存在的订单一样返回 404
+	s.expect(http.StatusNotFound, "GET", fmt.Sprintf("/api/v1/orders/%d", bobs.ID), alice, nil, nil)
+	s.expect(http.StatusNotFound, "GET", "/api/v1/orders/999", alice, nil, nil)
+	s.expect(http.StatusNotFound, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", bobs.ID), alice, nil, nil)
+
+	var all struct {
+		Orders []models.Order `json:"orders"`
+		Total  int            `json:"total"`
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/admin/orders", 0, nil, &all)
+	if all.Total != 3 {
+		t.Errorf("GET /admin/orders total = %d, want 3", all.Total)
+	}
+}
+
+func TestOrderStatusChanges(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	items := []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}
+
+	order := s.order(alice, models.CreateOrderRequest{Items: items})
+	for _, status := range []string{models.OrderStatusConfirmed, models.OrderStatusPreparing, models.OrderStatusReady, models.OrderStatusCompleted} {
+		s.setStatus(order.ID, status)
+	}
+	var history []models.OrderStatusChange
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/admin/orders/%d/history", order.ID), 0, nil, &history)
+	if len(history) != 5 {
+		t.Errorf("history has %d entries, want 5", len(history))
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		want   int
+	}{
+		{"completed order cannot be cancelled", models.OrderStatusCancelled, http.StatusConflict},
+		{"unknown status", "lost", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("PUT", fmt.Sprintf("/api/v1/admin/orders/%d/status", order.ID), 1,
+				models.UpdateOrderStatusRequest{Status: tt.status})
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// 用户只能取消待确认或已确认的订单
+	cancelled := s.order(alice, models.CreateOrderRequest{Items: items})
+	var got models.Order
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", cancelled.ID), alice,
+		models.CancelOrderRequest{Reason: "不想要了"}, &got)
+	if got.Status != models.OrderStatusCancelled {
+		t.Errorf("cancelled order status = %s", got.Status)
+	}
+	s.expect(http.StatusConflict, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", order.ID), alice, nil, nil)
+	s.expect(http.StatusNotFound, "PUT", "/api/v1/admin/orders/999/status", 1,
+		models.UpdateOrderStatusRequest{Status: models.OrderStatusConfirmed}, nil)
+}
+
+func TestFavorites(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	bob := s.user("bob")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	greens := s.dish("清炒时蔬", mains, "18.50")
+
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/favorites/%d", pork.ID), alice, nil, nil)
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/favorites/%d", greens.ID), alice, nil, nil)
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/favorites/%d", pork.ID), bob, nil, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"duplicate", "POST", fmt.Sprintf("/api/v1/favorites/%d", pork.ID), http.StatusConflict},
+		{"unknown dish", "POST", "/api/v1/favorites/999", http.StatusNotFound},
+		{"invalid dish ID", "POST", "/api/v1/favorites/abc", http.StatusBadRequest},
+		{"remove missing", "DELETE", "/api/v1/favorites/999", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := s.do(tt.method, tt.path, alice, nil); w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+
+	var list struct {
+		Favorites []models.UserFavorite `json:"favorites"`
+		Total     int                   `json:"total"`
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/favorites", alice, nil, &list)
+	if list.Total != 2 || len(list.Favorites) != 2 || list.Favorites[0].Dish == nil || list.Favorites[0].Dish.ID != greens.ID {
+		t.Fatalf("GET /favorites = %+v, want greens then pork", list)
+	}
+
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/favorites/%d", greens.ID), alice, nil, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/favorites", alice, nil, &list)
+	if list.Total != 1 || list.Favorites[0].DishID != pork.ID {
+		t.Errorf("after remove GET /favorites = %+v, want only pork", list)
+	}
+
+	// 下架的菜品不出现在收藏中
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", pork.ID), 0, nil, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/favorites", bob, nil, &list)
+	if list.Total != 0 {
+		t.Errorf("favorites of an inactive dish: total = %d, want 0", list.Total)
+	}
+}
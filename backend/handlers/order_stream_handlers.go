@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"food-ordering/events"
+	"food-ordering/middleware"
+	"food-ordering/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// SSE 断线后客户端的重连间隔（毫秒）
+const sseRetryMillis = 3000
+
+// publishOrderEvent 发布订单事件，推送失败不影响订单操作本身
+func (h *Handler) publishOrderEvent(c *gin.Context, eventType string, order *models.Order) {
+	err := h.events.Publish(c.Request.Context(), events.Event{
+		Type:    eventType,
+		OrderID: order.ID,
+		UserID:  order.UserID,
+		Status:  order.Status,
+		Order:   order,
+	})
+	if err != nil {
+		log.Printf("Failed to publish %s event for order %d: %v", eventType, order.ID, err)
+	}
+}
+
+// subscribeOrderEvents 按当前用户订阅订单事件：有 orders:read 权限时接收所有订单的事件，否则只接收自己订单的事件
+// ?status= 按逗号分隔的状态进一步过滤，Last-Event-ID 请求头或 ?last_event_id= 用于断线续传
+func (h *Handler) subscribeOrderEvents(c *gin.Context) (*events.Subscription, []events.Event, bool) {
+	statuses := map[string]bool{}
+	if value := c.Query("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if !models.IsOrderStatus(status) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order status"})
+				return nil, nil, false
+			}
+			statuses[status] = true
+		}
+	}
+
+	allOrders := middleware.HasPermission(c, "orders:read")
+	userID := c.GetInt("user_id")
+	match := func(e events.Event) bool {
+		if !allOrders && e.UserID != userID {
+			return false
+		}
+		return len(statuses) == 0 || statuses[e.Status]
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	afterID, _ := strconv.ParseInt(lastEventID, 10, 64)
+
+	sub, backlog, err := h.events.Subscribe(c.Request.Context(), afterID, match)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe to order events"})
+		return nil, nil, false
+	}
+	return sub, backlog, true
+}
+
+// 订单事件流（Server-Sent Events），事件类型为 order.created 和 order.status_changed
+func (h *Handler) StreamOrderEvents(c *gin.Context) {
+	sub, backlog, ok := h.subscribeOrderEvents(c)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // 禁止 nginx 缓冲
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+
+	write := func(e events.Event) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		return err
+	}
+
+	replayed := make(map[int64]bool, len(backlog))
+	for _, e := range backlog {
+		if err := write(e); err != nil {
+			return
+		}
+		replayed[e.ID] = true
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(h.cfg.OrderStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			// 订阅被关闭说明客户端处理太慢，断开后由客户端带着 Last-Event-ID 重连
+			if !ok {
+				return
+			}
+			if replayed[e.ID] {
+				continue
+			}
+			if err := write(e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		w.Flush()
+	}
+}
+
+// 订单事件流（WebSocket），每条消息是一个 JSON 格式的事件，续传使用 ?last_event_id=
+func (h *Handler) OrderEventsWebSocket(c *gin.Context) {
+	sub, backlog, ok := h.subscribeOrderEvents(c)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	upgrader := websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrade 已经写入了错误响应
+	}
+	defer conn.Close()
+
+	// 读协程处理 pong 和关闭帧，连接断开或对端超时未响应心跳时结束整个连接
+	heartbeat := h.cfg.OrderStreamHeartbeat
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(e events.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(heartbeat))
+		return conn.WriteJSON(e)
+	}
+
+	replayed := make(map[int64]bool, len(backlog))
+	for _, e := range backlog {
+		if err := write(e); err != nil {
+			return
+		}
+		replayed[e.ID] = true
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber too slow"), time.Now().Add(time.Second))
+				return
+			}
+			if replayed[e.ID] {
+				continue
+			}
+			if err := write(e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(heartbeat)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// checkOrigin 只允许配置的前端来源发起 WebSocket 连接，没有 Origin 的非浏览器客户端不受限制
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range h.cfg.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSpace(allowed), origin) {
+			return true
+		}
+	}
+	return false
+}
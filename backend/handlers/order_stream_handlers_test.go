@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"food-ordering/events"
+	"food-ordering/models"
+)
+
+// eventStream 一个 SSE 连接
+type eventStream struct {
+	t      *testing.T
+	events chan events.Event
+	cancel context.CancelFunc
+}
+
+// stream 以 userID 的身份连接 path 上的订单事件流，lastEventID 非空时带上 Last-Event-ID
+func stream(t *testing.T, server *httptest.Server, path string, userID int, lastEventID string) *eventStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(testUserHeader, strconv.Itoa(userID))
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	// 响应头到达时订阅已经建立
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		cancel()
+		t.Fatalf("GET %s: status = %d, content type = %q", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	s := &eventStream{t: t, events: make(chan events.Event, 16), cancel: cancel}
+	go func() {
+		defer resp.Body.Close()
+		defer close(s.events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var e events.Event
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				t.Errorf("invalid event %q: %v", data, err)
+				return
+			}
+			s.events <- e
+		}
+	}()
+	t.Cleanup(cancel)
+	return s
+}
+
+// next 等待下一个事件
+func (s *eventStream) next() events.Event {
+	s.t.Helper()
+	select {
+	case e, ok := <-s.events:
+		if !ok {
+			s.t.Fatal("event stream closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("timed out waiting for an event")
+	}
+	return events.Event{}
+}
+
+// none 确认短时间内没有更多事件
+func (s *eventStream) none() {
+	s.t.Helper()
+	select {
+	case e := <-s.events:
+		s.t.Errorf("unexpected event %d %s for order %d of user %d", e.ID, e.Type, e.OrderID, e.UserID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestOrderEventStream(t *testing.T) {
+	s := newTestServer(t)
+	// 先注册的清理后执行：流的连接断开之后再关闭服务器
+	server := httptest.NewServer(s.router)
+	t.Cleanup(server.Close)
+	alice, bob := s.user("alice"), s.user("bob")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	items := []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}
+
+	aliceStream := stream(t, server, "/api/v1/orders/stream", alice, "")
+	kitchen := stream(t, server, "/api/v1/admin/orders/stream", 1, "")
+
+	bobOrder := s.order(bob, models.CreateOrderRequest{Items: items})
+	aliceOrder := s.order(alice, models.CreateOrderRequest{Items: items})
+	s.setStatus(bobOrder.ID, models.OrderStatusConfirmed)
+	s.setStatus(aliceOrder.ID, models.OrderStatusConfirmed)
+
+	// 顾客只收到自己订单的事件
+	for _, want := range []string{events.OrderCreated, events.OrderStatusChanged} {
+		e := aliceStream.next()
+		if e.Type != want || e.OrderID != aliceOrder.ID || e.UserID != alice || e.Order == nil || e.Order.UserID != alice {
+			t.Errorf("alice received %s for order %d of user %d, want %s for order %d", e.Type, e.OrderID, e.UserID, want, aliceOrder.ID)
+		}
+	}
+	aliceStream.none()
+
+	// 有 orders:read 权限时收到所有订单的事件
+	var kitchenIDs []string
+	var lastID int64
+	for i := 0; i < 4; i++ {
+		e := kitchen.next()
+		kitchenIDs = append(kitchenIDs, fmt.Sprintf("%s %d", e.Type, e.OrderID))
+		lastID = e.ID
+	}
+	want := fmt.Sprintf("[%s %d %s %d %s %d %s %d]", events.OrderCreated, bobOrder.ID, events.OrderCreated, aliceOrder.ID,
+		events.OrderStatusChanged, bobOrder.ID, events.OrderStatusChanged, aliceOrder.ID)
+	if fmt.Sprint(kitchenIDs) != want {
+		t.Errorf("kitchen received %v, want %s", kitchenIDs, want)
+	}
+	kitchen.none()
+	if lastID != 4 {
+		t.Fatalf("last event ID = %d, want 4", lastID)
+	}
+
+	// 断线续传只补发自己订单的事件
+	aliceStream.cancel()
+	s.order(bob, models.CreateOrderRequest{Items: items})
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", aliceOrder.ID), alice, nil, nil)
+	resumed := stream(t, server, "/api/v1/orders/stream", alice, "1")
+	for _, want := range []string{events.OrderCreated, events.OrderStatusChanged, events.OrderStatusChanged} {
+		e := resumed.next()
+		if e.Type != want || e.UserID != alice || e.ID <= 1 {
+			t.Errorf("alice replayed event %d %s of user %d, want %s", e.ID, e.Type, e.UserID, want)
+		}
+	}
+	resumed.none()
+
+	// 另一位顾客续传时看不到 alice 的事件
+	bobStream := stream(t, server, "/api/v1/orders/stream?status=pending", bob, "1")
+	e := bobStream.next()
+	if e.Type != events.OrderCreated || e.UserID != bob || e.ID != 5 {
+		t.Errorf("bob replayed event %d %s of user %d, want his second order", e.ID, e.Type, e.UserID)
+	}
+	bobStream.none()
+
+	if w := s.do("GET", "/api/v1/orders/stream?status=eaten", alice, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid status filter: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"food-ordering/events"
+	"food-ordering/models"
+	"food-ordering/money"
+	"food-ordering/payment"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBody 支付回调请求体的上限
+const maxWebhookBody = 64 << 10
+
+// 回调事件对应的支付状态
+var webhookPaymentStatus = map[string]string{
+	payment.EventAuthorized: models.PaymentStatusAuthorized,
+	payment.EventCaptured:   models.PaymentStatusCaptured,
+	payment.EventFailed:     models.PaymentStatusFailed,
+	payment.EventCancelled:  models.PaymentStatusCancelled,
+}
+
+// paymentError 支付处理失败，status 和 message 直接返回给客户端
+type paymentError struct {
+	status  int
+	message string
+}
+
+func (e *paymentError) Error() string {
+	return e.message
+}
+
+// providerError 记录支付渠道返回的错误，渠道拒绝操作时返回 409，其他错误视为渠道不可用
+func providerError(op string, err error) error {
+	log.Printf("Payment provider %s failed: %v", op, err)
+	if errors.Is(err, payment.ErrIntentState) || errors.Is(err, payment.ErrIntentNotFound) {
+		return &paymentError{http.StatusConflict, "Payment provider rejected the " + op}
+	}
+	return &paymentError{http.StatusBadGateway, "Payment provider unavailable"}
+}
+
+// 为自己的待确认订单发起支付，已有进行中的支付时直接返回该支付
+func (h *Handler) CreatePayment(c *gin.Context) {
+	if h.payments == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payments are not enabled"})
+		return
+	}
+	order, ok := h.ownOrder(c)
+	if !ok {
+		return
+	}
+	if order.Status != models.OrderStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending orders can be paid"})
+		return
+	}
+	if !order.TotalAmount.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order does not require payment"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	latest, err := h.store.Payments.Latest(ctx, order.ID)
+	if err != nil && err != store.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment"})
+		return
+	}
+	if err == nil {
+		switch latest.Status {
+		case models.PaymentStatusPending:
+			c.JSON(http.StatusOK, latest)
+			return
+		case models.PaymentStatusFailed, models.PaymentStatusCancelled:
+			// 上一次支付失败或已撤销，重新发起
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": "Order has already been paid"})
+			return
+		}
+	}
+
+	intent, err := h.payments.CreateIntent(ctx, payment.IntentRequest{
+		OrderID:     order.ID,
+		Amount:      order.TotalAmount,
+		Description: fmt.Sprintf("Order #%d", order.ID),
+	})
+	if err != nil {
+		respondPaymentError(c, providerError("payment", err), "Failed to create payment")
+		return
+	}
+	created, err := h.store.Payments.Create(ctx, models.Payment{
+		OrderID:      order.ID,
+		Provider:     h.payments.Name(),
+		IntentID:     intent.ID,
+		ClientSecret: intent.ClientSecret,
+		Amount:       order.TotalAmount,
+	})
+	if err != nil {
+		// 并发发起的另一笔支付已经保存，撤销多余的支付意图
+		if err := h.payments.Cancel(ctx, intent.ID); err != nil {
+			log.Printf("Failed to cancel unused payment intent %s: %v", intent.ID, err)
+		}
+		if err == store.ErrConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order already has a payment in progress"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		return
+	}
+
+	h.publishPaymentEvent(c, order.ID)
+	c.JSON(http.StatusCreated, created)
+}
+
+// 获取自己订单最近一次支付
+func (h *Handler) GetPayment(c *gin.Context) {
+	order, ok := h.ownOrder(c)
+	if !ok {
+		return
+	}
+	h.respondLatestPayment(c, order.ID, true)
+}
+
+// 获取订单最近一次支付（管理员/厨师）
+func (h *Handler) GetAdminPayment(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	h.respondLatestPayment(c, orderID, false)
+}
+
+// respondLatestPayment withSecret 为 false 时不返回 client_secret，它只应交给下单用户
+func (h *Handler) respondLatestPayment(c *gin.Context, orderID int, withSecret bool) {
+	latest, err := h.store.Payments.Latest(c.Request.Context(), orderID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment"})
+		return
+	}
+	if !withSecret {
+		latest.ClientSecret = ""
+	}
+	c.JSON(http.StatusOK, latest)
+}
+
+// 为已扣款的订单退款，不填金额时退还全部剩余金额
+func (h *Handler) RefundPayment(c *gin.Context) {
+	if h.payments == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payments are not enabled"})
+		return
+	}
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	// 请求体可以为空
+	var req models.RefundPaymentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	latest, err := h.store.Payments.Latest(ctx, orderID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment"})
+		return
+	}
+	if latest.Status != models.PaymentStatusCaptured && latest.Status != models.PaymentStatusPartiallyRefunded {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only captured payments can be refunded"})
+		return
+	}
+
+	remaining := latest.Amount.Sub(latest.RefundedAmount)
+	amount := remaining
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	if !amount.IsPositive() || amount.Cmp(remaining) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Refund amount must be positive and at most %s", remaining)})
+		return
+	}
+
+	refunded, err := h.refundPayment(ctx, latest, amount, req.Reason, c.GetInt("user_id"))
+	if err != nil {
+		respondPaymentError(c, err, "Failed to refund payment")
+		return
+	}
+
+	h.publishPaymentEvent(c, orderID)
+	refunded.ClientSecret = ""
+	c.JSON(http.StatusOK, refunded)
+}
+
+// 支付渠道的回调，按签名校验来源；重复或过期的事件直接忽略，返回 2xx 避免渠道重试
+func (h *Handler) PaymentWebhook(c *gin.Context) {
+	if h.payments == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payments are not enabled"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	event, err := h.payments.ParseWebhook(c.Request.Header, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook signature"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	provider := h.payments.Name()
+	current, err := h.store.Payments.GetByIntent(ctx, provider, event.IntentID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			log.Printf("Ignoring %s event %s for unknown payment intent %s", provider, event.ID, event.IntentID)
+			c.JSON(http.StatusOK, gin.H{"message": "Event ignored"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment"})
+		return
+	}
+
+	var updated *models.Payment
+	to, known := webhookPaymentStatus[event.Type]
+	switch {
+	case !known:
+		log.Printf("Ignoring %s event %s of unknown type %s", provider, event.ID, event.Type)
+	case event.Amount.Amount != current.Amount.Amount:
+		log.Printf("Ignoring %s event %s: amount %s does not match payment %d amount %s",
+			provider, event.ID, event.Amount, current.ID, current.Amount)
+	default:
+		updated, err = h.store.Payments.Transition(ctx, current.ID, to)
+		var invalid *store.PaymentTransitionError
+		if errors.As(err, &invalid) {
+			// 重复回调或回调晚于接单、取消时的扣款和撤销
+			log.Printf("Ignoring %s event %s: %v", provider, event.ID, invalid)
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment"})
+			return
+		}
+	}
+
+	err = h.store.Payments.RecordEvent(ctx, models.PaymentEvent{
+		Provider: provider,
+		EventID:  event.ID,
+		Type:     event.Type,
+		IntentID: event.IntentID,
+		Payload:  body,
+	})
+	if err != nil && err != store.ErrConflict {
+		log.Printf("Failed to record %s event %s: %v", provider, event.ID, err)
+	}
+
+	if updated != nil {
+		h.releaseCancelledOrderPayment(ctx, updated)
+		h.publishPaymentEvent(c, updated.OrderID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Event processed"})
+}
+
+// releaseCancelledOrderPayment 顾客在订单取消后才完成支付时撤销授权，资金退回顾客
+func (h *Handler) releaseCancelledOrderPayment(ctx context.Context, p *models.Payment) {
+	if p.Status != models.PaymentStatusAuthorized {
+		return
+	}
+	order, err := h.store.Orders.Get(ctx, p.OrderID)
+	if err != nil || order.Status != models.OrderStatusCancelled {
+		return
+	}
+	if err := h.payments.Cancel(ctx, p.IntentID); err != nil {
+		log.Printf("Failed to cancel payment %d of cancelled order %d: %v", p.ID, p.OrderID, err)
+		return
+	}
+	if _, err := h.store.Payments.Transition(ctx, p.ID, models.PaymentStatusCancelled); err != nil {
+		log.Printf("Failed to mark payment %d as cancelled: %v", p.ID, err)
+	}
+}
+
+// 模拟顾客在支付渠道完成支付，仅内置的 fake 渠道可用；结果通过回调更新支付状态
+func (h *Handler) FakePay(c *gin.Context) {
+	fake, ok := h.payments.(*payment.Fake)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fake payment provider is not enabled"})
+		return
+	}
+
+	var req models.FakePayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := fake.Pay(c.Request.Context(), req.ClientSecret, req.Outcome != "fail")
+	switch {
+	case errors.Is(err, payment.ErrIntentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	case errors.Is(err, payment.ErrIntentState):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment can no longer be paid"})
+		return
+	case err != nil:
+		log.Printf("Fake payment webhook failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to deliver payment webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, event)
+}
+
+// settlePayment 在订单状态变更前处理支付：接单时扣款，未支付的订单不能接单；
+// 取消时撤销未扣款的支付，已扣款的退还剩余金额。未启用支付时不做任何处理
+func (h *Handler) settlePayment(ctx context.Context, change store.StatusChange) error {
+	if h.payments == nil || change.To != models.OrderStatusConfirmed && change.To != models.OrderStatusCancelled {
+		return nil
+	}
+	order, err := h.store.Orders.Get(ctx, change.OrderID)
+	if err != nil {
+		return err
+	}
+	if change.OwnerID != 0 && order.UserID != change.OwnerID {
+		return store.ErrNotFound
+	}
+	// 先校验订单能否流转，避免扣款或退款后订单状态却改不了
+	if err := store.CheckTransition(order.Status, change); err != nil {
+		return err
+	}
+
+	current, err := h.store.Payments.Latest(ctx, order.ID)
+	if err == store.ErrNotFound {
+		current = nil
+	} else if err != nil {
+		return err
+	}
+
+	if change.To == models.OrderStatusConfirmed {
+		// 优惠后金额恰好为 0 的订单无需支付，金额为负说明订单数据有误，不能接单
+		if order.TotalAmount.IsNegative() {
+			return &paymentError{http.StatusConflict, "Order total cannot be negative"}
+		}
+		if order.TotalAmount.IsZero() && order.DiscountAmount.IsPositive() {
+			return nil
+		}
+		if current == nil {
+			return &paymentError{http.StatusConflict, "Order has not been paid"}
+		}
+		switch current.Status {
+		case models.PaymentStatusCaptured:
+			return nil
+		case models.PaymentStatusAuthorized:
+			if err := h.payments.Capture(ctx, current.IntentID); err != nil {
+				return providerError("capture", err)
+			}
+			_, err := h.store.Payments.Transition(ctx, current.ID, models.PaymentStatusCaptured)
+			return err
+		}
+		return &paymentError{http.StatusConflict, "Order has not been paid"}
+	}
+
+	if current == nil {
+		return nil
+	}
+	switch current.Status {
+	case models.PaymentStatusPending, models.PaymentStatusAuthorized:
+		if err := h.payments.Cancel(ctx, current.IntentID); err != nil {
+			return providerError("cancellation", err)
+		}
+		_, err := h.store.Payments.Transition(ctx, current.ID, models.PaymentStatusCancelled)
+		return err
+	case models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded:
+		remaining := current.Amount.Sub(current.RefundedAmount)
+		_, err := h.refundPayment(ctx, current, remaining, "Order cancelled", change.ChangedBy)
+		return err
+	}
+	return nil
+}
+
+// refundPayment 先在支付渠道退款再记录，refundedBy 为 0 表示系统操作
+func (h *Handler) refundPayment(ctx context.Context, p *models.Payment, amount money.Money, reason string, refundedBy int) (*models.Payment, error) {
+	refundID, err := h.payments.Refund(ctx, p.IntentID, amount)
+	if err != nil {
+		return nil, providerError("refund", err)
+	}
+	refund := models.PaymentRefund{ProviderRefundID: refundID, Amount: amount, Reason: reason}
+	if refundedBy != 0 {
+		refund.CreatedBy = &refundedBy
+	}
+	refunded, err := h.store.Payments.Refund(ctx, p.ID, refund)
+	if err != nil {
+		// 渠道已经退款，记录失败时需要人工对账
+		log.Printf("Refund %s of payment %d succeeded at provider but was not recorded: %v", refundID, p.ID, err)
+		return nil, err
+	}
+	return refunded, nil
+}
+
+// respondPaymentError 返回支付处理的错误，无法识别的错误按 fallback 返回 500
+func respondPaymentError(c *gin.Context, err error, fallback string) {
+	var failed *paymentError
+	var invalid *store.PaymentTransitionError
+	switch {
+	case errors.As(err, &failed):
+		c.JSON(failed.status, gin.H{"error": failed.message})
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusConflict, gin.H{"error": invalid.Error()})
+	case err == store.ErrConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment was changed concurrently, please retry"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// publishPaymentEvent 支付状态变化后推送订单的最新快照
+func (h *Handler) publishPaymentEvent(c *gin.Context, orderID int) {
+	order, err := h.store.Orders.Get(c.Request.Context(), orderID)
+	if err != nil {
+		log.Printf("Failed to load order %d for payment event: %v", orderID, err)
+		return
+	}
+	h.publishOrderEvent(c, events.OrderPaymentChanged, order)
+}
+
+// ownOrder 读取路径中的订单，别人的订单与不存在的订单返回相同的结果；失败时已写入响应
+func (h *Handler) ownOrder(c *gin.Context) (*models.Order, bool) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return nil, false
+	}
+	order, err := h.store.Orders.Get(c.Request.Context(), orderID)
+	if err != nil && err != store.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+		return nil, false
+	}
+	if err == store.ErrNotFound || order.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return nil, false
+	}
+	return order, true
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/payment"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// enablePayments 启用模拟支付渠道，回调经本地 HTTP 服务发回测试路由
+func (s *testServer) enablePayments() {
+	s.t.Helper()
+
+	server := httptest.NewServer(s.router)
+	s.t.Cleanup(server.Close)
+	s.handler.payments = payment.NewFake(testWebhookSecret, server.URL+"/api/v1/payments/webhook")
+}
+
+// pay 为订单发起支付并以 outcome 模拟顾客支付，返回支付后的状态
+func (s *testServer) pay(userID, orderID int, outcome string) models.Payment {
+	s.t.Helper()
+
+	var created models.Payment
+	s.expect(http.StatusCreated, "POST", fmt.Sprintf("/api/v1/orders/%d/pay", orderID), userID, nil, &created)
+	s.expect(http.StatusOK, "POST", "/api/v1/payments/fake/pay", 0,
+		models.FakePayRequest{ClientSecret: created.ClientSecret, Outcome: outcome}, nil)
+	return s.payment(userID, orderID)
+}
+
+// payment 获取订单最近一次支付
+func (s *testServer) payment(userID, orderID int) models.Payment {
+	s.t.Helper()
+
+	var latest models.Payment
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/orders/%d/payment", orderID), userID, nil, &latest)
+	return latest
+}
+
+// webhook 以 secret 签名并发送支付回调
+func (s *testServer) webhook(secret string, event payment.Event) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/api/v1/payments/webhook", bytes.NewReader(body))
+	req.Header.Set(payment.FakeSignatureHeader, payment.Sign(secret, body, time.Now()))
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPaymentsDisabled(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	order := s.order(alice, models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}})
+
+	s.expect(http.StatusNotFound, "POST", fmt.Sprintf("/api/v1/orders/%d/pay", order.ID), alice, nil, nil)
+	s.expect(http.StatusNotFound, "POST", "/api/v1/payments/fake/pay", 0, models.FakePayRequest{ClientSecret: "x"}, nil)
+	s.expect(http.StatusNotFound, "POST", "/api/v1/payments/webhook", 0, payment.Event{}, nil)
+	// 未启用支付时不检查是否已支付
+	s.setStatus(order.ID, models.OrderStatusConfirmed)
+}
+
+func TestPaymentLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.enablePayments()
+	alice := s.user("alice")
+	bob := s.user("bob")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	items := []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}
+	order := s.order(alice, models.CreateOrderRequest{Items: items})
+	path := fmt.Sprintf("/api/v1/admin/orders/%d/status", order.ID)
+
+	w := s.do("PUT", path, 1, models.UpdateOrderStatusRequest{Status: models.OrderStatusConfirmed})
+	if w.Code != http.StatusConflict || errorMessage(w) != "Order has not been paid" {
+		t.Fatalf("confirming an unpaid order: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+
+	// 进行中的支付重复发起时返回同一笔支付
+	var created, again models.Payment
+	s.expect(http.StatusCreated, "POST", fmt.Sprintf("/api/v1/orders/%d/pay", order.ID), alice, nil, &created)
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/pay", order.ID), alice, nil, &again)
+	if created.Status != models.PaymentStatusPending || created.Amount.String() != "38.00" || created.ClientSecret == "" || again.ID != created.ID {
+		t.Errorf("created payment = %+v, again = %+v", created, again)
+	}
+	s.expect(http.StatusNotFound, "POST", fmt.Sprintf("/api/v1/orders/%d/pay", order.ID), bob, nil, nil)
+	s.expect(http.StatusNotFound, "GET", fmt.Sprintf("/api/v1/orders/%d/payment", order.ID), bob, nil, nil)
+
+	// 支付失败后可以重新发起
+	s.expect(http.StatusOK, "POST", "/api/v1/payments/fake/pay", 0,
+		models.FakePayRequest{ClientSecret: created.ClientSecret, Outcome: "fail"}, nil)
+	if got := s.payment(alice, order.ID); got.Status != models.PaymentStatusFailed {
+		t.Fatalf("payment after failed attempt = %s, want failed", got.Status)
+	}
+	paid := s.pay(alice, order.ID, "succeed")
+	if paid.Status != models.PaymentStatusAuthorized || paid.ID == created.ID {
+		t.Fatalf("second payment = %+v, want a new authorized payment", paid)
+	}
+	s.expect(http.StatusConflict, "POST", "/api/v1/payments/fake/pay", 0, models.FakePayRequest{ClientSecret: paid.ClientSecret}, nil)
+	s.expect(http.StatusNotFound, "POST", "/api/v1/payments/fake/pay", 0, models.FakePayRequest{ClientSecret: "nope"}, nil)
+	s.expect(http.StatusConflict, "POST", fmt.Sprintf("/api/v1/orders/%d/pay", order.ID), alice, nil, nil)
+
+	// 接单时扣款，管理员看不到 client_secret
+	s.setStatus(order.ID, models.OrderStatusConfirmed)
+	var admin models.Payment
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/admin/orders/%d/payment", order.ID), 1, nil, &admin)
+	if admin.Status != models.PaymentStatusCaptured || admin.ClientSecret != "" {
+		t.Errorf("admin payment = %+v, want captured without client secret", admin)
+	}
+
+	refund := func(amount string) *httptest.ResponseRecorder {
+		req := models.RefundPaymentRequest{Reason: "少送一份"}
+		if amount != "" {
+			m := mustMoney(t, amount)
+			req.Amount = &m
+		}
+		return s.do("POST", fmt.Sprintf("/api/v1/admin/orders/%d/refund", order.ID), 1, req)
+	}
+	var refunded models.Payment
+	w = refund("10.00")
+	if w.Code != http.StatusOK {
+		t.Fatalf("partial refund: status = %d; body: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &refunded)
+	if refunded.Status != models.PaymentStatusPartiallyRefunded || refunded.RefundedAmount.String() != "10.00" {
+		t.Errorf("after partial refund = %s %s, want partially_refunded 10.00", refunded.Status, refunded.RefundedAmount)
+	}
+	for _, amount := range []string{"28.01", "0", "-1"} {
+		if w := refund(amount); w.Code != http.StatusBadRequest || errorMessage(w) != "Refund amount must be positive and at most 28.00" {
+			t.Errorf("refund %s: status = %d, error = %q", amount, w.Code, errorMessage(w))
+		}
+	}
+
+	// 取消已扣款的订单时退还剩余金额
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", order.ID), alice, nil, nil)
+	refunded = s.payment(alice, order.ID)
+	if refunded.Status != models.PaymentStatusRefunded || refunded.RefundedAmount.String() != "38.00" || len(refunded.Refunds) != 2 {
+		t.Errorf("after cancellation payment = %s refunded %s in %d refunds, want refunded 38.00 in 2",
+			refunded.Status, refunded.RefundedAmount, len(refunded.Refunds))
+	}
+	if w := refund(""); w.Code != http.StatusConflict {
+		t.Errorf("refunding a fully refunded payment: status = %d, want 409", w.Code)
+	}
+
+	// 取消未扣款的订单时撤销支付
+	second := s.order(alice, models.CreateOrderRequest{Items: items})
+	s.pay(alice, second.ID, "succeed")
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", second.ID), alice, nil, nil)
+	if got := s.payment(alice, second.ID); got.Status != models.PaymentStatusCancelled {
+		t.Errorf("payment of a cancelled order = %s, want cancelled", got.Status)
+	}
+	s.expect(http.StatusConflict, "POST", fmt.Sprintf("/api/v1/orders/%d/pay", second.ID), alice, nil, nil)
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	s := newTestServer(t)
+	s.enablePayments()
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	order := s.order(alice, models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}})
+
+	var created models.Payment
+	s.expect(http.StatusCreated, "POST", fmt.Sprintf("/api/v1/orders/%d/pay", order.ID), alice, nil, &created)
+	event := func(id, eventType, amount string) payment.Event {
+		return payment.Event{ID: id, Type: eventType, IntentID: created.IntentID, Amount: mustMoney(t, amount), CreatedAt: time.Now()}
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		event  payment.Event
+		code   int
+		want   string // 回调后的支付状态
+	}{
+		{"wrong signature", "other", event("evt_1", payment.EventAuthorized, "38.00"), http.StatusBadRequest, models.PaymentStatusPending},
+		{"amount mismatch", testWebhookSecret, event("evt_2", payment.EventAuthorized, "1.00"), http.StatusOK, models.PaymentStatusPending},
+		{"unknown type", testWebhookSecret, event("evt_3", "payment.disputed", "38.00"), http.StatusOK, models.PaymentStatusPending},
+		{"unknown intent", testWebhookSecret, payment.Event{ID: "evt_4", Type: payment.EventAuthorized, IntentID: "pi_nope"}, http.StatusOK, models.PaymentStatusPending},
+		{"authorized", testWebhookSecret, event("evt_5", payment.EventAuthorized, "38.00"), http.StatusOK, models.PaymentStatusAuthorized},
+		{"duplicate is ignored", testWebhookSecret, event("evt_5", payment.EventAuthorized, "38.00"), http.StatusOK, models.PaymentStatusAuthorized},
+		{"failure after authorization is ignored", testWebhookSecret, event("evt_6", payment.EventFailed, "38.00"), http.StatusOK, models.PaymentStatusAuthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := s.webhook(tt.secret, tt.event); w.Code != tt.code {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.code, w.Body.String())
+			}
+			if got := s.payment(alice, order.ID); got.Status != tt.want {
+				t.Errorf("payment status = %s, want %s", got.Status, tt.want)
+			}
+		})
+	}
+
+	var got models.Order
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/orders/%d", order.ID), alice, nil, &got)
+	if got.PaymentStatus != models.PaymentStatusAuthorized {
+		t.Errorf("order payment_status = %q, want authorized", got.PaymentStatus)
+	}
+}
+
+func TestFullyDiscountedOrderSkipsPayment(t *testing.T) {
+	s := newTestServer(t)
+	s.enablePayments()
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	s.promotion(models.PromotionRequest{Name: "免单", Code: "FREE", Type: models.PromotionPercentage, PercentOff: 100})
+
+	order := s.order(alice, models.CreateOrderRequest{
+		Items: []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}, CouponCode: "FREE",
+	})
+	if !order.TotalAmount.IsZero() || order.DiscountAmount.String() != "38.00" {
+		t.Fatalf("order total = %s discount = %s, want 0.00 and 38.00", order.TotalAmount, order.DiscountAmount)
+	}
+	w := s.do("POST", fmt.Sprintf("/api/v1/orders/%d/pay", order.ID), alice, nil)
+	if w.Code != http.StatusBadRequest || errorMessage(w) != "Order does not require payment" {
+		t.Errorf("paying a free order: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+	s.setStatus(order.ID, models.OrderStatusConfirmed)
+	s.expect(http.StatusNotFound, "GET", fmt.Sprintf("/api/v1/orders/%d/payment", order.ID), alice, nil, nil)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"food-ordering/models"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// normalizeCouponCode 优惠券代码不区分大小写，统一保存为大写
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// bindPromotion 解析并校验优惠请求，失败时已写入 400 响应
+func (h *Handler) bindPromotion(c *gin.Context) (models.PromotionRequest, bool) {
+	var req models.PromotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	req.Code = normalizeCouponCode(req.Code)
+
+	message, err := h.validatePromotion(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate promotion"})
+		return req, false
+	}
+	if message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return req, false
+	}
+	return req, true
+}
+
+// validatePromotion 返回请求不合法的原因，合法时返回空字符串
+func (h *Handler) validatePromotion(ctx context.Context, req models.PromotionRequest) (string, error) {
+	switch req.Type {
+	case models.PromotionPercentage:
+		if req.PercentOff < 1 || req.PercentOff > 100 {
+			return "percent_off must be between 1 and 100", nil
+		}
+	case models.PromotionFixedAmount:
+		if !req.AmountOff.IsPositive() {
+			return "amount_off must be greater than 0", nil
+		}
+	case models.PromotionBuyNGetOne:
+		if req.BuyQuantity < 1 {
+			return "buy_quantity must be at least 1", nil
+		}
+	default:
+		return "Invalid promotion type", nil
+	}
+
+	if len(req.Code) > 50 {
+		return "Coupon code must be at most 50 characters", nil
+	}
+	if req.MinSpend.IsNegative() {
+		return "min_spend must not be negative", nil
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return "ends_at must be after starts_at", nil
+	}
+	if req.DishID != nil && req.CategoryID != nil {
+		return "Only one of dish_id and category_id can be set", nil
+	}
+
+	if req.DishID != nil {
+		if _, err := h.store.Dishes.Get(ctx, *req.DishID); err == store.ErrNotFound {
+			return "Invalid dish ID", nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	if req.CategoryID != nil {
+		exists, err := h.store.Categories.Exists(ctx, *req.CategoryID)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "Invalid category ID", nil
+		}
+	}
+	return "", nil
+}
+
+// 获取优惠列表（管理员）
+func (h *Handler) GetPromotions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	offset := (page - 1) * limit
+
+	promotions, total, err := h.store.Promotions.List(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promotions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"promotions": promotions,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+// 获取优惠详情（管理员）
+func (h *Handler) GetPromotion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	promotion, err := h.store.Promotions.Get(c.Request.Context(), id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promotion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, promotion)
+}
+
+// 创建优惠（管理员）
+func (h *Handler) CreatePromotion(c *gin.Context) {
+	req, ok := h.bindPromotion(c)
+	if !ok {
+		return
+	}
+
+	promotion, err := h.store.Promotions.Create(c.Request.Context(), req)
+	if err != nil {
+		if err == store.ErrConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promotion"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, promotion)
+}
+
+// 修改优惠（管理员），整体替换，只影响之后的订单
+func (h *Handler) UpdatePromotion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	req, ok := h.bindPromotion(c)
+	if !ok {
+		return
+	}
+
+	promotion, err := h.store.Promotions.Update(c.Request.Context(), id, req)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		case store.ErrConflict:
+			c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update promotion"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, promotion)
+}
+
+// 删除优惠（管理员）
+func (h *Handler) DeletePromotion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	// 已被订单使用的优惠保留下来用于对账，只能停用
+	err = h.store.Promotions.Delete(c.Request.Context(), id)
+	if err != nil {
+		switch err {
+		case store.ErrInUse:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete a promotion that has been used by orders, deactivate it instead"})
+		case store.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete promotion"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promotion deleted successfully"})
+}
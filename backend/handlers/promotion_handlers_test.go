@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"food-ordering/models"
+)
+
+// promotion 通过管理接口创建优惠
+func (s *testServer) promotion(req models.PromotionRequest) models.Promotion {
+	s.t.Helper()
+
+	var promotion models.Promotion
+	s.expect(http.StatusCreated, "POST", "/api/v1/admin/promotions", 0, req, &promotion)
+	return promotion
+}
+
+func TestPromotions(t *testing.T) {
+	s := newTestServer(t)
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+
+	coupon := s.promotion(models.PromotionRequest{
+		Name: "立减五元", Code: " save5 ", Type: models.PromotionFixedAmount, AmountOff: mustMoney(t, "5"),
+	})
+	if coupon.Code != "SAVE5" || !coupon.IsActive {
+		t.Errorf("created promotion code = %q active = %v, want SAVE5 active", coupon.Code, coupon.IsActive)
+	}
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	missing := 999
+	tests := []struct {
+		name string
+		req  models.PromotionRequest
+		want string
+	}{
+		{"percent too large", models.PromotionRequest{Name: "x", Type: models.PromotionPercentage, PercentOff: 101},
+			"percent_off must be between 1 and 100"},
+		{"zero amount", models.PromotionRequest{Name: "x", Type: models.PromotionFixedAmount},
+			"amount_off must be greater than 0"},
+		{"zero buy quantity", models.PromotionRequest{Name: "x", Type: models.PromotionBuyNGetOne},
+			"buy_quantity must be at least 1"},
+		{"unknown type", models.PromotionRequest{Name: "x", Type: "mystery"}, "Invalid promotion type"},
+		{"negative min spend", models.PromotionRequest{Name: "x", Type: models.PromotionPercentage, PercentOff: 10,
+			MinSpend: mustMoney(t, "-1")}, "min_spend must not be negative"},
+		{"ends before it starts", models.PromotionRequest{Name: "x", Type: models.PromotionPercentage, PercentOff: 10,
+			StartsAt: &start, EndsAt: &start}, "ends_at must be after starts_at"},
+		{"dish and category", models.PromotionRequest{Name: "x", Type: models.PromotionPercentage, PercentOff: 10,
+			DishID: &pork.ID, CategoryID: &mains}, "Only one of dish_id and category_id can be set"},
+		{"unknown dish", models.PromotionRequest{Name: "x", Type: models.PromotionPercentage, PercentOff: 10,
+			DishID: &missing}, "Invalid dish ID"},
+		{"unknown category", models.PromotionRequest{Name: "x", Type: models.PromotionPercentage, PercentOff: 10,
+			CategoryID: &missing}, "Invalid category ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("POST", "/api/v1/admin/promotions", 0, tt.req)
+			if w.Code != http.StatusBadRequest || errorMessage(w) != tt.want {
+				t.Errorf("status = %d, error = %q; want 400 %q", w.Code, errorMessage(w), tt.want)
+			}
+		})
+	}
+
+	// 优惠券代码不区分大小写，不能重复
+	w := s.do("POST", "/api/v1/admin/promotions", 0, models.PromotionRequest{
+		Name: "重复", Code: "Save5", Type: models.PromotionPercentage, PercentOff: 10,
+	})
+	if w.Code != http.StatusConflict {
+		t.Errorf("duplicate coupon code: status = %d, want 409", w.Code)
+	}
+
+	inactive := false
+	automatic := s.promotion(models.PromotionRequest{
+		Name: "红烧肉九折", Type: models.PromotionPercentage, PercentOff: 10, DishID: &pork.ID, IsActive: &inactive,
+	})
+	var list struct {
+		Promotions []models.Promotion `json:"promotions"`
+		Total      int                `json:"total"`
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/admin/promotions", 0, nil, &list)
+	if list.Total != 2 || len(list.Promotions) != 2 || list.Promotions[0].ID != automatic.ID {
+		t.Errorf("GET /admin/promotions = %+v, want both promotions newest first", list)
+	}
+
+	var got models.Promotion
+	s.expect(http.StatusOK, "PUT", fmt.Sprintf("/api/v1/admin/promotions/%d", automatic.ID), 0, models.PromotionRequest{
+		Name: "红烧肉八折", Type: models.PromotionPercentage, PercentOff: 20, DishID: &pork.ID,
+	}, &got)
+	if got.PercentOff != 20 || !got.IsActive || !got.CreatedAt.Equal(automatic.CreatedAt) {
+		t.Errorf("updated promotion = %+v", got)
+	}
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/admin/promotions/%d", automatic.ID), 0, nil, &got)
+	if got.Name != "红烧肉八折" {
+		t.Errorf("GET promotion name = %q, want the updated name", got.Name)
+	}
+	s.expect(http.StatusConflict, "PUT", fmt.Sprintf("/api/v1/admin/promotions/%d", automatic.ID), 0, models.PromotionRequest{
+		Name: "x", Code: "SAVE5", Type: models.PromotionPercentage, PercentOff: 20,
+	}, nil)
+	s.expect(http.StatusNotFound, "GET", "/api/v1/admin/promotions/999", 0, nil, nil)
+	s.expect(http.StatusNotFound, "PUT", "/api/v1/admin/promotions/999", 0, models.PromotionRequest{
+		Name: "x", Type: models.PromotionPercentage, PercentOff: 20,
+	}, nil)
+	s.expect(http.StatusBadRequest, "GET", "/api/v1/admin/promotions/abc", 0, nil, nil)
+
+	// 被订单使用过的优惠不能删除
+	s.order(s.user("alice"), models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}})
+	s.expect(http.StatusBadRequest, "DELETE", fmt.Sprintf("/api/v1/admin/promotions/%d", automatic.ID), 0, nil, nil)
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/promotions/%d", coupon.ID), 0, nil, nil)
+	s.expect(http.StatusNotFound, "DELETE", fmt.Sprintf("/api/v1/admin/promotions/%d", coupon.ID), 0, nil, nil)
+}
+
+func TestOrderPromotions(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	greens := s.dish("清炒时蔬", mains, "18.50")
+	items := []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 2}, {DishID: greens.ID, Quantity: 1}}
+
+	tenPercent := s.promotion(models.PromotionRequest{Name: "九折", Type: models.PromotionPercentage, PercentOff: 10})
+	s.promotion(models.PromotionRequest{
+		Name: "满百减二十", Type: models.PromotionFixedAmount, AmountOff: mustMoney(t, "20"), MinSpend: mustMoney(t, "100"),
+	})
+	save5 := s.promotion(models.PromotionRequest{
+		Name: "立减五元", Code: "SAVE5", Type: models.PromotionFixedAmount, AmountOff: mustMoney(t, "5"), UsageLimitPerUser: 1,
+	})
+	s.promotion(models.PromotionRequest{
+		Name: "满二百减三十", Code: "BIG", Type: models.PromotionFixedAmount, AmountOff: mustMoney(t, "30"), MinSpend: mustMoney(t, "200"),
+	})
+	inactive := false
+	s.promotion(models.PromotionRequest{
+		Name: "已停用", Code: "OLD", Type: models.PromotionFixedAmount, AmountOff: mustMoney(t, "5"), IsActive: &inactive,
+	})
+
+	// 自动优惠叠加优惠券，未达到门槛的自动优惠不生效
+	order := s.order(alice, models.CreateOrderRequest{Items: items, CouponCode: "save5"})
+	if order.Subtotal.String() != "94.50" || order.DiscountAmount.String() != "14.45" || order.TotalAmount.String() != "80.05" {
+		t.Errorf("order amounts = %s - %s = %s, want 94.50 - 14.45 = 80.05",
+			order.Subtotal, order.DiscountAmount, order.TotalAmount)
+	}
+	if len(order.Adjustments) != 2 ||
+		*order.Adjustments[0].PromotionID != tenPercent.ID || order.Adjustments[0].Amount.String() != "-9.45" ||
+		*order.Adjustments[1].PromotionID != save5.ID || order.Adjustments[1].Code != "SAVE5" {
+		t.Errorf("adjustments = %+v, want 10%% off then SAVE5", order.Adjustments)
+	}
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"SAVE5", "Coupon SAVE5 cannot be used: usage limit reached"},
+		{"BIG", "Coupon BIG cannot be used: minimum spend is 200.00"},
+		{"OLD", "Coupon OLD cannot be used: not active"},
+		{"NOPE", "Coupon NOPE cannot be used: not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			w := s.do("POST", "/api/v1/orders", alice, models.CreateOrderRequest{Items: items, CouponCode: tt.code})
+			if w.Code != http.StatusBadRequest || errorMessage(w) != tt.want {
+				t.Errorf("status = %d, error = %q; want 400 %q", w.Code, errorMessage(w), tt.want)
+			}
+		})
+	}
+
+	// 取消订单后优惠券的使用次数退回
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", order.ID), alice, nil, nil)
+	s.order(alice, models.CreateOrderRequest{Items: items, CouponCode: "SAVE5"})
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"food-ordering/models"
+	"food-ordering/money"
+	"food-ordering/personalize"
+	"food-ordering/recommend"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recommendConfig 读取推荐设置，失败时已写入 500 响应
+func (h *Handler) recommendConfig(c *gin.Context) (*recommend.Config, bool) {
+	values, err := h.configValues(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch config"})
+		return nil, false
+	}
+	config, err := recommend.Load(values)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid recommendation config: " + err.Error()})
+		return nil, false
+	}
+	return config, true
+}
+
+// 获取推荐列表
+func (h *Handler) GetRecommendations(c *gin.Context) {
+	recommendations, err := h.store.Recommendations.List(c.Request.Context(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, recommendations)
+}
+
+// 获取当前用户的个性化推荐，由后台任务定期计算；尚未计算过时 dishes 为空、computed_at 为 null
+func (h *Handler) GetPersonalRecommendations(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	// 后台任务为每个用户最多保存 personalize.DefaultParams.Limit 道菜
+	maxLimit := personalize.DefaultParams.Limit
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > maxLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxLimit)})
+		return
+	}
+
+	recommendations, err := h.store.Personalization.Get(c.Request.Context(), userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch personal recommendations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, recommendations)
+}
+
+// 按推荐配置生成一份菜单，固定菜单原样返回
+// ?budget= 总价上限，?exclude= 逗号分隔的不要的菜品 ID，?seed= 随机种子，不填时随机生成并在响应中返回
+func (h *Handler) GenerateRecommendation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recommendation ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rec, err := h.store.Recommendations.Get(ctx, id)
+	if err != nil && err != store.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendation"})
+		return
+	}
+	// 停用的推荐配置与不存在的返回相同的结果
+	if err == store.ErrNotFound || !rec.IsActive {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recommendation not found"})
+		return
+	}
+
+	req := recommend.Request{
+		MeatCount:      rec.MeatCount,
+		VegetableCount: rec.VegetableCount,
+		// 随机种子不超过 2^53，前端 JSON 解析为 number 时不丢失精度
+		Seed: rand.Int63n(1 << 53),
+	}
+	if seed := c.Query("seed"); seed != "" {
+		if req.Seed, err = strconv.ParseInt(seed, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seed"})
+			return
+		}
+	}
+	if value := c.Query("budget"); value != "" {
+		budget, err := money.Parse(value, "")
+		if err != nil || !budget.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget"})
+			return
+		}
+		req.Budget = &budget
+	}
+	if value := c.Query("exclude"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			dishID, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exclude, expected comma-separated dish IDs"})
+				return
+			}
+			req.Exclude = append(req.Exclude, dishID)
+		}
+	}
+
+	config, ok := h.recommendConfig(c)
+	if !ok {
+		return
+	}
+	var menu []models.Dish
+	if rec.Type == models.RecommendationCurated {
+		menu, err = config.Curated(append([]models.Dish{}, rec.Dishes...), req)
+	} else {
+		var candidates []models.Dish
+		candidates, err = h.store.Dishes.WithAnyTag(ctx, recommend.Tags)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dishes"})
+			return
+		}
+		menu, err = config.Generate(candidates, req)
+	}
+	if err != nil {
+		var unsatisfiable *recommend.Error
+		if errors.As(err, &unsatisfiable) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot generate menu: " + unsatisfiable.Reason})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate menu"})
+		return
+	}
+
+	rec.Dishes = menu
+	c.JSON(http.StatusOK, models.GeneratedMenu{
+		Recommendation: *rec,
+		Seed:           req.Seed,
+		Total:          recommend.Total(menu),
+		Budget:         req.Budget,
+	})
+}
+
+// checkRecommendation 按推荐设置校验推荐配置，返回不合法的原因，合法时返回空字符串；
+// 固定菜单的菜品按 dishIDs 读取，失败时已写入 500 响应并返回 ok 为 false
+func (h *Handler) checkRecommendation(c *gin.Context, recType string, meatCount, vegetableCount int, dishIDs []int) (message string, ok bool) {
+	config, ok := h.recommendConfig(c)
+	if !ok {
+		return "", false
+	}
+
+	var dishes []models.Dish
+	if recType == models.RecommendationCurated {
+		dishes = make([]models.Dish, 0, len(dishIDs))
+		for _, dishID := range dishIDs {
+			dish, err := h.store.Dishes.Get(c.Request.Context(), dishID)
+			if err == store.ErrNotFound {
+				return fmt.Sprintf("Invalid dish ID %d", dishID), true
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dishes"})
+				return "", false
+			}
+			dishes = append(dishes, *dish)
+		}
+	}
+
+	var invalid *recommend.Error
+	if err := config.Check(meatCount, vegetableCount, dishes); errors.As(err, &invalid) {
+		return invalid.Reason, true
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate recommendation"})
+		return "", false
+	}
+	return "", true
+}
+
+// bindRecommendation 解析并校验推荐配置请求，失败时已写入响应
+func (h *Handler) bindRecommendation(c *gin.Context) (models.RecommendationRequest, bool) {
+	var req models.RecommendationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	if req.Type == "" {
+		req.Type = models.RecommendationTemplate
+	}
+	if req.Type == models.RecommendationTemplate && len(req.DishIDs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only curated recommendations can have dish_ids"})
+		return req, false
+	}
+
+	message, ok := h.checkRecommendation(c, req.Type, req.MeatCount, req.VegetableCount, req.DishIDs)
+	if !ok {
+		return req, false
+	}
+	if message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return req, false
+	}
+	return req, true
+}
+
+// respondRecommendation 写入推荐配置的修改结果
+func respondRecommendation(c *gin.Context, status int, rec *models.Recommendation, err error, action string) {
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recommendation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + " recommendation"})
+		return
+	}
+	c.JSON(status, rec)
+}
+
+// 获取推荐配置列表（管理员），包括停用的
+func (h *Handler) GetAdminRecommendations(c *gin.Context) {
+	recommendations, err := h.store.Recommendations.List(c.Request.Context(), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, recommendations)
+}
+
+// 获取推荐配置详情（管理员）
+func (h *Handler) GetAdminRecommendation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recommendation ID"})
+		return
+	}
+
+	rec, err := h.store.Recommendations.Get(c.Request.Context(), id)
+	respondRecommendation(c, http.StatusOK, rec, err, "fetch")
+}
+
+// 创建推荐配置（管理员）
+func (h *Handler) CreateRecommendation(c *gin.Context) {
+	req, ok := h.bindRecommendation(c)
+	if !ok {
+		return
+	}
+
+	rec, err := h.store.Recommendations.Create(c.Request.Context(), req)
+	respondRecommendation(c, http.StatusCreated, rec, err, "create")
+}
+
+// 修改推荐配置（管理员），整体替换，改为规则模板时清空固定菜单
+func (h *Handler) UpdateRecommendation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recommendation ID"})
+		return
+	}
+
+	req, ok := h.bindRecommendation(c)
+	if !ok {
+		return
+	}
+
+	rec, err := h.store.Recommendations.Update(c.Request.Context(), id, req)
+	respondRecommendation(c, http.StatusOK, rec, err, "update")
+}
+
+// 替换固定菜单的菜品（管理员），荤菜、素菜的数量必须与推荐配置一致
+func (h *Handler) UpdateRecommendationDishes(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recommendation ID"})
+		return
+	}
+
+	var req models.RecommendationDishesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rec, err := h.store.Recommendations.Get(ctx, id)
+	if err != nil {
+		respondRecommendation(c, http.StatusOK, nil, err, "fetch")
+		return
+	}
+	if rec.Type != models.RecommendationCurated {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only curated recommendations have a fixed dish set"})
+		return
+	}
+	message, ok := h.checkRecommendation(c, rec.Type, rec.MeatCount, rec.VegetableCount, req.DishIDs)
+	if !ok {
+		return
+	}
+	if message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	rec, err = h.store.Recommendations.SetDishes(ctx, id, req.DishIDs)
+	respondRecommendation(c, http.StatusOK, rec, err, "update")
+}
+
+// 启用推荐配置（管理员），菜品下架或推荐设置修改后不再符合要求的不能启用
+func (h *Handler) ActivateRecommendation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recommendation ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rec, err := h.store.Recommendations.Get(ctx, id)
+	if err != nil {
+		respondRecommendation(c, http.StatusOK, nil, err, "fetch")
+		return
+	}
+	dishIDs := make([]int, len(rec.Dishes))
+	for i, dish := range rec.Dishes {
+		dishIDs[i] = dish.ID
+	}
+	message, ok := h.checkRecommendation(c, rec.Type, rec.MeatCount, rec.VegetableCount, dishIDs)
+	if !ok {
+		return
+	}
+	if message != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot activate recommendation: " + message})
+		return
+	}
+
+	rec, err = h.store.Recommendations.SetActive(ctx, id, true)
+	respondRecommendation(c, http.StatusOK, rec, err, "activate")
+}
+
+// 停用推荐配置（管理员）
+func (h *Handler) DeactivateRecommendation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recommendation ID"})
+		return
+	}
+
+	rec, err := h.store.Recommendations.SetActive(c.Request.Context(), id, false)
+	respondRecommendation(c, http.StatusOK, rec, err, "deactivate")
+}
+
+// 删除推荐配置（管理员）
+func (h *Handler) DeleteRecommendation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recommendation ID"})
+		return
+	}
+
+	err = h.store.Recommendations.Delete(c.Request.Context(), id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recommendation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recommendation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recommendation deleted successfully"})
+}
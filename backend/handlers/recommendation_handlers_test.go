@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/personalize"
+	"food-ordering/recommend"
+)
+
+// menuIDs 菜单中菜品的 ID，按菜单顺序
+func menuIDs(menu models.GeneratedMenu) []int {
+	ids := []int{}
+	for _, dish := range menu.Dishes {
+		ids = append(ids, dish.ID)
+	}
+	return ids
+}
+
+func TestGenerateRecommendation(t *testing.T) {
+	s := newTestServer(t)
+	s.mem.SeedConfig(recommend.KeyMaxDishCount, "6", "")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00", models.TagMeat)
+	chicken := s.dish("宫保鸡丁", mains, "28.00", models.TagMeat, "spicy")
+	fish := s.dish("清蒸鱼", mains, "48.00", models.TagMeat)
+	greens := s.dish("清炒时蔬", mains, "18.50", models.TagVegetable)
+	tofu := s.dish("麻婆豆腐", mains, "12.00", models.TagVegetable)
+	s.dish("番茄蛋汤", mains, "12.00", models.TagSoup)
+
+	template := s.mem.SeedRecommendation(models.Recommendation{Name: "两荤一素", MeatCount: 2, VegetableCount: 1, IsActive: true})
+	curated := s.mem.SeedRecommendation(models.Recommendation{
+		Name: "招牌套餐", Type: models.RecommendationCurated, MeatCount: 1, VegetableCount: 1, IsActive: true,
+		Dishes: []models.Dish{greens, pork},
+	})
+	inactive := s.mem.SeedRecommendation(models.Recommendation{Name: "停用", MeatCount: 1, VegetableCount: 1})
+
+	var list []models.Recommendation
+	s.expect(http.StatusOK, "GET", "/api/v1/recommendations", 0, nil, &list)
+	if len(list) != 2 || list[0].ID != template.ID || list[1].ID != curated.ID || len(list[1].Dishes) != 2 {
+		t.Errorf("GET /recommendations = %+v, want the two active recommendations", list)
+	}
+
+	generate := func(id int, query string) models.GeneratedMenu {
+		t.Helper()
+		var menu models.GeneratedMenu
+		s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/recommendations/%d/generate%s", id, query), 0, nil, &menu)
+		return menu
+	}
+
+	// 同一个 seed 得到同一份菜单，荤菜在前
+	menu := generate(template.ID, "?seed=42")
+	if menu.ID != template.ID || menu.Seed != 42 || len(menu.Dishes) != 3 || menu.Budget != nil ||
+		!recommend.IsMeat(menu.Dishes[0]) || !recommend.IsMeat(menu.Dishes[1]) || !recommend.IsVegetable(menu.Dishes[2]) {
+		t.Fatalf("generated menu = %+v", menu)
+	}
+	if total := recommend.Total(menu.Dishes); menu.Total.Cmp(total) != 0 {
+		t.Errorf("menu total = %s, want %s", menu.Total, total)
+	}
+	if again := generate(template.ID, "?seed=42"); fmt.Sprint(menuIDs(again)) != fmt.Sprint(menuIDs(menu)) {
+		t.Errorf("seed 42 gave %v then %v", menuIDs(menu), menuIDs(again))
+	}
+	if random := generate(template.ID, ""); random.Seed < 0 || random.Seed >= 1<<53 {
+		t.Errorf("random seed = %d, want within [0, 2^53)", random.Seed)
+	}
+
+	// 预算恰好够最便宜的组合
+	menu = generate(template.ID, "?budget=78&seed=1")
+	if ids := menuIDs(menu); len(ids) != 3 || ids[0]+ids[1] != chicken.ID+pork.ID || ids[2] != tofu.ID ||
+		menu.Total.String() != "78.00" || menu.Budget == nil || menu.Budget.String() != "78.00" {
+		t.Errorf("menu within budget 78 = %v total %s, want chicken, pork and tofu", ids, menu.Total)
+	}
+	for seed := 0; seed < 10; seed++ {
+		menu = generate(template.ID, fmt.Sprintf("?exclude=%d,%d&seed=%d", fish.ID, tofu.ID, seed))
+		if ids := menuIDs(menu); ids[0] == fish.ID || ids[1] == fish.ID || ids[2] != greens.ID {
+			t.Errorf("menu excluding fish and tofu = %v", ids)
+		}
+	}
+
+	// 固定菜单原样返回，荤菜在前
+	menu = generate(curated.ID, "?seed=7")
+	if fmt.Sprint(menuIDs(menu)) != fmt.Sprint([]int{pork.ID, greens.ID}) || menu.Total.String() != "56.50" {
+		t.Errorf("curated menu = %v total %s, want pork then greens", menuIDs(menu), menu.Total)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		{"over budget", fmt.Sprintf("/api/v1/recommendations/%d/generate?budget=77.99", template.ID), http.StatusConflict,
+			"Cannot generate menu: no combination fits within budget 77.99, the cheapest costs 78.00"},
+		{"too many excluded", fmt.Sprintf("/api/v1/recommendations/%d/generate?exclude=%d,%d", template.ID, pork.ID, fish.ID), http.StatusConflict,
+			"Cannot generate menu: not enough meat dishes: need 2, 1 available"},
+		{"curated over budget", fmt.Sprintf("/api/v1/recommendations/%d/generate?budget=50", curated.ID), http.StatusConflict,
+			"Cannot generate menu: curated menu costs 56.50, over budget 50.00"},
+		{"curated excluded", fmt.Sprintf("/api/v1/recommendations/%d/generate?exclude=%d", curated.ID, pork.ID), http.StatusConflict,
+			fmt.Sprintf("Cannot generate menu: curated menu contains excluded dish %d", pork.ID)},
+		{"invalid seed", fmt.Sprintf("/api/v1/recommendations/%d/generate?seed=abc", template.ID), http.StatusBadRequest, "Invalid seed"},
+		{"zero budget", fmt.Sprintf("/api/v1/recommendations/%d/generate?budget=0", template.ID), http.StatusBadRequest, "Invalid budget"},
+		{"invalid budget", fmt.Sprintf("/api/v1/recommendations/%d/generate?budget=1.234", template.ID), http.StatusBadRequest, "Invalid budget"},
+		{"invalid exclude", fmt.Sprintf("/api/v1/recommendations/%d/generate?exclude=1,a", template.ID), http.StatusBadRequest,
+			"Invalid exclude, expected comma-separated dish IDs"},
+		{"inactive", fmt.Sprintf("/api/v1/recommendations/%d/generate", inactive.ID), http.StatusNotFound, "Recommendation not found"},
+		{"unknown", "/api/v1/recommendations/999/generate", http.StatusNotFound, "Recommendation not found"},
+		{"invalid ID", "/api/v1/recommendations/abc/generate", http.StatusBadRequest, "Invalid recommendation ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("GET", tt.path, 0, nil)
+			if w.Code != tt.status || errorMessage(w) != tt.want {
+				t.Errorf("status = %d, error = %q; want %d %q", w.Code, errorMessage(w), tt.status, tt.want)
+			}
+		})
+	}
+
+	// 下架的菜品不再参与生成
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", tofu.ID), 0, nil, nil)
+	w := s.do("GET", fmt.Sprintf("/api/v1/recommendations/%d/generate?budget=78", template.ID), 0, nil)
+	if w.Code != http.StatusConflict || errorMessage(w) != "Cannot generate menu: no combination fits within budget 78.00, the cheapest costs 84.50" {
+		t.Errorf("after delisting tofu: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", greens.ID), 0, nil, nil)
+	w = s.do("GET", fmt.Sprintf("/api/v1/recommendations/%d/generate", curated.ID), 0, nil)
+	if w.Code != http.StatusConflict || errorMessage(w) != fmt.Sprintf("Cannot generate menu: dish %d is not available", greens.ID) {
+		t.Errorf("curated menu with a delisted dish: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+}
+
+func TestAdminRecommendations(t *testing.T) {
+	s := newTestServer(t)
+	s.mem.SeedConfig(recommend.KeyMaxDishCount, "6", "")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00", models.TagMeat)
+	chicken := s.dish("宫保鸡丁", mains, "28.00", models.TagMeat)
+	greens := s.dish("清炒时蔬", mains, "18.50", models.TagVegetable)
+	tofu := s.dish("麻婆豆腐", mains, "12.00", models.TagVegetable)
+	soup := s.dish("番茄蛋汤", mains, "12.00", models.TagSoup)
+
+	var template, curated models.Recommendation
+	s.expect(http.StatusCreated, "POST", "/api/v1/admin/recommendations", 0,
+		models.RecommendationRequest{Name: "两荤一素", MeatCount: 2, VegetableCount: 1}, &template)
+	if template.Type != models.RecommendationTemplate || !template.IsActive || len(template.Dishes) != 0 {
+		t.Errorf("created template = %+v, want an active template without dishes", template)
+	}
+	s.expect(http.StatusCreated, "POST", "/api/v1/admin/recommendations", 0, models.RecommendationRequest{
+		Name: "招牌套餐", Type: models.RecommendationCurated, MeatCount: 1, VegetableCount: 1, DishIDs: []int{greens.ID, pork.ID},
+	}, &curated)
+	if len(curated.Dishes) != 2 {
+		t.Errorf("created curated menu has %d dishes, want 2", len(curated.Dishes))
+	}
+
+	tests := []struct {
+		name   string
+		req    models.RecommendationRequest
+		status int
+		want   string
+	}{
+		{"template with dishes", models.RecommendationRequest{Name: "x", MeatCount: 1, DishIDs: []int{pork.ID}},
+			http.StatusBadRequest, "Only curated recommendations can have dish_ids"},
+		{"too many dishes", models.RecommendationRequest{Name: "x", MeatCount: 4, VegetableCount: 3},
+			http.StatusBadRequest, "recommendation needs 7 dishes, more than max_dish_count 6"},
+		{"no dishes", models.RecommendationRequest{Name: "x"}, http.StatusBadRequest, "recommendation needs at least one dish"},
+		{"curated unknown dish", models.RecommendationRequest{Name: "x", Type: models.RecommendationCurated, MeatCount: 1,
+			DishIDs: []int{999}}, http.StatusBadRequest, "Invalid dish ID 999"},
+		{"curated soup", models.RecommendationRequest{Name: "x", Type: models.RecommendationCurated, MeatCount: 1, VegetableCount: 1,
+			DishIDs: []int{pork.ID, soup.ID}}, http.StatusBadRequest, fmt.Sprintf("dish %d is neither a meat nor a vegetable dish", soup.ID)},
+		{"curated counts differ", models.RecommendationRequest{Name: "x", Type: models.RecommendationCurated, MeatCount: 2, VegetableCount: 1,
+			DishIDs: []int{pork.ID, greens.ID}}, http.StatusBadRequest,
+			"curated menu has 1 meat and 1 vegetable dishes, recommendation needs 2 and 1"},
+		{"unknown type", models.RecommendationRequest{Name: "x", Type: "random", MeatCount: 1}, http.StatusBadRequest, ""},
+		{"missing name", models.RecommendationRequest{MeatCount: 1}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("POST", "/api/v1/admin/recommendations", 0, tt.req)
+			if w.Code != tt.status || tt.want != "" && errorMessage(w) != tt.want {
+				t.Errorf("status = %d, error = %q; want %d %q", w.Code, errorMessage(w), tt.status, tt.want)
+			}
+		})
+	}
+
+	// 替换固定菜单的菜品
+	dishesPath := fmt.Sprintf("/api/v1/admin/recommendations/%d/dishes", curated.ID)
+	var got models.Recommendation
+	s.expect(http.StatusOK, "PUT", dishesPath, 0, models.RecommendationDishesRequest{DishIDs: []int{chicken.ID, tofu.ID}}, &got)
+	if len(got.Dishes) != 2 || got.Dishes[0].ID != chicken.ID || got.Dishes[1].ID != tofu.ID {
+		t.Errorf("curated dishes after replacement = %+v", got.Dishes)
+	}
+	w := s.do("PUT", dishesPath, 0, models.RecommendationDishesRequest{DishIDs: []int{chicken.ID, pork.ID}})
+	if w.Code != http.StatusBadRequest || errorMessage(w) != "curated menu has 2 meat and 0 vegetable dishes, recommendation needs 1 and 1" {
+		t.Errorf("replacing with two meat dishes: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+	w = s.do("PUT", fmt.Sprintf("/api/v1/admin/recommendations/%d/dishes", template.ID), 0, models.RecommendationDishesRequest{DishIDs: []int{}})
+	if w.Code != http.StatusBadRequest || errorMessage(w) != "Only curated recommendations have a fixed dish set" {
+		t.Errorf("replacing template dishes: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+	s.expect(http.StatusBadRequest, "PUT", dishesPath, 0, map[string]string{}, nil)
+	s.expect(http.StatusNotFound, "PUT", "/api/v1/admin/recommendations/999/dishes", 0, models.RecommendationDishesRequest{DishIDs: []int{}}, nil)
+
+	// 停用后不出现在公开列表中，管理员仍然可以看到
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/admin/recommendations/%d/deactivate", curated.ID), 0, nil, &got)
+	if got.IsActive {
+		t.Error("deactivated recommendation is still active")
+	}
+	var list []models.Recommendation
+	s.expect(http.StatusOK, "GET", "/api/v1/recommendations", 0, nil, &list)
+	if len(list) != 1 || list[0].ID != template.ID {
+		t.Errorf("GET /recommendations = %+v, want only the template", list)
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/admin/recommendations", 0, nil, &list)
+	if len(list) != 2 {
+		t.Errorf("GET /admin/recommendations has %d recommendations, want 2", len(list))
+	}
+
+	// 固定菜单的菜品下架后不能启用
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", tofu.ID), 0, nil, nil)
+	w = s.do("POST", fmt.Sprintf("/api/v1/admin/recommendations/%d/activate", curated.ID), 0, nil)
+	if w.Code != http.StatusConflict || errorMessage(w) != fmt.Sprintf("Cannot activate recommendation: dish %d is not available", tofu.ID) {
+		t.Errorf("activating with a delisted dish: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+	s.expect(http.StatusOK, "PUT", dishesPath, 0, models.RecommendationDishesRequest{DishIDs: []int{chicken.ID, greens.ID}}, nil)
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/admin/recommendations/%d/activate", curated.ID), 0, nil, &got)
+	if !got.IsActive {
+		t.Error("activated recommendation is not active")
+	}
+
+	// 改为规则模板时清空固定菜单
+	var updated models.Recommendation
+	s.expect(http.StatusOK, "PUT", fmt.Sprintf("/api/v1/admin/recommendations/%d", curated.ID), 0,
+		models.RecommendationRequest{Name: "一荤一素", MeatCount: 1, VegetableCount: 1}, &updated)
+	if updated.Type != models.RecommendationTemplate || updated.Name != "一荤一素" || len(updated.Dishes) != 0 ||
+		!updated.CreatedAt.Equal(curated.CreatedAt) {
+		t.Errorf("updated recommendation = %+v", updated)
+	}
+	s.expect(http.StatusNotFound, "PUT", "/api/v1/admin/recommendations/999", 0,
+		models.RecommendationRequest{Name: "x", MeatCount: 1}, nil)
+
+	// 推荐设置先校验再保存，调小菜品数量上限后超出的配置不能启用
+	w = s.do("PUT", "/api/v1/admin/config", 0, map[string]string{recommend.KeyMaxDishCount: "0"})
+	if w.Code != http.StatusBadRequest || errorMessage(w) != `Invalid recommendation config: invalid max_dish_count "0"` {
+		t.Errorf("invalid max_dish_count: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+	s.expect(http.StatusOK, "PUT", "/api/v1/admin/config", 0, map[string]string{recommend.KeyMaxDishCount: "2"}, nil)
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/admin/recommendations/%d/deactivate", template.ID), 0, nil, nil)
+	w = s.do("POST", fmt.Sprintf("/api/v1/admin/recommendations/%d/activate", template.ID), 0, nil)
+	if w.Code != http.StatusConflict || errorMessage(w) != "Cannot activate recommendation: recommendation needs 3 dishes, more than max_dish_count 2" {
+		t.Errorf("activating over max_dish_count: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/recommendations/%d", template.ID), 0, nil, nil)
+	s.expect(http.StatusNotFound, "GET", fmt.Sprintf("/api/v1/admin/recommendations/%d", template.ID), 0, nil, nil)
+	s.expect(http.StatusNotFound, "DELETE", fmt.Sprintf("/api/v1/admin/recommendations/%d", template.ID), 0, nil, nil)
+	s.expect(http.StatusNotFound, "POST", fmt.Sprintf("/api/v1/admin/recommendations/%d/activate", template.ID), 0, nil, nil)
+	s.expect(http.StatusBadRequest, "GET", "/api/v1/admin/recommendations/abc", 0, nil, nil)
+}
+
+// refreshPersonal 与后台任务一样为用户重新计算个性化推荐
+func (s *testServer) refreshPersonal(userID int) {
+	s.t.Helper()
+
+	ctx := context.Background()
+	computedAt := time.Now().UTC()
+	history, err := s.store.Personalization.History(ctx, userID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	candidates, err := s.store.Dishes.InCategories(ctx, history.CategoryIDs())
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	dishes := personalize.DefaultParams.Score(history, candidates, computedAt)
+	if err := s.store.Personalization.Save(ctx, userID, dishes, computedAt); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func TestPersonalRecommendations(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	bob := s.user("bob")
+	mains := s.category("主菜")
+	drinks := s.category("饮品")
+	pork := s.dish("红烧肉", mains, "38.00")
+	greens := s.dish("清炒时蔬", mains, "18.50")
+	rice := s.dish("米饭", mains, "2.00")
+	s.dish("柠檬茶", drinks, "8.00")
+
+	// 尚未计算过
+	var personal models.PersonalRecommendations
+	s.expect(http.StatusOK, "GET", "/api/v1/recommendations/personal", alice, nil, &personal)
+	if personal.Dishes == nil || len(personal.Dishes) != 0 || personal.ComputedAt != nil {
+		t.Errorf("personal recommendations before computing = %+v, want no dishes and no computed_at", personal)
+	}
+
+	// 收藏的菜排在最前；刚点过的菜被扣分，但点了两份，仍排在同分类没点过的菜之前
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/favorites/%d", pork.ID), alice, nil, nil)
+	s.order(alice, models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{{DishID: greens.ID, Quantity: 2}}})
+	s.refreshPersonal(alice)
+
+	s.expect(http.StatusOK, "GET", "/api/v1/recommendations/personal", alice, nil, &personal)
+	var got []string
+	for _, dish := range personal.Dishes {
+		got = append(got, fmt.Sprintf("%d %v", dish.Dish.ID, dish.Reasons))
+	}
+	want := []string{
+		fmt.Sprintf("%d [favorite category_affinity]", pork.ID),
+		fmt.Sprintf("%d [frequently_ordered category_affinity]", greens.ID),
+		fmt.Sprintf("%d [category_affinity]", rice.ID),
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) || personal.ComputedAt == nil {
+		t.Errorf("personal recommendations = %v computed at %v, want %v", got, personal.ComputedAt, want)
+	}
+
+	s.expect(http.StatusOK, "GET", "/api/v1/recommendations/personal?limit=1", alice, nil, &personal)
+	if len(personal.Dishes) != 1 || personal.Dishes[0].Dish.ID != pork.ID {
+		t.Errorf("personal recommendations with limit=1 = %+v", personal.Dishes)
+	}
+	for _, query := range []string{"?limit=0", "?limit=21", "?limit=abc"} {
+		w := s.do("GET", "/api/v1/recommendations/personal"+query, alice, nil)
+		if w.Code != http.StatusBadRequest || errorMessage(w) != "limit must be between 1 and 20" {
+			t.Errorf("GET /recommendations/personal%s: status = %d, error = %q", query, w.Code, errorMessage(w))
+		}
+	}
+
+	// 下架的菜品不再返回，其他用户的推荐互不影响
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", pork.ID), 0, nil, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/recommendations/personal", alice, nil, &personal)
+	if len(personal.Dishes) != 2 || personal.Dishes[0].Dish.ID != greens.ID {
+		t.Errorf("personal recommendations after delisting = %+v", personal.Dishes)
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/recommendations/personal", bob, nil, &personal)
+	if len(personal.Dishes) != 0 || personal.ComputedAt != nil {
+		t.Errorf("bob's personal recommendations = %+v, want none", personal)
+	}
+}
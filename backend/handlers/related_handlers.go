@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"food-ordering/models"
+	"food-ordering/related"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// relatedLimit 读取 ?limit=，后台任务为每道菜最多保存 related.DefaultParams.PerDish 道相关菜品
+func relatedLimit(c *gin.Context, defaultLimit int) (int, bool) {
+	maxLimit := related.DefaultParams.PerDish
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 || limit > maxLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxLimit)})
+		return 0, false
+	}
+	return limit, true
+}
+
+// 获取经常和这道菜一起点的菜品，由后台任务按订单定期统计
+func (h *Handler) GetRelatedDishes(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dish ID"})
+		return
+	}
+	limit, ok := relatedLimit(c, 6)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.store.Dishes.Get(ctx, id); err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dish not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dish"})
+		return
+	}
+
+	dishes, err := h.store.Related.Related(ctx, id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related dishes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dishes)
+}
+
+// 按购物车推荐“凑一餐”的菜品，能补上购物车中缺少的荤菜、素菜、汤、主食的菜优先，如只有肉菜时推荐汤；购物车为空时返回空列表
+func (h *Handler) GetCartSuggestions(c *gin.Context) {
+	limit, ok := relatedLimit(c, 4)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	cart, err := h.store.Carts.Get(ctx, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+
+	var dishes []models.Dish
+	relatedDishes := make(map[int][]models.RelatedDish)
+	for _, item := range cart.Items {
+		if item.Dish == nil {
+			continue
+		}
+		dishes = append(dishes, *item.Dish)
+		relatedDishes[item.DishID], err = h.store.Related.Related(ctx, item.DishID, related.DefaultParams.PerDish)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related dishes"})
+			return
+		}
+	}
+	if len(dishes) == 0 {
+		c.JSON(http.StatusOK, []models.CartSuggestion{})
+		return
+	}
+
+	// 相关菜品补不上的类型，从带有该类型标签、点单最多的菜中补充
+	var fallback []models.Dish
+	if missing := related.Missing(dishes); len(missing) > 0 {
+		fallback, err = h.store.Dishes.WithAnyTag(ctx, missing)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dishes"})
+			return
+		}
+	}
+	var ids []int
+	for _, dish := range fallback {
+		ids = append(ids, dish.ID)
+	}
+	for _, rel := range relatedDishes {
+		for _, r := range rel {
+			ids = append(ids, r.Dish.ID)
+		}
+	}
+	orderCounts, err := h.store.Related.OrderCounts(ctx, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related dishes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, related.Complete(dishes, relatedDishes, fallback, orderCounts, limit))
+}
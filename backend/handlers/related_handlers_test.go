@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/related"
+)
+
+// refreshRelated 与后台任务一样按全部订单重新统计相关菜品
+func (s *testServer) refreshRelated() {
+	s.t.Helper()
+
+	ctx := context.Background()
+	baskets, err := s.store.Related.Baskets(ctx, time.Time{})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if err := s.store.Related.Replace(ctx, related.DefaultParams.Compute(baskets)); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func TestRelatedDishes(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00", models.TagMeat)
+	greens := s.dish("清炒时蔬", mains, "18.50", models.TagVegetable)
+	soup := s.dish("番茄蛋汤", mains, "12.00", models.TagSoup)
+	tea := s.dish("柠檬茶", mains, "8.00", "drink")
+
+	for _, other := range []models.Dish{soup, soup, tea, tea, greens} {
+		s.order(alice, models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{
+			{DishID: pork.ID, Quantity: 1}, {DishID: other.ID, Quantity: 1},
+		}})
+	}
+	// 取消的订单不参与统计
+	cancelled := s.order(alice, models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{
+		{DishID: pork.ID, Quantity: 1}, {DishID: greens.ID, Quantity: 1},
+	}})
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", cancelled.ID), alice, nil, nil)
+	s.refreshRelated()
+
+	var dishes []models.RelatedDish
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/dishes/%d/related", pork.ID), 0, nil, &dishes)
+	if len(dishes) != 2 || dishes[0].Dish.ID != soup.ID || dishes[1].Dish.ID != tea.ID || dishes[0].CoOrders != 2 {
+		t.Fatalf("related dishes = %+v, want soup and tea", dishes)
+	}
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/dishes/%d/related?limit=1", pork.ID), 0, nil, &dishes)
+	if len(dishes) != 1 {
+		t.Errorf("related dishes with limit=1 = %d, want 1", len(dishes))
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/v1/dishes/999/related", http.StatusNotFound},
+		{"/api/v1/dishes/abc/related", http.StatusBadRequest},
+		{fmt.Sprintf("/api/v1/dishes/%d/related?limit=0", pork.ID), http.StatusBadRequest},
+		{fmt.Sprintf("/api/v1/dishes/%d/related?limit=21", pork.ID), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := s.do("GET", tt.path, 0, nil); w.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+
+	// 下架的菜品不再作为相关菜品返回
+	s.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/v1/admin/dishes/%d", tea.ID), 0, nil, nil)
+	s.expect(http.StatusOK, "GET", fmt.Sprintf("/api/v1/dishes/%d/related", pork.ID), 0, nil, &dishes)
+	if len(dishes) != 1 || dishes[0].Dish.ID != soup.ID {
+		t.Errorf("related dishes after delisting = %+v, want only soup", dishes)
+	}
+}
+
+func TestCartSuggestions(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	bob := s.user("bob")
+	mains := s.category("主菜")
+	soups := s.category("汤类")
+	pork := s.dish("红烧肉", mains, "38.00", models.TagMeat)
+	chicken := s.dish("宫保鸡丁", mains, "28.00", models.TagMeat, "spicy")
+	greens := s.dish("清炒时蔬", mains, "18.50", models.TagVegetable)
+	soup := s.dish("番茄蛋汤", soups, "12.00", models.TagSoup)
+	s.dish("米饭", mains, "2.00", models.TagStaple)
+	noodles := s.dish("阳春面", mains, "10.00", models.TagStaple)
+
+	for _, other := range []models.Dish{soup, soup, chicken, chicken, chicken, noodles} {
+		s.order(bob, models.CreateOrderRequest{Items: []models.CreateOrderItemRequest{
+			{DishID: pork.ID, Quantity: 1}, {DishID: other.ID, Quantity: 1},
+		}})
+	}
+	s.refreshRelated()
+
+	var suggestions []models.CartSuggestion
+	s.expect(http.StatusOK, "GET", "/api/v1/cart/suggestions", alice, nil, &suggestions)
+	if len(suggestions) != 0 {
+		t.Errorf("suggestions for an empty cart = %+v, want none", suggestions)
+	}
+
+	// 只有肉菜时，先推荐汤（相关菜品），再补上素菜和点单最多的主食，最后是经常一起点的肉菜
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", alice, models.AddCartItemRequest{DishID: pork.ID, Quantity: 1}, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/cart/suggestions?limit=5", alice, nil, &suggestions)
+	var got []string
+	for _, suggestion := range suggestions {
+		got = append(got, fmt.Sprintf("%d %s", suggestion.Dish.ID, suggestion.Reason))
+	}
+	want := []string{
+		fmt.Sprintf("%d %s", soup.ID, related.ReasonComplements),
+		fmt.Sprintf("%d %s", noodles.ID, related.ReasonComplements),
+		fmt.Sprintf("%d %s", greens.ID, related.ReasonComplements),
+		fmt.Sprintf("%d %s", chicken.ID, related.ReasonOrderedTogether),
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("suggestions = %v, want %v", got, want)
+	}
+
+	// 加了汤以后只补素菜和主食，每类一道；米饭没有人点过，排在阳春面之后不再推荐
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", alice, models.AddCartItemRequest{DishID: soup.ID, Quantity: 1}, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/cart/suggestions", alice, nil, &suggestions)
+	got = nil
+	for _, suggestion := range suggestions {
+		got = append(got, fmt.Sprintf("%d %s", suggestion.Dish.ID, suggestion.Reason))
+	}
+	want = []string{
+		fmt.Sprintf("%d %s", noodles.ID, related.ReasonComplements),
+		fmt.Sprintf("%d %s", greens.ID, related.ReasonComplements),
+		fmt.Sprintf("%d %s", chicken.ID, related.ReasonOrderedTogether),
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("suggestions with soup in cart = %v, want %v", got, want)
+	}
+
+	if w := s.do("GET", "/api/v1/cart/suggestions?limit=0", alice, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: status = %d, want 400", w.Code)
+	}
+
+	// 凑一餐使用的标签不能删除
+	var tags []models.Tag
+	s.expect(http.StatusOK, "GET", "/api/v1/tags", 0, nil, &tags)
+	for _, tag := range tags {
+		want := http.StatusOK
+		if tag.Slug == models.TagMeat || tag.Slug == models.TagVegetable || tag.Slug == models.TagSoup || tag.Slug == models.TagStaple {
+			want = http.StatusBadRequest
+		}
+		if w := s.do("DELETE", fmt.Sprintf("/api/v1/admin/tags/%d", tag.ID), 0, nil); w.Code != want {
+			t.Errorf("DELETE tag %s: status = %d, want %d", tag.Slug, w.Code, want)
+		}
+	}
+}
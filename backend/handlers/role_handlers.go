@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+
+	"food-ordering/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// 内置角色不能删除：admin 始终拥有全部权限，customer 是注册用户的默认角色
+var builtinRoles = map[string]bool{
+	"admin":    true,
+	"customer": true,
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// 获取角色列表（管理员）
+func (h *Handler) GetRoles(c *gin.Context) {
+	rows, err := h.db.Query(`
+		SELECT r.name, COALESCE(r.description, ''), r.created_at,
+			   ARRAY(SELECT permission FROM role_permissions WHERE role = r.name ORDER BY permission)
+		FROM roles r
+		ORDER BY r.name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		err := rows.Scan(&role.Name, &role.Description, &role.CreatedAt, pq.Array(&role.Permissions))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan role"})
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// 获取权限列表（管理员）
+func (h *Handler) GetPermissions(c *gin.Context) {
+	rows, err := h.db.Query("SELECT name, COALESCE(description, '') FROM permissions ORDER BY name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+	defer rows.Close()
+
+	var permissions []models.Permission
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission.Name, &permission.Description); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan permission"})
+			return
+		}
+		permissions = append(permissions, permission)
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// 创建角色（管理员）
+func (h *Handler) CreateRole(c *gin.Context) {
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !roleNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name may only contain lowercase letters, digits and '_'"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO roles (name, description) VALUES ($1, $2)", req.Name, req.Description)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	if !setRolePermissions(c, tx, req.Name, req.Permissions) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if req.Permissions == nil {
+		req.Permissions = []string{}
+	}
+	c.JSON(http.StatusCreated, models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	})
+}
+
+// 修改角色权限（管理员），整体替换该角色的权限集合
+func (h *Handler) UpdateRolePermissions(c *gin.Context) {
+	name := c.Param("name")
+	if name == "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The admin role always has every permission"})
+		return
+	}
+
+	var req models.UpdateRolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", name).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role = $1", name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role permissions"})
+		return
+	}
+	if !setRolePermissions(c, tx, name, req.Permissions) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role permissions updated successfully"})
+}
+
+// 删除角色（管理员），仍有用户使用的角色不能删除
+func (h *Handler) DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+	if builtinRoles[name] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	var inUse bool
+	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE role = $1)", name).Scan(&inUse)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role usage"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete role assigned to users"})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM roles WHERE name = $1", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// setRolePermissions 为角色添加权限，未知权限返回400
+func setRolePermissions(c *gin.Context, tx *sql.Tx, role string, permissions []string) bool {
+	for _, permission := range permissions {
+		_, err := tx.Exec(`
+			INSERT INTO role_permissions (role, permission) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, role, permission)
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + permission})
+				return false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role permissions"})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/schedule"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 排期视图最多查询的天数
+const maxScheduleDays = 14
+
+// configValues 以 key => value 的形式返回全部系统配置
+func (h *Handler) configValues(ctx context.Context) (map[string]string, error) {
+	configs, err := h.store.Config.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(configs))
+	for _, config := range configs {
+		values[config.ConfigKey] = config.ConfigValue
+	}
+	return values, nil
+}
+
+// 厨房排期：按天和用餐时段列出预约订单
+func (h *Handler) GetSchedule(c *gin.Context) {
+	values, err := h.configValues(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch config"})
+		return
+	}
+	config, err := schedule.Load(values)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid schedule config: " + err.Error()})
+		return
+	}
+
+	from := config.Date(time.Now())
+	if date := c.Query("date"); date != "" {
+		from, err = time.ParseInLocation("2006-01-02", date, config.Location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+			return
+		}
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "1"))
+	if err != nil || days < 1 || days > maxScheduleDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and " + strconv.Itoa(maxScheduleDays)})
+		return
+	}
+	to := from.AddDate(0, 0, days)
+
+	orders, err := h.store.Orders.Scheduled(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled orders"})
+		return
+	}
+
+	// 先按配置列出每天的每个时段，再把订单放入所在的时段
+	slots := []models.ScheduleSlot{}
+	index := map[string]int{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		for _, slot := range config.Slots {
+			start, end, cutoff := config.Window(slot, day)
+			index[date+"/"+slot.Name] = len(slots)
+			slots = append(slots, models.ScheduleSlot{
+				Date:     date,
+				MealSlot: slot.Name,
+				StartsAt: start.UTC(),
+				EndsAt:   end.UTC(),
+				CutoffAt: cutoff.UTC(),
+				Capacity: slot.Capacity,
+				Orders:   []models.Order{},
+			})
+		}
+	}
+	for _, order := range orders {
+		i, ok := index[order.RequestedFor.In(config.Location).Format("2006-01-02")+"/"+order.MealSlot]
+		if !ok {
+			continue
+		}
+		slots[i].Orders = append(slots[i].Orders, order)
+		slots[i].Booked++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timezone": config.Location.String(),
+		"date":     from.Format("2006-01-02"),
+		"days":     days,
+		"slots":    slots,
+	})
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"food-ordering/models"
+	"food-ordering/schedule"
+)
+
+// seedSchedule 写入与迁移 0016 一致的预约设置，午餐容量改为 lunchCapacity，返回预约时区
+func (s *testServer) seedSchedule(lunchCapacity int) *time.Location {
+	s.t.Helper()
+
+	values := map[string]string{
+		schedule.KeyTimezone:                     "Asia/Shanghai",
+		schedule.KeyMaxDaysAhead:                 "7",
+		schedule.WindowKey(schedule.Breakfast):   "07:00-09:30",
+		schedule.CapacityKey(schedule.Breakfast): "20",
+		schedule.CutoffKey(schedule.Breakfast):   "10h",
+		schedule.WindowKey(schedule.Lunch):       "11:00-13:30",
+		schedule.CapacityKey(schedule.Lunch):     fmt.Sprint(lunchCapacity),
+		schedule.CutoffKey(schedule.Lunch):       "2h",
+		schedule.WindowKey(schedule.Dinner):      "17:30-20:00",
+		schedule.CapacityKey(schedule.Dinner):    "30",
+		schedule.CutoffKey(schedule.Dinner):      "3h",
+	}
+	for key, value := range values {
+		s.mem.SeedConfig(key, value, "")
+	}
+	location, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return location
+}
+
+func TestScheduledOrders(t *testing.T) {
+	s := newTestServer(t)
+	location := s.seedSchedule(2)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	items := []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}
+
+	// 明天的时段总在截单时间之前
+	now := time.Now().In(location)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+	date := tomorrow.Format("2006-01-02")
+	lunch := tomorrow.Add(12 * time.Hour)
+
+	first := s.order(alice, models.CreateOrderRequest{Items: items, RequestedFor: &lunch})
+	if first.MealSlot != schedule.Lunch || first.RequestedFor == nil || !first.RequestedFor.Equal(lunch) {
+		t.Errorf("scheduled order slot = %q requested_for = %v, want lunch at %v", first.MealSlot, first.RequestedFor, lunch)
+	}
+	s.order(alice, models.CreateOrderRequest{Items: items, RequestedFor: &lunch, MealSlot: schedule.Lunch})
+	s.order(alice, models.CreateOrderRequest{Items: items}) // 不预约的订单不占用时段
+
+	dinner := tomorrow.Add(18 * time.Hour)
+	tooFar := lunch.AddDate(0, 0, 8)
+	tests := []struct {
+		name   string
+		req    models.CreateOrderRequest
+		status int
+		want   string
+	}{
+		{"slot is full", models.CreateOrderRequest{Items: items, RequestedFor: &lunch}, http.StatusConflict,
+			fmt.Sprintf("Meal slot lunch on %s is fully booked", date)},
+		{"slot without time", models.CreateOrderRequest{Items: items, MealSlot: schedule.Lunch}, http.StatusBadRequest,
+			"Cannot schedule order: requested_for is required when meal_slot is set"},
+		{"time outside slot", models.CreateOrderRequest{Items: items, RequestedFor: &lunch, MealSlot: schedule.Dinner}, http.StatusBadRequest,
+			"Cannot schedule order: requested_for must be within dinner (17:30-20:00)"},
+		{"too far ahead", models.CreateOrderRequest{Items: items, RequestedFor: &tooFar}, http.StatusBadRequest,
+			"Cannot schedule order: orders can be scheduled at most 7 days ahead"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("POST", "/api/v1/orders", alice, tt.req)
+			if w.Code != tt.status || errorMessage(w) != tt.want {
+				t.Errorf("status = %d, error = %q; want %d %q", w.Code, errorMessage(w), tt.status, tt.want)
+			}
+		})
+	}
+
+	// 取消的订单释放时段容量
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", first.ID), alice, nil, nil)
+	s.order(alice, models.CreateOrderRequest{Items: items, RequestedFor: &lunch})
+
+	// 购物车结算也可以预约
+	s.expect(http.StatusOK, "POST", "/api/v1/cart/items", alice, models.AddCartItemRequest{DishID: pork.ID, Quantity: 1}, nil)
+	var order models.Order
+	s.expect(http.StatusCreated, "POST", "/api/v1/cart/checkout", alice, models.CheckoutRequest{RequestedFor: &dinner}, &order)
+	if order.MealSlot != schedule.Dinner {
+		t.Errorf("checkout meal slot = %q, want dinner", order.MealSlot)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s := newTestServer(t)
+	location := s.seedSchedule(30)
+	alice := s.user("alice")
+	mains := s.category("主菜")
+	pork := s.dish("红烧肉", mains, "38.00")
+	items := []models.CreateOrderItemRequest{{DishID: pork.ID, Quantity: 1}}
+
+	now := time.Now().In(location)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+	date := tomorrow.Format("2006-01-02")
+	lunch := tomorrow.Add(12 * time.Hour)
+	early := tomorrow.Add(11 * time.Hour)
+	dinner := tomorrow.Add(19 * time.Hour)
+	s.order(alice, models.CreateOrderRequest{Items: items, RequestedFor: &lunch})
+	s.order(alice, models.CreateOrderRequest{Items: items, RequestedFor: &early})
+	s.order(alice, models.CreateOrderRequest{Items: items, RequestedFor: &dinner})
+	cancelled := s.order(alice, models.CreateOrderRequest{Items: items, RequestedFor: &dinner})
+	s.expect(http.StatusOK, "POST", fmt.Sprintf("/api/v1/orders/%d/cancel", cancelled.ID), alice, nil, nil)
+
+	var view struct {
+		Timezone string                `json:"timezone"`
+		Date     string                `json:"date"`
+		Days     int                   `json:"days"`
+		Slots    []models.ScheduleSlot `json:"slots"`
+	}
+	s.expect(http.StatusOK, "GET", "/api/v1/schedule?date="+date, alice, nil, &view)
+	if view.Timezone != "Asia/Shanghai" || view.Date != date || view.Days != 1 || len(view.Slots) != 3 {
+		t.Fatalf("schedule = %s %s %d days, %d slots", view.Timezone, view.Date, view.Days, len(view.Slots))
+	}
+	var got []string
+	for _, slot := range view.Slots {
+		got = append(got, fmt.Sprintf("%s %d/%d", slot.MealSlot, slot.Booked, slot.Capacity))
+	}
+	if want := "[breakfast 0/20 lunch 2/30 dinner 1/30]"; fmt.Sprint(got) != want {
+		t.Errorf("slots = %v, want %s", got, want)
+	}
+	lunchSlot := view.Slots[1]
+	if len(lunchSlot.Orders) != 2 || !lunchSlot.Orders[0].RequestedFor.Equal(early) ||
+		!lunchSlot.StartsAt.Equal(early) || !lunchSlot.CutoffAt.Equal(tomorrow.Add(9*time.Hour)) {
+		t.Errorf("lunch slot = %+v, want two orders earliest first", lunchSlot)
+	}
+
+	// 不带日期时从今天开始
+	s.expect(http.StatusOK, "GET", "/api/v1/schedule?days=2", alice, nil, &view)
+	if view.Date != now.Format("2006-01-02") || len(view.Slots) != 6 || view.Slots[4].Booked != 2 {
+		t.Errorf("two day schedule from %s has %d slots", view.Date, len(view.Slots))
+	}
+
+	for _, query := range []string{"?days=0", "?days=15", "?date=tomorrow", "?date=2024-13-01"} {
+		if w := s.do("GET", "/api/v1/schedule"+query, alice, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /schedule%s: status = %d, want 400", query, w.Code)
+		}
+	}
+
+	// 修改预约设置时先校验
+	w := s.do("PUT", "/api/v1/admin/config", 0, map[string]string{schedule.WindowKey(schedule.Lunch): "09:00-13:00"})
+	if w.Code != http.StatusBadRequest || errorMessage(w) != "Invalid schedule config: slot_lunch_window overlaps slot_breakfast_window" {
+		t.Errorf("invalid schedule config: status = %d, error = %q", w.Code, errorMessage(w))
+	}
+	s.expect(http.StatusOK, "PUT", "/api/v1/admin/config", 0, map[string]string{schedule.CapacityKey(schedule.Lunch): "1"}, nil)
+	s.expect(http.StatusOK, "GET", "/api/v1/schedule?date="+date, alice, nil, &view)
+	if view.Slots[1].Capacity != 1 {
+		t.Errorf("lunch capacity after update = %d, want 1", view.Slots[1].Capacity)
+	}
+	w = s.do("POST", "/api/v1/orders", alice, models.CreateOrderRequest{Items: items, RequestedFor: &lunch})
+	if w.Code != http.StatusConflict {
+		t.Errorf("ordering into an overbooked slot: status = %d, want 409", w.Code)
+	}
+}
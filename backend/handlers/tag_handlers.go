@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"food-ordering/models"
+	"food-ordering/recommend"
+	"food-ordering/related"
+	"food-ordering/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tagSlugPattern 标签的 slug 用于查询参数，只允许小写字母、数字和下划线
+var tagSlugPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// checkDishTags 校验菜品的标签都存在，且不能同时是荤菜和素菜；失败时已写入响应
+func (h *Handler) checkDishTags(c *gin.Context, tags []string) bool {
+	missing, err := h.store.Tags.Missing(c.Request.Context(), tags)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return false
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown tags: " + strings.Join(missing, ", ")})
+		return false
+	}
+	if containsTag(tags, models.TagMeat) && containsTag(tags, models.TagVegetable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dish cannot be tagged both meat and vegetable"})
+		return false
+	}
+	return true
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取标签列表
+func (h *Handler) GetTags(c *gin.Context) {
+	tags, err := h.store.Tags.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// 创建标签（管理员）
+func (h *Handler) CreateTag(c *gin.Context) {
+	var req models.CreateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !tagSlugPattern.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slug must start with a lowercase letter and contain only lowercase letters, digits and underscores"})
+		return
+	}
+
+	tag, err := h.store.Tags.Create(c.Request.Context(), req)
+	if err != nil {
+		if err == store.ErrConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tag already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// 更新标签（管理员），slug 不能修改
+func (h *Handler) UpdateTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+
+	var req models.UpdateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name == nil && req.Description == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	tag, err := h.store.Tags.Update(c.Request.Context(), id, req)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// 删除标签（管理员），同时去掉菜品上的这个标签；生成推荐菜单和凑一餐推荐使用的标签不能删除
+func (h *Handler) DeleteTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tag, err := h.store.Tags.Get(ctx, id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		return
+	}
+	if containsTag(recommend.Tags, tag.Slug) || containsTag(related.Courses, tag.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete tag used by recommendations"})
+		return
+	}
+
+	if err := h.store.Tags.Delete(ctx, id); err != nil {
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
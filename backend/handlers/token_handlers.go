@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"food-ordering/middleware"
+	"food-ordering/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// execer 由 *sql.DB 和 *sql.Tx 共同实现
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// 刷新访问令牌
+// 刷新令牌只能使用一次；已轮换的令牌再次出现说明可能被盗用，整个会话会被吊销
+func (h *Handler) RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	var familyID string
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(req.RefreshToken)).Scan(&tokenID, &userID, &familyID, &expiresAt, &usedAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if revokedAt.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+		return
+	}
+
+	if usedAt.Valid {
+		if err := revokeSessions(tx, "family_id = $1", familyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, session revoked"})
+		return
+	}
+
+	if time.Now().After(expiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1", tokenID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+		return
+	}
+
+	var user models.User
+	err = tx.QueryRow(
+		"SELECT id, username, email, role, status, must_change_password, created_at, updated_at FROM users WHERE id = $1",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Status, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	resp, err := h.issueTokens(tx, user, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// 注销：吊销当前访问令牌所属会话的全部刷新令牌
+func (h *Handler) Logout(c *gin.Context) {
+	sessionID, _ := c.Get("session_id")
+
+	if err := revokeSessions(h.db, "family_id = $1", sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// 吊销用户的全部会话（管理员）
+func (h *Handler) RevokeUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := revokeSessions(h.db, "user_id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked"})
+}
+
+// issueTokens 签发访问令牌和刷新令牌，familyID 为空时开启新会话
+func (h *Handler) issueTokens(db execer, user models.User, familyID string) (*models.LoginResponse, error) {
+	var err error
+	if familyID == "" {
+		familyID, err = middleware.RandomToken(16)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refreshToken, err := middleware.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, user.ID, familyID, hashToken(refreshToken), time.Now().UTC().Add(h.tokens.RefreshTokenTTL()))
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := h.tokens.GenerateJWT(user, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.tokens.AccessTokenTTL().Seconds()),
+		User:         user,
+	}, nil
+}
+
+// revokeSessions 吊销满足条件的所有刷新令牌，已签发的访问令牌随之失效
+func revokeSessions(db execer, condition string, args ...interface{}) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE revoked_at IS NULL AND "+condition, args...)
+	return err
+}
+
+// hashToken 刷新令牌只以摘要形式落库
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
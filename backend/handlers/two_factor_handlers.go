@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"food-ordering/middleware"
+	"food-ordering/models"
+	"food-ordering/totp"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+// 完成两步验证登录
+// 用户尚未启用两步验证时（角色强制要求），首次验证成功即视为完成绑定，同时返回恢复码
+func (h *Handler) LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	claims, err := h.tokens.ParseChallenge(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+		return
+	}
+
+	// 验证码只有6位，和密码共用失败计数，防止在挑战令牌有效期内暴力尝试
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+	wait, err := h.guard.Check(ctx, claims.Username, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, please try again later"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var user models.User
+	var secret sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, username, email, role, status, must_change_password, totp_enabled, created_at, updated_at, totp_secret
+		FROM users WHERE id = $1
+		FOR UPDATE
+	`, claims.UserID).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Status, &user.MustChangePassword, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt, &secret)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+	if !secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+
+	var ok bool
+	if req.RecoveryCode != "" {
+		// 恢复码只能在已启用两步验证后使用
+		if user.TwoFactorEnabled {
+			ok, err = consumeRecoveryCode(tx, user.ID, req.RecoveryCode)
+		}
+	} else {
+		ok, err = consumeTOTP(tx, user.ID, secret.String, req.Code)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		tx.Rollback()
+		if err := h.guard.Fail(ctx, claims.Username, ip); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	var recoveryCodes []string
+	if !user.TwoFactorEnabled {
+		recoveryCodes, err = enableTwoFactor(tx, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+			return
+		}
+		user.TwoFactorEnabled = true
+	}
+
+	resp, err := h.issueTokens(tx, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if err := h.guard.Succeed(ctx, claims.Username); err != nil {
+		log.Printf("Failed to reset login failures: %v", err)
+	}
+
+	resp.RecoveryCodes = recoveryCodes
+	c.JSON(http.StatusOK, resp)
+}
+
+// 登录过程中绑定验证器，用于角色强制要求两步验证但用户尚未启用的情况
+func (h *Handler) EnrollTwoFactor(c *gin.Context) {
+	var req models.TwoFactorEnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := h.tokens.ParseChallenge(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+		return
+	}
+
+	h.startTwoFactorSetup(c, claims.UserID)
+}
+
+// 开始绑定验证器
+func (h *Handler) SetupTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	h.startTwoFactorSetup(c, userID.(int))
+}
+
+// 确认绑定验证器，返回恢复码
+func (h *Handler) ConfirmTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	secret, enabled, ok := loadTwoFactor(c, tx, userID.(int))
+	if !ok {
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if !secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+
+	valid, err := consumeTOTP(tx, userID.(int), secret.String, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	codes, err := enableTwoFactor(tx, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// 关闭两步验证，需要同时提供密码和验证码
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	required, err := h.twoFactorRequired(role.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor policy"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var passwordHash string
+	err = tx.QueryRow("SELECT password_hash FROM users WHERE id = $1", userID).Scan(&passwordHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	secret, enabled, ok := loadTwoFactor(c, tx, userID.(int))
+	if !ok {
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	valid, err := consumeTOTP(tx, userID.(int), secret.String, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	if err := clearTwoFactor(tx, userID.(int)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// 重新生成恢复码，旧的恢复码全部作废
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	secret, enabled, ok := loadTwoFactor(c, tx, userID.(int))
+	if !ok {
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	valid, err := consumeTOTP(tx, userID.(int), secret.String, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// 重置用户的两步验证（管理员），用于用户丢失验证器且恢复码用完的情况
+func (h *Handler) ResetUserTwoFactor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	currentUserID, _ := c.Get("user_id")
+	if currentUserID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot reset your own two-factor authentication"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, _, ok := loadTwoFactor(c, tx, id); !ok {
+		return
+	}
+	if err := clearTwoFactor(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset successfully"})
+}
+
+// twoFactorRequired 系统配置开启 require_admin_2fa 后，拥有任意权限的角色都必须启用两步验证
+func (h *Handler) twoFactorRequired(role string) (bool, error) {
+	var required bool
+	err := h.db.QueryRow(`
+		SELECT COALESCE((SELECT config_value FROM system_config WHERE config_key = 'require_admin_2fa'), 'false') = 'true'
+			   AND EXISTS(SELECT 1 FROM role_permissions WHERE role = $1)
+	`, role).Scan(&required)
+	return required, err
+}
+
+// startTwoFactorSetup 生成新的待确认密钥，已启用两步验证时返回409
+func (h *Handler) startTwoFactorSetup(c *gin.Context, userID int) {
+	var username string
+	var enabled bool
+	err := h.db.QueryRow("SELECT username, totp_enabled FROM users WHERE id = $1", userID).Scan(&username, &enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	_, err = h.db.Exec("UPDATE users SET totp_secret = $1, totp_last_step = 0, updated_at = NOW() WHERE id = $2 AND totp_enabled = false", secret, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TOTPSetupResponse{
+		Secret:     secret,
+		OTPAuthURL: totp.URL(h.cfg.TOTPIssuer, username, secret),
+	})
+}
+
+// loadTwoFactor 锁定并读取用户的两步验证状态，用户不存在时写入404
+func loadTwoFactor(c *gin.Context, tx *sql.Tx, userID int) (sql.NullString, bool, bool) {
+	var secret sql.NullString
+	var enabled bool
+	err := tx.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&secret, &enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return secret, false, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return secret, false, false
+	}
+	return secret, enabled, true
+}
+
+// consumeTOTP 校验验证码并记录其时间步，同一个验证码只能使用一次
+func consumeTOTP(db execer, userID int, secret, code string) (bool, error) {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	result, err := db.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1", step, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+// consumeRecoveryCode 使用一个恢复码
+func consumeRecoveryCode(db execer, userID int, code string) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, hashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+// enableTwoFactor 启用两步验证并生成恢复码
+func enableTwoFactor(db execer, userID int) ([]string, error) {
+	if _, err := db.Exec("UPDATE users SET totp_enabled = true, updated_at = NOW() WHERE id = $1", userID); err != nil {
+		return nil, err
+	}
+	return replaceRecoveryCodes(db, userID)
+}
+
+// clearTwoFactor 关闭两步验证并删除密钥和恢复码
+func clearTwoFactor(db execer, userID int) error {
+	_, err := db.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = 0, updated_at = NOW() WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	return err
+}
+
+// replaceRecoveryCodes 作废旧恢复码并生成一组新的，返回明文，数据库中只保存哈希
+func replaceRecoveryCodes(db execer, userID int) ([]string, error) {
+	if _, err := db.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := middleware.RandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hashToken(raw)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode 忽略大小写、空格和分隔符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"food-ordering/totp"
+)
+
+// fakeTwoFactorDB 模拟 users.totp_last_step 和 recovery_codes 上的条件更新
+type fakeTwoFactorDB struct {
+	lastStep int64
+	unused   map[string]bool // 未使用的恢复码哈希
+}
+
+func (db *fakeTwoFactorDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	switch {
+	case strings.HasPrefix(query, "UPDATE users SET totp_last_step"):
+		if step := args[0].(int64); step > db.lastStep {
+			db.lastStep = step
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(query, "DELETE FROM recovery_codes"):
+		db.unused = map[string]bool{}
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(query, "INSERT INTO recovery_codes"):
+		db.unused[args[1].(string)] = true
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "UPDATE recovery_codes SET used_at"):
+		if hash := args[1].(string); db.unused[hash] {
+			delete(db.unused, hash)
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+func TestConsumeTOTP(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// consumeTOTP 按当前时间校验，临近步长结束时等到下一步，避免测试中途换步
+	if remaining := totp.Period - time.Duration(time.Now().UnixNano())%totp.Period; remaining < time.Second {
+		time.Sleep(remaining)
+	}
+	current := totp.Step(time.Now())
+	code := func(step int64) string {
+		c, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// 与窗口内任何验证码都不同的 6 位数字
+	wrong := "000000"
+	for n := 1; wrong == code(current-1) || wrong == code(current) || wrong == code(current+1); n++ {
+		wrong = fmt.Sprintf("%06d", n)
+	}
+
+	db := &fakeTwoFactorDB{}
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"previous step", code(current - 1), true},
+		{"current step", code(current), true},
+		{"same code again", code(current), false},
+		{"older code after a newer one", code(current - 1), false},
+		{"next step", code(current + 1), true},
+		{"current code after the next one", code(current), false},
+		{"wrong code", wrong, false},
+	}
+	for _, tt := range tests {
+		ok, err := consumeTOTP(db, 1, secret, tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s: consumeTOTP() = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+	if db.lastStep != current+1 {
+		t.Errorf("totp_last_step = %d, want %d", db.lastStep, current+1)
+	}
+}
+
+func TestConsumeRecoveryCode(t *testing.T) {
+	db := &fakeTwoFactorDB{}
+	codes, err := replaceRecoveryCodes(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(db.unused) != recoveryCodeCount {
+		t.Fatalf("%d codes, %d stored, want %d", len(codes), len(db.unused), recoveryCodeCount)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"first use", codes[0], true},
+		{"second use", codes[0], false},
+		{"case, spaces and dash are ignored", " " + strings.ToUpper(strings.Replace(codes[1], "-", " ", 1)), true},
+		{"reused in another form", strings.ReplaceAll(codes[1], "-", ""), false},
+		{"unknown code", "00000-00000", false},
+	}
+	for _, tt := range tests {
+		ok, err := consumeRecoveryCode(db, 1, tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s: consumeRecoveryCode(%q) = %v, want %v", tt.name, tt.code, ok, tt.want)
+		}
+	}
+	if len(db.unused) != recoveryCodeCount-2 {
+		t.Errorf("%d unused codes left, want %d", len(db.unused), recoveryCodeCount-2)
+	}
+
+	// 重新生成后旧恢复码全部作废
+	if _, err := replaceRecoveryCodes(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := consumeRecoveryCode(db, 1, codes[2]); ok {
+		t.Error("recovery code from the replaced set was accepted")
+	}
+}
@@ -0,0 +1,155 @@
+// Package idempotency 按 Idempotency-Key 请求头对 POST 请求去重
+//
+// 客户端为一次操作生成唯一的 key，网络重试或重复点击时带上同一个 key，
+// 服务端只执行一次，之后的重试直接返回第一次的响应。
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Header 客户端传递幂等键的请求头
+	Header = "Idempotency-Key"
+	// ReplayedHeader 重放的响应带有这个响应头
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	// 带幂等键的请求体需要整个读入内存计算摘要，超过这个大小时返回 413
+	maxBodySize = 1 << 20
+	// 请求处理中的占位记录的有效期，进程在处理中途退出时，超过这个时间后可以用同一个 key 重试
+	lockTimeout = time.Minute
+)
+
+// Record 一个幂等键的记录，Completed 为 false 表示第一次请求仍在处理
+type Record struct {
+	Key         string
+	RequestHash string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Store 幂等键的存储，内存实现用于单实例，Postgres 实现用于多副本共享
+type Store interface {
+	// Reserve key 不存在或已过期时写入处理中的占位记录并返回 nil，否则返回已有的记录
+	Reserve(ctx context.Context, key, requestHash string, now, lockedUntil time.Time) (*Record, error)
+	// Complete 保存响应，记录保留到 expiresAt
+	Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error
+	// Release 删除占位记录，允许用同一个 key 重试
+	Release(ctx context.Context, key string) error
+}
+
+// Middleware 对带 Idempotency-Key 的 POST 请求去重，响应保留 ttl
+// key 按用户隔离，需要在 AuthMiddleware 之后使用。5xx 响应不保存，客户端可以用同一个 key 重试
+func Middleware(store Store, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Idempotency-Key must be at most %d characters", maxKeyLength)})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body must be at most %d bytes", maxBodySize)})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// 同一个 key 用在不同的接口或不同的请求体上都视为冲突
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+		scoped := fmt.Sprintf("%d:%s", c.GetInt("user_id"), key)
+
+		ctx := c.Request.Context()
+		now := time.Now().UTC()
+		existing, err := store.Reserve(ctx, scoped, requestHash, now, now.Add(lockTimeout))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check idempotency key"})
+			c.Abort()
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != requestHash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key has already been used with a different request"})
+			case !existing.Completed:
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+			default:
+				c.Header(ReplayedHeader, "true")
+				c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// 5xx、保存失败或处理器 panic 时释放占位记录
+			if !completed {
+				if err := store.Release(context.Background(), scoped); err != nil {
+					log.Printf("Failed to release idempotency key: %v", err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		err = store.Complete(ctx, scoped, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes(), time.Now().UTC().Add(ttl))
+		if err != nil {
+			log.Printf("Failed to save idempotent response: %v", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// responseRecorder 在写出响应的同时保存一份响应体
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
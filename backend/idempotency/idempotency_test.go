@@ -0,0 +1,83 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRouter(calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Next()
+	})
+	r.Use(Middleware(NewMemoryStore(), time.Hour))
+	r.POST("/orders", func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusCreated, gin.H{"call": *calls})
+	})
+	r.POST("/other", func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusCreated, gin.H{"call": *calls})
+	})
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls int
+	r := newRouter(&calls)
+
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(Header, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		key      string
+		body     string
+		status   int
+		replayed bool
+		calls    int
+	}{
+		{"first request", "/orders", "k1", `{"a":1}`, http.StatusCreated, false, 1},
+		{"retry is replayed", "/orders", "k1", `{"a":1}`, http.StatusCreated, true, 1},
+		{"different body", "/orders", "k1", `{"a":2}`, http.StatusUnprocessableEntity, false, 1},
+		{"different path", "/other", "k1", `{"a":1}`, http.StatusUnprocessableEntity, false, 1},
+		{"new key", "/orders", "k2", `{"a":1}`, http.StatusCreated, false, 2},
+		{"no key", "/orders", "", `{"a":1}`, http.StatusCreated, false, 3},
+		{"key too long", "/orders", strings.Repeat("k", maxKeyLength+1), `{}`, http.StatusBadRequest, false, 3},
+		{"body at limit", "/orders", "k3", strings.Repeat(" ", maxBodySize), http.StatusCreated, false, 4},
+		{"body too large", "/orders", "k4", strings.Repeat(" ", maxBodySize+1), http.StatusRequestEntityTooLarge, false, 4},
+		{"large body without key", "/orders", "", strings.Repeat(" ", maxBodySize+1), http.StatusCreated, false, 5},
+	}
+	for _, tt := range tests {
+		w := send(tt.path, tt.key, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d; body: %s", tt.name, w.Code, tt.status, w.Body.String())
+		}
+		if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != tt.replayed {
+			t.Errorf("%s: replayed = %v, want %v", tt.name, replayed, tt.replayed)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: handler called %d times, want %d", tt.name, calls, tt.calls)
+		}
+	}
+
+	// 被 413 拒绝的 key 没有留下占位记录，可以用正常大小的请求体重试
+	if w := send("/orders", "k4", `{"a":1}`); w.Code != http.StatusCreated {
+		t.Errorf("retry after 413: status = %d, want 201", w.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内存储，只适合单实例部署
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key, requestHash string, now, lockedUntil time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(now)
+
+	if record, ok := s.records[key]; ok {
+		copied := *record
+		return &copied, nil
+	}
+	s.records[key] = &Record{Key: key, RequestHash: requestHash, ExpiresAt: lockedUntil}
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; ok {
+		record.Completed = true
+		record.StatusCode = statusCode
+		record.ContentType = contentType
+		record.Body = append([]byte(nil), body...)
+		record.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; ok && !record.Completed {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// purge 清理已过期的记录
+func (s *MemoryStore) purge(now time.Time) {
+	for key, record := range s.records {
+		if record.ExpiresAt.Before(now) {
+			delete(s.records, key)
+		}
+	}
+}
+
+// PostgresStore 基于 idempotency_keys 表的存储，多副本共享同一份记录
+// 时间统一以UTC写入，避免 TIMESTAMP 列受数据库时区影响
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Reserve(ctx context.Context, key, requestHash string, now, lockedUntil time.Time) (*Record, error) {
+	// 顺带清理其他过期记录；同一个 key 的过期记录直接被新的占位记录覆盖
+	var reserved string
+	err := s.db.QueryRowContext(ctx, `
+		WITH purged AS (
+			DELETE FROM idempotency_keys WHERE expires_at < $3 AND key <> $1
+		)
+		INSERT INTO idempotency_keys (key, request_hash, expires_at, created_at)
+		VALUES ($1, $2, $4, $3)
+		ON CONFLICT (key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code = NULL,
+			content_type = NULL,
+			response_body = NULL,
+			expires_at = EXCLUDED.expires_at,
+			created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.expires_at < $3
+		RETURNING key
+	`, key, requestHash, now.UTC(), lockedUntil.UTC()).Scan(&reserved)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var record Record
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	err = s.db.QueryRowContext(ctx, `
+		SELECT key, request_hash, status_code, content_type, response_body, expires_at
+		FROM idempotency_keys WHERE key = $1
+	`, key).Scan(&record.Key, &record.RequestHash, &statusCode, &contentType, &record.Body, &record.ExpiresAt)
+	if err == sql.ErrNoRows {
+		// 记录在两次查询之间被释放，按处理中返回，由客户端稍后重试
+		return &Record{Key: key, RequestHash: requestHash}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.Completed = statusCode.Valid
+	record.StatusCode = int(statusCode.Int64)
+	record.ContentType = contentType.String
+	return &record, nil
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $1, content_type = $2, response_body = $3, expires_at = $4
+		WHERE key = $5
+	`, statusCode, contentType, body, expiresAt.UTC(), key)
+	return err
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL", key)
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"food-ordering/personalize"
+	"food-ordering/related"
+	"food-ordering/store"
+)
+
+// runCartExpiry 每隔 interval 清理超过 ttl 未修改的购物车，多副本同时运行时结果相同
+func runCartExpiry(ctx context.Context, carts store.CartStore, ttl, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := carts.ExpireBefore(ctx, time.Now().Add(-ttl))
+		if err != nil {
+			log.Printf("Failed to expire carts: %v", err)
+		} else if n > 0 {
+			log.Printf("Expired %d idle carts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// personalizationBatch 每次查询需要重新计算的用户数
+const personalizationBatch = 100
+
+// runPersonalization 每隔 interval 重新计算有新订单、订单状态变化、新收藏或取消收藏的用户的个性化推荐，
+// 超过 maxAge 未计算的用户也会重新计算，使时间衰减和“最近吃过”的扣分随时间变化
+func runPersonalization(ctx context.Context, st *store.Store, interval, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := refreshPersonalization(ctx, st, maxAge)
+		if err != nil {
+			log.Printf("Failed to refresh personal recommendations: %v", err)
+		} else if n > 0 {
+			log.Printf("Refreshed personal recommendations for %d users", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshPersonalization 计算全部需要更新的用户，返回计算的用户数；
+// 同一轮中每个用户最多计算一次，计算期间又有新订单的用户留到下一轮
+func refreshPersonalization(ctx context.Context, st *store.Store, maxAge time.Duration) (int, error) {
+	done := make(map[int]bool)
+	for {
+		users, err := st.Personalization.StaleUsers(ctx, time.Now().UTC().Add(-maxAge), personalizationBatch)
+		if err != nil {
+			return len(done), err
+		}
+		progressed := false
+		for _, userID := range users {
+			if done[userID] {
+				continue
+			}
+			if err := personalizeUser(ctx, st, userID); err != nil {
+				return len(done), fmt.Errorf("user %d: %w", userID, err)
+			}
+			done[userID] = true
+			progressed = true
+		}
+		if len(users) < personalizationBatch || !progressed {
+			return len(done), nil
+		}
+	}
+}
+
+// personalizeUser 按用户的订单和收藏重新计算个性化推荐
+func personalizeUser(ctx context.Context, st *store.Store, userID int) error {
+	// 计算时间取读取历史之前，读取之后的新订单会让用户在下一轮重新计算
+	computedAt := time.Now().UTC().Truncate(time.Microsecond)
+	history, err := st.Personalization.History(ctx, userID)
+	if err != nil {
+		return err
+	}
+	candidates, err := st.Dishes.InCategories(ctx, history.CategoryIDs())
+	if err != nil {
+		return err
+	}
+	dishes := personalize.DefaultParams.Score(history, candidates, computedAt)
+	return st.Personalization.Save(ctx, userID, dishes, computedAt)
+}
+
+// runRelatedDishes 每隔 interval 按最近 window 内的订单重新统计菜品的共同点单，全量替换上一次的结果
+func runRelatedDishes(ctx context.Context, rel store.RelatedStore, interval, window time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := refreshRelatedDishes(ctx, rel, window)
+		if err != nil {
+			log.Printf("Failed to refresh related dishes: %v", err)
+		} else {
+			log.Printf("Refreshed related dishes from %d orders", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshRelatedDishes 重新统计一次，返回统计的订单数
+func refreshRelatedDishes(ctx context.Context, rel store.RelatedStore, window time.Duration) (int, error) {
+	baskets, err := rel.Baskets(ctx, time.Now().UTC().Add(-window))
+	if err != nil {
+		return 0, err
+	}
+	if err := rel.Replace(ctx, related.DefaultParams.Compute(baskets)); err != nil {
+		return 0, err
+	}
+	return len(baskets), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/money"
+	"food-ordering/personalize"
+	"food-ordering/store"
+)
+
+// seedDishes 在内存存储中创建一个分类和若干上架菜品
+func seedDishes(t *testing.T, st *store.Store, names ...string) []models.Dish {
+	t.Helper()
+
+	ctx := context.Background()
+	category, err := st.Categories.Create(ctx, models.CreateCategoryRequest{Name: "主菜"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dishes []models.Dish
+	for _, name := range names {
+		dish, err := st.Dishes.Create(ctx, models.CreateDishRequest{Name: name, CategoryID: category.ID, Price: money.New(1000)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dishes = append(dishes, *dish)
+	}
+	return dishes
+}
+
+func TestRefreshPersonalization(t *testing.T) {
+	ctx := context.Background()
+	mem := store.NewMemory()
+	st := mem.Store()
+	alice := mem.SeedUser(models.User{Username: "alice"}, "").ID
+	mem.SeedUser(models.User{Username: "bob"}, "")
+	dishes := seedDishes(t, st, "红烧肉", "清炒时蔬")
+
+	refresh := func(want int) *models.PersonalRecommendations {
+		t.Helper()
+		n, err := refreshPersonalization(ctx, st, 24*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("refreshPersonalization computed %d users, want %d", n, want)
+		}
+		personal, err := st.Personalization.Get(ctx, alice, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return personal
+	}
+	// 两次修改之间留出时间，使修改时间晚于上次计算时间
+	tick := func() { time.Sleep(2 * time.Microsecond) }
+
+	// 没有订单和收藏的用户不需要计算
+	refresh(0)
+
+	if err := st.Favorites.Add(ctx, alice, dishes[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	personal := refresh(1)
+	if len(personal.Dishes) == 0 || personal.Dishes[0].Dish.ID != dishes[0].ID || personal.Dishes[0].Reasons[0] != personalize.ReasonFavorite {
+		t.Fatalf("personal recommendations = %+v, want the favorite dish first", personal.Dishes)
+	}
+	refresh(0)
+
+	// 取消收藏后重新计算，不再以收藏为推荐原因
+	tick()
+	if err := st.Favorites.Remove(ctx, alice, dishes[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	personal = refresh(1)
+	for _, dish := range personal.Dishes {
+		for _, reason := range dish.Reasons {
+			if reason == personalize.ReasonFavorite {
+				t.Errorf("dish %d still recommended as a favorite after removal", dish.Dish.ID)
+			}
+		}
+	}
+	refresh(0)
+
+	// 下单后重新计算
+	tick()
+	if _, err := st.Orders.Create(ctx, alice, models.CreateOrderRequest{
+		Items: []models.CreateOrderItemRequest{{DishID: dishes[1].ID, Quantity: 2}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	personal = refresh(1)
+	if len(personal.Dishes) == 0 || personal.Dishes[0].Dish.ID != dishes[1].ID {
+		t.Errorf("personal recommendations = %+v, want the ordered dish first", personal.Dishes)
+	}
+	refresh(0)
+}
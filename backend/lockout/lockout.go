@@ -0,0 +1,140 @@
+package lockout
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+)
+
+// Attempt 某个用户名或IP的失败记录
+type Attempt struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// Store 失败记录的存储，内存实现用于单实例，Postgres 实现用于多副本共享
+type Store interface {
+	// Get 返回 key 的记录，不存在时返回 nil
+	Get(ctx context.Context, key string) (*Attempt, error)
+	// Increment 增加失败次数并返回新的次数；上次失败早于 resetBefore 时从1重新计数
+	Increment(ctx context.Context, key string, now, resetBefore time.Time) (int, error)
+	// Lock 设置 key 的锁定截止时间
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset 清除 key 的记录
+	Reset(ctx context.Context, key string) error
+	// List 返回最近有失败记录的全部 key
+	List(ctx context.Context, since time.Time) ([]Attempt, error)
+}
+
+// Policy 某一类 key 的限制策略
+type Policy struct {
+	// 允许的连续失败次数，超过后锁定 LockoutDuration
+	MaxFailures int
+	// 超过 FreeFailures 次后，每次失败的等待时间从 BaseDelay 开始指数增长
+	FreeFailures int
+	BaseDelay    time.Duration
+	// 锁定时长，同时也是失败计数的重置窗口
+	LockoutDuration time.Duration
+}
+
+// delay 第 failures 次失败后需要等待的时间
+func (p Policy) delay(failures int) time.Duration {
+	if failures >= p.MaxFailures {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeFailures {
+		return 0
+	}
+	d := time.Duration(float64(p.BaseDelay) * math.Pow(2, float64(failures-p.FreeFailures-1)))
+	if d > p.LockoutDuration {
+		return p.LockoutDuration
+	}
+	return d
+}
+
+// Guard 按用户名和IP两个维度限制登录失败
+type Guard struct {
+	store          Store
+	usernamePolicy Policy
+	ipPolicy       Policy
+	now            func() time.Time
+}
+
+func NewGuard(store Store, usernamePolicy, ipPolicy Policy) *Guard {
+	return &Guard{
+		store:          store,
+		usernamePolicy: usernamePolicy,
+		ipPolicy:       ipPolicy,
+		now:            time.Now,
+	}
+}
+
+func UsernameKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check 返回还需等待多久才允许再次尝试，0 表示允许
+func (g *Guard) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	now := g.now()
+	var wait time.Duration
+	for _, key := range []string{UsernameKey(username), IPKey(ip)} {
+		attempt, err := g.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if attempt == nil || attempt.LockedUntil == nil {
+			continue
+		}
+		if remaining := attempt.LockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// Fail 记录一次失败的登录
+func (g *Guard) Fail(ctx context.Context, username, ip string) error {
+	if err := g.fail(ctx, UsernameKey(username), g.usernamePolicy); err != nil {
+		return err
+	}
+	return g.fail(ctx, IPKey(ip), g.ipPolicy)
+}
+
+func (g *Guard) fail(ctx context.Context, key string, policy Policy) error {
+	now := g.now()
+	failures, err := g.store.Increment(ctx, key, now, now.Add(-policy.LockoutDuration))
+	if err != nil {
+		return err
+	}
+	if d := policy.delay(failures); d > 0 {
+		return g.store.Lock(ctx, key, now.Add(d))
+	}
+	return nil
+}
+
+// Succeed 登录成功后清除该用户名的失败记录
+// IP 的记录保留，避免攻击者用自己的账号登录来重置计数
+func (g *Guard) Succeed(ctx context.Context, username string) error {
+	return g.store.Reset(ctx, UsernameKey(username))
+}
+
+// List 返回仍在计数窗口内的失败记录
+func (g *Guard) List(ctx context.Context) ([]Attempt, error) {
+	window := g.usernamePolicy.LockoutDuration
+	if g.ipPolicy.LockoutDuration > window {
+		window = g.ipPolicy.LockoutDuration
+	}
+	return g.store.List(ctx, g.now().Add(-window))
+}
+
+// Clear 清除指定 key 的失败记录和锁定
+func (g *Guard) Clear(ctx context.Context, key string) error {
+	return g.store.Reset(ctx, key)
+}
@@ -0,0 +1,179 @@
+package lockout
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	backoff := Policy{MaxFailures: 10, FreeFailures: 3, BaseDelay: time.Second, LockoutDuration: 15 * time.Minute}
+	capped := Policy{MaxFailures: 20, FreeFailures: 0, BaseDelay: time.Minute, LockoutDuration: 10 * time.Minute}
+	tests := []struct {
+		name     string
+		policy   Policy
+		failures int
+		want     time.Duration
+	}{
+		{"first failure is free", backoff, 1, 0},
+		{"last free failure", backoff, 3, 0},
+		{"backoff starts at base delay", backoff, 4, time.Second},
+		{"backoff doubles", backoff, 5, 2 * time.Second},
+		{"backoff keeps doubling", backoff, 9, 32 * time.Second},
+		{"max failures locks out", backoff, 10, 15 * time.Minute},
+		{"beyond max failures", backoff, 12, 15 * time.Minute},
+		{"no free failures", capped, 1, time.Minute},
+		{"below the cap", capped, 4, 8 * time.Minute},
+		{"capped at lockout duration", capped, 5, 10 * time.Minute},
+		{"stays capped", capped, 19, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.delay(tt.failures); got != tt.want {
+				t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestGuard 使用内存存储和可调的时钟
+func newTestGuard() (*Guard, *time.Time) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	guard := NewGuard(NewMemoryStore(),
+		Policy{MaxFailures: 3, FreeFailures: 1, BaseDelay: time.Second, LockoutDuration: 15 * time.Minute},
+		Policy{MaxFailures: 5, FreeFailures: 4, BaseDelay: time.Second, LockoutDuration: time.Hour},
+	)
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	type step struct {
+		fail     string // 用户名@IP 登录失败一次
+		succeed  string // 用户名登录成功
+		advance  time.Duration
+		check    string // 用户名@IP 的等待时间应为 want
+		want     time.Duration
+		failures map[string]int // 各 key 的失败次数，0 表示没有记录
+	}
+	split := func(s string) (string, string) {
+		username, ip, _ := strings.Cut(s, "@")
+		return username, ip
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"per username", []step{
+			{fail: "alice@10.0.0.1"},
+			{check: "alice@10.0.0.9", want: 0},
+			{fail: "alice@10.0.0.2"},
+			{check: "alice@10.0.0.9", want: time.Second},
+			{check: "bob@10.0.0.1", want: 0},
+			{fail: "Alice @10.0.0.3"},
+			{check: "alice@10.0.0.9", want: 15 * time.Minute, failures: map[string]int{
+				"user:alice": 3, "ip:10.0.0.1": 1, "ip:10.0.0.2": 1, "ip:10.0.0.3": 1,
+			}},
+			{advance: 10 * time.Minute, check: "alice@10.0.0.9", want: 5 * time.Minute},
+			{advance: 5 * time.Minute, check: "alice@10.0.0.9", want: 0},
+		}},
+		{"per IP", []step{
+			{fail: "u1@10.0.0.1"},
+			{fail: "u2@10.0.0.1"},
+			{fail: "u3@10.0.0.1"},
+			{fail: "u4@10.0.0.1"},
+			{check: "u5@10.0.0.1", want: 0},
+			{fail: "u5@10.0.0.1"},
+			{check: "u6@10.0.0.1", want: time.Hour, failures: map[string]int{"ip:10.0.0.1": 5, "user:u1": 1}},
+			{check: "u6@10.0.0.2", want: 0},
+		}},
+		{"reset on success", []step{
+			{fail: "alice@10.0.0.1"},
+			{fail: "alice@10.0.0.1"},
+			{check: "alice@10.0.0.2", want: time.Second},
+			{succeed: "alice", check: "alice@10.0.0.2", want: 0, failures: map[string]int{"user:alice": 0, "ip:10.0.0.1": 2}},
+			{fail: "alice@10.0.0.1", check: "alice@10.0.0.2", want: 0, failures: map[string]int{"user:alice": 1}},
+		}},
+		{"count resets after the window", []step{
+			{fail: "alice@10.0.0.1"},
+			{fail: "alice@10.0.0.1"},
+			{advance: 16 * time.Minute, fail: "alice@10.0.0.2"},
+			{check: "alice@10.0.0.3", want: 0, failures: map[string]int{"user:alice": 1, "ip:10.0.0.1": 2}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, now := newTestGuard()
+			for i, s := range tt.steps {
+				*now = now.Add(s.advance)
+				if s.succeed != "" {
+					if err := guard.Succeed(ctx, s.succeed); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if s.fail != "" {
+					username, ip := split(s.fail)
+					if err := guard.Fail(ctx, username, ip); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if s.check != "" {
+					username, ip := split(s.check)
+					wait, err := guard.Check(ctx, username, ip)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if wait != s.want {
+						t.Errorf("step %d: Check(%s) = %v, want %v", i, s.check, wait, s.want)
+					}
+				}
+				for key, want := range s.failures {
+					attempt, err := guard.store.Get(ctx, key)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got := 0
+					if attempt != nil {
+						got = attempt.Failures
+					}
+					if got != want {
+						t.Errorf("step %d: %s failures = %d, want %d", i, key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGuardListAndClear(t *testing.T) {
+	ctx := context.Background()
+	guard, now := newTestGuard()
+	guard.Fail(ctx, "alice", "10.0.0.1")
+	*now = now.Add(time.Minute)
+	guard.Fail(ctx, "bob", "10.0.0.1")
+
+	attempts, err := guard.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, attempt := range attempts {
+		keys = append(keys, attempt.Key)
+	}
+	// 最近失败的在前，bob 与 IP 同一时刻失败，两者之间的顺序不固定
+	if len(keys) != 3 || keys[2] != "user:alice" {
+		t.Errorf("List() = %v, want user:alice last of 3", keys)
+	}
+
+	if err := guard.Clear(ctx, IPKey("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Hour)
+	attempts, _ = guard.List(ctx)
+	if len(attempts) != 0 {
+		t.Errorf("List() after clearing the IP and the window passing = %+v, want none", attempts)
+	}
+}
@@ -0,0 +1,175 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内存储，只适合单实例部署
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]*Attempt
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]*Attempt)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *attempt
+	return &copied, nil
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, now, resetBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(key, now, resetBefore)
+
+	attempt, ok := s.attempts[key]
+	if !ok || attempt.LastFailureAt.Before(resetBefore) {
+		attempt = &Attempt{Key: key}
+		s.attempts[key] = attempt
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	return attempt.Failures, nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.attempts[key]; ok {
+		attempt.LockedUntil = &until
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, since time.Time) ([]Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Attempt
+	for _, attempt := range s.attempts {
+		if attempt.LastFailureAt.After(since) {
+			result = append(result, *attempt)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastFailureAt.After(result[j].LastFailureAt)
+	})
+	return result, nil
+}
+
+// purge 清理已过期的记录，防止大量随机用户名撑爆内存
+// 用户名和IP的计数窗口不同，只按 resetBefore 清理与 key 同类（前缀相同）的记录
+func (s *MemoryStore) purge(key string, now, resetBefore time.Time) {
+	kind := key[:strings.IndexByte(key, ':')+1]
+	for other, attempt := range s.attempts {
+		if !strings.HasPrefix(other, kind) {
+			continue
+		}
+		if attempt.LastFailureAt.Before(resetBefore) && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(now)) {
+			delete(s.attempts, other)
+		}
+	}
+}
+
+// PostgresStore 基于 login_attempts 表的存储，多副本共享同一份计数
+// 时间统一以UTC写入，避免 TIMESTAMP 列受数据库时区影响
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (*Attempt, error) {
+	var attempt Attempt
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT key, failures, last_failure_at, locked_until
+		FROM login_attempts WHERE key = $1
+	`, key).Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		attempt.LockedUntil = &lockedUntil.Time
+	}
+	return &attempt, nil
+}
+
+func (s *PostgresStore) Increment(ctx context.Context, key string, now, resetBefore time.Time) (int, error) {
+	var failures int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures
+	`, key, now.UTC(), resetBefore.UTC()).Scan(&failures)
+	return failures, err
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE login_attempts SET locked_until = $1 WHERE key = $2", until.UTC(), key)
+	return err
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
+
+func (s *PostgresStore) List(ctx context.Context, since time.Time) ([]Attempt, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT key, failures, last_failure_at, locked_until
+		FROM login_attempts
+		WHERE last_failure_at > $1 OR locked_until > $2
+		ORDER BY last_failure_at DESC
+	`, since.UTC(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Attempt
+	for rows.Next() {
+		var attempt Attempt
+		var lockedUntil sql.NullTime
+		if err := rows.Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &lockedUntil); err != nil {
+			return nil, err
+		}
+		if lockedUntil.Valid {
+			attempt.LockedUntil = &lockedUntil.Time
+		}
+		result = append(result, attempt)
+	}
+	return result, rows.Err()
+}
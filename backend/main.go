@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
 	"food-ordering/config"
 	"food-ordering/database"
+	"food-ordering/events"
 	"food-ordering/handlers"
+	"food-ordering/idempotency"
+	"food-ordering/lockout"
 	"food-ordering/middleware"
 	"food-ordering/models"
+	"food-ordering/money"
+	"food-ordering/oidc"
+	"food-ordering/payment"
+	"food-ordering/store"
 	"log"
 	"net/http"
+	"os"
+	_ "time/tzdata" // 内嵌时区数据，预约时段按 schedule_timezone 计算，不依赖系统的时区文件
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -16,6 +26,7 @@ import (
 func main() {
 	// 加载配置
 	cfg := config.Load()
+	money.DefaultCurrency = cfg.Currency
 
 	// 初始化数据库
 	db, err := database.Init(cfg)
@@ -24,23 +35,112 @@ func main() {
 	}
 	defer db.Close()
 
+	// migrate 子命令：只执行迁移操作后退出
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(db, os.Args[2:]); err != nil {
+			log.Fatal("Migration failed:", err)
+		}
+		return
+	}
+
 	// 自动迁移数据库表
 	if err := models.AutoMigrate(db); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// 初始化令牌服务
+	tokens, err := middleware.NewTokenService(cfg, db)
+	if err != nil {
+		log.Fatal("Failed to initialize token service:", err)
+	}
+
+	// 初始化登录防爆破，多副本部署时使用 postgres 存储共享失败计数
+	var attemptStore lockout.Store = lockout.NewMemoryStore()
+	if cfg.LoginAttemptStore == "postgres" {
+		attemptStore = lockout.NewPostgresStore(db)
+	}
+	guard := lockout.NewGuard(attemptStore,
+		lockout.Policy{
+			MaxFailures:     cfg.LoginMaxFailures,
+			FreeFailures:    2,
+			BaseDelay:       cfg.LoginBackoffBase,
+			LockoutDuration: cfg.LoginLockoutDuration,
+		},
+		lockout.Policy{
+			MaxFailures:     cfg.LoginMaxIPFailures,
+			FreeFailures:    cfg.LoginMaxIPFailures / 2,
+			BaseDelay:       cfg.LoginBackoffBase,
+			LockoutDuration: cfg.LoginLockoutDuration,
+		},
+	)
+
+	// 初始化单点登录，未配置 OIDC_ISSUER 时不启用
+	var sso *oidc.Provider
+	if cfg.OIDCIssuer != "" {
+		sso = oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		})
+	}
+
+	// 初始化幂等键存储，多副本部署时使用 postgres 共享
+	var idempotencyStore idempotency.Store = idempotency.NewMemoryStore()
+	if cfg.IdempotencyStore == "postgres" {
+		idempotencyStore = idempotency.NewPostgresStore(db)
+	}
+	idempotent := idempotency.Middleware(idempotencyStore, cfg.IdempotencyTTL)
+
+	// 初始化订单实时推送，多副本部署时通过 postgres 的 LISTEN/NOTIFY 在副本间转发事件
+	var eventBackend events.Backend
+	if cfg.OrderEventBroker == "postgres" {
+		eventBackend = events.NewPostgresBackend(db, cfg.DatabaseURL)
+	}
+	hub := events.NewHub(cfg.OrderEventBuffer, eventBackend)
+	go func() {
+		if err := hub.Run(context.Background()); err != nil {
+			log.Printf("Order event hub stopped: %v", err)
+		}
+	}()
+
+	// 初始化支付渠道，未配置 PAYMENT_PROVIDER 时不启用在线支付
+	var payments payment.Provider
+	if cfg.PaymentProvider != "" && cfg.PaymentWebhookSecret == "" {
+		log.Fatal("PAYMENT_WEBHOOK_SECRET is required when PAYMENT_PROVIDER is set")
+	}
+	switch cfg.PaymentProvider {
+	case "":
+	case "fake":
+		payments = payment.NewFake(cfg.PaymentWebhookSecret, cfg.PaymentWebhookURL)
+	default:
+		log.Fatalf("Unknown payment provider %q", cfg.PaymentProvider)
+	}
+
 	// 初始化处理器
-	handler := handlers.NewHandler(db, cfg)
+	st := store.NewPostgres(db)
+	handler := handlers.NewHandler(db, st, cfg, tokens, guard, sso, hub, payments)
+
+	// 后台清理长时间未修改的购物车
+	go runCartExpiry(context.Background(), st.Carts, cfg.CartTTL, cfg.CartCleanupInterval)
+
+	// 后台计算个性化推荐，接口只读取计算结果
+	go runPersonalization(context.Background(), st, cfg.PersonalizationInterval, cfg.PersonalizationMaxAge)
 
-	// 设置Gin路由
-	r := gin.Default()
+	// 后台统计菜品共同点单，用于相关菜品和购物车推荐
+	go runRelatedDishes(context.Background(), st.Related, cfg.RelatedDishesInterval, cfg.RelatedDishesWindow)
+
+	// 设置Gin路由，请求日志隐去流式路由 URL 中的访问令牌
+	r := gin.New()
+	r.Use(middleware.Logger(), gin.Recovery())
 
 	// 配置CORS
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:8080"},
+		AllowOrigins:     cfg.AllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "Last-Event-ID", idempotency.Header},
+		ExposeHeaders:    []string{"Content-Length", idempotency.ReplayedHeader},
 		AllowCredentials: true,
 	}))
 
@@ -54,42 +154,130 @@ func main() {
 		public := api.Group("/")
 		{
 			public.POST("/login", handler.Login)
+			public.POST("/login/2fa", handler.LoginTwoFactor)
+			public.POST("/login/2fa/enroll", handler.EnrollTwoFactor)
+			public.GET("/auth/sso", handler.GetSSOConfig)
+			public.POST("/auth/sso/login", handler.StartSSOLogin)
+			public.POST("/auth/sso/callback", handler.SSOCallback)
+			public.POST("/register", handler.Register)
+			public.POST("/token/refresh", handler.RefreshToken)
 			public.GET("/dishes", handler.GetDishes)
 			public.GET("/dishes/:id", handler.GetDish)
+			public.GET("/dishes/:id/related", handler.GetRelatedDishes)
 			public.GET("/categories", handler.GetCategories)
+			public.GET("/tags", handler.GetTags)
 			public.GET("/recommendations", handler.GetRecommendations)
+			public.GET("/recommendations/:id/generate", handler.GenerateRecommendation)
 			public.GET("/seasonal-dishes", handler.GetSeasonalDishes)
+			public.POST("/payments/webhook", handler.PaymentWebhook)
+			// 模拟支付渠道的支付页面，凭 client_secret 完成支付，仅 PAYMENT_PROVIDER=fake 时可用
+			public.POST("/payments/fake/pay", handler.FakePay)
 		}
 
-		// 需要认证的路由
+		// 需要认证的路由，只接受登录会话；API 密钥只能访问按权限授权的管理路由
+		// 带 Idempotency-Key 请求头的 POST 请求会按 key 去重
 		protected := api.Group("/")
-		protected.Use(middleware.AuthMiddleware())
+		protected.Use(tokens.AuthMiddleware(), middleware.RequireSession(), idempotent)
 		{
+			protected.POST("/logout", handler.Logout)
 			protected.GET("/profile", handler.GetProfile)
+			protected.PUT("/profile", handler.UpdateProfile)
+			protected.PUT("/profile/password", handler.ChangePassword)
+			protected.POST("/profile/2fa/setup", handler.SetupTwoFactor)
+			protected.POST("/profile/2fa/confirm", handler.ConfirmTwoFactor)
+			protected.DELETE("/profile/2fa", handler.DisableTwoFactor)
+			protected.POST("/profile/2fa/recovery-codes", handler.RegenerateRecoveryCodes)
+			protected.GET("/profile/api-keys", handler.GetAPIKeys)
+			protected.POST("/profile/api-keys", handler.CreateAPIKey)
+			protected.DELETE("/profile/api-keys/:id", handler.DeleteAPIKey)
 			protected.POST("/orders", handler.CreateOrder)
 			protected.GET("/orders", handler.GetOrders)
+			protected.GET("/orders/:id", handler.GetOrder)
+			protected.POST("/orders/:id/cancel", handler.CancelOrder)
+			protected.POST("/orders/:id/pay", handler.CreatePayment)
+			protected.GET("/orders/:id/payment", handler.GetPayment)
+			protected.GET("/cart", handler.GetCart)
+			protected.DELETE("/cart", handler.ClearCart)
+			protected.POST("/cart/items", handler.AddCartItem)
+			protected.PUT("/cart/items/:dishId", handler.UpdateCartItem)
+			protected.DELETE("/cart/items/:dishId", handler.RemoveCartItem)
+			protected.POST("/cart/checkout", handler.Checkout)
+			protected.GET("/cart/suggestions", handler.GetCartSuggestions)
 			protected.POST("/favorites/:dishId", handler.AddToFavorites)
 			protected.DELETE("/favorites/:dishId", handler.RemoveFromFavorites)
 			protected.GET("/favorites", handler.GetFavorites)
+			protected.GET("/recommendations/personal", handler.GetPersonalRecommendations)
+		}
+
+		// 订单事件流：浏览器的 EventSource 和 WebSocket 无法设置请求头，允许通过 access_token 查询参数传递访问令牌
+		stream := api.Group("/")
+		stream.Use(middleware.QueryToken(), tokens.AuthMiddleware())
+		{
+			stream.GET("/orders/stream", middleware.RequireSession(), handler.StreamOrderEvents)
+			stream.GET("/orders/ws", middleware.RequireSession(), handler.OrderEventsWebSocket)
+			stream.GET("/admin/orders/stream", middleware.RequirePermission("orders:read"), handler.StreamOrderEvents)
+			stream.GET("/admin/orders/ws", middleware.RequirePermission("orders:read"), handler.OrderEventsWebSocket)
 		}
 
-		// 管理员路由
+		// 厨房排期：按用餐时段列出预约订单
+		api.GET("/schedule", tokens.AuthMiddleware(), middleware.RequirePermission("orders:read"), handler.GetSchedule)
+
+		// 管理路由：按权限授权，角色与权限的映射见 roles/role_permissions 表
+		// 使用 API 密钥时，权限为密钥 scopes 与角色权限的交集
 		admin := api.Group("/admin")
-		admin.Use(middleware.AuthMiddleware())
-		admin.Use(middleware.AdminMiddleware())
+		admin.Use(tokens.AuthMiddleware(), idempotent)
 		{
-			admin.GET("/users", handler.GetUsers)
-			admin.POST("/dishes", handler.CreateDish)
-			admin.PUT("/dishes/:id", handler.UpdateDish)
-			admin.DELETE("/dishes/:id", handler.DeleteDish)
-			admin.POST("/categories", handler.CreateCategory)
-			admin.PUT("/categories/:id", handler.UpdateCategory)
-			admin.DELETE("/categories/:id", handler.DeleteCategory)
-			admin.GET("/config", handler.GetConfig)
-			admin.PUT("/config", handler.UpdateConfig)
+			admin.GET("/users", middleware.RequirePermission("users:read"), handler.GetUsers)
+			admin.POST("/users", middleware.RequirePermission("users:manage"), handler.CreateUser)
+			admin.PUT("/users/:id/role", middleware.RequirePermission("users:manage"), handler.UpdateUserRole)
+			admin.PUT("/users/:id/status", middleware.RequirePermission("users:manage"), handler.UpdateUserStatus)
+			admin.POST("/users/:id/reset-password", middleware.RequirePermission("users:manage"), handler.ResetUserPassword)
+			admin.DELETE("/users/:id", middleware.RequirePermission("users:manage"), handler.DeleteUser)
+			admin.DELETE("/users/:id/sessions", middleware.RequirePermission("users:manage"), handler.RevokeUserSessions)
+			admin.DELETE("/users/:id/2fa", middleware.RequirePermission("users:manage"), handler.ResetUserTwoFactor)
+			admin.GET("/lockouts", middleware.RequirePermission("users:manage"), handler.GetLockouts)
+			admin.DELETE("/lockouts", middleware.RequirePermission("users:manage"), handler.ClearLockout)
+			admin.GET("/roles", middleware.RequirePermission("roles:manage"), handler.GetRoles)
+			admin.POST("/roles", middleware.RequirePermission("roles:manage"), handler.CreateRole)
+			admin.PUT("/roles/:name/permissions", middleware.RequirePermission("roles:manage"), handler.UpdateRolePermissions)
+			admin.DELETE("/roles/:name", middleware.RequirePermission("roles:manage"), handler.DeleteRole)
+			admin.GET("/permissions", middleware.RequirePermission("roles:manage"), handler.GetPermissions)
+			admin.POST("/dishes", middleware.RequirePermission("dishes:manage"), handler.CreateDish)
+			admin.PUT("/dishes/:id", middleware.RequirePermission("dishes:manage"), handler.UpdateDish)
+			admin.DELETE("/dishes/:id", middleware.RequirePermission("dishes:manage"), handler.DeleteDish)
+			admin.POST("/categories", middleware.RequirePermission("categories:manage"), handler.CreateCategory)
+			admin.PUT("/categories/:id", middleware.RequirePermission("categories:manage"), handler.UpdateCategory)
+			admin.DELETE("/categories/:id", middleware.RequirePermission("categories:manage"), handler.DeleteCategory)
+			admin.POST("/tags", middleware.RequirePermission("categories:manage"), handler.CreateTag)
+			admin.PUT("/tags/:id", middleware.RequirePermission("categories:manage"), handler.UpdateTag)
+			admin.DELETE("/tags/:id", middleware.RequirePermission("categories:manage"), handler.DeleteTag)
+			admin.GET("/promotions", middleware.RequirePermission("promotions:manage"), handler.GetPromotions)
+			admin.POST("/promotions", middleware.RequirePermission("promotions:manage"), handler.CreatePromotion)
+			admin.GET("/promotions/:id", middleware.RequirePermission("promotions:manage"), handler.GetPromotion)
+			admin.PUT("/promotions/:id", middleware.RequirePermission("promotions:manage"), handler.UpdatePromotion)
+			admin.DELETE("/promotions/:id", middleware.RequirePermission("promotions:manage"), handler.DeletePromotion)
+			admin.GET("/recommendations", middleware.RequirePermission("recommendations:manage"), handler.GetAdminRecommendations)
+			admin.POST("/recommendations", middleware.RequirePermission("recommendations:manage"), handler.CreateRecommendation)
+			admin.GET("/recommendations/:id", middleware.RequirePermission("recommendations:manage"), handler.GetAdminRecommendation)
+			admin.PUT("/recommendations/:id", middleware.RequirePermission("recommendations:manage"), handler.UpdateRecommendation)
+			admin.DELETE("/recommendations/:id", middleware.RequirePermission("recommendations:manage"), handler.DeleteRecommendation)
+			admin.PUT("/recommendations/:id/dishes", middleware.RequirePermission("recommendations:manage"), handler.UpdateRecommendationDishes)
+			admin.POST("/recommendations/:id/activate", middleware.RequirePermission("recommendations:manage"), handler.ActivateRecommendation)
+			admin.POST("/recommendations/:id/deactivate", middleware.RequirePermission("recommendations:manage"), handler.DeactivateRecommendation)
+			admin.GET("/orders", middleware.RequirePermission("orders:read"), handler.GetAllOrders)
+			admin.GET("/orders/:id", middleware.RequirePermission("orders:read"), handler.GetAdminOrder)
+			admin.PUT("/orders/:id/status", middleware.RequirePermission("orders:update"), handler.UpdateOrderStatus)
+			admin.GET("/orders/:id/history", middleware.RequirePermission("orders:read"), handler.GetOrderStatusHistory)
+			admin.GET("/orders/:id/payment", middleware.RequirePermission("orders:read"), handler.GetAdminPayment)
+			admin.POST("/orders/:id/refund", middleware.RequirePermission("payments:refund"), handler.RefundPayment)
+			admin.GET("/config", middleware.RequirePermission("config:read"), handler.GetConfig)
+			admin.PUT("/config", middleware.RequirePermission("config:manage"), handler.UpdateConfig)
 		}
 	}
 
+	// 公开令牌验证公钥
+	r.GET("/.well-known/jwks.json", tokens.JWKSHandler)
+
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// API 密钥格式为 fo_<prefix>_<secret>
+// prefix 明文保存用于查找和在列表中辨认，secret 只保存 SHA-256 摘要
+const apiKeyTag = "fo"
+
+// 最近使用时间的更新间隔，避免每个请求都写库
+const apiKeyTouchInterval = time.Minute
+
+// GenerateAPIKey 生成新的 API 密钥，返回完整密钥、前缀和 secret 的摘要
+func GenerateAPIKey() (key, prefix, secretHash string, err error) {
+	prefix, err = RandomToken(4)
+	if err != nil {
+		return "", "", "", err
+	}
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	return apiKeyTag + "_" + prefix + "_" + secret, prefix, hashAPIKeySecret(secret), nil
+}
+
+// parseAPIKey 拆分出前缀和 secret
+func parseAPIKey(key string) (prefix, secret string, ok bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyTag || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyFromRequest 从 X-API-Key 或 Authorization: ApiKey 头中取出 API 密钥
+func apiKeyFromRequest(c *gin.Context) (string, bool) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key, true
+	}
+	if key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "ApiKey "); ok {
+		return strings.TrimSpace(key), true
+	}
+	return "", false
+}
+
+// authenticateAPIKey 校验 API 密钥
+// 密钥的有效权限是其 scopes 与用户当前角色权限的交集，角色被降级后密钥随之失去权限
+func (s *TokenService) authenticateAPIKey(c *gin.Context, key string) {
+	prefix, secret, ok := parseAPIKey(key)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	var keyID, userID int
+	var username, role, status, secretHash string
+	var expiresAt, lastUsedAt sql.NullTime
+	var permissions []string
+	var mustChangePassword bool
+	err := s.db.QueryRow(`
+		SELECT k.id, k.user_id, u.username, u.role, u.status, u.must_change_password, k.secret_hash, k.expires_at, k.last_used_at,
+			   ARRAY(SELECT permission FROM role_permissions WHERE role = u.role AND permission = ANY(k.scopes) ORDER BY permission)
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.prefix = $1
+	`, prefix).Scan(&keyID, &userID, &username, &role, &status, &mustChangePassword, &secretHash, &expiresAt, &lastUsedAt, pq.Array(&permissions))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify API key"})
+		c.Abort()
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(secretHash)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+	now := time.Now().UTC()
+	if expiresAt.Valid && now.After(expiresAt.Time) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+		c.Abort()
+		return
+	}
+	if status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		c.Abort()
+		return
+	}
+	if mustChangePassword && !passwordChangeRoutes[c.Request.Method+" "+c.FullPath()] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password change required"})
+		c.Abort()
+		return
+	}
+
+	if !lastUsedAt.Valid || now.Sub(lastUsedAt.Time) > apiKeyTouchInterval {
+		if _, err := s.db.Exec("UPDATE api_keys SET last_used_at = $1 WHERE id = $2", now, keyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify API key"})
+			c.Abort()
+			return
+		}
+	}
+
+	c.Set("user_id", userID)
+	c.Set("username", username)
+	c.Set("role", role)
+	c.Set("permissions", permissions)
+	c.Set("api_key_id", keyID)
+
+	c.Next()
+}
+
+// RequireSession 只允许登录会话访问，拒绝 API 密钥
+// 用于个人资料、密码、两步验证和密钥管理等账号相关的接口
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAPIKey := c.Get("api_key_id"); isAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot access this endpoint"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenKey 一个由 kid 标识的密钥
+// 签名密钥的 sign 为私钥或 HMAC 密钥，verify 为对应的公钥或同一个 HMAC 密钥
+type tokenKey struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// JWK JSON Web Key，只包含公钥信息
+type JWK struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func newHMACKey(id, secret string) (*tokenKey, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("jwt key %q: empty HMAC secret", id)
+	}
+	return &tokenKey{id: id, method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}, nil
+}
+
+// loadPrivateKey 从PEM文件加载 RS256 或 EdDSA 签名私钥
+func loadPrivateKey(id, algorithm, path string) (*tokenKey, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %q: %w", id, err)
+	}
+
+	switch algorithm {
+	case "RS256":
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", id, err)
+		}
+		return &tokenKey{id: id, method: jwt.SigningMethodRS256, sign: key, verify: &key.PublicKey}, nil
+	case "EdDSA":
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", id, err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("jwt key %q: not an Ed25519 private key", id)
+		}
+		return &tokenKey{id: id, method: jwt.SigningMethodEdDSA, sign: edKey, verify: edKey.Public()}, nil
+	default:
+		return nil, fmt.Errorf("jwt key %q: unsupported algorithm %q", id, algorithm)
+	}
+}
+
+// loadPublicKey 从PEM文件加载仅用于验证的公钥，算法由密钥类型决定
+func loadPublicKey(id, path string) (*tokenKey, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %q: %w", id, err)
+	}
+
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pemData); err == nil {
+		return &tokenKey{id: id, method: jwt.SigningMethodRS256, verify: key}, nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(pemData); err == nil {
+		return &tokenKey{id: id, method: jwt.SigningMethodEdDSA, verify: key}, nil
+	}
+	return nil, fmt.Errorf("jwt key %q: %s is neither an RSA nor an Ed25519 public key", id, path)
+}
+
+// jwk 返回公钥的 JWK 表示，HMAC 密钥不公开
+func (k *tokenKey) jwk() (JWK, bool) {
+	switch pub := k.verify.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyID:     k.id,
+			KeyType:   "RSA",
+			Algorithm: k.method.Alg(),
+			Use:       "sig",
+			N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyID:     k.id,
+			KeyType:   "OKP",
+			Algorithm: k.method.Alg(),
+			Use:       "sig",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	}
+	return JWK{}, false
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import "testing"
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/orders", "/api/v1/orders"},
+		{"/api/v1/orders?page=2", "/api/v1/orders?page=2"},
+		{"/api/v1/orders/stream?access_token=eyJhbGciOi.abc.def", "/api/v1/orders/stream?access_token=REDACTED"},
+		{"/api/v1/orders/ws?status=pending&access_token=secret", "/api/v1/orders/ws?access_token=REDACTED&status=pending"},
+		{"/api/v1/orders/stream?access_token=a&access_token=b", "/api/v1/orders/stream?access_token=REDACTED"},
+		{"/api/v1/orders/stream?access_token=%zz", "/api/v1/orders/stream"},
+		{"/api/v1/dishes?search=access_token", "/api/v1/dishes?search=access_token"},
+	}
+	for _, tt := range tests {
+		if got := redactQuery(tt.path); got != tt.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
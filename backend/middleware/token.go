@@ -0,0 +1,310 @@
+package middleware
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"food-ordering/config"
+	"food-ordering/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+// Claims 访问令牌中携带的声明
+type Claims struct {
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// ChallengeTTL 两步验证挑战令牌的有效期
+const ChallengeTTL = 5 * time.Minute
+
+const challengeAudience = "2fa"
+
+// TokenService 负责签发和校验访问令牌
+// 只有一个签名密钥，但可以同时持有多个验证密钥（按 kid 区分），用于密钥轮换
+type TokenService struct {
+	db               *sql.DB
+	signingKey       *tokenKey
+	verificationKeys map[string]*tokenKey
+	accessTTL        time.Duration
+	refreshTTL       time.Duration
+}
+
+// NewTokenService 根据配置加载签名密钥和验证密钥
+func NewTokenService(cfg *config.Config, db *sql.DB) (*TokenService, error) {
+	var signingKey *tokenKey
+	var err error
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		if cfg.JWTSecret == "your-secret-key" {
+			log.Println("WARNING: JWT_SECRET is using the insecure default value")
+		}
+		signingKey, err = newHMACKey(cfg.JWTKeyID, cfg.JWTSecret)
+	case "RS256", "EdDSA":
+		if cfg.JWTPrivateKeyFile == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", cfg.JWTAlgorithm)
+		}
+		signingKey, err = loadPrivateKey(cfg.JWTKeyID, cfg.JWTAlgorithm, cfg.JWTPrivateKeyFile)
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", cfg.JWTAlgorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TokenService{
+		db:               db,
+		signingKey:       signingKey,
+		verificationKeys: map[string]*tokenKey{signingKey.id: signingKey},
+		accessTTL:        cfg.AccessTokenTTL,
+		refreshTTL:       cfg.RefreshTokenTTL,
+	}
+
+	for id, secret := range cfg.JWTSecrets {
+		key, err := newHMACKey(id, secret)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.addVerificationKey(key); err != nil {
+			return nil, err
+		}
+	}
+	for id, path := range cfg.JWTPublicKeyFiles {
+		key, err := loadPublicKey(id, path)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.addVerificationKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *TokenService) addVerificationKey(key *tokenKey) error {
+	if _, exists := s.verificationKeys[key.id]; exists {
+		return fmt.Errorf("duplicate jwt key id %q", key.id)
+	}
+	s.verificationKeys[key.id] = key
+	return nil
+}
+
+// AccessTokenTTL 访问令牌有效期，过期后需要用刷新令牌换取新的访问令牌
+func (s *TokenService) AccessTokenTTL() time.Duration {
+	return s.accessTTL
+}
+
+// RefreshTokenTTL 刷新令牌有效期，每次刷新都会轮换出新的刷新令牌
+func (s *TokenService) RefreshTokenTTL() time.Duration {
+	return s.refreshTTL
+}
+
+// passwordChangeRoutes 需要修改密码的账号在改密前只能访问这些路由
+var passwordChangeRoutes = map[string]bool{
+	"GET /api/v1/profile":          true,
+	"PUT /api/v1/profile/password": true,
+	"POST /api/v1/logout":          true,
+}
+
+// AuthMiddleware 认证中间件，接受访问令牌或个人 API 密钥
+// 除了校验签名和有效期外，还会检查令牌所属的会话是否已被吊销、用户是否已被禁用、是否需要先修改密码
+func (s *TokenService) AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := apiKeyFromRequest(c); ok {
+			s.authenticateAPIKey(c, key)
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			c.Abort()
+			return
+		}
+
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if tokenString == authHeader {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
+			c.Abort()
+			return
+		}
+
+		claims, err := s.ParseJWT(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		// 角色、权限和状态以数据库为准，管理员修改后立即生效
+		var role, status string
+		var permissions []string
+		var mustChangePassword, revoked bool
+		err = s.db.QueryRow(`
+			SELECT u.role, u.status, u.must_change_password,
+				   ARRAY(SELECT permission FROM role_permissions WHERE role = u.role ORDER BY permission),
+				   EXISTS(SELECT 1 FROM refresh_tokens WHERE family_id = $2 AND revoked_at IS NOT NULL)
+			FROM users u
+			WHERE u.id = $1
+		`, claims.UserID, claims.SessionID).Scan(&role, &status, &mustChangePassword, pq.Array(&permissions), &revoked)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+		if status != "active" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			c.Abort()
+			return
+		}
+		if mustChangePassword && !passwordChangeRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password change required"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("role", role)
+		c.Set("permissions", permissions)
+		c.Set("session_id", claims.SessionID)
+
+		c.Next()
+	}
+}
+
+// GenerateJWT 用当前签名密钥生成属于 sessionID 会话的短期访问令牌
+func (s *TokenService) GenerateJWT(user models.User, sessionID string) (string, error) {
+	return s.sign(Claims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
+	}, s.accessTTL)
+}
+
+// GenerateChallenge 密码校验通过但还需要两步验证时签发的挑战令牌
+// 挑战令牌带有受众且没有会话，不能当作访问令牌使用
+func (s *TokenService) GenerateChallenge(user models.User) (string, error) {
+	return s.sign(Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience: jwt.ClaimStrings{challengeAudience},
+		},
+	}, ChallengeTTL)
+}
+
+// sign 补全 jti/iat/exp 后用当前签名密钥签名
+func (s *TokenService) sign(claims Claims, ttl time.Duration) (string, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.ID = jti
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+
+	token := jwt.NewWithClaims(s.signingKey.method, claims)
+	token.Header["kid"] = s.signingKey.id
+
+	tokenString, err := token.SignedString(s.signingKey.sign)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// ParseJWT 校验访问令牌并返回声明，缺少 exp/iat/jti/sid 或带有受众（挑战令牌）的令牌一律视为无效
+func (s *TokenService) ParseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keyFunc, jwt.WithIssuedAt())
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	if claims.ExpiresAt == nil || claims.IssuedAt == nil || claims.ID == "" || claims.SessionID == "" || len(claims.Audience) > 0 {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
+
+// ParseChallenge 校验两步验证挑战令牌并返回声明
+func (s *TokenService) ParseChallenge(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keyFunc, jwt.WithIssuedAt(), jwt.WithAudience(challengeAudience))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	if claims.ExpiresAt == nil || claims.IssuedAt == nil || claims.ID == "" {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
+
+// keyFunc 按令牌头中的 kid 选择验证密钥，并要求算法与密钥一致，防止算法混淆攻击
+func (s *TokenService) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.verificationKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.verify, nil
+}
+
+// JWKS 返回所有非对称验证密钥的公钥，供其他服务验证令牌
+func (s *TokenService) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range s.verificationKeys {
+		if jwk, ok := key.jwk(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+	return jwks
+}
+
+// JWKSHandler 公开 JWKS
+func (s *TokenService) JWKSHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, s.JWKS())
+}
@@ -0,0 +1,286 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"food-ordering/config"
+	"food-ordering/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys 测试用的 RSA 和 Ed25519 密钥对，PEM 文件写在临时目录
+type testKeys struct {
+	rsa                   *rsa.PrivateKey
+	ed                    ed25519.PrivateKey
+	rsaPrivate, rsaPublic string
+	edPrivate, edPublic   string
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	keys := &testKeys{rsa: rsaKey, ed: edKey}
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	keys.rsaPrivate = write("rsa.pem", "PRIVATE KEY", der, err)
+	der, err = x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	keys.rsaPublic = write("rsa.pub.pem", "PUBLIC KEY", der, err)
+	der, err = x509.MarshalPKCS8PrivateKey(edKey)
+	keys.edPrivate = write("ed.pem", "PRIVATE KEY", der, err)
+	der, err = x509.MarshalPKIXPublicKey(edKey.Public())
+	keys.edPublic = write("ed.pub.pem", "PUBLIC KEY", der, err)
+	return keys
+}
+
+func newTestTokenService(t *testing.T, cfg config.Config) *TokenService {
+	t.Helper()
+	cfg.AccessTokenTTL = 15 * time.Minute
+	cfg.RefreshTokenTTL = time.Hour
+	s, err := NewTokenService(&cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func accessToken(t *testing.T, s *TokenService) string {
+	t.Helper()
+	token, err := s.GenerateJWT(models.User{ID: 7, Username: "alice", Role: "user"}, "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestNewTokenService(t *testing.T) {
+	keys := newTestKeys(t)
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{"HS256", config.Config{JWTAlgorithm: "HS256", JWTKeyID: "k1", JWTSecret: "secret"}, ""},
+		{"RS256", config.Config{JWTAlgorithm: "RS256", JWTKeyID: "k1", JWTPrivateKeyFile: keys.rsaPrivate}, ""},
+		{"EdDSA", config.Config{JWTAlgorithm: "EdDSA", JWTKeyID: "k1", JWTPrivateKeyFile: keys.edPrivate}, ""},
+		{"unsupported algorithm", config.Config{JWTAlgorithm: "HS512", JWTKeyID: "k1", JWTSecret: "secret"},
+			`unsupported JWT_ALGORITHM "HS512"`},
+		{"empty secret", config.Config{JWTAlgorithm: "HS256", JWTKeyID: "k1"}, `jwt key "k1": empty HMAC secret`},
+		{"missing private key", config.Config{JWTAlgorithm: "RS256", JWTKeyID: "k1"}, "JWT_PRIVATE_KEY_FILE is required for RS256"},
+		{"private key of another type", config.Config{JWTAlgorithm: "EdDSA", JWTKeyID: "k1", JWTPrivateKeyFile: keys.rsaPrivate},
+			`jwt key "k1": `},
+		{"duplicate kid", config.Config{JWTAlgorithm: "HS256", JWTKeyID: "k1", JWTSecret: "secret",
+			JWTPublicKeyFiles: map[string]string{"k1": keys.rsaPublic}}, `duplicate jwt key id "k1"`},
+		{"not a public key", config.Config{JWTAlgorithm: "HS256", JWTKeyID: "k1", JWTSecret: "secret",
+			JWTPublicKeyFiles: map[string]string{"k0": keys.rsaPrivate}}, `jwt key "k0": `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTokenService(&tt.cfg, nil)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("NewTokenService() error = %v", err)
+			case tt.want != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.want)):
+				t.Errorf("NewTokenService() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys := newTestKeys(t)
+	hs := newTestTokenService(t, config.Config{JWTAlgorithm: "HS256", JWTKeyID: "hs-1", JWTSecret: "old secret"})
+	rs := newTestTokenService(t, config.Config{JWTAlgorithm: "RS256", JWTKeyID: "rs-1", JWTPrivateKeyFile: keys.rsaPrivate})
+	hsToken, rsToken := accessToken(t, hs), accessToken(t, rs)
+
+	tests := []struct {
+		name   string
+		cfg    config.Config
+		token  string
+		reject string // 为空表示应当通过
+	}{
+		{"new HMAC secret keeps the old one", config.Config{
+			JWTAlgorithm: "HS256", JWTKeyID: "hs-2", JWTSecret: "new secret", JWTSecrets: map[string]string{"hs-1": "old secret"},
+		}, hsToken, ""},
+		{"HMAC to RS256", config.Config{
+			JWTAlgorithm: "RS256", JWTKeyID: "rs-1", JWTPrivateKeyFile: keys.rsaPrivate, JWTSecrets: map[string]string{"hs-1": "old secret"},
+		}, hsToken, ""},
+		{"RS256 to EdDSA", config.Config{
+			JWTAlgorithm: "EdDSA", JWTKeyID: "ed-1", JWTPrivateKeyFile: keys.edPrivate, JWTPublicKeyFiles: map[string]string{"rs-1": keys.rsaPublic},
+		}, rsToken, ""},
+		{"old HMAC secret dropped", config.Config{
+			JWTAlgorithm: "HS256", JWTKeyID: "hs-2", JWTSecret: "new secret",
+		}, hsToken, `unknown jwt key id "hs-1"`},
+		{"old public key dropped", config.Config{
+			JWTAlgorithm: "EdDSA", JWTKeyID: "ed-1", JWTPrivateKeyFile: keys.edPrivate,
+		}, rsToken, `unknown jwt key id "rs-1"`},
+		{"same kid with another secret", config.Config{
+			JWTAlgorithm: "HS256", JWTKeyID: "hs-1", JWTSecret: "new secret",
+		}, hsToken, "signature is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestTokenService(t, tt.cfg)
+			claims, err := s.ParseJWT(tt.token)
+			switch {
+			case tt.reject == "" && err != nil:
+				t.Errorf("ParseJWT() error = %v", err)
+			case tt.reject == "" && (claims.UserID != 7 || claims.SessionID != "session-1"):
+				t.Errorf("ParseJWT() = %+v", claims)
+			case tt.reject != "" && (err == nil || !strings.Contains(err.Error(), tt.reject)):
+				t.Errorf("ParseJWT() error = %v, want %q", err, tt.reject)
+			}
+
+			// 新签发的令牌使用当前签名密钥
+			token, _, err := jwt.NewParser().ParseUnverified(accessToken(t, s), &Claims{})
+			if err != nil || token.Header["kid"] != tt.cfg.JWTKeyID || token.Method.Alg() != tt.cfg.JWTAlgorithm {
+				t.Errorf("new token header = %v, want kid %s and alg %s", token.Header, tt.cfg.JWTKeyID, tt.cfg.JWTAlgorithm)
+			}
+		})
+	}
+}
+
+func TestAlgorithmGuard(t *testing.T) {
+	keys := newTestKeys(t)
+	s := newTestTokenService(t, config.Config{
+		JWTAlgorithm: "RS256", JWTKeyID: "rs-1", JWTPrivateKeyFile: keys.rsaPrivate,
+		JWTSecrets:        map[string]string{"hs-1": "secret"},
+		JWTPublicKeyFiles: map[string]string{"ed-1": keys.edPublic},
+	})
+	rsaPublicPEM, err := os.ReadFile(keys.rsaPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := Claims{
+		UserID:    7,
+		SessionID: "session-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	forge := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"HS256 with the RSA public key as secret", forge(jwt.SigningMethodHS256, "rs-1", rsaPublicPEM), jwt.ErrSignatureInvalid},
+		{"HS256 with the Ed25519 public key as secret", forge(jwt.SigningMethodHS256, "ed-1", []byte(keys.ed.Public().(ed25519.PublicKey))),
+			jwt.ErrSignatureInvalid},
+		{"RS256 for an HMAC kid", forge(jwt.SigningMethodRS256, "hs-1", keys.rsa), jwt.ErrSignatureInvalid},
+		{"EdDSA for an RSA kid", forge(jwt.SigningMethodEdDSA, "rs-1", keys.ed), jwt.ErrSignatureInvalid},
+		{"none for an RSA kid", forge(jwt.SigningMethodNone, "rs-1", jwt.UnsafeAllowNoneSignatureType), jwt.ErrSignatureInvalid},
+		{"none for an HMAC kid", forge(jwt.SigningMethodNone, "hs-1", jwt.UnsafeAllowNoneSignatureType), jwt.ErrSignatureInvalid},
+		{"without kid", forge(jwt.SigningMethodRS256, "", keys.rsa), jwt.ErrTokenUnverifiable},
+		{"correctly signed", forge(jwt.SigningMethodRS256, "rs-1", keys.rsa), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ParseJWT(tt.token)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("ParseJWT() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	s := newTestTokenService(t, config.Config{
+		JWTAlgorithm: "RS256", JWTKeyID: "rs-2", JWTPrivateKeyFile: keys.rsaPrivate,
+		JWTSecrets:        map[string]string{"hs-1": "secret"},
+		JWTPublicKeyFiles: map[string]string{"ed-1": keys.edPublic},
+	})
+
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", s.JWKSHandler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var jwks JWKS
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil {
+		t.Fatal(err)
+	}
+
+	// HMAC 密钥不公开，其余按 kid 排序
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != "ed-1" || jwks.Keys[1].KeyID != "rs-2" {
+		t.Fatalf("JWKS = %+v, want ed-1 and rs-2", jwks)
+	}
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	ed := jwks.Keys[0]
+	if ed.KeyType != "OKP" || ed.Algorithm != "EdDSA" || ed.Use != "sig" || ed.Curve != "Ed25519" ||
+		!ed25519.PublicKey(decode(ed.X)).Equal(keys.ed.Public()) || ed.N != "" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	rs := jwks.Keys[1]
+	n := new(big.Int).SetBytes(decode(rs.N))
+	e := new(big.Int).SetBytes(decode(rs.E))
+	if rs.KeyType != "RSA" || rs.Algorithm != "RS256" || rs.Use != "sig" || rs.X != "" ||
+		n.Cmp(keys.rsa.N) != 0 || e.Int64() != int64(keys.rsa.E) {
+		t.Errorf("RSA JWK = %+v", rs)
+	}
+
+	hs := newTestTokenService(t, config.Config{JWTAlgorithm: "HS256", JWTKeyID: "hs-1", JWTSecret: "secret"})
+	if body, _ := json.Marshal(hs.JWKS()); string(body) != `{"keys":[]}` {
+		t.Errorf("JWKS of an HMAC-only service = %s", body)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"food-ordering/database"
+)
+
+const migrateUsage = "usage: food-ordering migrate up | down [steps] | status"
+
+// runMigrate 处理 migrate 子命令
+func runMigrate(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		for _, mig := range applied {
+			fmt.Printf("Applied %04d_%s\n", mig.Version, mig.Name)
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid steps %q: %s", args[1], migrateUsage)
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migrations to revert")
+		}
+		for _, mig := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", mig.Version, mig.Name)
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q: %s", args[0], migrateUsage)
+	}
+
+	return nil
+}
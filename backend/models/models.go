@@ -1,18 +1,41 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"log"
 	"time"
+
+	"food-ordering/database"
+	"food-ordering/money"
 )
 
 // 用户模型
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                 int       `json:"id"`
+	Username           string    `json:"username"`
+	Email              string    `json:"email"`
+	Role               string    `json:"role"`
+	Status             string    `json:"status"`
+	MustChangePassword bool      `json:"must_change_password"`
+	TwoFactorEnabled   bool      `json:"two_factor_enabled,omitempty"`
+	Permissions        []string  `json:"permissions,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// 角色及其权限
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// 权限
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 // 菜品分类模型
@@ -25,19 +48,37 @@ type Category struct {
 
 // 菜品模型
 type Dish struct {
-	ID            int       `json:"id"`
-	Name          string    `json:"name"`
-	Description   string    `json:"description"`
-	CategoryID    int       `json:"category_id"`
-	Category      *Category `json:"category,omitempty"`
-	Price         float64   `json:"price"`
-	ImageURL      string    `json:"image_url"`
-	VideoURL      string    `json:"video_url"`
-	CookingSteps  string    `json:"cooking_steps"`
-	IsSeasonal    bool      `json:"is_seasonal"`
-	IsActive      bool      `json:"is_active"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID           int         `json:"id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description"`
+	CategoryID   int         `json:"category_id"`
+	Category     *Category   `json:"category,omitempty"`
+	Price        money.Money `json:"price"`
+	ImageURL     string      `json:"image_url"`
+	VideoURL     string      `json:"video_url"`
+	CookingSteps string      `json:"cooking_steps"`
+	IsSeasonal   bool        `json:"is_seasonal"`
+	IsActive     bool        `json:"is_active"`
+	Tags         []string    `json:"tags"` // 标签的 slug，按字母顺序
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// 生成推荐菜单时用于区分荤菜、素菜，购物车凑一餐时用于区分荤菜、素菜、汤、主食的标签，不能删除
+const (
+	TagMeat      = "meat"
+	TagVegetable = "vegetable"
+	TagSoup      = "soup"
+	TagStaple    = "staple"
+)
+
+// 菜品标签，如荤菜、素菜、汤、辣；一道菜可以有多个标签
+type Tag struct {
+	ID          int       `json:"id"`
+	Slug        string    `json:"slug"` // 筛选和打标签时使用，创建后不能修改
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // 菜品营养信息
@@ -53,39 +94,296 @@ type DishNutrition struct {
 }
 
 // 订单模型
+// Subtotal 为明细原价合计，TotalAmount = Subtotal - DiscountAmount
+// 预约订单的 RequestedFor 为预约的用餐时间，MealSlot 为所在的用餐时段
 type Order struct {
-	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	TotalAmount float64   `json:"total_amount"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Items       []OrderItem `json:"items,omitempty"`
+	ID             int               `json:"id"`
+	UserID         int               `json:"user_id"`
+	Username       string            `json:"username,omitempty"`
+	Subtotal       money.Money       `json:"subtotal"`
+	DiscountAmount money.Money       `json:"discount_amount"`
+	TotalAmount    money.Money       `json:"total_amount"`
+	Status         string            `json:"status"`
+	RequestedFor   *time.Time        `json:"requested_for,omitempty"`
+	MealSlot       string            `json:"meal_slot,omitempty"`
+	PaymentStatus  string            `json:"payment_status,omitempty"` // 最近一次支付的状态，未支付时为空
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	Items          []OrderItem       `json:"items,omitempty"`
+	Adjustments    []OrderAdjustment `json:"adjustments,omitempty"`
+}
+
+// 排期视图中某一天的一个用餐时段
+type ScheduleSlot struct {
+	Date     string    `json:"date"`
+	MealSlot string    `json:"meal_slot"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	CutoffAt time.Time `json:"cutoff_at"`
+	Capacity int       `json:"capacity"` // 0 表示不限
+	Booked   int       `json:"booked"`
+	Orders   []Order   `json:"orders"`
 }
 
 // 订单明细
 type OrderItem struct {
-	ID        int       `json:"id"`
-	OrderID   int       `json:"order_id"`
-	DishID    int       `json:"dish_id"`
-	Dish      *Dish     `json:"dish,omitempty"`
-	Quantity  int       `json:"quantity"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int         `json:"id"`
+	OrderID   int         `json:"order_id"`
+	DishID    int         `json:"dish_id"`
+	Dish      *Dish       `json:"dish,omitempty"`
+	Quantity  int         `json:"quantity"`
+	Price     money.Money `json:"price"`
+	Note      string      `json:"note,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// 购物车中每种菜品的最大数量
+const MaxCartItemQuantity = 99
+
+// 购物车，价格和可用状态按菜品当前数据计算
+type Cart struct {
+	Items     []CartItem  `json:"items"`
+	Subtotal  money.Money `json:"subtotal"` // 可下单菜品按当前价格的合计，不含优惠
+	Warnings  []string    `json:"warnings"`
+	UpdatedAt *time.Time  `json:"updated_at"` // 购物车从未使用或已过期时为 null
+	ExpiresAt *time.Time  `json:"expires_at"`
+}
+
+// 购物车明细
+type CartItem struct {
+	DishID     int         `json:"dish_id"`
+	Dish       *Dish       `json:"dish,omitempty"`
+	Quantity   int         `json:"quantity"`
+	Note       string      `json:"note"`
+	AddedPrice money.Money `json:"added_price"` // 加入或修改时的价格
+	Price      money.Money `json:"price"`       // 当前价格
+	LineTotal  money.Money `json:"line_total"`
+	Available  bool        `json:"available"`
+	Warning    string      `json:"warning,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// 订单调整项：下单时应用的优惠，Amount 为负数
+type OrderAdjustment struct {
+	ID          int         `json:"id"`
+	OrderID     int         `json:"order_id"`
+	PromotionID *int        `json:"promotion_id"` // 优惠被删除后为 nil
+	Code        string      `json:"code,omitempty"`
+	Description string      `json:"description"`
+	Amount      money.Money `json:"amount"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// 订单状态
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusConfirmed = "confirmed"
+	OrderStatusPreparing = "preparing"
+	OrderStatusReady     = "ready"
+	OrderStatusCompleted = "completed"
+	OrderStatusCancelled = "cancelled"
+)
+
+// 订单状态机：每个状态允许流转到的下一个状态，completed 和 cancelled 为终态
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed: {OrderStatusPreparing, OrderStatusCancelled},
+	OrderStatusPreparing: {OrderStatusReady, OrderStatusCancelled},
+	OrderStatusReady:     {OrderStatusCompleted},
+	OrderStatusCompleted: {},
+	OrderStatusCancelled: {},
+}
+
+// IsOrderStatus 判断是否为合法的订单状态
+func IsOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransitionOrder 判断订单能否从 from 流转到 to
+func CanTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// 订单状态变更记录，from_status 为空表示订单创建
+type OrderStatusChange struct {
+	ID                int       `json:"id"`
+	OrderID           int       `json:"order_id"`
+	FromStatus        *string   `json:"from_status"`
+	ToStatus          string    `json:"to_status"`
+	ChangedBy         *int      `json:"changed_by"`
+	ChangedByUsername string    `json:"changed_by_username,omitempty"`
+	Note              string    `json:"note"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// 支付状态
+const (
+	PaymentStatusPending           = "pending"    // 已创建支付意图，等待顾客支付
+	PaymentStatusAuthorized        = "authorized" // 顾客已支付，资金冻结待扣款
+	PaymentStatusCaptured          = "captured"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusCancelled         = "cancelled"
+)
+
+// 支付状态机：failed、cancelled 和 refunded 为终态，前两者之后订单可以重新发起支付
+var paymentTransitions = map[string][]string{
+	PaymentStatusPending:           {PaymentStatusAuthorized, PaymentStatusCaptured, PaymentStatusFailed, PaymentStatusCancelled},
+	PaymentStatusAuthorized:        {PaymentStatusCaptured, PaymentStatusCancelled},
+	PaymentStatusCaptured:          {PaymentStatusPartiallyRefunded, PaymentStatusRefunded},
+	PaymentStatusPartiallyRefunded: {PaymentStatusPartiallyRefunded, PaymentStatusRefunded},
+	PaymentStatusRefunded:          {},
+	PaymentStatusFailed:            {},
+	PaymentStatusCancelled:         {},
+}
+
+// CanTransitionPayment 判断支付能否从 from 流转到 to
+func CanTransitionPayment(from, to string) bool {
+	for _, next := range paymentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPaymentSettled 判断支付是否已扣款（包括之后的部分或全部退款）
+func IsPaymentSettled(status string) bool {
+	return status == PaymentStatusCaptured || status == PaymentStatusPartiallyRefunded || status == PaymentStatusRefunded
+}
+
+// 订单的一次支付，ClientSecret 只返回给下单用户，用于在支付渠道完成支付
+type Payment struct {
+	ID             int             `json:"id"`
+	OrderID        int             `json:"order_id"`
+	Provider       string          `json:"provider"`
+	IntentID       string          `json:"intent_id"`
+	ClientSecret   string          `json:"client_secret,omitempty"`
+	Status         string          `json:"status"`
+	Amount         money.Money     `json:"amount"`
+	RefundedAmount money.Money     `json:"refunded_amount"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Refunds        []PaymentRefund `json:"refunds,omitempty"`
+}
+
+// 一笔退款，CreatedBy 为 nil 表示系统操作（如取消订单时自动退款）
+type PaymentRefund struct {
+	ID               int         `json:"id"`
+	PaymentID        int         `json:"payment_id"`
+	ProviderRefundID string      `json:"provider_refund_id"`
+	Amount           money.Money `json:"amount"`
+	Reason           string      `json:"reason"`
+	CreatedBy        *int        `json:"created_by"`
+	CreatedAt        time.Time   `json:"created_at"`
 }
 
-// 推荐配置
+// 支付渠道的回调事件，按渠道和事件 ID 去重
+type PaymentEvent struct {
+	Provider string
+	EventID  string
+	Type     string
+	IntentID string
+	Payload  []byte
+}
+
+// 优惠类型
+const (
+	PromotionPercentage  = "percentage"    // 按比例折扣
+	PromotionFixedAmount = "fixed_amount"  // 减免固定金额
+	PromotionBuyNGetOne  = "buy_n_get_one" // 买 N 送一，送价格最低的一份
+)
+
+// IsPromotionType 判断是否为合法的优惠类型
+func IsPromotionType(t string) bool {
+	return t == PromotionPercentage || t == PromotionFixedAmount || t == PromotionBuyNGetOne
+}
+
+// 优惠活动：Code 为空时满足条件自动生效，否则为优惠券，下单时填写代码才生效
+// DishID、CategoryID 限定参与优惠的菜品，都为空时整单参与；MinSpend 按参与优惠的菜品金额计算
+type Promotion struct {
+	ID                int         `json:"id"`
+	Name              string      `json:"name"`
+	Description       string      `json:"description"`
+	Code              string      `json:"code,omitempty"`
+	Type              string      `json:"type"`
+	PercentOff        int         `json:"percent_off"`  // percentage：折扣百分比，1-100
+	AmountOff         money.Money `json:"amount_off"`   // fixed_amount：减免金额
+	BuyQuantity       int         `json:"buy_quantity"` // buy_n_get_one：每买 N 份送一份
+	DishID            *int        `json:"dish_id"`
+	CategoryID        *int        `json:"category_id"`
+	MinSpend          money.Money `json:"min_spend"`
+	UsageLimitPerUser int         `json:"usage_limit_per_user"` // 每个用户可使用的订单数，0 表示不限，取消的订单不计
+	StartsAt          *time.Time  `json:"starts_at"`
+	EndsAt            *time.Time  `json:"ends_at"`
+	IsActive          bool        `json:"is_active"`
+	CreatedAt         time.Time   `json:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
+
+// 推荐配置类型
+const (
+	RecommendationTemplate = "template" // 规则模板，按荤素数量随机挑选菜品
+	RecommendationCurated  = "curated"  // 固定菜单，菜品由管理员选定
+)
+
+// 推荐配置，固定菜单的 Dishes 为选定的菜品
 type Recommendation struct {
 	ID               int       `json:"id"`
 	Name             string    `json:"name"`
 	Description      string    `json:"description"`
+	Type             string    `json:"type"`
 	MeatCount        int       `json:"meat_count"`
 	VegetableCount   int       `json:"vegetable_count"`
 	IsActive         bool      `json:"is_active"`
 	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 	Dishes           []Dish    `json:"dishes,omitempty"`
 }
 
+// 按推荐配置生成的菜单，Dishes 为选中的菜品（荤菜在前），用同一个 seed 可以重新得到这份菜单
+type GeneratedMenu struct {
+	Recommendation
+	Seed   int64        `json:"seed"`
+	Total  money.Money  `json:"total"`
+	Budget *money.Money `json:"budget,omitempty"`
+}
+
+// 个性化推荐的菜品，Reasons 为推荐原因，按贡献从大到小
+type PersonalDish struct {
+	Dish    Dish     `json:"dish"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// 个性化推荐结果，由后台任务计算；尚未计算过时 ComputedAt 为 nil
+type PersonalRecommendations struct {
+	Dishes     []PersonalDish `json:"dishes"`
+	ComputedAt *time.Time     `json:"computed_at"`
+}
+
+// 经常和某道菜一起点的菜品，CoOrders 为一起出现的订单数
+type RelatedDish struct {
+	Dish     Dish    `json:"dish"`
+	Score    float64 `json:"score"`
+	CoOrders int     `json:"co_orders"`
+}
+
+// 购物车“凑一餐”推荐，Reason 为 often_ordered_together 或 complements_cart
+type CartSuggestion struct {
+	Dish   Dish    `json:"dish"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
 // 用户收藏
 type UserFavorite struct {
 	ID        int       `json:"id"`
@@ -112,43 +410,255 @@ type LoginRequest struct {
 
 // 登录响应
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User  `json:"user"`
+	Token         string   `json:"token"`
+	RefreshToken  string   `json:"refresh_token"`
+	ExpiresIn     int      `json:"expires_in"`
+	User          User     `json:"user"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// 两步验证挑战：密码正确，但还需要提交验证码才能拿到令牌
+// enrollment_required 为 true 表示角色要求两步验证而用户尚未启用，需要先绑定验证器
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired  bool   `json:"two_factor_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ChallengeToken     string `json:"challenge_token"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+// 两步验证登录请求，code 和 recovery_code 二选一
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// 登录过程中绑定验证器的请求
+type TwoFactorEnrollRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// 个人 API 密钥，完整密钥只在创建时通过 key 返回一次
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// 创建 API 密钥请求，expires_at 为空表示永不过期
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// 单点登录回调请求，code 和 state 来自身份提供方跳转回前端时的地址栏参数
+type SSOCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// 验证器绑定信息
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// 验证码请求
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// 关闭两步验证请求
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// 恢复码，只在生成时返回一次
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// 刷新令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// 注册请求
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email,max=100"`
+}
+
+// 修改密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// 更新个人资料请求
+type UpdateProfileRequest struct {
+	Email *string `json:"email" binding:"omitempty,email,max=100"`
+}
+
+// 创建用户请求（管理员）
+type AdminCreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email,max=100"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// 创建角色请求（管理员）
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
 }
 
-// 创建订单请求
+// 修改角色权限请求（管理员）
+type UpdateRolePermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// 修改用户角色请求（管理员）
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// 修改用户状态请求（管理员）
+type UpdateUserStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active disabled"`
+}
+
+// 重置密码请求（管理员），不提供密码时自动生成临时密码
+type ResetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// 创建订单请求，RequestedFor 为空时立即下单；MealSlot 为空时按 RequestedFor 推断
 type CreateOrderRequest struct {
-	Items []CreateOrderItemRequest `json:"items" binding:"required"`
+	Items        []CreateOrderItemRequest `json:"items" binding:"required,min=1,dive"`
+	CouponCode   string                   `json:"coupon_code"`
+	RequestedFor *time.Time               `json:"requested_for"`
+	MealSlot     string                   `json:"meal_slot"`
 }
 
 type CreateOrderItemRequest struct {
-	DishID   int `json:"dish_id" binding:"required"`
-	Quantity int `json:"quantity" binding:"required,min=1"`
+	DishID   int    `json:"dish_id" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,min=1"`
+	Note     string `json:"note" binding:"max=200"`
+}
+
+// 加入购物车请求，菜品已在购物车中时累加数量
+type AddCartItemRequest struct {
+	DishID   int    `json:"dish_id" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,min=1,max=99"`
+	Note     string `json:"note" binding:"max=200"`
+}
+
+// 修改购物车明细请求，只修改非 nil 的字段
+type UpdateCartItemRequest struct {
+	Quantity *int    `json:"quantity" binding:"omitempty,min=1,max=99"`
+	Note     *string `json:"note" binding:"omitempty,max=200"`
+}
+
+// 购物车结算请求
+type CheckoutRequest struct {
+	CouponCode   string     `json:"coupon_code"`
+	RequestedFor *time.Time `json:"requested_for"`
+	MealSlot     string     `json:"meal_slot"`
+}
+
+// 修改订单状态请求（管理员/厨师）
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+// 取消订单请求
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
+
+// 退款请求，不填金额时退还全部剩余金额
+type RefundPaymentRequest struct {
+	Amount *money.Money `json:"amount"`
+	Reason string       `json:"reason" binding:"max=200"`
+}
+
+// 模拟支付请求，仅内置的 fake 支付渠道可用
+type FakePayRequest struct {
+	ClientSecret string `json:"client_secret" binding:"required"`
+	Outcome      string `json:"outcome" binding:"omitempty,oneof=succeed fail"` // 默认 succeed
+}
+
+// 创建或修改优惠请求，修改时整体替换
+type PromotionRequest struct {
+	Name              string      `json:"name" binding:"required"`
+	Description       string      `json:"description"`
+	Code              string      `json:"code"`
+	Type              string      `json:"type" binding:"required"`
+	PercentOff        int         `json:"percent_off"`
+	AmountOff         money.Money `json:"amount_off"`
+	BuyQuantity       int         `json:"buy_quantity"`
+	DishID            *int        `json:"dish_id"`
+	CategoryID        *int        `json:"category_id"`
+	MinSpend          money.Money `json:"min_spend"`
+	UsageLimitPerUser int         `json:"usage_limit_per_user" binding:"min=0"`
+	StartsAt          *time.Time  `json:"starts_at"`
+	EndsAt            *time.Time  `json:"ends_at"`
+	IsActive          *bool       `json:"is_active"` // 默认启用
+}
+
+// 创建、修改推荐配置请求，修改时整体替换
+type RecommendationRequest struct {
+	Name           string `json:"name" binding:"required,max=100"`
+	Description    string `json:"description"`
+	Type           string `json:"type" binding:"omitempty,oneof=template curated"` // 默认 template
+	MeatCount      int    `json:"meat_count" binding:"min=0"`
+	VegetableCount int    `json:"vegetable_count" binding:"min=0"`
+	DishIDs        []int  `json:"dish_ids"`  // 固定菜单的菜品，规则模板不能填写
+	IsActive       *bool  `json:"is_active"` // 默认启用
+}
+
+// 替换固定菜单菜品请求
+type RecommendationDishesRequest struct {
+	DishIDs []int `json:"dish_ids" binding:"required"`
 }
 
 // 创建菜品请求
 type CreateDishRequest struct {
-	Name         string  `json:"name" binding:"required"`
-	Description  string  `json:"description"`
-	CategoryID   int     `json:"category_id" binding:"required"`
-	Price        float64 `json:"price" binding:"required,min=0"`
-	ImageURL     string  `json:"image_url"`
-	VideoURL     string  `json:"video_url"`
-	CookingSteps string  `json:"cooking_steps"`
-	IsSeasonal   bool    `json:"is_seasonal"`
+	Name         string      `json:"name" binding:"required"`
+	Description  string      `json:"description"`
+	CategoryID   int         `json:"category_id" binding:"required"`
+	Price        money.Money `json:"price"` // 必须大于 0，由处理器校验
+	ImageURL     string      `json:"image_url"`
+	VideoURL     string      `json:"video_url"`
+	CookingSteps string      `json:"cooking_steps"`
+	IsSeasonal   bool        `json:"is_seasonal"`
+	Tags         []string    `json:"tags"` // 标签的 slug
 }
 
 // 更新菜品请求
 type UpdateDishRequest struct {
-	Name         *string  `json:"name"`
-	Description  *string  `json:"description"`
-	CategoryID   *int     `json:"category_id"`
-	Price        *float64 `json:"price"`
-	ImageURL     *string  `json:"image_url"`
-	VideoURL     *string  `json:"video_url"`
-	CookingSteps *string  `json:"cooking_steps"`
-	IsSeasonal   *bool    `json:"is_seasonal"`
-	IsActive     *bool    `json:"is_active"`
+	Name         *string      `json:"name"`
+	Description  *string      `json:"description"`
+	CategoryID   *int         `json:"category_id"`
+	Price        *money.Money `json:"price"`
+	ImageURL     *string      `json:"image_url"`
+	VideoURL     *string      `json:"video_url"`
+	CookingSteps *string      `json:"cooking_steps"`
+	IsSeasonal   *bool        `json:"is_seasonal"`
+	IsActive     *bool        `json:"is_active"`
+	Tags         *[]string    `json:"tags"` // 替换全部标签，空数组表示去掉全部标签
 }
 
 // 创建分类请求
@@ -163,8 +673,33 @@ type UpdateCategoryRequest struct {
 	Description *string `json:"description"`
 }
 
+// 创建标签请求
+type CreateTagRequest struct {
+	Slug        string `json:"slug" binding:"required,max=30"` // 小写字母、数字和下划线，由处理器校验
+	Name        string `json:"name" binding:"required,max=50"`
+	Description string `json:"description"`
+}
+
+// 更新标签请求，slug 不能修改
+type UpdateTagRequest struct {
+	Name        *string `json:"name" binding:"omitempty,max=50"`
+	Description *string `json:"description"`
+}
+
 // 数据库自动迁移
 func AutoMigrate(db *sql.DB) error {
-	// 这里应该执行schema.sql文件，但为了简化，我们假设表已经存在
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range applied {
+		log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+	}
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,296 @@
+// Package money 精确的金额运算
+//
+// 金额以最小货币单位（人民币为分）的整数保存，避免 float64 的累计误差。
+// 数据库中对应 DECIMAL/NUMERIC 列，JSON 中仍是数字（如 12.5），与原来的 float64 格式兼容。
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency 系统使用的货币，从数据库读出的金额和新建的金额都使用这个货币
+var DefaultCurrency = "CNY"
+
+var (
+	// ErrInvalid 金额格式不正确
+	ErrInvalid = errors.New("money: invalid amount")
+	// ErrPrecision 小数位数超过货币的最小单位
+	ErrPrecision = errors.New("money: too many decimal places")
+)
+
+// Money 金额，Amount 为最小货币单位的数量，Currency 为 ISO 4217 货币代码
+// 零值表示默认货币的 0 元
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New 创建默认货币的金额，minor 为最小单位的数量
+func New(minor int64) Money {
+	return Money{Amount: minor, Currency: DefaultCurrency}
+}
+
+// Parse 解析十进制金额，如 "12.5"、"-3.20"；小数位数超过货币的最小单位时返回 ErrPrecision
+func Parse(s, currency string) (Money, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, ErrInvalid
+	}
+	// 多余的小数位只能是 0，如数据库返回的 "12.50"
+	digits := minorDigits(currency)
+	if len(frac) > digits {
+		if strings.Trim(frac[digits:], "0") != "" {
+			return Money{}, ErrPrecision
+		}
+		frac = frac[:digits]
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, ErrInvalid
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// minorDigits 货币最小单位的小数位数
+func minorDigits(currency string) int {
+	switch currency {
+	case "JPY", "KRW":
+		return 0
+	default:
+		return 2
+	}
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// String 返回十进制表示，如 "12.50"
+func (m Money) String() string {
+	digits := minorDigits(m.currency())
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if digits == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+	p := pow10(digits)
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/p, digits, amount%p)
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+
+// Cmp 比较两个金额，m 小于、等于、大于 o 时分别返回 -1、0、1
+func (m Money) Cmp(o Money) int {
+	mustSameCurrency(m, o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Add 两个金额相加，货币不同时 panic
+func (m Money) Add(o Money) Money {
+	mustSameCurrency(m, o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currency()}
+}
+
+// Sub 两个金额相减，货币不同时 panic
+func (m Money) Sub(o Money) Money {
+	mustSameCurrency(m, o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currency()}
+}
+
+// Mul 乘以数量，如单价乘以份数
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.currency()}
+}
+
+// 币种为空的金额视为默认货币
+func mustSameCurrency(a, b Money) {
+	if a.currency() != b.currency() {
+		panic(fmt.Sprintf("money: currency mismatch %s and %s", a.currency(), b.currency()))
+	}
+}
+
+// Rounding 金额无法精确到最小单位时的舍入方式
+type Rounding int
+
+const (
+	// RoundHalfUp 四舍五入，恰好一半时远离 0
+	RoundHalfUp Rounding = iota
+	// RoundHalfEven 银行家舍入，恰好一半时取偶数
+	RoundHalfEven
+	// RoundDown 向 0 截断
+	RoundDown
+)
+
+// 折扣和税费的舍入规则：折扣金额向 0 截断，不会多减；税额四舍五入
+const (
+	DiscountRounding = RoundDown
+	TaxRounding      = RoundHalfUp
+)
+
+// Percent 按万分比计算金额，如 basisPoints 为 1250 表示 12.5%
+func (m Money) Percent(basisPoints int64, rounding Rounding) Money {
+	return Money{Amount: divRound(m.Amount*basisPoints, 10000, rounding), Currency: m.currency()}
+}
+
+// Discount 按万分比计算折扣金额
+func (m Money) Discount(basisPoints int64) Money {
+	return m.Percent(basisPoints, DiscountRounding)
+}
+
+// Tax 按万分比计算税额
+func (m Money) Tax(basisPoints int64) Money {
+	return m.Percent(basisPoints, TaxRounding)
+}
+
+// divRound 计算 n/d 并按 rounding 舍入，d 必须为正数
+func divRound(n, d int64, rounding Rounding) int64 {
+	q, r := n/d, n%d
+	if r == 0 || rounding == RoundDown {
+		return q
+	}
+	sign := int64(1)
+	if n < 0 {
+		sign, r = -1, -r
+	}
+	switch {
+	case 2*r > d:
+		return q + sign
+	case 2*r == d && (rounding == RoundHalfUp || q%2 != 0):
+		return q + sign
+	default:
+		return q
+	}
+}
+
+// Allocate 按权重分摊金额，各份之和恰好等于 m，舍入产生的零头按最大余数分给前面的份额
+// 用于把订单级的优惠分摊到每个明细
+func (m Money) Allocate(weights []int64) []Money {
+	result := make([]Money, len(weights))
+	var total int64
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		for i := range result {
+			result[i] = Money{Currency: m.currency()}
+		}
+		return result
+	}
+
+	amount := m.Amount
+	sign := int64(1)
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+	remainders := make([]int, len(weights))
+	left := amount
+	for i, w := range weights {
+		share := amount * w / total
+		result[i] = Money{Amount: share, Currency: m.currency()}
+		left -= share
+		remainders[i] = i
+	}
+	sort.SliceStable(remainders, func(a, b int) bool {
+		return amount*weights[remainders[a]]%total > amount*weights[remainders[b]]%total
+	})
+	for i := 0; left > 0; i++ {
+		result[remainders[i%len(remainders)]].Amount++
+		left--
+	}
+	for i := range result {
+		result[i].Amount *= sign
+	}
+	return result
+}
+
+// MarshalJSON 输出为 JSON 数字，如 12.5 输出为 12.50
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON 接受 JSON 数字或字符串，使用默认货币
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := Parse(strings.Trim(s, `"`), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan 从 NUMERIC 列读取金额，NULL 读作 0
+func (m *Money) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*m = New(0)
+	case []byte:
+		*m, err = Parse(string(v), DefaultCurrency)
+	case string:
+		*m, err = Parse(v, DefaultCurrency)
+	case int64:
+		*m = New(v * pow10(minorDigits(DefaultCurrency)))
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	return err
+}
+
+// Value 以十进制字符串写入 NUMERIC 列
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,238 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     int64
+		err      error
+	}{
+		{"12.5", "", 1250, nil},
+		{"12.50", "CNY", 1250, nil},
+		{"12.500", "CNY", 1250, nil},
+		{"-3.20", "CNY", -320, nil},
+		{"+1.05", "CNY", 105, nil},
+		{".5", "CNY", 50, nil},
+		{" 7 ", "CNY", 700, nil},
+		{"0", "CNY", 0, nil},
+		{"1200", "JPY", 1200, nil},
+		{"12.505", "CNY", 0, ErrPrecision},
+		{"12.5", "JPY", 0, ErrPrecision},
+		{"", "CNY", 0, ErrInvalid},
+		{"-", "CNY", 0, ErrInvalid},
+		{".", "CNY", 0, ErrInvalid},
+		{"abc", "CNY", 0, ErrInvalid},
+		{"1e3", "CNY", 0, ErrInvalid},
+		{"1.2.3", "CNY", 0, ErrInvalid},
+		{"--1", "CNY", 0, ErrInvalid},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tt.currency)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q, %q) error = %v, want %v", tt.in, tt.currency, err, tt.err)
+			continue
+		}
+		if err == nil && got.Amount != tt.want {
+			t.Errorf("Parse(%q, %q) = %d, want %d", tt.in, tt.currency, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{New(1250), "12.50"},
+		{New(5), "0.05"},
+		{New(-320), "-3.20"},
+		{New(-5), "-0.05"},
+		{Money{}, "0.00"},
+		{Money{Amount: 1200, Currency: "JPY"}, "1200"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		n, d     int64
+		rounding Rounding
+		want     int64
+	}{
+		{15, 10, RoundHalfUp, 2},
+		{14, 10, RoundHalfUp, 1},
+		{-15, 10, RoundHalfUp, -2},
+		{-14, 10, RoundHalfUp, -1},
+		{-16, 10, RoundHalfUp, -2},
+		{-5, 10, RoundHalfUp, -1},
+		{15, 10, RoundHalfEven, 2},
+		{25, 10, RoundHalfEven, 2},
+		{-15, 10, RoundHalfEven, -2},
+		{-25, 10, RoundHalfEven, -2},
+		{-5, 10, RoundHalfEven, 0},
+		{-26, 10, RoundHalfEven, -3},
+		{19, 10, RoundDown, 1},
+		{-19, 10, RoundDown, -1},
+		{-20, 10, RoundHalfUp, -2},
+	}
+	for _, tt := range tests {
+		if got := divRound(tt.n, tt.d, tt.rounding); got != tt.want {
+			t.Errorf("divRound(%d, %d, %d) = %d, want %d", tt.n, tt.d, tt.rounding, got, tt.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		amount      int64
+		basisPoints int64
+		discount    int64
+		tax         int64
+	}{
+		{1999, 1000, 199, 200},
+		{1005, 5000, 502, 503},
+		{-1005, 5000, -502, -503},
+		{100, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		m := New(tt.amount)
+		if got := m.Discount(tt.basisPoints).Amount; got != tt.discount {
+			t.Errorf("New(%d).Discount(%d) = %d, want %d", tt.amount, tt.basisPoints, got, tt.discount)
+		}
+		if got := m.Tax(tt.basisPoints).Amount; got != tt.tax {
+			t.Errorf("New(%d).Tax(%d) = %d, want %d", tt.amount, tt.basisPoints, got, tt.tax)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"even split", 90, []int64{1, 1, 1}, []int64{30, 30, 30}},
+		{"remainder goes to earlier shares on ties", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"largest remainder first", 10, []int64{1, 2, 3}, []int64{2, 3, 5}},
+		{"largest remainder is not the first share", 10, []int64{3, 1, 2}, []int64{5, 2, 3}},
+		{"two leftover units", 11, []int64{1, 1, 1}, []int64{4, 4, 3}},
+		{"stable among equal remainders", 5, []int64{3, 3, 4}, []int64{2, 1, 2}},
+		{"negative amount", -10, []int64{1, 2, 3}, []int64{-2, -3, -5}},
+		{"zero weight share", 10, []int64{0, 1, 1}, []int64{0, 5, 5}},
+		{"all weights zero", 10, []int64{0, 0}, []int64{0, 0}},
+		{"no weights", 10, nil, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := New(tt.amount).Allocate(tt.weights)
+			got := make([]int64, len(shares))
+			var sum int64
+			for i, share := range shares {
+				got[i] = share.Amount
+				sum += share.Amount
+				if share.Currency != DefaultCurrency {
+					t.Errorf("share %d currency = %q, want %q", i, share.Currency, DefaultCurrency)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate(%v) = %v, want %v", tt.weights, got, tt.want)
+			}
+			var total int64
+			for _, w := range tt.weights {
+				total += w
+			}
+			if total > 0 && sum != tt.amount {
+				t.Errorf("Allocate(%v) sums to %d, want %d", tt.weights, sum, tt.amount)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want int64
+		err  error
+	}{
+		{[]byte("12.50"), 1250, nil},
+		{"12.50", 1250, nil},
+		{int64(12), 1200, nil},
+		{nil, 0, nil},
+		{"12.505", 0, ErrPrecision},
+		{[]byte("abc"), 0, ErrInvalid},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := m.Scan(tt.src)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Scan(%#v) error = %v, want %v", tt.src, err, tt.err)
+			continue
+		}
+		if err == nil && (m.Amount != tt.want || m.Currency != DefaultCurrency) {
+			t.Errorf("Scan(%#v) = %#v, want %d %s", tt.src, m, tt.want, DefaultCurrency)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(12.5); err == nil {
+		t.Error("Scan(float64) succeeded, want error")
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  error
+	}{
+		{`"12.50"`, 1250, nil},
+		{`12.50`, 1250, nil},
+		{`12`, 1200, nil},
+		{`"12"`, 1200, nil},
+		{`-0.5`, -50, nil},
+		{`12.505`, 0, ErrPrecision},
+		{`"12.505"`, 0, ErrPrecision},
+		{`"abc"`, 0, ErrInvalid},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := json.Unmarshal([]byte(tt.in), &m)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Unmarshal(%s) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && m.Amount != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, m.Amount, tt.want)
+		}
+	}
+
+	// null 保留原值
+	m := New(300)
+	if err := json.Unmarshal([]byte("null"), &m); err != nil || m.Amount != 300 {
+		t.Errorf("Unmarshal(null) = %d, %v, want 300, nil", m.Amount, err)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{New(1250)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"price":12.50}` {
+		t.Errorf("Marshal = %s, want {\"price\":12.50}", data)
+	}
+}
@@ -0,0 +1,278 @@
+// Package oidctest 最小的 OIDC 身份提供方，供 oidc 和单点登录处理器的测试以及 cmd/mock-oidc 使用
+//
+// 支持服务发现、授权码 + PKCE(S256)、JWKS，ID Token 使用创建时生成的 RSA 密钥签名。
+// 授权页是一个表单，可以填写任意 sub/email/用户名/角色组；
+// 授权请求里直接带上 sub 参数时跳过表单，测试和 curl 可以直接拿到回调地址。
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID 签名密钥在 JWKS 中的 kid
+const KeyID = "mock"
+
+// authCode 已签发但尚未兑换的授权码
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+	expiresAt     time.Time
+}
+
+// Server 身份提供方，Issuer 必须与客户端配置的 issuer 一致
+// 使用 httptest.NewServer 时，在拿到服务地址后再设置 Issuer
+type Server struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // 为空表示公开客户端
+	Key          *rsa.PrivateKey
+
+	mux   *http.ServeMux
+	mu    sync.Mutex
+	codes map[string]*authCode
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Mock OIDC</title></head>
+<body>
+<h2>Mock OIDC 登录</h2>
+<form method="post" action="/authorize">
+{{range $k, $v := .Query}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}
+<p><label>sub <input name="sub" value="alice"></label></p>
+<p><label>preferred_username <input name="preferred_username" value="alice"></label></p>
+<p><label>email <input name="email" value="alice@example.com"></label></p>
+<p><label>groups（逗号分隔） <input name="groups" value=""></label></p>
+<p><button type="submit">登录</button></p>
+</form>
+</body></html>`))
+
+// New 创建身份提供方并生成签名密钥
+func New(issuer, clientID, clientSecret string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		mux:          http.NewServeMux(),
+		codes:        make(map[string]*authCode),
+	}
+	s.mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	s.mux.HandleFunc("/authorize", s.authorize)
+	s.mux.HandleFunc("/token", s.token)
+	s.mux.HandleFunc("/jwks", s.jwks)
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SignIDToken 用身份提供方的密钥签名任意声明，测试可以据此构造过期、受众不符等 ID Token
+func (s *Server) SignIDToken(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	return token.SignedString(s.Key)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/authorize",
+		"token_endpoint":                        s.Issuer + "/token",
+		"jwks_uri":                              s.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("client_id") != s.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("response_type") != "code" {
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge") == "" || r.Form.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("sub") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		loginPage.Execute(w, map[string]interface{}{"Query": r.URL.Query()})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"sub":            r.Form.Get("sub"),
+		"email_verified": true,
+	}
+	for _, name := range []string{"email", "preferred_username", "name"} {
+		if v := r.Form.Get(name); v != "" {
+			claims[name] = v
+		}
+	}
+	if groups := r.Form.Get("groups"); groups != "" {
+		claims["groups"] = strings.Split(groups, ",")
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = &authCode{
+		clientID:      s.ClientID,
+		redirectURI:   redirectURI.String(),
+		codeChallenge: r.Form.Get("code_challenge"),
+		nonce:         r.Form.Get("nonce"),
+		claims:        claims,
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.Form.Get("client_id")
+		clientSecret = r.Form.Get("client_secret")
+	}
+	if clientID != s.ClientID || clientSecret != s.ClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+	if r.Form.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	// 授权码只能使用一次
+	s.mu.Lock()
+	code, exists := s.codes[r.Form.Get("code")]
+	delete(s.codes, r.Form.Get("code"))
+	s.mu.Unlock()
+
+	if !exists || time.Now().After(code.expiresAt) || code.redirectURI != r.Form.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.codeChallenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": s.Issuer,
+		"aud": code.clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	if code.nonce != "" {
+		claims["nonce"] = code.nonce
+	}
+	for k, v := range code.claims {
+		claims[k] = v
+	}
+
+	idToken, err := s.SignIDToken(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": KeyID,
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,287 @@
+// Package oidc 实现 OpenID Connect 授权码流程（带 PKCE）的客户端部分：
+// 服务发现、构造授权地址、用授权码换取令牌以及校验 ID Token
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config 身份提供方和本应用在其中注册的客户端信息
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Discovery /.well-known/openid-configuration 中用到的字段
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims ID Token 中的声明，Raw 保留全部声明用于角色映射
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+	Raw               map[string]interface{}
+}
+
+// Provider 一个 OIDC 身份提供方
+// 服务发现在第一次使用时进行，身份提供方暂时不可用不影响服务启动
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *Discovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// 两次拉取 JWKS 的最小间隔，防止伪造 kid 的令牌导致频繁请求身份提供方
+const jwksRefreshInterval = time.Minute
+
+func NewProvider(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Discover 获取并缓存身份提供方的端点信息
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d Discovery
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch, expected %q got %q", p.cfg.Issuer, d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: missing required endpoints")
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// AuthCodeURL 构造跳转到身份提供方的授权地址
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange 用授权码换取令牌，并校验其中的 ID Token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oidc token request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token request: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("oidc token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("oidc token response: missing id_token")
+	}
+
+	return p.Verify(ctx, token.IDToken, nonce)
+}
+
+// Verify 校验 ID Token 的签名、签发方、受众、有效期和 nonce
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if _, ok := raw["exp"]; !ok {
+		return nil, errors.New("invalid id_token: missing exp")
+	}
+	if got, _ := raw["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	// 有多个受众时 azp 必须是本应用
+	if aud, ok := raw["aud"].([]interface{}); ok && len(aud) > 1 {
+		if azp, _ := raw["azp"].(string); azp != p.cfg.ClientID {
+			return nil, errors.New("invalid id_token: azp mismatch")
+		}
+	}
+
+	claims := &Claims{Raw: raw}
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Email, _ = raw["email"].(string)
+	claims.PreferredUsername, _ = raw["preferred_username"].(string)
+	claims.Name, _ = raw["name"].(string)
+	switch v := raw["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = v
+	case string:
+		claims.EmailVerified = v == "true"
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id_token: missing sub")
+	}
+
+	return claims, nil
+}
+
+// key 按 kid 返回验证公钥，找不到时重新拉取一次 JWKS 以支持身份提供方轮换密钥
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var set jsonWebKeySet
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	p.keys = set.publicKeys()
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// 只有一个密钥且令牌没有 kid 时直接使用该密钥
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// CodeChallenge 按 PKCE S256 方法计算 code_challenge
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
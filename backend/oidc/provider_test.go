@@ -0,0 +1,289 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"food-ordering/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "food-ordering"
+	testRedirectURL = "http://localhost:3000/auth/callback"
+)
+
+// newTestProvider 启动模拟身份提供方，返回它和指向它的 Provider
+func newTestProvider(t *testing.T, clientSecret string) (*oidctest.Server, *Provider) {
+	t.Helper()
+	idp, err := oidctest.New("", testClientID, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(idp)
+	t.Cleanup(server.Close)
+	idp.Issuer = server.URL
+
+	p := NewProvider(Config{
+		Issuer:       server.URL,
+		ClientID:     testClientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+	return idp, p
+}
+
+// authorize 以 sub 的身份在身份提供方完成授权，返回回调地址中的授权码和 state
+func authorize(t *testing.T, authURL string, identity url.Values) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL + "&" + identity.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status = %d, want 302", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURL {
+		t.Fatalf("redirected to %s, want %s", got, testRedirectURL)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+// login 发起一次授权，返回授权码
+func login(t *testing.T, p *Provider, codeVerifier, nonce string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), "state", nonce, codeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, authURL, url.Values{"sub": {"alice"}})
+	return code
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	idp, p := newTestProvider(t, "")
+
+	d, err := p.Discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Issuer != idp.Issuer || d.AuthorizationEndpoint != idp.Issuer+"/authorize" ||
+		d.TokenEndpoint != idp.Issuer+"/token" || d.JWKSURI != idp.Issuer+"/jwks" {
+		t.Errorf("discovery = %+v", d)
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, "the-state", "the-nonce", "the-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid profile email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        CodeChallenge("the-verifier"),
+		"code_challenge_method": "S256",
+	} {
+		if got := query.Get(name); got != want {
+			t.Errorf("authorization URL %s = %q, want %q", name, got, want)
+		}
+	}
+	if query.Has("code_verifier") {
+		t.Error("authorization URL leaks the code verifier")
+	}
+
+	code, state := authorize(t, authURL, url.Values{
+		"sub":                {"alice-id"},
+		"email":              {"alice@example.com"},
+		"preferred_username": {"alice"},
+		"groups":             {"kitchen,admins"},
+	})
+	if state != "the-state" {
+		t.Errorf("callback state = %q, want the-state", state)
+	}
+
+	claims, err := p.Exchange(ctx, code, "the-verifier", "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice-id" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.PreferredUsername != "alice" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if groups := claims.Raw["groups"]; !reflect.DeepEqual(groups, []interface{}{"kitchen", "admins"}) {
+		t.Errorf("groups claim = %v, want [kitchen admins]", groups)
+	}
+
+	// 授权码只能兑换一次
+	if _, err := p.Exchange(ctx, code, "the-verifier", "the-nonce"); err == nil {
+		t.Error("authorization code was accepted twice")
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name         string
+		clientSecret string // 身份提供方登记的密钥
+		useSecret    string // Provider 使用的密钥
+		codeVerifier string
+		nonce        string
+		code         string // 非空时代替真实的授权码
+		wantErr      string
+	}{
+		{"valid", "", "", "verifier", "nonce", "", ""},
+		{"confidential client", "s3cret", "s3cret", "verifier", "nonce", "", ""},
+		{"wrong client secret", "s3cret", "guess", "verifier", "nonce", "", "invalid_client"},
+		{"wrong PKCE verifier", "", "", "another-verifier", "nonce", "", "invalid_grant"},
+		{"wrong nonce", "", "", "verifier", "another-nonce", "", "nonce mismatch"},
+		{"unknown code", "", "", "verifier", "nonce", "made-up", "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, p := newTestProvider(t, tt.clientSecret)
+			p.cfg.ClientSecret = tt.useSecret
+			code := login(t, p, "verifier", "nonce")
+			if tt.code != "" {
+				code = tt.code
+			}
+			_, err := p.Exchange(ctx, code, tt.codeVerifier, tt.nonce)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Exchange() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Exchange() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	idp, p := newTestProvider(t, "")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.Issuer,
+			"aud":   testClientID,
+			"sub":   "alice",
+			"nonce": "nonce",
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+		}
+	}
+	with := func(changes jwt.MapClaims) jwt.MapClaims {
+		claims := valid()
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+	sign := func(claims jwt.MapClaims) string {
+		token, err := idp.SignIDToken(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	signWith := func(method jwt.SigningMethod, key interface{}, kid string) string {
+		token := jwt.NewWithClaims(method, valid())
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", sign(valid()), ""},
+		{"audience is another client", sign(with(jwt.MapClaims{"aud": "another-app"})), "audience"},
+		{"several audiences without azp", sign(with(jwt.MapClaims{"aud": []string{testClientID, "another-app"}})), "azp mismatch"},
+		{"several audiences with azp", sign(with(jwt.MapClaims{"aud": []string{testClientID, "another-app"}, "azp": testClientID})), ""},
+		{"another issuer", sign(with(jwt.MapClaims{"iss": "https://evil.example.com"})), "issuer"},
+		{"expired", sign(with(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})), "expired"},
+		{"no expiry", sign(with(jwt.MapClaims{"exp": nil})), "missing exp"},
+		{"issued in the future", sign(with(jwt.MapClaims{"iat": now.Add(time.Hour).Unix()})), "used before issued"},
+		{"nonce mismatch", sign(with(jwt.MapClaims{"nonce": "another-nonce"})), "nonce mismatch"},
+		{"no nonce", sign(with(jwt.MapClaims{"nonce": nil})), "nonce mismatch"},
+		{"no subject", sign(with(jwt.MapClaims{"sub": nil})), "missing sub"},
+		{"signed by another key", signWith(jwt.SigningMethodRS256, otherKey, oidctest.KeyID), "verification error"},
+		{"unknown kid", signWith(jwt.SigningMethodRS256, otherKey, "rotated"), "unknown key id"},
+		{"HMAC is not accepted", signWith(jwt.SigningMethodHS256, []byte("secret"), oidctest.KeyID), "signing method"},
+		{"tampered payload", tamper(t, sign(valid())), "verification error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := p.Verify(ctx, tt.token, "nonce")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Verify() error = %v", err)
+			case tt.wantErr == "" && claims.Subject != "alice":
+				t.Errorf("subject = %q, want alice", claims.Subject)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Verify() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// tamper 把载荷里的 sub 换成 mallory，签名保持不变
+func tamper(t *testing.T, token string) string {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	claims["sub"] = "mallory"
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SigningString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	idp, p := newTestProvider(t, "")
+	idp.Issuer = "https://login.example.com"
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Errorf("AuthCodeURL() error = %v, want issuer mismatch", err)
+	}
+}
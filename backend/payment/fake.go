@@ -0,0 +1,214 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"food-ordering/money"
+)
+
+// FakeSignatureHeader Fake 回调携带签名的请求头
+const FakeSignatureHeader = "Fake-Signature"
+
+// Fake 支付意图的状态
+const (
+	fakeRequiresPayment = "requires_payment"
+	fakeAuthorized      = "authorized"
+	fakeCaptured        = "captured"
+	fakeFailed          = "failed"
+	fakeCancelled       = "cancelled"
+)
+
+// Fake 模拟的支付渠道，支付意图保存在进程内存中，重启后丢失。
+// 顾客的支付操作由 Pay 模拟，结果像真实渠道一样以签名回调发送到 WebhookURL。
+type Fake struct {
+	Secret     string
+	WebhookURL string // 为空时不发送回调
+	Client     *http.Client
+
+	mu      sync.Mutex
+	intents map[string]*fakeIntent
+}
+
+type fakeIntent struct {
+	clientSecret string
+	amount       money.Money
+	refunded     money.Money
+	status       string
+}
+
+func NewFake(secret, webhookURL string) *Fake {
+	return &Fake{
+		Secret:     secret,
+		WebhookURL: webhookURL,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		intents:    make(map[string]*fakeIntent),
+	}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	if !req.Amount.IsPositive() {
+		return nil, fmt.Errorf("payment: amount must be positive, got %s", req.Amount)
+	}
+	id := "pi_fake_" + randomHex(12)
+	intent := &fakeIntent{
+		clientSecret: id + "_secret_" + randomHex(16),
+		amount:       req.Amount,
+		refunded:     money.Money{Currency: req.Amount.Currency},
+		status:       fakeRequiresPayment,
+	}
+
+	f.mu.Lock()
+	f.intents[id] = intent
+	f.mu.Unlock()
+	return &Intent{ID: id, ClientSecret: intent.clientSecret}, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, intentID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, err := f.intent(intentID)
+	if err != nil {
+		return err
+	}
+	if intent.status != fakeAuthorized {
+		return ErrIntentState
+	}
+	intent.status = fakeCaptured
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, intentID string, amount money.Money) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, err := f.intent(intentID)
+	if err != nil {
+		return "", err
+	}
+	if intent.status != fakeCaptured || !amount.IsPositive() || intent.refunded.Add(amount).Cmp(intent.amount) > 0 {
+		return "", ErrIntentState
+	}
+	intent.refunded = intent.refunded.Add(amount)
+	return "re_fake_" + randomHex(12), nil
+}
+
+func (f *Fake) Cancel(ctx context.Context, intentID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, err := f.intent(intentID)
+	if err != nil {
+		return err
+	}
+	switch intent.status {
+	case fakeRequiresPayment, fakeAuthorized, fakeFailed:
+		intent.status = fakeCancelled
+		return nil
+	case fakeCancelled:
+		return nil
+	}
+	return ErrIntentState
+}
+
+func (f *Fake) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	if err := Verify(f.Secret, header.Get(FakeSignatureHeader), body, time.Now()); err != nil {
+		return nil, err
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, ErrInvalidSignature
+	}
+	return &event, nil
+}
+
+// Pay 模拟顾客在渠道侧用 clientSecret 完成支付，succeed 为 false 时模拟支付失败（如余额不足）。
+// 结果回调同步发送，返回的错误包括回调失败；回调失败时支付意图的状态已经改变。
+func (f *Fake) Pay(ctx context.Context, clientSecret string, succeed bool) (*Event, error) {
+	f.mu.Lock()
+	var intentID string
+	var intent *fakeIntent
+	for id, candidate := range f.intents {
+		if candidate.clientSecret == clientSecret {
+			intentID, intent = id, candidate
+			break
+		}
+	}
+	if intent == nil {
+		f.mu.Unlock()
+		return nil, ErrIntentNotFound
+	}
+	if intent.status != fakeRequiresPayment {
+		f.mu.Unlock()
+		return nil, ErrIntentState
+	}
+	event := &Event{
+		ID:        "evt_fake_" + randomHex(12),
+		Type:      EventAuthorized,
+		IntentID:  intentID,
+		Amount:    intent.amount,
+		CreatedAt: time.Now().UTC(),
+	}
+	intent.status = fakeAuthorized
+	if !succeed {
+		event.Type = EventFailed
+		intent.status = fakeFailed
+	}
+	f.mu.Unlock()
+
+	return event, f.deliver(ctx, event)
+}
+
+// deliver 把事件签名后 POST 到 WebhookURL，非 2xx 响应视为失败
+func (f *Fake) deliver(ctx context.Context, event *Event) error {
+	if f.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FakeSignatureHeader, Sign(f.Secret, body, time.Now()))
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("payment: deliver webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("payment: deliver webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// intent 调用方需持有锁
+func (f *Fake) intent(id string) (*fakeIntent, error) {
+	intent, ok := f.intents[id]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	return intent, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
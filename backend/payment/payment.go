@@ -0,0 +1,69 @@
+// Package payment 在线支付渠道
+//
+// 支付流程：顾客为待确认的订单创建支付意图，在渠道侧完成支付后，渠道通过签名回调通知授权结果；
+// 商家接单时扣款（capture），取消订单时撤销授权或退款。
+// Provider 屏蔽不同渠道的差异，内置的 Fake 不访问外部网络，用于本地开发和联调完整的支付流程。
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"food-ordering/money"
+)
+
+var (
+	// ErrInvalidSignature 回调签名缺失、不匹配或已过期
+	ErrInvalidSignature = errors.New("payment: invalid webhook signature")
+	// ErrIntentNotFound 渠道中不存在该支付意图
+	ErrIntentNotFound = errors.New("payment: intent not found")
+	// ErrIntentState 支付意图当前的状态不允许该操作，如扣款未授权的支付
+	ErrIntentState = errors.New("payment: intent state does not allow this operation")
+)
+
+// 回调事件类型
+const (
+	EventAuthorized = "payment.authorized" // 顾客已支付，资金冻结待扣款
+	EventCaptured   = "payment.captured"
+	EventFailed     = "payment.failed"
+	EventCancelled  = "payment.cancelled"
+)
+
+// IntentRequest 创建支付意图的参数
+type IntentRequest struct {
+	OrderID     int
+	Amount      money.Money
+	Description string
+}
+
+// Intent 渠道创建的支付意图，ClientSecret 交给顾客的客户端用于在渠道侧完成支付
+type Intent struct {
+	ID           string
+	ClientSecret string
+}
+
+// Event 渠道回调的事件，ID 在同一渠道内唯一，重复回调时 ID 相同
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	IntentID  string      `json:"intent_id"`
+	Amount    money.Money `json:"amount"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Provider 一个支付渠道，方法返回的非 payment 包错误都视为渠道暂时不可用
+type Provider interface {
+	// Name 渠道名称，保存在支付记录中
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	// Capture 扣除已授权的全部金额
+	Capture(ctx context.Context, intentID string) error
+	// Refund 退还已扣款的部分或全部金额，返回渠道的退款单号
+	Refund(ctx context.Context, intentID string, amount money.Money) (string, error)
+	// Cancel 撤销未扣款的支付意图，已授权的金额退回顾客
+	Cancel(ctx context.Context, intentID string) error
+	// ParseWebhook 校验回调签名并解析事件，签名无效时返回 ErrInvalidSignature
+	ParseWebhook(header http.Header, body []byte) (*Event, error)
+}
@@ -0,0 +1,57 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureTolerance 回调签名中的时间戳与当前时间最多相差多久，超过时视为重放
+const SignatureTolerance = 5 * time.Minute
+
+// Sign 计算回调签名，格式为 t=<unix 秒>,v1=<hex(HMAC-SHA256(secret, "<t>.<body>"))>
+func Sign(secret string, body []byte, at time.Time) string {
+	t := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+// Verify 校验 Sign 生成的签名，header 中可以有多个 v1，轮换密钥期间任意一个匹配即可
+func Verify(secret, header string, body []byte, now time.Time) error {
+	var t string
+	var candidates []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			candidates = append(candidates, value)
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(candidates) == 0 {
+		return ErrInvalidSignature
+	}
+	if diff := now.Sub(time.Unix(unix, 0)); diff > SignatureTolerance || diff < -SignatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := signature(secret, t, body)
+	for _, candidate := range candidates {
+		if hmac.Equal([]byte(candidate), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func signature(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,188 @@
+// Package personalize 根据用户的订单和收藏为菜品打分，生成个性化推荐
+//
+// 得分由四部分组成：购买频次、最近一次购买、是否收藏、对所在分类的偏好；
+// 购买记录的权重随时间衰减。最近刚吃过的菜会被扣分，避免总是推荐同一道菜。
+// 这里只做计算，读取历史和保存结果由调用方负责。
+package personalize
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"food-ordering/models"
+)
+
+// 推荐原因，按贡献从大到小出现在结果中
+const (
+	ReasonFrequentlyOrdered = "frequently_ordered" // 经常点
+	ReasonRecentlyOrdered   = "recently_ordered"   // 最近点过
+	ReasonFavorite          = "favorite"           // 已收藏
+	ReasonCategoryAffinity  = "category_affinity"  // 常点这个分类的菜
+)
+
+// Purchase 一道菜的一次购买，取消的订单不计
+type Purchase struct {
+	DishID     int
+	CategoryID int
+	Quantity   int
+	EatenAt    time.Time // 预约订单为预约时间，否则为下单时间
+}
+
+// Favorite 收藏的菜品
+type Favorite struct {
+	DishID     int
+	CategoryID int
+}
+
+// History 一个用户的订单和收藏
+type History struct {
+	Purchases []Purchase
+	Favorites []Favorite
+}
+
+// Empty 没有任何订单和收藏
+func (h *History) Empty() bool {
+	return len(h.Purchases) == 0 && len(h.Favorites) == 0
+}
+
+// Params 打分参数
+type Params struct {
+	HalfLife         time.Duration // 购买记录的权重每隔 HalfLife 减半
+	FrequencyWeight  float64
+	RecencyWeight    float64
+	FavoriteWeight   float64
+	CategoryWeight   float64
+	DiversityPenalty float64 // 刚吃过的菜扣除的分数，在 DiversityWindow 内线性减少到 0
+	DiversityWindow  time.Duration
+	Limit            int // 每个用户最多保留几道菜
+}
+
+// DefaultParams 默认的打分参数
+var DefaultParams = Params{
+	HalfLife:         30 * 24 * time.Hour,
+	FrequencyWeight:  1,
+	RecencyWeight:    1,
+	FavoriteWeight:   1.5,
+	CategoryWeight:   1,
+	DiversityPenalty: 2,
+	DiversityWindow:  3 * 24 * time.Hour,
+	Limit:            20,
+}
+
+// Score 按历史为候选菜品打分，返回得分为正的菜品，按得分从高到低，最多 Limit 道。
+// 候选菜品应为上架的菜品；历史中有、候选中没有的菜品（如已下架）不会出现在结果中
+func (p Params) Score(history *History, candidates []models.Dish, now time.Time) []models.PersonalDish {
+	decay := func(at time.Time) float64 {
+		age := now.Sub(at)
+		if age < 0 {
+			age = 0
+		}
+		return math.Pow(0.5, float64(age)/float64(p.HalfLife))
+	}
+
+	// 每道菜衰减后的购买份数和最近一次食用时间，每个分类衰减后的购买份数加收藏数
+	weighted := make(map[int]float64)
+	lastEaten := make(map[int]time.Time)
+	categories := make(map[int]float64)
+	for _, purchase := range history.Purchases {
+		w := float64(purchase.Quantity) * decay(purchase.EatenAt)
+		weighted[purchase.DishID] += w
+		categories[purchase.CategoryID] += w
+		if purchase.EatenAt.After(lastEaten[purchase.DishID]) {
+			lastEaten[purchase.DishID] = purchase.EatenAt
+		}
+	}
+	favorites := make(map[int]bool, len(history.Favorites))
+	for _, favorite := range history.Favorites {
+		favorites[favorite.DishID] = true
+		categories[favorite.CategoryID]++
+	}
+	maxCategory := 0.0
+	for categoryID, w := range categories {
+		if categoryID != 0 && w > maxCategory {
+			maxCategory = w
+		}
+	}
+
+	var scored []models.PersonalDish
+	for _, dish := range candidates {
+		type part struct {
+			reason string
+			value  float64
+		}
+		parts := []part{
+			{ReasonFrequentlyOrdered, p.FrequencyWeight * math.Log1p(weighted[dish.ID])},
+			{ReasonFavorite, 0},
+			{ReasonCategoryAffinity, 0},
+			{ReasonRecentlyOrdered, 0},
+		}
+		if favorites[dish.ID] {
+			parts[1].value = p.FavoriteWeight
+		}
+		if dish.CategoryID != 0 && maxCategory > 0 {
+			parts[2].value = p.CategoryWeight * categories[dish.CategoryID] / maxCategory
+		}
+		// 刚吃过的扣分算在最近购买这一项里，扣分大于加分时不作为推荐原因
+		if last, ok := lastEaten[dish.ID]; ok {
+			parts[3].value = p.RecencyWeight * decay(last)
+			if age := now.Sub(last); age < p.DiversityWindow {
+				if age < 0 {
+					age = 0
+				}
+				parts[3].value -= p.DiversityPenalty * (1 - float64(age)/float64(p.DiversityWindow))
+			}
+		}
+
+		score := 0.0
+		for _, part := range parts {
+			score += part.value
+		}
+		if score <= 0 {
+			continue
+		}
+		sort.SliceStable(parts, func(i, j int) bool { return parts[i].value > parts[j].value })
+		reasons := []string{}
+		for _, part := range parts {
+			if part.value > 0 {
+				reasons = append(reasons, part.reason)
+			}
+		}
+		scored = append(scored, models.PersonalDish{
+			Dish:    dish,
+			Score:   math.Round(score*10000) / 10000,
+			Reasons: reasons,
+		})
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score != scored[j].Score {
+			return scored[i].Score > scored[j].Score
+		}
+		return scored[i].Dish.ID < scored[j].Dish.ID
+	})
+	if len(scored) > p.Limit {
+		scored = scored[:p.Limit]
+	}
+	return scored
+}
+
+// CategoryIDs 历史中出现过的分类，用于读取候选菜品
+func (h *History) CategoryIDs() []int {
+	seen := make(map[int]bool)
+	var ids []int
+	add := func(id int) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, purchase := range h.Purchases {
+		add(purchase.CategoryID)
+	}
+	for _, favorite := range h.Favorites {
+		add(favorite.CategoryID)
+	}
+	sort.Ints(ids)
+	return ids
+}
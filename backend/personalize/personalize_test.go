@@ -0,0 +1,132 @@
+package personalize
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"food-ordering/models"
+)
+
+func TestScore(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	halfLifeAgo := now.Add(-DefaultParams.HalfLife)
+	// 分类 1 的菜品 1、2，分类 2 的菜品 3
+	candidates := []models.Dish{
+		{ID: 1, CategoryID: 1, IsActive: true},
+		{ID: 2, CategoryID: 1, IsActive: true},
+		{ID: 3, CategoryID: 2, IsActive: true},
+	}
+
+	tests := []struct {
+		name    string
+		params  Params
+		history History
+		want    []string // 菜品 ID、得分和推荐原因
+	}{
+		{
+			name:    "no history",
+			params:  DefaultParams,
+			history: History{},
+			want:    nil,
+		},
+		{
+			name:    "favorite and its category",
+			params:  DefaultParams,
+			history: History{Favorites: []Favorite{{DishID: 1, CategoryID: 1}}},
+			want:    []string{"1 2.5 [favorite category_affinity]", "2 1 [category_affinity]"},
+		},
+		{
+			name:    "purchases decay by half life",
+			params:  DefaultParams,
+			history: History{Purchases: []Purchase{{DishID: 1, CategoryID: 1, Quantity: 1, EatenAt: halfLifeAgo}}},
+			want: []string{
+				"1 1.9055 [category_affinity recently_ordered frequently_ordered]",
+				"2 1 [category_affinity]",
+			},
+		},
+		{
+			name:   "more purchases rank higher",
+			params: DefaultParams,
+			history: History{Purchases: []Purchase{
+				{DishID: 2, CategoryID: 1, Quantity: 1, EatenAt: halfLifeAgo},
+				{DishID: 1, CategoryID: 1, Quantity: 3, EatenAt: halfLifeAgo},
+			}},
+			want: []string{
+				"1 2.4163 [category_affinity frequently_ordered recently_ordered]",
+				"2 1.9055 [category_affinity recently_ordered frequently_ordered]",
+			},
+		},
+		{
+			name:    "just eaten is penalized",
+			params:  DefaultParams,
+			history: History{Purchases: []Purchase{{DishID: 1, CategoryID: 1, Quantity: 1, EatenAt: now}}},
+			want:    []string{"2 1 [category_affinity]", "1 0.6931 [category_affinity frequently_ordered]"},
+		},
+		{
+			name:    "scheduled for later counts as just eaten",
+			params:  DefaultParams,
+			history: History{Purchases: []Purchase{{DishID: 1, CategoryID: 1, Quantity: 1, EatenAt: now.Add(24 * time.Hour)}}},
+			want:    []string{"2 1 [category_affinity]", "1 0.6931 [category_affinity frequently_ordered]"},
+		},
+		{
+			name:   "category affinity is relative to the top category",
+			params: DefaultParams,
+			history: History{
+				Purchases: []Purchase{{DishID: 1, CategoryID: 1, Quantity: 1, EatenAt: halfLifeAgo}},
+				Favorites: []Favorite{{DishID: 3, CategoryID: 2}},
+			},
+			want: []string{
+				"3 2.5 [favorite category_affinity]",
+				"1 1.4055 [category_affinity recently_ordered frequently_ordered]",
+				"2 0.5 [category_affinity]",
+			},
+		},
+		{
+			name:    "dishes missing from candidates still count for their category",
+			params:  DefaultParams,
+			history: History{Purchases: []Purchase{{DishID: 99, CategoryID: 1, Quantity: 1, EatenAt: halfLifeAgo}}},
+			want:    []string{"1 1 [category_affinity]", "2 1 [category_affinity]"},
+		},
+		{
+			name:    "limit",
+			params:  Params{HalfLife: DefaultParams.HalfLife, FavoriteWeight: 1.5, CategoryWeight: 1, Limit: 1},
+			history: History{Favorites: []Favorite{{DishID: 1, CategoryID: 1}}},
+			want:    []string{"1 2.5 [favorite category_affinity]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, dish := range tt.params.Score(&tt.history, candidates, now) {
+				got = append(got, fmt.Sprintf("%d %v %v", dish.Dish.ID, dish.Score, dish.Reasons))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Score() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var empty History
+	if !empty.Empty() || empty.CategoryIDs() != nil {
+		t.Errorf("empty history: Empty() = %v, CategoryIDs() = %v", empty.Empty(), empty.CategoryIDs())
+	}
+
+	history := History{
+		Purchases: []Purchase{{DishID: 1, CategoryID: 3}, {DishID: 2, CategoryID: 1}, {DishID: 4}},
+		Favorites: []Favorite{{DishID: 5, CategoryID: 2}, {DishID: 1, CategoryID: 3}},
+	}
+	if history.Empty() {
+		t.Error("Empty() = true for a history with purchases")
+	}
+	if got := history.CategoryIDs(); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("CategoryIDs() = %v, want [1 2 3]", got)
+	}
+	favoritesOnly := History{Favorites: []Favorite{{DishID: 5, CategoryID: 2}}}
+	if favoritesOnly.Empty() {
+		t.Error("Empty() = true for a history with favorites")
+	}
+}
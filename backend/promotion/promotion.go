@@ -0,0 +1,166 @@
+// Package promotion 计算订单可以享受的优惠
+//
+// 计算只依赖传入的优惠和订单明细，不访问数据库；
+// 哪些优惠在有效期内、用户是否还有使用次数由调用方（store）负责筛选。
+package promotion
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/money"
+)
+
+// Line 参与计算的一行订单明细
+type Line struct {
+	DishID     int
+	CategoryID int
+	Quantity   int
+	Price      money.Money
+}
+
+// IneligibleError 优惠不能用于这个订单，Reason 是返回给用户的英文说明
+type IneligibleError struct {
+	Reason string
+}
+
+func (e *IneligibleError) Error() string {
+	return e.Reason
+}
+
+func ineligible(format string, args ...interface{}) error {
+	return &IneligibleError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Subtotal 明细原价合计
+func Subtotal(lines []Line) money.Money {
+	total := money.New(0)
+	for _, line := range lines {
+		total = total.Add(line.Price.Mul(int64(line.Quantity)))
+	}
+	return total
+}
+
+// Available 检查优惠在 at 时刻是否启用且在有效期内
+func Available(p models.Promotion, at time.Time) error {
+	switch {
+	case !p.IsActive:
+		return ineligible("not active")
+	case p.StartsAt != nil && at.Before(*p.StartsAt):
+		return ineligible("not valid until %s", p.StartsAt.UTC().Format(time.RFC3339))
+	case p.EndsAt != nil && !at.Before(*p.EndsAt):
+		return ineligible("expired")
+	}
+	return nil
+}
+
+// applies 明细是否在优惠的范围内
+func applies(p models.Promotion, line Line) bool {
+	if p.DishID != nil {
+		return line.DishID == *p.DishID
+	}
+	if p.CategoryID != nil {
+		return line.CategoryID == *p.CategoryID
+	}
+	return true
+}
+
+// Evaluate 计算一个优惠的减免金额（正数），不满足条件时返回 *IneligibleError
+func Evaluate(p models.Promotion, lines []Line) (money.Money, error) {
+	var eligible []Line
+	for _, line := range lines {
+		if applies(p, line) {
+			eligible = append(eligible, line)
+		}
+	}
+	if len(eligible) == 0 {
+		return money.Money{}, ineligible("no eligible items in the order")
+	}
+	subtotal := Subtotal(eligible)
+	if subtotal.Cmp(p.MinSpend) < 0 {
+		return money.Money{}, ineligible("minimum spend is %s", p.MinSpend)
+	}
+
+	switch p.Type {
+	case models.PromotionPercentage:
+		return subtotal.Discount(int64(p.PercentOff) * 100), nil
+	case models.PromotionFixedAmount:
+		if p.AmountOff.Cmp(subtotal) > 0 {
+			return subtotal, nil
+		}
+		return p.AmountOff, nil
+	case models.PromotionBuyNGetOne:
+		// 每 N+1 份送一份，送出的是价格最低的几份
+		var units []money.Money
+		for _, line := range eligible {
+			for i := 0; i < line.Quantity; i++ {
+				units = append(units, line.Price)
+			}
+		}
+		free := len(units) / (p.BuyQuantity + 1)
+		if p.BuyQuantity <= 0 || free == 0 {
+			return money.Money{}, ineligible("buy %d eligible items to get one free", p.BuyQuantity)
+		}
+		sort.Slice(units, func(i, j int) bool { return units[i].Cmp(units[j]) < 0 })
+		discount := money.New(0)
+		for _, price := range units[:free] {
+			discount = discount.Add(price)
+		}
+		return discount, nil
+	default:
+		return money.Money{}, ineligible("unsupported promotion type %s", p.Type)
+	}
+}
+
+// Apply 计算订单的调整项：满足条件的自动优惠全部叠加，再加上至多一张优惠券
+// 自动优惠不满足条件时跳过，优惠券不满足条件时返回 *IneligibleError。
+// 每个优惠都按原价独立计算，总减免不超过订单小计，超出部分从后面的调整项中扣除
+func Apply(automatic []models.Promotion, coupon *models.Promotion, lines []Line) ([]models.OrderAdjustment, error) {
+	type applied struct {
+		promotion models.Promotion
+		discount  money.Money
+	}
+	var discounts []applied
+	for _, p := range automatic {
+		discount, err := Evaluate(p, lines)
+		if err == nil && discount.IsPositive() {
+			discounts = append(discounts, applied{p, discount})
+		}
+	}
+	if coupon != nil {
+		discount, err := Evaluate(*coupon, lines)
+		if err != nil {
+			return nil, err
+		}
+		discounts = append(discounts, applied{*coupon, discount})
+	}
+
+	remaining := Subtotal(lines)
+	adjustments := make([]models.OrderAdjustment, 0, len(discounts))
+	for _, d := range discounts {
+		discount := d.discount
+		if discount.Cmp(remaining) > 0 {
+			discount = remaining
+		}
+		remaining = remaining.Sub(discount)
+
+		id := d.promotion.ID
+		adjustments = append(adjustments, models.OrderAdjustment{
+			PromotionID: &id,
+			Code:        d.promotion.Code,
+			Description: d.promotion.Name,
+			Amount:      discount.Mul(-1),
+		})
+	}
+	return adjustments, nil
+}
+
+// Total 小计加上调整项后的应付金额
+func Total(subtotal money.Money, adjustments []models.OrderAdjustment) money.Money {
+	for _, adjustment := range adjustments {
+		subtotal = subtotal.Add(adjustment.Amount)
+	}
+	return subtotal
+}
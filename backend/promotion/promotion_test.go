@@ -0,0 +1,154 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/money"
+)
+
+func price(s string) money.Money {
+	m, err := money.Parse(s, "")
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func intPtr(v int) *int { return &v }
+
+// 小计 34.99：分类 1 的两道菜 29.99，分类 2 的一道菜 5.00
+var lines = []Line{
+	{DishID: 1, CategoryID: 1, Quantity: 2, Price: price("10.00")},
+	{DishID: 2, CategoryID: 2, Quantity: 1, Price: price("5.00")},
+	{DishID: 3, CategoryID: 1, Quantity: 3, Price: price("3.33")},
+}
+
+func TestSubtotal(t *testing.T) {
+	if got := Subtotal(lines).String(); got != "34.99" {
+		t.Errorf("Subtotal = %s, want 34.99", got)
+	}
+	if got := Subtotal(nil).String(); got != "0.00" {
+		t.Errorf("Subtotal(nil) = %s, want 0.00", got)
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		p    models.Promotion
+		want string
+	}{
+		{"active without dates", models.Promotion{IsActive: true}, ""},
+		{"inactive", models.Promotion{}, "not active"},
+		{"within dates", models.Promotion{IsActive: true, StartsAt: &before, EndsAt: &after}, ""},
+		{"starts now", models.Promotion{IsActive: true, StartsAt: &now}, ""},
+		{"not started", models.Promotion{IsActive: true, StartsAt: &after}, "not valid until 2024-05-01T13:00:00Z"},
+		{"ends now", models.Promotion{IsActive: true, EndsAt: &now}, "expired"},
+		{"ended", models.Promotion{IsActive: true, EndsAt: &before}, "expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Available(tt.p, now)
+			if got := fmt.Sprint(err); tt.want == "" && err != nil || tt.want != "" && got != tt.want {
+				t.Errorf("Available() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		p    models.Promotion
+		want string // 减免金额，或不满足条件的原因
+	}{
+		{"percentage rounds down", models.Promotion{Type: models.PromotionPercentage, PercentOff: 10}, "3.49"},
+		{"percentage on a category", models.Promotion{Type: models.PromotionPercentage, PercentOff: 15, CategoryID: intPtr(1)}, "4.49"},
+		{"fixed amount", models.Promotion{Type: models.PromotionFixedAmount, AmountOff: price("5")}, "5.00"},
+		{"fixed amount capped at eligible subtotal", models.Promotion{Type: models.PromotionFixedAmount, AmountOff: price("50"), DishID: intPtr(2)}, "5.00"},
+		{"minimum spend met", models.Promotion{Type: models.PromotionFixedAmount, AmountOff: price("5"), MinSpend: price("34.99")}, "5.00"},
+		{"minimum spend not met", models.Promotion{Type: models.PromotionFixedAmount, AmountOff: price("5"), MinSpend: price("40")}, "minimum spend is 40.00"},
+		{"minimum spend counts eligible items only", models.Promotion{Type: models.PromotionPercentage, PercentOff: 10, CategoryID: intPtr(2), MinSpend: price("10")}, "minimum spend is 10.00"},
+		{"no eligible items", models.Promotion{Type: models.PromotionPercentage, PercentOff: 10, DishID: intPtr(99)}, "no eligible items in the order"},
+		{"buy two get the cheapest free", models.Promotion{Type: models.PromotionBuyNGetOne, BuyQuantity: 2}, "6.66"},
+		{"buy one get one on a category", models.Promotion{Type: models.PromotionBuyNGetOne, BuyQuantity: 1, CategoryID: intPtr(1)}, "6.66"},
+		{"not enough items for a free one", models.Promotion{Type: models.PromotionBuyNGetOne, BuyQuantity: 2, DishID: intPtr(2)}, "buy 2 eligible items to get one free"},
+		{"invalid buy quantity", models.Promotion{Type: models.PromotionBuyNGetOne}, "buy 0 eligible items to get one free"},
+		{"unknown type", models.Promotion{Type: "mystery"}, "unsupported promotion type mystery"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discount, err := Evaluate(tt.p, lines)
+			got := discount.String()
+			if err != nil {
+				var ineligible *IneligibleError
+				if !errors.As(err, &ineligible) {
+					t.Fatalf("Evaluate() error = %v, want *IneligibleError", err)
+				}
+				got = ineligible.Reason
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tenPercent := models.Promotion{ID: 1, Name: "九折", Type: models.PromotionPercentage, PercentOff: 10}
+	bigSpender := models.Promotion{ID: 2, Name: "满百减二十", Type: models.PromotionFixedAmount, AmountOff: price("20"), MinSpend: price("100")}
+	thirtyOff := models.Promotion{ID: 3, Name: "立减三十", Type: models.PromotionFixedAmount, AmountOff: price("30")}
+	coupon := models.Promotion{ID: 4, Name: "优惠券", Code: "SAVE5", Type: models.PromotionFixedAmount, AmountOff: price("5")}
+	tenOff := models.Promotion{ID: 5, Name: "优惠券", Code: "SAVE10", Type: models.PromotionFixedAmount, AmountOff: price("10")}
+	unusable := models.Promotion{ID: 6, Name: "优惠券", Code: "BIG", Type: models.PromotionFixedAmount, AmountOff: price("5"), MinSpend: price("100")}
+
+	tests := []struct {
+		name      string
+		automatic []models.Promotion
+		coupon    *models.Promotion
+		want      string // 各调整项的金额
+		total     string
+		err       string
+	}{
+		{"no promotions", nil, nil, "[]", "34.99", ""},
+		{"automatic promotions stack, ineligible ones are skipped", []models.Promotion{tenPercent, bigSpender}, &coupon, "[-3.49 -5.00]", "26.50", ""},
+		{"total discount is capped at the subtotal", []models.Promotion{thirtyOff}, &tenOff, "[-30.00 -4.99]", "0.00", ""},
+		{"ineligible coupon is an error", []models.Promotion{tenPercent}, &unusable, "", "", "minimum spend is 100.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adjustments, err := Apply(tt.automatic, tt.coupon, lines)
+			if tt.err != "" {
+				var ineligible *IneligibleError
+				if !errors.As(err, &ineligible) || ineligible.Reason != tt.err {
+					t.Fatalf("Apply() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			amounts := []string{}
+			for _, adjustment := range adjustments {
+				amounts = append(amounts, adjustment.Amount.String())
+				if adjustment.PromotionID == nil {
+					t.Errorf("adjustment %q has no promotion ID", adjustment.Description)
+				}
+			}
+			if got := fmt.Sprint(amounts); got != tt.want {
+				t.Errorf("Apply() amounts = %s, want %s", got, tt.want)
+			}
+			if got := Total(Subtotal(lines), adjustments).String(); got != tt.total {
+				t.Errorf("Total = %s, want %s", got, tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Package recommend 按推荐配置生成具体的菜单
+//
+// 规则模板（template）只规定荤菜、素菜各几道，这里从上架的菜品中随机挑选，满足预算和排除条件；
+// 固定菜单（curated）由管理员选定菜品，生成时原样返回。
+// 随机数由 seed 决定：同样的 seed 和同样的候选菜品总是得到同样的菜单，换一个 seed 即“换一批”。
+// 菜品带 meat 标签算荤菜、带 vegetable 标签算素菜；读取候选菜品由调用方负责。
+package recommend
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"food-ordering/models"
+	"food-ordering/money"
+)
+
+// KeyMaxDishCount 推荐设置的配置项：一份菜单最多几道菜
+const KeyMaxDishCount = "max_dish_count"
+
+// Tags 决定荤菜、素菜的标签，候选菜品为带有其中任一标签的上架菜品
+var Tags = []string{models.TagMeat, models.TagVegetable}
+
+// IsKey 判断配置项是否属于推荐设置
+func IsKey(key string) bool {
+	return key == KeyMaxDishCount
+}
+
+// Config 推荐设置
+type Config struct {
+	MaxDishCount int
+}
+
+// Load 从配置项解析推荐设置，配置无效时返回错误
+func Load(values map[string]string) (*Config, error) {
+	maxDishes, err := strconv.Atoi(values[KeyMaxDishCount])
+	if err != nil || maxDishes < 1 {
+		return nil, fmt.Errorf("invalid %s %q", KeyMaxDishCount, values[KeyMaxDishCount])
+	}
+	return &Config{MaxDishCount: maxDishes}, nil
+}
+
+// IsMeat 判断菜品是否为荤菜
+func IsMeat(dish models.Dish) bool {
+	return hasTag(dish, models.TagMeat)
+}
+
+// IsVegetable 判断菜品是否为素菜；同时带两个标签的菜品按荤菜处理
+func IsVegetable(dish models.Dish) bool {
+	return !IsMeat(dish) && hasTag(dish, models.TagVegetable)
+}
+
+func hasTag(dish models.Dish, tag string) bool {
+	for _, t := range dish.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Request 生成菜单的条件
+type Request struct {
+	MeatCount      int
+	VegetableCount int
+	Budget         *money.Money // 菜单总价上限，nil 表示不限
+	Exclude        []int        // 不要的菜品 ID
+	Seed           int64
+}
+
+// Error 无法生成满足条件的菜单，Reason 是返回给用户的英文说明
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+func unsatisfiable(format string, args ...interface{}) error {
+	return &Error{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Generate 从候选菜品中按标签选出荤菜和素菜，返回的菜单荤菜在前。
+// 有预算时每一步只选仍然能在预算内凑齐剩余菜品的菜，因此只要存在满足预算的组合就一定能生成
+func (c *Config) Generate(candidates []models.Dish, req Request) ([]models.Dish, error) {
+	if err := c.Check(req.MeatCount, req.VegetableCount, nil); err != nil {
+		return nil, err
+	}
+
+	var meats, vegetables []models.Dish
+	for _, dish := range candidates {
+		if !dish.IsActive || contains(req.Exclude, dish.ID) {
+			continue
+		}
+		switch {
+		case IsMeat(dish):
+			meats = append(meats, dish)
+		case IsVegetable(dish):
+			vegetables = append(vegetables, dish)
+		}
+	}
+	if len(meats) < req.MeatCount {
+		return nil, unsatisfiable("not enough meat dishes: need %d, %d available", req.MeatCount, len(meats))
+	}
+	if len(vegetables) < req.VegetableCount {
+		return nil, unsatisfiable("not enough vegetable dishes: need %d, %d available", req.VegetableCount, len(vegetables))
+	}
+
+	// 候选菜品先按 ID 排序再打乱，结果只取决于 seed 和候选菜品本身，与查询顺序无关
+	rng := rand.New(rand.NewSource(req.Seed))
+	shuffle := func(dishes []models.Dish) {
+		sort.Slice(dishes, func(i, j int) bool { return dishes[i].ID < dishes[j].ID })
+		rng.Shuffle(len(dishes), func(i, j int) { dishes[i], dishes[j] = dishes[j], dishes[i] })
+	}
+	shuffle(meats)
+	shuffle(vegetables)
+
+	if req.Budget != nil {
+		cheapest := cheapestTotal(meats, req.MeatCount, -1).Add(cheapestTotal(vegetables, req.VegetableCount, -1))
+		if cheapest.Cmp(*req.Budget) > 0 {
+			return nil, unsatisfiable("no combination fits within budget %s, the cheapest costs %s", *req.Budget, cheapest)
+		}
+	}
+
+	total := money.New(0)
+	menu := make([]models.Dish, 0, req.MeatCount+req.VegetableCount)
+	pools := []pool{{meats, req.MeatCount}, {vegetables, req.VegetableCount}}
+	for p := range pools {
+		pool := &pools[p]
+		for ; pool.count > 0; pool.count-- {
+			picked := -1
+			for i, dish := range pool.dishes {
+				if req.Budget == nil || fits(total.Add(dish.Price), pools[p:], i, *req.Budget) {
+					picked = i
+					break
+				}
+			}
+			// 预算在开始时已经校验过，这里总能选到
+			dish := pool.dishes[picked]
+			menu = append(menu, dish)
+			total = total.Add(dish.Price)
+			pool.dishes = append(pool.dishes[:picked:picked], pool.dishes[picked+1:]...)
+		}
+	}
+	return menu, nil
+}
+
+// pool 一类菜品中尚未选中的候选菜品，以及还要选几道
+type pool struct {
+	dishes []models.Dish
+	count  int
+}
+
+// fits 判断选中 pools[0] 的第 skip 道菜、总价为 total 后，剩余的名额用最便宜的菜能否凑齐在预算内
+func fits(total money.Money, pools []pool, skip int, budget money.Money) bool {
+	total = total.Add(cheapestTotal(pools[0].dishes, pools[0].count-1, skip))
+	for _, pool := range pools[1:] {
+		total = total.Add(cheapestTotal(pool.dishes, pool.count, -1))
+	}
+	return total.Cmp(budget) <= 0
+}
+
+// cheapestTotal 除第 skip 道以外最便宜的 n 道菜的总价
+func cheapestTotal(dishes []models.Dish, n, skip int) money.Money {
+	prices := make([]money.Money, 0, len(dishes))
+	for i, dish := range dishes {
+		if i != skip {
+			prices = append(prices, dish.Price)
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Cmp(prices[j]) < 0 })
+	total := money.New(0)
+	for _, price := range prices[:n] {
+		total = total.Add(price)
+	}
+	return total
+}
+
+// Total 菜单总价
+func Total(menu []models.Dish) money.Money {
+	total := money.New(0)
+	for _, dish := range menu {
+		total = total.Add(dish.Price)
+	}
+	return total
+}
+
+// Check 校验推荐配置能否使用：荤素数量不超过 max_dish_count；
+// 固定菜单（dishes 非 nil）的菜品必须上架、不重复，且荤菜、素菜的数量与配置一致
+func (c *Config) Check(meatCount, vegetableCount int, dishes []models.Dish) error {
+	if meatCount < 0 || vegetableCount < 0 {
+		return unsatisfiable("dish counts cannot be negative")
+	}
+	n := meatCount + vegetableCount
+	if n == 0 {
+		return unsatisfiable("recommendation needs at least one dish")
+	}
+	if n > c.MaxDishCount {
+		return unsatisfiable("recommendation needs %d dishes, more than max_dish_count %d", n, c.MaxDishCount)
+	}
+	if dishes == nil {
+		return nil
+	}
+
+	meats, vegetables := 0, 0
+	seen := make(map[int]bool, len(dishes))
+	for _, dish := range dishes {
+		if seen[dish.ID] {
+			return unsatisfiable("dish %d is listed more than once", dish.ID)
+		}
+		seen[dish.ID] = true
+		if !dish.IsActive {
+			return unsatisfiable("dish %d is not available", dish.ID)
+		}
+		switch {
+		case IsMeat(dish):
+			meats++
+		case IsVegetable(dish):
+			vegetables++
+		default:
+			return unsatisfiable("dish %d is neither a meat nor a vegetable dish", dish.ID)
+		}
+	}
+	if meats != meatCount || vegetables != vegetableCount {
+		return unsatisfiable("curated menu has %d meat and %d vegetable dishes, recommendation needs %d and %d",
+			meats, vegetables, meatCount, vegetableCount)
+	}
+	return nil
+}
+
+// Curated 返回固定菜单，荤菜在前；固定菜单不随 seed 变化，有不要的菜品或超出预算时无法生成
+func (c *Config) Curated(dishes []models.Dish, req Request) ([]models.Dish, error) {
+	if err := c.Check(req.MeatCount, req.VegetableCount, dishes); err != nil {
+		return nil, err
+	}
+	for _, dish := range dishes {
+		if contains(req.Exclude, dish.ID) {
+			return nil, unsatisfiable("curated menu contains excluded dish %d", dish.ID)
+		}
+	}
+	menu := make([]models.Dish, 0, len(dishes))
+	for _, dish := range dishes {
+		if IsMeat(dish) {
+			menu = append(menu, dish)
+		}
+	}
+	for _, dish := range dishes {
+		if IsVegetable(dish) {
+			menu = append(menu, dish)
+		}
+	}
+	if total := Total(menu); req.Budget != nil && total.Cmp(*req.Budget) > 0 {
+		return nil, unsatisfiable("curated menu costs %s, over budget %s", total, *req.Budget)
+	}
+	return menu, nil
+}
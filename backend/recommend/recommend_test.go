@@ -0,0 +1,232 @@
+package recommend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"food-ordering/models"
+	"food-ordering/money"
+)
+
+func dish(id int, yuan int64, tags ...string) models.Dish {
+	return models.Dish{ID: id, Name: fmt.Sprintf("dish %d", id), Price: money.New(yuan * 100), IsActive: true, Tags: tags}
+}
+
+// 荤菜 1、2、3、7（7 同时带素菜标签），素菜 4、5、6，8 是饮品，9 已下架
+var candidates = []models.Dish{
+	dish(1, 30, models.TagMeat),
+	dish(2, 20, models.TagMeat, "spicy"),
+	dish(3, 10, models.TagMeat),
+	dish(4, 15, models.TagVegetable),
+	dish(5, 8, models.TagVegetable),
+	dish(6, 5, models.TagVegetable, "vegetarian"),
+	dish(7, 12, models.TagMeat, models.TagVegetable),
+	dish(8, 3, "drink"),
+	{ID: 9, Price: money.New(100), Tags: []string{models.TagMeat}},
+}
+
+func byID(id int) models.Dish {
+	for _, d := range candidates {
+		if d.ID == id {
+			return d
+		}
+	}
+	panic(fmt.Sprintf("no dish %d", id))
+}
+
+func ids(menu []models.Dish) []int {
+	result := []int{}
+	for _, d := range menu {
+		result = append(result, d.ID)
+	}
+	return result
+}
+
+func budget(yuan string) *money.Money {
+	m, err := money.Parse(yuan, "")
+	if err != nil {
+		panic(err)
+	}
+	return &m
+}
+
+func TestDishKinds(t *testing.T) {
+	tests := []struct {
+		id        int
+		meat      bool
+		vegetable bool
+	}{
+		{1, true, false},
+		{6, false, true},
+		{7, true, false},
+		{8, false, false},
+	}
+	for _, tt := range tests {
+		d := byID(tt.id)
+		if IsMeat(d) != tt.meat || IsVegetable(d) != tt.vegetable {
+			t.Errorf("dish %d: IsMeat = %v, IsVegetable = %v; want %v, %v", tt.id, IsMeat(d), IsVegetable(d), tt.meat, tt.vegetable)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"4", ""},
+		{"1", ""},
+		{"0", `invalid max_dish_count "0"`},
+		{"", `invalid max_dish_count ""`},
+		{"many", `invalid max_dish_count "many"`},
+	}
+	for _, tt := range tests {
+		config, err := Load(map[string]string{KeyMaxDishCount: tt.value})
+		switch {
+		case tt.want == "" && (err != nil || fmt.Sprint(config.MaxDishCount) != tt.value):
+			t.Errorf("Load(%q) = %+v, %v", tt.value, config, err)
+		case tt.want != "" && fmt.Sprint(err) != tt.want:
+			t.Errorf("Load(%q) error = %v, want %q", tt.value, err, tt.want)
+		}
+	}
+	if !IsKey(KeyMaxDishCount) || IsKey("schedule_timezone") {
+		t.Error("IsKey does not match only max_dish_count")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	config := &Config{MaxDishCount: 4}
+	tests := []struct {
+		name      string
+		meat, veg int
+		dishes    []int // nil 表示规则模板
+		want      string
+	}{
+		{"template", 2, 1, nil, ""},
+		{"template at max_dish_count", 2, 2, nil, ""},
+		{"no dishes", 0, 0, nil, "recommendation needs at least one dish"},
+		{"negative count", -1, 2, nil, "dish counts cannot be negative"},
+		{"too many dishes", 3, 2, nil, "recommendation needs 5 dishes, more than max_dish_count 4"},
+		{"curated", 2, 1, []int{4, 1, 7}, ""},
+		{"curated duplicate", 2, 1, []int{1, 1, 4}, "dish 1 is listed more than once"},
+		{"curated inactive dish", 2, 1, []int{1, 9, 4}, "dish 9 is not available"},
+		{"curated drink", 2, 1, []int{1, 8, 4}, "dish 8 is neither a meat nor a vegetable dish"},
+		{"curated counts differ", 2, 1, []int{1, 4}, "curated menu has 1 meat and 1 vegetable dishes, recommendation needs 2 and 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dishes []models.Dish
+			for _, id := range tt.dishes {
+				dishes = append(dishes, byID(id))
+			}
+			err := config.Check(tt.meat, tt.veg, dishes)
+			if got := fmt.Sprint(err); tt.want == "" && err != nil || tt.want != "" && got != tt.want {
+				t.Errorf("Check() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	config := &Config{MaxDishCount: 4}
+	tests := []struct {
+		name string
+		req  Request
+		want string // 菜品 ID，或无法生成的原因
+	}{
+		{"budget fits only the cheapest menu", Request{MeatCount: 2, VegetableCount: 1, Budget: budget("27.00")}, "[3 7 6]"},
+		{"budget too small", Request{MeatCount: 2, VegetableCount: 1, Budget: budget("26.99")},
+			"no combination fits within budget 26.99, the cheapest costs 27.00"},
+		{"not enough meat dishes", Request{MeatCount: 3, VegetableCount: 1, Exclude: []int{1, 2}},
+			"not enough meat dishes: need 3, 2 available"},
+		{"not enough vegetable dishes", Request{MeatCount: 1, VegetableCount: 1, Exclude: []int{4, 5, 6}},
+			"not enough vegetable dishes: need 1, 0 available"},
+		{"too many dishes", Request{MeatCount: 4, VegetableCount: 1}, "recommendation needs 5 dishes, more than max_dish_count 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			menu, err := config.Generate(candidates, tt.req)
+			got := fmt.Sprint(ids(menu))
+			if err != nil {
+				if _, ok := err.(*Error); !ok {
+					t.Fatalf("Generate() error = %v, want *Error", err)
+				}
+				got = err.Error()
+			} else if len(menu) == 3 && menu[0].ID > menu[1].ID {
+				// 同类菜品的顺序取决于 seed
+				menu[0], menu[1] = menu[1], menu[0]
+				got = fmt.Sprint(ids(menu))
+			}
+			if got != tt.want {
+				t.Errorf("Generate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateRandomMenus(t *testing.T) {
+	config := &Config{MaxDishCount: 4}
+	reversed := make([]models.Dish, len(candidates))
+	for i, d := range candidates {
+		reversed[len(candidates)-1-i] = d
+	}
+
+	menus := map[string]bool{}
+	for seed := int64(0); seed < 50; seed++ {
+		req := Request{MeatCount: 2, VegetableCount: 1, Budget: budget("40.00"), Exclude: []int{2}, Seed: seed}
+		menu, err := config.Generate(candidates, req)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if len(menu) != 3 || !IsMeat(menu[0]) || !IsMeat(menu[1]) || !IsVegetable(menu[2]) || menu[0].ID == menu[1].ID {
+			t.Fatalf("seed %d: menu %v, want two meat dishes then a vegetable dish", seed, ids(menu))
+		}
+		if total := Total(menu); total.Cmp(*req.Budget) > 0 {
+			t.Errorf("seed %d: menu %v costs %s, over budget", seed, ids(menu), total)
+		}
+		for _, d := range menu {
+			if d.ID == 2 || d.ID == 9 {
+				t.Errorf("seed %d: menu %v contains excluded or inactive dish %d", seed, ids(menu), d.ID)
+			}
+		}
+		// 结果只取决于 seed 和候选菜品，与候选菜品的顺序无关
+		again, _ := config.Generate(reversed, req)
+		if !reflect.DeepEqual(ids(again), ids(menu)) {
+			t.Errorf("seed %d: menu %v from reversed candidates, want %v", seed, ids(again), ids(menu))
+		}
+		menus[fmt.Sprint(ids(menu))] = true
+	}
+	if len(menus) < 2 {
+		t.Errorf("50 seeds produced only %d distinct menus", len(menus))
+	}
+}
+
+func TestCurated(t *testing.T) {
+	config := &Config{MaxDishCount: 4}
+	dishes := []models.Dish{byID(4), byID(1), byID(2)}
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"meat dishes first", Request{MeatCount: 2, VegetableCount: 1, Seed: 7}, "[1 2 4]"},
+		{"within budget", Request{MeatCount: 2, VegetableCount: 1, Budget: budget("65")}, "[1 2 4]"},
+		{"over budget", Request{MeatCount: 2, VegetableCount: 1, Budget: budget("64.99")}, "curated menu costs 65.00, over budget 64.99"},
+		{"excluded dish", Request{MeatCount: 2, VegetableCount: 1, Exclude: []int{2}}, "curated menu contains excluded dish 2"},
+		{"counts differ", Request{MeatCount: 1, VegetableCount: 2},
+			"curated menu has 2 meat and 1 vegetable dishes, recommendation needs 1 and 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			menu, err := config.Curated(dishes, tt.req)
+			got := fmt.Sprint(ids(menu))
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("Curated() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Package related 根据订单中菜品的共同出现计算“点了这道菜的人还点了”
+//
+// 两道菜出现在同一个订单中记为一次共同点单，相似度为共同点单数除以两道菜各自点单数乘积的平方根（余弦相似度），
+// 只点一道热门菜不会让它与所有菜都相似。统计由后台任务定期全量计算，这里只做计算，读取订单和保存结果由调用方负责。
+package related
+
+import (
+	"math"
+	"sort"
+
+	"food-ordering/models"
+)
+
+// 购物车推荐的原因
+const (
+	ReasonOrderedTogether = "often_ordered_together" // 经常和购物车中的菜一起点
+	ReasonComplements     = "complements_cart"       // 购物车中还没有这类菜，如只有荤菜时的汤
+)
+
+// Pair 一道菜与另一道菜的相似度，DishID、RelatedDishID 两个方向各保存一条
+type Pair struct {
+	DishID        int
+	RelatedDishID int
+	CoOrders      int
+	Score         float64
+}
+
+// Stats 一次统计的结果
+type Stats struct {
+	Pairs       []Pair
+	OrderCounts map[int]int // 每道菜出现在多少个订单中
+}
+
+// Params 统计参数
+type Params struct {
+	MinCoOrders int // 至少一起出现在这么多个订单中才算相关
+	PerDish     int // 每道菜最多保留多少道相关菜品
+}
+
+// DefaultParams 默认的统计参数
+var DefaultParams = Params{
+	MinCoOrders: 2,
+	PerDish:     20,
+}
+
+// Compute 按订单统计相似度，baskets 为每个订单中的菜品 ID，同一订单中重复的菜品只算一次
+func (p Params) Compute(baskets [][]int) *Stats {
+	type key struct{ a, b int }
+	counts := make(map[int]int)
+	co := make(map[key]int)
+	for _, basket := range baskets {
+		dishes := distinct(basket)
+		for i, a := range dishes {
+			counts[a]++
+			for _, b := range dishes[i+1:] {
+				co[key{a, b}]++
+			}
+		}
+	}
+
+	byDish := make(map[int][]Pair)
+	for k, n := range co {
+		if n < p.MinCoOrders {
+			continue
+		}
+		score := math.Round(float64(n)/math.Sqrt(float64(counts[k.a]*counts[k.b]))*10000) / 10000
+		byDish[k.a] = append(byDish[k.a], Pair{DishID: k.a, RelatedDishID: k.b, CoOrders: n, Score: score})
+		byDish[k.b] = append(byDish[k.b], Pair{DishID: k.b, RelatedDishID: k.a, CoOrders: n, Score: score})
+	}
+
+	stats := &Stats{OrderCounts: counts}
+	dishIDs := make([]int, 0, len(byDish))
+	for id := range byDish {
+		dishIDs = append(dishIDs, id)
+	}
+	sort.Ints(dishIDs)
+	for _, id := range dishIDs {
+		pairs := byDish[id]
+		sort.Slice(pairs, func(i, j int) bool {
+			if pairs[i].Score != pairs[j].Score {
+				return pairs[i].Score > pairs[j].Score
+			}
+			if pairs[i].CoOrders != pairs[j].CoOrders {
+				return pairs[i].CoOrders > pairs[j].CoOrders
+			}
+			return pairs[i].RelatedDishID < pairs[j].RelatedDishID
+		})
+		if len(pairs) > p.PerDish {
+			pairs = pairs[:p.PerDish]
+		}
+		stats.Pairs = append(stats.Pairs, pairs...)
+	}
+	return stats
+}
+
+// distinct 去重并排序
+func distinct(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	var result []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+// Courses 凑一餐时区分的菜品类型，对应同名的标签
+var Courses = []string{models.TagMeat, models.TagVegetable, models.TagSoup, models.TagStaple}
+
+// Missing 购物车中还没有的菜品类型，按 Courses 的顺序
+func Missing(cart []models.Dish) []string {
+	has := make(map[string]bool)
+	for _, dish := range cart {
+		for _, course := range courses(dish) {
+			has[course] = true
+		}
+	}
+	var missing []string
+	for _, course := range Courses {
+		if !has[course] {
+			missing = append(missing, course)
+		}
+	}
+	return missing
+}
+
+// courses 菜品带有的菜品类型标签
+func courses(dish models.Dish) []string {
+	var result []string
+	for _, course := range Courses {
+		for _, tag := range dish.Tags {
+			if tag == course {
+				result = append(result, course)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Complete 为购物车推荐“凑一餐”的菜品，能补上购物车中缺少的菜品类型（荤菜、素菜、汤、主食）的菜优先，每个缺少的类型先推荐一道。
+// related 为购物车中每道菜的相关菜品；fallback 为带有缺少的类型标签的上架菜品，
+// 相关菜品补不上的类型从中按点单数各补一道。结果不含购物车中已有的菜品，最多 limit 道
+func Complete(cart []models.Dish, related map[int][]models.RelatedDish, fallback []models.Dish, orderCounts map[int]int, limit int) []models.CartSuggestion {
+	inCart := make(map[int]bool, len(cart))
+	for _, dish := range cart {
+		inCart[dish.ID] = true
+	}
+	missing := make(map[string]bool)
+	for _, course := range Missing(cart) {
+		missing[course] = true
+	}
+	// fills 菜品能补上的缺少的类型
+	fills := func(dish models.Dish) []string {
+		var result []string
+		for _, course := range courses(dish) {
+			if missing[course] {
+				result = append(result, course)
+			}
+		}
+		return result
+	}
+
+	// 同一道菜与购物车中多道菜相关时累加相似度
+	candidates := make(map[int]*models.CartSuggestion)
+	for _, dish := range cart {
+		for _, r := range related[dish.ID] {
+			if inCart[r.Dish.ID] || !r.Dish.IsActive {
+				continue
+			}
+			if candidate, ok := candidates[r.Dish.ID]; ok {
+				candidate.Score += r.Score
+				continue
+			}
+			reason := ReasonOrderedTogether
+			if len(fills(r.Dish)) > 0 {
+				reason = ReasonComplements
+			}
+			candidates[r.Dish.ID] = &models.CartSuggestion{Dish: r.Dish, Score: r.Score, Reason: reason}
+		}
+	}
+
+	covered := make(map[string]bool)
+	for _, candidate := range candidates {
+		for _, course := range fills(candidate.Dish) {
+			covered[course] = true
+		}
+	}
+	sort.Slice(fallback, func(i, j int) bool {
+		if orderCounts[fallback[i].ID] != orderCounts[fallback[j].ID] {
+			return orderCounts[fallback[i].ID] > orderCounts[fallback[j].ID]
+		}
+		return fallback[i].ID < fallback[j].ID
+	})
+	for _, dish := range fallback {
+		if inCart[dish.ID] || !dish.IsActive || candidates[dish.ID] != nil || !uncovered(fills(dish), covered) {
+			continue
+		}
+		for _, course := range fills(dish) {
+			covered[course] = true
+		}
+		candidates[dish.ID] = &models.CartSuggestion{Dish: dish, Reason: ReasonComplements}
+	}
+
+	suggestions := make([]models.CartSuggestion, 0, len(candidates))
+	for _, candidate := range candidates {
+		candidate.Score = math.Round(candidate.Score*10000) / 10000
+		suggestions = append(suggestions, *candidate)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if (a.Reason == ReasonComplements) != (b.Reason == ReasonComplements) {
+			return a.Reason == ReasonComplements
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if orderCounts[a.Dish.ID] != orderCounts[b.Dish.ID] {
+			return orderCounts[a.Dish.ID] > orderCounts[b.Dish.ID]
+		}
+		return a.Dish.ID < b.Dish.ID
+	})
+
+	// 每个缺少的类型先各推荐得分最高的一道，再推荐其余的菜，避免被同一个类型占满
+	ordered := make([]models.CartSuggestion, 0, len(suggestions))
+	var rest []models.CartSuggestion
+	first := make(map[string]bool)
+	for _, suggestion := range suggestions {
+		courses := fills(suggestion.Dish)
+		if suggestion.Reason == ReasonComplements && uncovered(courses, first) {
+			for _, course := range courses {
+				first[course] = true
+			}
+			ordered = append(ordered, suggestion)
+		} else {
+			rest = append(rest, suggestion)
+		}
+	}
+	ordered = append(ordered, rest...)
+	if len(ordered) > limit {
+		ordered = ordered[:limit]
+	}
+	return ordered
+}
+
+// uncovered courses 中是否有 covered 中没有的类型
+func uncovered(courses []string, covered map[string]bool) bool {
+	for _, course := range courses {
+		if !covered[course] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package related
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"food-ordering/models"
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  Params
+		baskets [][]int
+		want    []Pair
+		counts  map[int]int
+	}{
+		{
+			name:    "pairs below MinCoOrders are dropped",
+			params:  Params{MinCoOrders: 2, PerDish: 20},
+			baskets: [][]int{{1, 2}, {2, 1}, {1, 3}},
+			want:    []Pair{{1, 2, 2, 0.8165}, {2, 1, 2, 0.8165}},
+			counts:  map[int]int{1: 3, 2: 2, 3: 1},
+		},
+		{
+			name:    "repeated dishes in one order count once",
+			params:  Params{MinCoOrders: 1, PerDish: 20},
+			baskets: [][]int{{1, 1, 2}, {2, 1, 2}},
+			want:    []Pair{{1, 2, 2, 1}, {2, 1, 2, 1}},
+			counts:  map[int]int{1: 2, 2: 2},
+		},
+		{
+			name:    "PerDish keeps the most similar dishes",
+			params:  Params{MinCoOrders: 2, PerDish: 1},
+			baskets: [][]int{{1, 2}, {1, 2}, {1, 3}, {1, 3}, {1, 3}},
+			want:    []Pair{{1, 3, 3, 0.7746}, {2, 1, 2, 0.6325}, {3, 1, 3, 0.7746}},
+			counts:  map[int]int{1: 5, 2: 2, 3: 3},
+		},
+		{
+			name:    "single dish orders",
+			params:  DefaultParams,
+			baskets: [][]int{{1}, {1}},
+			want:    nil,
+			counts:  map[int]int{1: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := tt.params.Compute(tt.baskets)
+			if !reflect.DeepEqual(stats.Pairs, tt.want) {
+				t.Errorf("Pairs = %v, want %v", stats.Pairs, tt.want)
+			}
+			if !reflect.DeepEqual(stats.OrderCounts, tt.counts) {
+				t.Errorf("OrderCounts = %v, want %v", stats.OrderCounts, tt.counts)
+			}
+		})
+	}
+}
+
+func dish(id int, tags ...string) models.Dish {
+	return models.Dish{ID: id, Name: fmt.Sprintf("dish %d", id), IsActive: true, Tags: tags}
+}
+
+var (
+	pork      = dish(1, models.TagMeat, "spicy")
+	chicken   = dish(2, models.TagMeat)
+	greens    = dish(3, models.TagVegetable)
+	eggSoup   = dish(4, models.TagSoup)
+	fishSoup  = dish(5, models.TagSoup)
+	rice      = dish(6, models.TagStaple)
+	tea       = dish(7, "drink")
+	oldSoup   = models.Dish{ID: 8, Tags: []string{models.TagSoup}}
+	greenSoup = dish(9, models.TagSoup, models.TagVegetable)
+)
+
+func TestMissing(t *testing.T) {
+	tests := []struct {
+		cart []models.Dish
+		want []string
+	}{
+		{nil, Courses},
+		{[]models.Dish{pork}, []string{models.TagVegetable, models.TagSoup, models.TagStaple}},
+		{[]models.Dish{pork, greenSoup}, []string{models.TagStaple}},
+		{[]models.Dish{tea}, Courses},
+		{[]models.Dish{pork, greens, eggSoup, rice}, nil},
+	}
+	for _, tt := range tests {
+		if got := Missing(tt.cart); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Missing(%v) = %v, want %v", tt.cart, got, tt.want)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	rel := func(d models.Dish, score float64) models.RelatedDish {
+		return models.RelatedDish{Dish: d, Score: score}
+	}
+	tests := []struct {
+		name        string
+		cart        []models.Dish
+		related     map[int][]models.RelatedDish
+		fallback    []models.Dish
+		orderCounts map[int]int
+		limit       int
+		want        []string
+	}{
+		{
+			name: "missing courses first, one per course",
+			cart: []models.Dish{pork},
+			related: map[int][]models.RelatedDish{
+				pork.ID: {rel(chicken, 0.9), rel(tea, 0.8), rel(eggSoup, 0.5), rel(oldSoup, 0.99)},
+			},
+			fallback:    []models.Dish{greens, eggSoup, fishSoup, rice},
+			orderCounts: map[int]int{greens.ID: 5, rice.ID: 1, fishSoup.ID: 9, eggSoup.ID: 2},
+			limit:       10,
+			want: []string{
+				"4 complements_cart 0.5", "3 complements_cart 0", "6 complements_cart 0",
+				"2 often_ordered_together 0.9", "7 often_ordered_together 0.8",
+			},
+		},
+		{
+			name:        "limit",
+			cart:        []models.Dish{pork},
+			related:     map[int][]models.RelatedDish{pork.ID: {rel(chicken, 0.9), rel(eggSoup, 0.5)}},
+			fallback:    []models.Dish{greens, rice},
+			orderCounts: map[int]int{},
+			limit:       2,
+			want:        []string{"4 complements_cart 0.5", "3 complements_cart 0"},
+		},
+		{
+			name:        "second dish of a course waits for the other courses",
+			cart:        []models.Dish{pork},
+			related:     map[int][]models.RelatedDish{pork.ID: {rel(eggSoup, 0.5), rel(fishSoup, 0.7), rel(greens, 0.1)}},
+			fallback:    []models.Dish{rice},
+			orderCounts: map[int]int{},
+			limit:       10,
+			want: []string{
+				"5 complements_cart 0.7", "3 complements_cart 0.1", "6 complements_cart 0", "4 complements_cart 0.5",
+			},
+		},
+		{
+			name: "scores add up across cart dishes when every course is covered",
+			cart: []models.Dish{pork, greens, eggSoup, rice},
+			related: map[int][]models.RelatedDish{
+				pork.ID:   {rel(chicken, 0.4), rel(greens, 0.9)},
+				greens.ID: {rel(chicken, 0.3), rel(tea, 0.2)},
+			},
+			orderCounts: map[int]int{},
+			limit:       10,
+			want:        []string{"2 often_ordered_together 0.7", "7 often_ordered_together 0.2"},
+		},
+		{
+			name:        "a dish can fill several courses",
+			cart:        []models.Dish{pork},
+			related:     map[int][]models.RelatedDish{pork.ID: {rel(greenSoup, 0.3)}},
+			fallback:    []models.Dish{greens, fishSoup, rice},
+			orderCounts: map[int]int{greens.ID: 5, fishSoup.ID: 9},
+			limit:       10,
+			want:        []string{"9 complements_cart 0.3", "6 complements_cart 0"},
+		},
+		{
+			name:        "cart dishes are never suggested",
+			cart:        []models.Dish{pork, chicken},
+			related:     map[int][]models.RelatedDish{pork.ID: {rel(chicken, 0.9), rel(eggSoup, 0.2)}},
+			fallback:    []models.Dish{chicken, rice, greens, eggSoup},
+			orderCounts: map[int]int{},
+			limit:       10,
+			want:        []string{"4 complements_cart 0.2", "3 complements_cart 0", "6 complements_cart 0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range Complete(tt.cart, tt.related, tt.fallback, tt.orderCounts, tt.limit) {
+				got = append(got, fmt.Sprintf("%d %s %v", s.Dish.ID, s.Reason, s.Score))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Complete() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package schedule 预约订单的用餐时段
+//
+// 时段的时间窗口、容量和截单时间都保存在 system_config 中，管理员可以随时修改；
+// 这里只负责解析配置和校验预约时间，容量的占用由 store 在下单事务中检查。
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 用餐时段
+const (
+	Breakfast = "breakfast"
+	Lunch     = "lunch"
+	Dinner    = "dinner"
+)
+
+// Slots 全部用餐时段，按一天中的先后顺序
+var Slots = []string{Breakfast, Lunch, Dinner}
+
+// 预约设置的配置项
+const (
+	KeyTimezone     = "schedule_timezone"       // 时段所在的时区，如 Asia/Shanghai
+	KeyMaxDaysAhead = "schedule_max_days_ahead" // 最多提前几天预约，0 表示不限
+)
+
+// WindowKey 时段的时间窗口，如 11:00-13:00
+func WindowKey(slot string) string { return "slot_" + slot + "_window" }
+
+// CapacityKey 时段每天最多接多少单，0 表示不限
+func CapacityKey(slot string) string { return "slot_" + slot + "_capacity" }
+
+// CutoffKey 时段开始前多久停止接单，如 2h
+func CutoffKey(slot string) string { return "slot_" + slot + "_cutoff" }
+
+// IsKey 判断配置项是否属于预约设置
+func IsKey(key string) bool {
+	return strings.HasPrefix(key, "schedule_") || strings.HasPrefix(key, "slot_")
+}
+
+// Slot 一个用餐时段的配置
+type Slot struct {
+	Name     string
+	Start    time.Duration // 距当天 0 点
+	End      time.Duration
+	Capacity int
+	Cutoff   time.Duration
+}
+
+// Config 预约设置
+type Config struct {
+	Location     *time.Location
+	MaxDaysAhead int
+	Slots        []Slot
+}
+
+// Load 从配置项解析预约设置，配置缺失或无效时返回错误
+func Load(values map[string]string) (*Config, error) {
+	location, err := time.LoadLocation(values[KeyTimezone])
+	if err != nil || values[KeyTimezone] == "" {
+		return nil, fmt.Errorf("invalid %s %q", KeyTimezone, values[KeyTimezone])
+	}
+	maxDays, err := strconv.Atoi(values[KeyMaxDaysAhead])
+	if err != nil || maxDays < 0 {
+		return nil, fmt.Errorf("invalid %s %q", KeyMaxDaysAhead, values[KeyMaxDaysAhead])
+	}
+
+	config := &Config{Location: location, MaxDaysAhead: maxDays}
+	for _, name := range Slots {
+		slot := Slot{Name: name}
+		slot.Start, slot.End, err = parseWindow(values[WindowKey(name)])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", WindowKey(name), values[WindowKey(name)], err)
+		}
+		slot.Capacity, err = strconv.Atoi(values[CapacityKey(name)])
+		if err != nil || slot.Capacity < 0 {
+			return nil, fmt.Errorf("invalid %s %q", CapacityKey(name), values[CapacityKey(name)])
+		}
+		slot.Cutoff, err = time.ParseDuration(values[CutoffKey(name)])
+		if err != nil || slot.Cutoff < 0 {
+			return nil, fmt.Errorf("invalid %s %q", CutoffKey(name), values[CutoffKey(name)])
+		}
+		// 时段不能重叠，否则无法按预约时间推断时段
+		if n := len(config.Slots); n > 0 && slot.Start < config.Slots[n-1].End {
+			return nil, fmt.Errorf("%s overlaps %s", WindowKey(name), WindowKey(config.Slots[n-1].Name))
+		}
+		config.Slots = append(config.Slots, slot)
+	}
+	return config, nil
+}
+
+// parseWindow 解析 HH:MM-HH:MM，结束时间最晚为 24:00
+func parseWindow(s string) (time.Duration, time.Duration, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected HH:MM-HH:MM")
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("end must be after start")
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	hour, minute, ok := strings.Cut(strings.TrimSpace(s), ":")
+	h, err1 := strconv.Atoi(hour)
+	m, err2 := strconv.Atoi(minute)
+	if !ok || err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Slot 按名称查找时段
+func (c *Config) Slot(name string) (Slot, bool) {
+	for _, slot := range c.Slots {
+		if slot.Name == name {
+			return slot, true
+		}
+	}
+	return Slot{}, false
+}
+
+// Date 返回 t 在预约时区中所在日期的 0 点
+func (c *Config) Date(t time.Time) time.Time {
+	local := t.In(c.Location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.Location)
+}
+
+// Window 返回时段在 date 这一天的开始时间、结束时间和截单时间
+func (c *Config) Window(slot Slot, date time.Time) (start, end, cutoff time.Time) {
+	day := c.Date(date)
+	start = day.Add(slot.Start)
+	return start, day.Add(slot.End), start.Add(-slot.Cutoff)
+}
+
+// Booking 校验通过的预约
+type Booking struct {
+	Slot         string
+	RequestedFor time.Time
+	Date         string // 预约时区中的日期，YYYY-MM-DD
+	Start        time.Time
+	End          time.Time
+	Capacity     int
+}
+
+// Error 预约时间不可用，Reason 是返回给用户的英文说明
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &Error{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Book 校验预约时间，slot 为空时按 requestedFor 所在的时段推断；
+// 预约时间必须在时段内、截单时间之前，且不超过最多提前预约的天数
+func (c *Config) Book(requestedFor time.Time, slot string, now time.Time) (*Booking, error) {
+	day := c.Date(requestedFor)
+	offset := requestedFor.Sub(day)
+
+	var chosen Slot
+	if slot != "" {
+		var ok bool
+		if chosen, ok = c.Slot(slot); !ok {
+			return nil, invalid("unknown meal slot %s", slot)
+		}
+		if offset < chosen.Start || offset >= chosen.End {
+			return nil, invalid("requested_for must be within %s (%s)", slot, formatWindow(chosen))
+		}
+	} else {
+		found := false
+		for _, s := range c.Slots {
+			if offset >= s.Start && offset < s.End {
+				chosen, found = s, true
+				break
+			}
+		}
+		if !found {
+			return nil, invalid("requested_for is not within any meal slot")
+		}
+	}
+
+	start, end, cutoff := c.Window(chosen, day)
+	date := day.Format("2006-01-02")
+	if !now.Before(cutoff) {
+		if !now.Before(requestedFor) {
+			return nil, invalid("requested_for is in the past")
+		}
+		return nil, invalid("orders for %s on %s closed at %s", chosen.Name, date, cutoff.In(c.Location).Format("2006-01-02 15:04"))
+	}
+	if c.MaxDaysAhead > 0 && day.After(c.Date(now).AddDate(0, 0, c.MaxDaysAhead)) {
+		return nil, invalid("orders can be scheduled at most %d days ahead", c.MaxDaysAhead)
+	}
+
+	return &Booking{
+		Slot:         chosen.Name,
+		RequestedFor: requestedFor.UTC(),
+		Date:         date,
+		Start:        start.UTC(),
+		End:          end.UTC(),
+		Capacity:     chosen.Capacity,
+	}, nil
+}
+
+func formatWindow(slot Slot) string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(slot.Start) + "-" + clock(slot.End)
+}
@@ -0,0 +1,145 @@
+package schedule
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// defaults 与迁移 0016 写入的预约设置一致
+func defaults() map[string]string {
+	return map[string]string{
+		KeyTimezone:            "Asia/Shanghai",
+		KeyMaxDaysAhead:        "7",
+		WindowKey(Breakfast):   "07:00-09:30",
+		CapacityKey(Breakfast): "20",
+		CutoffKey(Breakfast):   "10h",
+		WindowKey(Lunch):       "11:00-13:30",
+		CapacityKey(Lunch):     "30",
+		CutoffKey(Lunch):       "2h",
+		WindowKey(Dinner):      "17:30-20:00",
+		CapacityKey(Dinner):    "30",
+		CutoffKey(Dinner):      "3h",
+	}
+}
+
+func TestIsKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		KeyTimezone:            true,
+		CapacityKey(Dinner):    true,
+		"recommend_meat_count": false,
+		"site_name":            false,
+	} {
+		if got := IsKey(key); got != want {
+			t.Errorf("IsKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	config, err := Load(defaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lunch, ok := config.Slot(Lunch)
+	if config.Location.String() != "Asia/Shanghai" || config.MaxDaysAhead != 7 || len(config.Slots) != 3 || !ok ||
+		lunch.Start != 11*time.Hour || lunch.End != 13*time.Hour+30*time.Minute || lunch.Capacity != 30 || lunch.Cutoff != 2*time.Hour {
+		t.Errorf("Load() = %+v, lunch = %+v", config, lunch)
+	}
+	if _, ok := config.Slot("brunch"); ok {
+		t.Error("Slot(brunch) found")
+	}
+
+	tests := []struct {
+		key   string
+		value string
+		want  string
+	}{
+		{KeyTimezone, "", `invalid schedule_timezone ""`},
+		{KeyTimezone, "Mars/Base", `invalid schedule_timezone "Mars/Base"`},
+		{KeyMaxDaysAhead, "-1", `invalid schedule_max_days_ahead "-1"`},
+		{WindowKey(Lunch), "11:00", `invalid slot_lunch_window "11:00": expected HH:MM-HH:MM`},
+		{WindowKey(Lunch), "13:00-11:00", `invalid slot_lunch_window "13:00-11:00": end must be after start`},
+		{WindowKey(Lunch), "11:60-13:00", `invalid slot_lunch_window "11:60-13:00": invalid time "11:60"`},
+		{WindowKey(Dinner), "17:30-24:01", `invalid slot_dinner_window "17:30-24:01": invalid time "24:01"`},
+		{WindowKey(Dinner), "17:30-24:00", ""},
+		{WindowKey(Lunch), "09:00-13:00", "slot_lunch_window overlaps slot_breakfast_window"},
+		{CapacityKey(Lunch), "-1", `invalid slot_lunch_capacity "-1"`},
+		{CapacityKey(Lunch), "", `invalid slot_lunch_capacity ""`},
+		{CutoffKey(Lunch), "soon", `invalid slot_lunch_cutoff "soon"`},
+		{CutoffKey(Lunch), "-1h", `invalid slot_lunch_cutoff "-1h"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			values := defaults()
+			values[tt.key] = tt.value
+			_, err := Load(values)
+			if got := fmt.Sprint(err); tt.want == "" && err != nil || tt.want != "" && got != tt.want {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBook(t *testing.T) {
+	config, err := Load(defaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	shanghai := config.Location
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, 0, 0, shanghai)
+	}
+	now := at(1, 8, 0)
+
+	tests := []struct {
+		name         string
+		requestedFor time.Time
+		slot         string
+		now          time.Time
+		want         string // 时段和日期，或不可预约的原因
+	}{
+		{"slot inferred from time", at(1, 12, 0), "", now, "lunch 2024-05-01"},
+		{"slot given", at(1, 11, 0), Lunch, now, "lunch 2024-05-01"},
+		{"next morning before cutoff", at(2, 7, 30), "", now, "breakfast 2024-05-02"},
+		{"UTC time in the next local day", time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC), "", now, "breakfast 2024-05-02"},
+		{"last day allowed", at(8, 18, 0), Dinner, now, "dinner 2024-05-08"},
+		{"too far ahead", at(9, 18, 0), Dinner, now, "orders can be scheduled at most 7 days ahead"},
+		{"unknown slot", at(1, 12, 0), "brunch", now, "unknown meal slot brunch"},
+		{"time outside the given slot", at(1, 12, 0), Dinner, now, "requested_for must be within dinner (17:30-20:00)"},
+		{"end of window is exclusive", at(1, 13, 30), "", now, "requested_for is not within any meal slot"},
+		{"between slots", at(1, 15, 0), "", now, "requested_for is not within any meal slot"},
+		{"after cutoff", at(1, 12, 0), "", at(1, 9, 0), "orders for lunch on 2024-05-01 closed at 2024-05-01 09:00"},
+		{"in the past", at(1, 7, 30), "", now, "requested_for is in the past"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking, err := config.Book(tt.requestedFor, tt.slot, tt.now)
+			var got string
+			if err != nil {
+				invalid, ok := err.(*Error)
+				if !ok {
+					t.Fatalf("Book() error = %v, want *Error", err)
+				}
+				got = invalid.Reason
+			} else {
+				got = booking.Slot + " " + booking.Date
+				if !booking.RequestedFor.Equal(tt.requestedFor) || booking.RequestedFor.Location() != time.UTC {
+					t.Errorf("RequestedFor = %v, want %v in UTC", booking.RequestedFor, tt.requestedFor)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("Book() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	booking, err := config.Book(at(1, 12, 0), "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !booking.Start.Equal(at(1, 11, 0)) || !booking.End.Equal(at(1, 13, 30)) || booking.Capacity != 30 {
+		t.Errorf("booking = %+v, want 11:00-13:30 with capacity 30", booking)
+	}
+}
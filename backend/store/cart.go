@@ -0,0 +1,61 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/money"
+)
+
+// summarizeCart 按菜品当前数据计算明细价格、小计和提示，Postgres 和内存实现共用
+// items 的 Dish 为菜品当前数据
+func summarizeCart(items []models.CartItem, updatedAt *time.Time) *models.Cart {
+	cart := &models.Cart{
+		Items:     make([]models.CartItem, 0, len(items)),
+		Subtotal:  money.New(0),
+		Warnings:  []string{},
+		UpdatedAt: updatedAt,
+	}
+	for _, item := range items {
+		switch {
+		case item.Dish == nil || !item.Dish.IsActive:
+			name := fmt.Sprintf("%d", item.DishID)
+			if item.Dish != nil {
+				item.Price = item.Dish.Price
+				name = item.Dish.Name
+			}
+			item.Warning = fmt.Sprintf("Dish %s is no longer available", name)
+		default:
+			item.Available = true
+			item.Price = item.Dish.Price
+			item.LineTotal = item.Price.Mul(int64(item.Quantity))
+			cart.Subtotal = cart.Subtotal.Add(item.LineTotal)
+			if item.Price.Cmp(item.AddedPrice) != 0 {
+				item.Warning = fmt.Sprintf("Price of %s changed from %s to %s", item.Dish.Name, item.AddedPrice, item.Price)
+			}
+		}
+		if item.Warning != "" {
+			cart.Warnings = append(cart.Warnings, item.Warning)
+		}
+		cart.Items = append(cart.Items, item)
+	}
+	return cart
+}
+
+// checkoutRequest 把购物车明细和结算请求转换为下单请求，保留每项的备注
+func checkoutRequest(items []models.CartItem, checkout models.CheckoutRequest) models.CreateOrderRequest {
+	req := models.CreateOrderRequest{
+		CouponCode:   checkout.CouponCode,
+		RequestedFor: checkout.RequestedFor,
+		MealSlot:     checkout.MealSlot,
+	}
+	for _, item := range items {
+		req.Items = append(req.Items, models.CreateOrderItemRequest{
+			DishID:   item.DishID,
+			Quantity: item.Quantity,
+			Note:     item.Note,
+		})
+	}
+	return req
+}
@@ -0,0 +1,1029 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/promotion"
+	"food-ordering/related"
+	"food-ordering/schedule"
+)
+
+// Memory 进程内实现，语义与 Postgres 实现保持一致，用于处理器测试
+type Memory struct {
+	mu sync.Mutex
+
+	seq             map[string]int
+	users           map[int]*memoryUser
+	categories      map[int]models.Category
+	tags            map[int]models.Tag
+	dishes          map[int]models.Dish
+	dishTags        map[int][]string // 每道菜的标签 slug，按字母顺序
+	orders          map[int]models.Order
+	promotions      map[int]models.Promotion
+	carts           map[int]*memoryCart
+	payments        map[int]models.Payment
+	recommendations map[int]models.Recommendation
+	// 固定菜单的菜品 ID，按加入顺序
+	recommendationDishes map[int][]int
+	personal             map[int]models.PersonalRecommendations // 按用户保存的个性化推荐，Dishes 只保存菜品 ID、得分和原因
+	similarities         *related.Stats                         // 最近一次菜品相似度统计
+	events               map[string]bool                        // 已保存的支付回调事件，provider + "/" + event_id
+	history              []models.OrderStatusChange
+	favorites            []models.UserFavorite
+	favoritesChangedAt   map[int]time.Time // 每个用户最近一次取消收藏的时间
+	config               map[string]models.SystemConfig
+	loginStates          map[string]LoginState // 按 state 哈希保存的单点登录参数
+}
+
+type memoryUser struct {
+	user         models.User
+	passwordHash string
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		seq:                  make(map[string]int),
+		users:                make(map[int]*memoryUser),
+		categories:           make(map[int]models.Category),
+		tags:                 make(map[int]models.Tag),
+		dishes:               make(map[int]models.Dish),
+		dishTags:             make(map[int][]string),
+		orders:               make(map[int]models.Order),
+		promotions:           make(map[int]models.Promotion),
+		carts:                make(map[int]*memoryCart),
+		payments:             make(map[int]models.Payment),
+		recommendations:      make(map[int]models.Recommendation),
+		recommendationDishes: make(map[int][]int),
+		personal:             make(map[int]models.PersonalRecommendations),
+		favoritesChangedAt:   make(map[int]time.Time),
+		events:               make(map[string]bool),
+		config:               make(map[string]models.SystemConfig),
+		loginStates:          make(map[string]LoginState),
+	}
+}
+
+// Store 返回基于该内存数据的 Store
+func (m *Memory) Store() *Store {
+	return &Store{
+		Dishes:          memoryDishes{m},
+		Categories:      memoryCategories{m},
+		Tags:            memoryTags{m},
+		Orders:          memoryOrders{m},
+		Promotions:      memoryPromotions{m},
+		Carts:           memoryCarts{m},
+		Payments:        memoryPayments{m},
+		Recommendations: memoryRecommendations{m},
+		Personalization: memoryPersonalization{m},
+		Related:         memoryRelated{m},
+		Favorites:       memoryFavorites{m},
+		Config:          memoryConfig{m},
+		Users:           memoryUsers{m},
+		LoginStates:     memoryLoginStates{m},
+	}
+}
+
+// SeedUser 写入一个用户，未指定的 ID、状态和时间使用默认值
+func (m *Memory) SeedUser(user models.User, passwordHash string) models.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user.ID == 0 {
+		user.ID = m.nextID("users")
+	} else if user.ID > m.seq["users"] {
+		m.seq["users"] = user.ID
+	}
+	if user.Status == "" {
+		user.Status = "active"
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now()
+		user.UpdatedAt = user.CreatedAt
+	}
+	m.users[user.ID] = &memoryUser{user: user, passwordHash: passwordHash}
+	return user
+}
+
+// SeedConfig 写入一个配置项
+func (m *Memory) SeedConfig(key, value, description string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	config, ok := m.config[key]
+	if !ok {
+		config.ID = m.nextID("system_config")
+	}
+	config.ConfigKey = key
+	config.ConfigValue = value
+	config.Description = description
+	config.UpdatedAt = now()
+	m.config[key] = config
+}
+
+// SeedRecommendation 写入一个推荐配置，未指定的 ID、类型和时间使用默认值，Dishes 作为固定菜单的菜品
+func (m *Memory) SeedRecommendation(rec models.Recommendation) models.Recommendation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rec.ID == 0 {
+		rec.ID = m.nextID("recommendations")
+	} else if rec.ID > m.seq["recommendations"] {
+		m.seq["recommendations"] = rec.ID
+	}
+	if rec.Type == "" {
+		rec.Type = models.RecommendationTemplate
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now()
+		rec.UpdatedAt = rec.CreatedAt
+	}
+	m.recommendationDishes[rec.ID] = nil
+	for _, dish := range rec.Dishes {
+		m.recommendationDishes[rec.ID] = append(m.recommendationDishes[rec.ID], dish.ID)
+	}
+	rec.Dishes = nil
+	m.recommendations[rec.ID] = rec
+	return m.recommendationView(rec.ID)
+}
+
+func (m *Memory) nextID(table string) int {
+	m.seq[table]++
+	return m.seq[table]
+}
+
+// 与数据库的 TIMESTAMP 列一致，使用 UTC 并截断到微秒
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// page 按 limit/offset 截取，越界时返回 nil，与空结果集一致
+func page[T any](items []T, limit, offset int) []T {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return items
+}
+
+// dishView 补上分类和标签，调用方需持有锁
+func (m *Memory) dishView(dish models.Dish) models.Dish {
+	dish.Category = nil
+	if category, ok := m.categories[dish.CategoryID]; ok {
+		dish.Category = &models.Category{ID: category.ID, Name: category.Name}
+	}
+	dish.Tags = append([]string{}, m.dishTags[dish.ID]...)
+	return dish
+}
+
+// hasTags 判断菜品是否带有全部这些标签，调用方需持有锁
+func (m *Memory) hasTags(dishID int, tags []string) bool {
+	for _, tag := range tags {
+		if !containsString(m.dishTags[dishID], tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// setDishTags 用 slugs 替换菜品的全部标签，不存在的标签被忽略，调用方需持有锁
+func (m *Memory) setDishTags(dishID int, slugs []string) {
+	var tags []string
+	for _, tag := range m.tags {
+		if containsString(slugs, tag.Slug) {
+			tags = append(tags, tag.Slug)
+		}
+	}
+	sort.Strings(tags)
+	m.dishTags[dishID] = tags
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryDishes struct{ m *Memory }
+
+func (s memoryDishes) List(ctx context.Context, filter DishFilter) ([]models.Dish, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	search := strings.ToLower(filter.Search)
+	var dishes []models.Dish
+	for _, dish := range s.m.dishes {
+		if !dish.IsActive {
+			continue
+		}
+		if filter.CategoryID > 0 && dish.CategoryID != filter.CategoryID {
+			continue
+		}
+		if filter.SeasonalOnly && !dish.IsSeasonal {
+			continue
+		}
+		if !s.m.hasTags(dish.ID, filter.Tags) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(dish.Name), search) &&
+			!strings.Contains(strings.ToLower(dish.Description), search) {
+			continue
+		}
+		dishes = append(dishes, s.m.dishView(dish))
+	}
+
+	sort.Slice(dishes, func(i, j int) bool {
+		if !dishes[i].CreatedAt.Equal(dishes[j].CreatedAt) {
+			return dishes[i].CreatedAt.After(dishes[j].CreatedAt)
+		}
+		return dishes[i].ID > dishes[j].ID
+	})
+	return page(dishes, filter.Limit, filter.Offset), len(dishes), nil
+}
+
+func (s memoryDishes) Get(ctx context.Context, id int) (*models.Dish, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	dish, ok := s.m.dishes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	dish = s.m.dishView(dish)
+	return &dish, nil
+}
+
+func (s memoryDishes) Create(ctx context.Context, req models.CreateDishRequest) (*models.Dish, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	createdAt := now()
+	dish := models.Dish{
+		ID:           s.m.nextID("dishes"),
+		Name:         req.Name,
+		Description:  req.Description,
+		CategoryID:   req.CategoryID,
+		Price:        req.Price,
+		ImageURL:     req.ImageURL,
+		VideoURL:     req.VideoURL,
+		CookingSteps: req.CookingSteps,
+		IsSeasonal:   req.IsSeasonal,
+		IsActive:     true,
+		CreatedAt:    createdAt,
+		UpdatedAt:    createdAt,
+	}
+	s.m.dishes[dish.ID] = dish
+	s.m.setDishTags(dish.ID, req.Tags)
+	dish = s.m.dishView(dish)
+	return &dish, nil
+}
+
+func (s memoryDishes) Update(ctx context.Context, id int, req models.UpdateDishRequest) (*models.Dish, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	dish, ok := s.m.dishes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if req.Name != nil {
+		dish.Name = *req.Name
+	}
+	if req.Description != nil {
+		dish.Description = *req.Description
+	}
+	if req.CategoryID != nil {
+		dish.CategoryID = *req.CategoryID
+	}
+	if req.Price != nil {
+		dish.Price = *req.Price
+	}
+	if req.ImageURL != nil {
+		dish.ImageURL = *req.ImageURL
+	}
+	if req.VideoURL != nil {
+		dish.VideoURL = *req.VideoURL
+	}
+	if req.CookingSteps != nil {
+		dish.CookingSteps = *req.CookingSteps
+	}
+	if req.IsSeasonal != nil {
+		dish.IsSeasonal = *req.IsSeasonal
+	}
+	if req.IsActive != nil {
+		dish.IsActive = *req.IsActive
+	}
+	if req.Tags != nil {
+		s.m.setDishTags(id, *req.Tags)
+	}
+	dish.UpdatedAt = now()
+
+	s.m.dishes[id] = dish
+	dish = s.m.dishView(dish)
+	return &dish, nil
+}
+
+func (s memoryDishes) Deactivate(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	dish, ok := s.m.dishes[id]
+	if !ok {
+		return ErrNotFound
+	}
+	dish.IsActive = false
+	dish.UpdatedAt = now()
+	s.m.dishes[id] = dish
+	return nil
+}
+
+func (s memoryDishes) InCategories(ctx context.Context, categoryIDs []int) ([]models.Dish, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var dishes []models.Dish
+	for _, dish := range s.m.dishes {
+		if !dish.IsActive {
+			continue
+		}
+		for _, id := range categoryIDs {
+			if dish.CategoryID == id {
+				dishes = append(dishes, s.m.dishView(dish))
+				break
+			}
+		}
+	}
+	sort.Slice(dishes, func(i, j int) bool { return dishes[i].ID < dishes[j].ID })
+	return dishes, nil
+}
+
+func (s memoryDishes) WithAnyTag(ctx context.Context, tags []string) ([]models.Dish, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var dishes []models.Dish
+	for _, dish := range s.m.dishes {
+		if !dish.IsActive {
+			continue
+		}
+		for _, tag := range tags {
+			if containsString(s.m.dishTags[dish.ID], tag) {
+				dishes = append(dishes, s.m.dishView(dish))
+				break
+			}
+		}
+	}
+	sort.Slice(dishes, func(i, j int) bool { return dishes[i].ID < dishes[j].ID })
+	return dishes, nil
+}
+
+type memoryCategories struct{ m *Memory }
+
+func (s memoryCategories) List(ctx context.Context) ([]models.Category, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var categories []models.Category
+	for _, category := range s.m.categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Name != categories[j].Name {
+			return categories[i].Name < categories[j].Name
+		}
+		return categories[i].ID < categories[j].ID
+	})
+	return categories, nil
+}
+
+func (s memoryCategories) Get(ctx context.Context, id int) (*models.Category, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	category, ok := s.m.categories[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &category, nil
+}
+
+func (s memoryCategories) Exists(ctx context.Context, id int) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	_, ok := s.m.categories[id]
+	return ok, nil
+}
+
+func (s memoryCategories) Create(ctx context.Context, req models.CreateCategoryRequest) (*models.Category, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	category := models.Category{
+		ID:          s.m.nextID("categories"),
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedAt:   now(),
+	}
+	s.m.categories[category.ID] = category
+	return &category, nil
+}
+
+func (s memoryCategories) Update(ctx context.Context, id int, req models.UpdateCategoryRequest) (*models.Category, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	category, ok := s.m.categories[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if req.Name != nil {
+		category.Name = *req.Name
+	}
+	if req.Description != nil {
+		category.Description = *req.Description
+	}
+	s.m.categories[id] = category
+	return &category, nil
+}
+
+func (s memoryCategories) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, dish := range s.m.dishes {
+		if dish.CategoryID == id && dish.IsActive {
+			return ErrInUse
+		}
+	}
+	if _, ok := s.m.categories[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.categories, id)
+	return nil
+}
+
+type memoryTags struct{ m *Memory }
+
+func (s memoryTags) List(ctx context.Context) ([]models.Tag, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var tags []models.Tag
+	for _, tag := range s.m.tags {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Slug < tags[j].Slug })
+	return tags, nil
+}
+
+func (s memoryTags) Get(ctx context.Context, id int) (*models.Tag, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	tag, ok := s.m.tags[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &tag, nil
+}
+
+func (s memoryTags) Create(ctx context.Context, req models.CreateTagRequest) (*models.Tag, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, tag := range s.m.tags {
+		if tag.Slug == req.Slug {
+			return nil, ErrConflict
+		}
+	}
+	tag := models.Tag{
+		ID:          s.m.nextID("tags"),
+		Slug:        req.Slug,
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedAt:   now(),
+	}
+	s.m.tags[tag.ID] = tag
+	return &tag, nil
+}
+
+func (s memoryTags) Update(ctx context.Context, id int, req models.UpdateTagRequest) (*models.Tag, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	tag, ok := s.m.tags[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if req.Name != nil {
+		tag.Name = *req.Name
+	}
+	if req.Description != nil {
+		tag.Description = *req.Description
+	}
+	s.m.tags[id] = tag
+	return &tag, nil
+}
+
+func (s memoryTags) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	tag, ok := s.m.tags[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.m.tags, id)
+	for dishID, tags := range s.m.dishTags {
+		var kept []string
+		for _, slug := range tags {
+			if slug != tag.Slug {
+				kept = append(kept, slug)
+			}
+		}
+		s.m.dishTags[dishID] = kept
+	}
+	return nil
+}
+
+func (s memoryTags) Missing(ctx context.Context, slugs []string) ([]string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var missing []string
+	for _, slug := range slugs {
+		found := false
+		for _, tag := range s.m.tags {
+			if tag.Slug == slug {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, slug)
+		}
+	}
+	return missing, nil
+}
+
+type memoryOrders struct{ m *Memory }
+
+func (s memoryOrders) Create(ctx context.Context, userID int, req models.CreateOrderRequest) (*models.Order, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	order, err := s.m.createOrder(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	return s.m.orderView(order), nil
+}
+
+// createOrder 校验菜品、计算优惠并保存订单，下单和购物车结算共用，调用方需持有锁
+func (m *Memory) createOrder(userID int, req models.CreateOrderRequest) (models.Order, error) {
+	// 先校验全部菜品和优惠券，失败时不占用订单号
+	lines := make([]promotion.Line, len(req.Items))
+	for i, item := range req.Items {
+		if item.Quantity < 1 {
+			return models.Order{}, &InvalidQuantityError{DishID: item.DishID, Quantity: item.Quantity}
+		}
+		dish, ok := m.dishes[item.DishID]
+		if !ok || !dish.IsActive {
+			return models.Order{}, &DishUnavailableError{DishID: item.DishID}
+		}
+		lines[i] = promotion.Line{DishID: dish.ID, CategoryID: dish.CategoryID, Quantity: item.Quantity, Price: dish.Price}
+	}
+
+	createdAt := now()
+	booking, err := m.reserveSlot(req, createdAt)
+	if err != nil {
+		return models.Order{}, err
+	}
+	automatic, coupon, err := m.applicablePromotions(userID, req.CouponCode, createdAt)
+	if err != nil {
+		return models.Order{}, err
+	}
+	adjustments, err := priceOrder(automatic, coupon, lines, createdAt)
+	if err != nil {
+		return models.Order{}, err
+	}
+	subtotal := promotion.Subtotal(lines)
+	total := promotion.Total(subtotal, adjustments)
+
+	order := models.Order{
+		ID:             m.nextID("orders"),
+		UserID:         userID,
+		Subtotal:       subtotal,
+		DiscountAmount: subtotal.Sub(total),
+		TotalAmount:    total,
+		Status:         "pending",
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+	}
+	if booking != nil {
+		order.RequestedFor = &booking.RequestedFor
+		order.MealSlot = booking.Slot
+	}
+	for i, line := range lines {
+		order.Items = append(order.Items, models.OrderItem{
+			ID:        m.nextID("order_items"),
+			OrderID:   order.ID,
+			DishID:    line.DishID,
+			Quantity:  line.Quantity,
+			Price:     line.Price,
+			Note:      req.Items[i].Note,
+			CreatedAt: createdAt,
+		})
+	}
+	for _, adjustment := range adjustments {
+		adjustment.ID = m.nextID("order_adjustments")
+		adjustment.OrderID = order.ID
+		adjustment.CreatedAt = createdAt
+		order.Adjustments = append(order.Adjustments, adjustment)
+	}
+
+	m.orders[order.ID] = order
+	m.recordStatus(order.ID, "", order.Status, userID, "", createdAt)
+	return order, nil
+}
+
+// reserveSlot 校验预约时间并检查时段容量，未预约时返回 nil，调用方需持有锁
+func (m *Memory) reserveSlot(req models.CreateOrderRequest, at time.Time) (*schedule.Booking, error) {
+	if req.RequestedFor == nil && req.MealSlot == "" {
+		return nil, nil
+	}
+
+	values := make(map[string]string, len(m.config))
+	for key, config := range m.config {
+		values[key] = config.ConfigValue
+	}
+	booking, err := bookSlot(values, req, at)
+	if err != nil || booking.Capacity == 0 {
+		return booking, err
+	}
+
+	booked := 0
+	for _, order := range m.orders {
+		if order.MealSlot == booking.Slot && order.Status != models.OrderStatusCancelled &&
+			!order.RequestedFor.Before(booking.Start) && order.RequestedFor.Before(booking.End) {
+			booked++
+		}
+	}
+	if booked >= booking.Capacity {
+		return nil, &SlotFullError{Slot: booking.Slot, Date: booking.Date}
+	}
+	return booking, nil
+}
+
+func (s memoryOrders) Get(ctx context.Context, id int) (*models.Order, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	order, ok := s.m.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.m.orderView(order), nil
+}
+
+func (s memoryOrders) List(ctx context.Context, filter OrderFilter) ([]models.Order, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var orders []models.Order
+	for _, order := range s.m.orders {
+		if filter.UserID > 0 && order.UserID != filter.UserID {
+			continue
+		}
+		if filter.Status != "" && order.Status != filter.Status {
+			continue
+		}
+		if filter.From != nil && order.CreatedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && !order.CreatedAt.Before(*filter.To) {
+			continue
+		}
+		if filter.DishID > 0 && !containsDish(order, filter.DishID) {
+			continue
+		}
+		orders = append(orders, *s.m.orderView(order))
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		a, b := orders[i], orders[j]
+		if filter.Asc {
+			a, b = b, a
+		}
+		switch filter.Sort {
+		case OrderSortTotalAmount:
+			if cmp := a.TotalAmount.Cmp(b.TotalAmount); cmp != 0 {
+				return cmp > 0
+			}
+		case OrderSortStatus:
+			if a.Status != b.Status {
+				return a.Status > b.Status
+			}
+		default:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.After(b.CreatedAt)
+			}
+		}
+		return a.ID > b.ID
+	})
+	return page(orders, filter.Limit, filter.Offset), len(orders), nil
+}
+
+func (s memoryOrders) Scheduled(ctx context.Context, from, to time.Time) ([]models.Order, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var orders []models.Order
+	for _, order := range s.m.orders {
+		if order.RequestedFor == nil || order.Status == models.OrderStatusCancelled ||
+			order.RequestedFor.Before(from) || !order.RequestedFor.Before(to) {
+			continue
+		}
+		orders = append(orders, *s.m.orderView(order))
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].RequestedFor.Equal(*orders[j].RequestedFor) {
+			return orders[i].RequestedFor.Before(*orders[j].RequestedFor)
+		}
+		return orders[i].ID < orders[j].ID
+	})
+	return orders, nil
+}
+
+func containsDish(order models.Order, dishID int) bool {
+	for _, item := range order.Items {
+		if item.DishID == dishID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s memoryOrders) ChangeStatus(ctx context.Context, change StatusChange) (*models.Order, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	order, ok := s.m.orders[change.OrderID]
+	if !ok || (change.OwnerID != 0 && order.UserID != change.OwnerID) {
+		return nil, ErrNotFound
+	}
+	if err := CheckTransition(order.Status, change); err != nil {
+		return nil, err
+	}
+
+	from := order.Status
+	order.Status = change.To
+	order.UpdatedAt = now()
+	s.m.orders[order.ID] = order
+	s.m.recordStatus(order.ID, from, change.To, change.ChangedBy, change.Note, order.UpdatedAt)
+	return s.m.orderView(order), nil
+}
+
+func (s memoryOrders) History(ctx context.Context, orderID int) ([]models.OrderStatusChange, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.orders[orderID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	history := []models.OrderStatusChange{}
+	for _, change := range s.m.history {
+		if change.OrderID != orderID {
+			continue
+		}
+		if change.ChangedBy != nil {
+			if u, ok := s.m.users[*change.ChangedBy]; ok {
+				change.ChangedByUsername = u.user.Username
+			}
+		}
+		history = append(history, change)
+	}
+	return history, nil
+}
+
+// recordStatus 追加一条状态变更记录，调用方需持有锁
+func (m *Memory) recordStatus(orderID int, from, to string, changedBy int, note string, at time.Time) {
+	change := models.OrderStatusChange{
+		ID:        m.nextID("order_status_history"),
+		OrderID:   orderID,
+		ToStatus:  to,
+		Note:      note,
+		CreatedAt: at,
+	}
+	if from != "" {
+		change.FromStatus = &from
+	}
+	if changedBy != 0 {
+		change.ChangedBy = &changedBy
+	}
+	m.history = append(m.history, change)
+}
+
+// orderView 复制订单，附带下单用户名以及明细的菜品信息，调用方需持有锁
+func (m *Memory) orderView(order models.Order) *models.Order {
+	order.Username = ""
+	if u, ok := m.users[order.UserID]; ok {
+		order.Username = u.user.Username
+	}
+
+	items := make([]models.OrderItem, len(order.Items))
+	for i, item := range order.Items {
+		if dish, ok := m.dishes[item.DishID]; ok {
+			dish = m.dishView(dish)
+			item.Dish = &models.Dish{
+				ID:         dish.ID,
+				Name:       dish.Name,
+				ImageURL:   dish.ImageURL,
+				Price:      dish.Price,
+				CategoryID: dish.CategoryID,
+				Category:   dish.Category,
+				IsSeasonal: dish.IsSeasonal,
+				IsActive:   dish.IsActive,
+			}
+		}
+		items[i] = item
+	}
+	order.Items = items
+
+	order.PaymentStatus = ""
+	if payment := m.latestPayment(order.ID); payment != nil {
+		order.PaymentStatus = payment.Status
+	}
+	return &order
+}
+
+type memoryFavorites struct{ m *Memory }
+
+func (s memoryFavorites) Add(ctx context.Context, userID, dishID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if dish, ok := s.m.dishes[dishID]; !ok || !dish.IsActive {
+		return ErrNotFound
+	}
+	for _, fav := range s.m.favorites {
+		if fav.UserID == userID && fav.DishID == dishID {
+			return ErrConflict
+		}
+	}
+	s.m.favorites = append(s.m.favorites, models.UserFavorite{
+		ID:        s.m.nextID("user_favorites"),
+		UserID:    userID,
+		DishID:    dishID,
+		CreatedAt: now(),
+	})
+	return nil
+}
+
+func (s memoryFavorites) Remove(ctx context.Context, userID, dishID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for i, fav := range s.m.favorites {
+		if fav.UserID == userID && fav.DishID == dishID {
+			s.m.favorites = append(s.m.favorites[:i], s.m.favorites[i+1:]...)
+			s.m.favoritesChangedAt[userID] = now()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s memoryFavorites) List(ctx context.Context, userID, limit, offset int) ([]models.UserFavorite, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var favorites []models.UserFavorite
+	for _, fav := range s.m.favorites {
+		dish, ok := s.m.dishes[fav.DishID]
+		if fav.UserID != userID || !ok || !dish.IsActive {
+			continue
+		}
+		dish = s.m.dishView(dish)
+		fav.Dish = &dish
+		favorites = append(favorites, fav)
+	}
+	sort.Slice(favorites, func(i, j int) bool {
+		if !favorites[i].CreatedAt.Equal(favorites[j].CreatedAt) {
+			return favorites[i].CreatedAt.After(favorites[j].CreatedAt)
+		}
+		return favorites[i].ID > favorites[j].ID
+	})
+	return page(favorites, limit, offset), len(favorites), nil
+}
+
+type memoryConfig struct{ m *Memory }
+
+func (s memoryConfig) List(ctx context.Context) ([]models.SystemConfig, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var configs []models.SystemConfig
+	for _, config := range s.m.config {
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].ConfigKey < configs[j].ConfigKey
+	})
+	return configs, nil
+}
+
+func (s memoryConfig) Get(ctx context.Context, key string) (string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	config, ok := s.m.config[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return config.ConfigValue, nil
+}
+
+func (s memoryConfig) Update(ctx context.Context, values map[string]string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	updatedAt := now()
+	for key, value := range values {
+		config, ok := s.m.config[key]
+		if !ok {
+			continue
+		}
+		config.ConfigValue = value
+		config.UpdatedAt = updatedAt
+		s.m.config[key] = config
+	}
+	return nil
+}
+
+type memoryUsers struct{ m *Memory }
+
+func (s memoryUsers) Get(ctx context.Context, id int) (*models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := u.user
+	return &user, nil
+}
+
+func (s memoryUsers) GetByUsername(ctx context.Context, username string) (*models.User, string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, u := range s.m.users {
+		if u.user.Username == username {
+			user := u.user
+			return &user, u.passwordHash, nil
+		}
+	}
+	return nil, "", ErrNotFound
+}
+
+func (s memoryUsers) List(ctx context.Context, search string, limit, offset int) ([]models.User, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	search = strings.ToLower(search)
+	var users []models.User
+	for _, u := range s.m.users {
+		if search != "" && !strings.Contains(strings.ToLower(u.user.Username), search) &&
+			!strings.Contains(strings.ToLower(u.user.Email), search) {
+			continue
+		}
+		users = append(users, u.user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.After(users[j].CreatedAt)
+		}
+		return users[i].ID > users[j].ID
+	})
+	return page(users, limit, offset), len(users), nil
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"food-ordering/models"
+)
+
+type memoryCart struct {
+	items     []models.CartItem // 按加入顺序，不含 Dish
+	updatedAt time.Time
+}
+
+type memoryCarts struct{ m *Memory }
+
+func (s memoryCarts) Get(ctx context.Context, userID int) (*models.Cart, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.cartView(userID), nil
+}
+
+func (s memoryCarts) AddItem(ctx context.Context, userID int, req models.AddCartItemRequest) (*models.Cart, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	dish, ok := s.m.dishes[req.DishID]
+	if !ok || !dish.IsActive {
+		return nil, ErrNotFound
+	}
+
+	at := now()
+	cart := s.m.touchCart(userID, at)
+	for i := range cart.items {
+		item := &cart.items[i]
+		if item.DishID != req.DishID {
+			continue
+		}
+		item.Quantity = min(item.Quantity+req.Quantity, models.MaxCartItemQuantity)
+		if req.Note != "" {
+			item.Note = req.Note
+		}
+		item.AddedPrice = dish.Price
+		item.UpdatedAt = at
+		return s.m.cartView(userID), nil
+	}
+	cart.items = append(cart.items, models.CartItem{
+		DishID:     req.DishID,
+		Quantity:   min(req.Quantity, models.MaxCartItemQuantity),
+		Note:       req.Note,
+		AddedPrice: dish.Price,
+		CreatedAt:  at,
+		UpdatedAt:  at,
+	})
+	return s.m.cartView(userID), nil
+}
+
+func (s memoryCarts) UpdateItem(ctx context.Context, userID, dishID int, req models.UpdateCartItemRequest) (*models.Cart, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	cart, ok := s.m.carts[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	for i := range cart.items {
+		item := &cart.items[i]
+		if item.DishID != dishID {
+			continue
+		}
+		if req.Quantity != nil {
+			item.Quantity = *req.Quantity
+		}
+		if req.Note != nil {
+			item.Note = *req.Note
+		}
+		item.AddedPrice = s.m.dishes[dishID].Price
+		item.UpdatedAt = now()
+		cart.updatedAt = item.UpdatedAt
+		return s.m.cartView(userID), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s memoryCarts) RemoveItem(ctx context.Context, userID, dishID int) (*models.Cart, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	cart, ok := s.m.carts[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	for i, item := range cart.items {
+		if item.DishID == dishID {
+			cart.items = append(cart.items[:i], cart.items[i+1:]...)
+			cart.updatedAt = now()
+			return s.m.cartView(userID), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s memoryCarts) Clear(ctx context.Context, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.carts, userID)
+	return nil
+}
+
+func (s memoryCarts) Checkout(ctx context.Context, userID int, req models.CheckoutRequest) (*models.Order, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	cart, ok := s.m.carts[userID]
+	if !ok || len(cart.items) == 0 {
+		return nil, ErrCartEmpty
+	}
+	order, err := s.m.createOrder(userID, checkoutRequest(cart.items, req))
+	if err != nil {
+		return nil, err
+	}
+	delete(s.m.carts, userID)
+	return s.m.orderView(order), nil
+}
+
+func (s memoryCarts) ExpireBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	n := 0
+	for userID, cart := range s.m.carts {
+		if cart.updatedAt.Before(cutoff) {
+			delete(s.m.carts, userID)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// touchCart 创建购物车或更新其最后修改时间，调用方需持有锁
+func (m *Memory) touchCart(userID int, at time.Time) *memoryCart {
+	cart, ok := m.carts[userID]
+	if !ok {
+		cart = &memoryCart{}
+		m.carts[userID] = cart
+	}
+	cart.updatedAt = at
+	return cart
+}
+
+// cartView 附加菜品当前数据并计算小计和提示，调用方需持有锁
+func (m *Memory) cartView(userID int) *models.Cart {
+	cart, ok := m.carts[userID]
+	if !ok {
+		return summarizeCart(nil, nil)
+	}
+	items := make([]models.CartItem, len(cart.items))
+	for i, item := range cart.items {
+		if dish, ok := m.dishes[item.DishID]; ok {
+			dish = m.dishView(dish)
+			item.Dish = &dish
+		}
+		items[i] = item
+	}
+	updatedAt := cart.updatedAt
+	return summarizeCart(items, &updatedAt)
+}
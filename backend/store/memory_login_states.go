@@ -0,0 +1,34 @@
+package store
+
+import "context"
+
+type memoryLoginStates struct{ m *Memory }
+
+func (s memoryLoginStates) Save(ctx context.Context, stateHash string, state LoginState) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	current := now()
+	for hash, existing := range s.m.loginStates {
+		if existing.ExpiresAt.Before(current) {
+			delete(s.m.loginStates, hash)
+		}
+	}
+	if _, ok := s.m.loginStates[stateHash]; ok {
+		return ErrConflict
+	}
+	s.m.loginStates[stateHash] = state
+	return nil
+}
+
+func (s memoryLoginStates) Take(ctx context.Context, stateHash string) (*LoginState, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	state, ok := s.m.loginStates[stateHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(s.m.loginStates, stateHash)
+	return &state, nil
+}
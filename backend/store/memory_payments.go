@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+
+	"food-ordering/models"
+	"food-ordering/money"
+)
+
+type memoryPayments struct{ m *Memory }
+
+func (s memoryPayments) Create(ctx context.Context, payment models.Payment) (*models.Payment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.orders[payment.OrderID]; !ok {
+		return nil, ErrNotFound
+	}
+	for _, existing := range s.m.payments {
+		if existing.Provider == payment.Provider && existing.IntentID == payment.IntentID {
+			return nil, ErrConflict
+		}
+		// 与 Postgres 的部分唯一索引一致：每个订单最多一笔未失败、未撤销的支付
+		if existing.OrderID == payment.OrderID &&
+			existing.Status != models.PaymentStatusFailed && existing.Status != models.PaymentStatusCancelled {
+			return nil, ErrConflict
+		}
+	}
+
+	payment.ID = s.m.nextID("payments")
+	payment.Status = models.PaymentStatusPending
+	payment.RefundedAmount = money.New(0)
+	payment.CreatedAt = now()
+	payment.UpdatedAt = payment.CreatedAt
+	payment.Refunds = nil
+	s.m.payments[payment.ID] = payment
+	return s.m.paymentView(payment.ID), nil
+}
+
+func (s memoryPayments) Latest(ctx context.Context, orderID int) (*models.Payment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	payment := s.m.latestPayment(orderID)
+	if payment == nil {
+		return nil, ErrNotFound
+	}
+	return s.m.paymentView(payment.ID), nil
+}
+
+func (s memoryPayments) GetByIntent(ctx context.Context, provider, intentID string) (*models.Payment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for id, payment := range s.m.payments {
+		if payment.Provider == provider && payment.IntentID == intentID {
+			return s.m.paymentView(id), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s memoryPayments) Transition(ctx context.Context, id int, to string) (*models.Payment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	payment, ok := s.m.payments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !models.CanTransitionPayment(payment.Status, to) {
+		return nil, &PaymentTransitionError{From: payment.Status, To: to}
+	}
+	payment.Status = to
+	payment.UpdatedAt = now()
+	s.m.payments[id] = payment
+	return s.m.paymentView(id), nil
+}
+
+func (s memoryPayments) Refund(ctx context.Context, id int, refund models.PaymentRefund) (*models.Payment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	payment, ok := s.m.payments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	to, err := refundStatus(payment, refund)
+	if err != nil {
+		return nil, err
+	}
+
+	refund.ID = s.m.nextID("payment_refunds")
+	refund.PaymentID = id
+	refund.CreatedAt = now()
+	payment.Status = to
+	payment.RefundedAmount = payment.RefundedAmount.Add(refund.Amount)
+	payment.UpdatedAt = refund.CreatedAt
+	payment.Refunds = append(append([]models.PaymentRefund{}, payment.Refunds...), refund)
+	s.m.payments[id] = payment
+	return s.m.paymentView(id), nil
+}
+
+func (s memoryPayments) RecordEvent(ctx context.Context, event models.PaymentEvent) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	key := event.Provider + "/" + event.EventID
+	if s.m.events[key] {
+		return ErrConflict
+	}
+	s.m.events[key] = true
+	return nil
+}
+
+// latestPayment 返回订单最近一次支付，调用方需持有锁
+func (m *Memory) latestPayment(orderID int) *models.Payment {
+	var latest *models.Payment
+	for _, payment := range m.payments {
+		if payment.OrderID == orderID && (latest == nil || payment.ID > latest.ID) {
+			payment := payment
+			latest = &payment
+		}
+	}
+	return latest
+}
+
+// paymentView 复制支付记录，调用方需持有锁
+func (m *Memory) paymentView(id int) *models.Payment {
+	payment := m.payments[id]
+	payment.Refunds = append([]models.PaymentRefund(nil), payment.Refunds...)
+	return &payment
+}
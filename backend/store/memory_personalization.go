@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/personalize"
+)
+
+type memoryPersonalization struct{ m *Memory }
+
+func (s memoryPersonalization) StaleUsers(ctx context.Context, refreshBefore time.Time, limit int) ([]int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	// 与 Postgres 实现一致：从未计算过的用户在前，其余按上次计算时间
+	type staleUser struct {
+		id         int
+		computedAt time.Time
+	}
+	var stale []staleUser
+	for id := range s.m.users {
+		var computedAt time.Time
+		if personal, ok := s.m.personal[id]; ok {
+			computedAt = *personal.ComputedAt
+		}
+		if s.m.personalStale(id, computedAt, refreshBefore) {
+			stale = append(stale, staleUser{id, computedAt})
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		if !stale[i].computedAt.Equal(stale[j].computedAt) {
+			return stale[i].computedAt.Before(stale[j].computedAt)
+		}
+		return stale[i].id < stale[j].id
+	})
+
+	var ids []int
+	for _, user := range stale {
+		if len(ids) == limit {
+			break
+		}
+		ids = append(ids, user.id)
+	}
+	return ids, nil
+}
+
+// personalStale computedAt 为零值表示从未计算过，调用方需持有锁
+func (m *Memory) personalStale(userID int, computedAt, refreshBefore time.Time) bool {
+	if !computedAt.IsZero() && (computedAt.Before(refreshBefore) || m.favoritesChangedAt[userID].After(computedAt)) {
+		return true
+	}
+	for _, order := range m.orders {
+		if order.UserID == userID && (computedAt.IsZero() || order.UpdatedAt.After(computedAt)) {
+			return true
+		}
+	}
+	for _, fav := range m.favorites {
+		if fav.UserID == userID && (computedAt.IsZero() || fav.CreatedAt.After(computedAt)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s memoryPersonalization) History(ctx context.Context, userID int) (*personalize.History, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var orders []models.Order
+	for _, order := range s.m.orders {
+		if order.UserID == userID && order.Status != models.OrderStatusCancelled {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+
+	history := &personalize.History{}
+	for _, order := range orders {
+		eatenAt := order.CreatedAt
+		if order.RequestedFor != nil {
+			eatenAt = *order.RequestedFor
+		}
+		for _, item := range order.Items {
+			history.Purchases = append(history.Purchases, personalize.Purchase{
+				DishID:     item.DishID,
+				CategoryID: s.m.dishes[item.DishID].CategoryID,
+				Quantity:   item.Quantity,
+				EatenAt:    eatenAt,
+			})
+		}
+	}
+	for _, fav := range s.m.favorites {
+		if fav.UserID == userID {
+			history.Favorites = append(history.Favorites, personalize.Favorite{
+				DishID:     fav.DishID,
+				CategoryID: s.m.dishes[fav.DishID].CategoryID,
+			})
+		}
+	}
+	return history, nil
+}
+
+func (s memoryPersonalization) Save(ctx context.Context, userID int, dishes []models.PersonalDish, computedAt time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	saved := make([]models.PersonalDish, len(dishes))
+	for i, dish := range dishes {
+		saved[i] = models.PersonalDish{
+			Dish:    models.Dish{ID: dish.Dish.ID},
+			Score:   dish.Score,
+			Reasons: append([]string{}, dish.Reasons...),
+		}
+	}
+	s.m.personal[userID] = models.PersonalRecommendations{Dishes: saved, ComputedAt: &computedAt}
+	return nil
+}
+
+func (s memoryPersonalization) Get(ctx context.Context, userID, limit int) (*models.PersonalRecommendations, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	result := &models.PersonalRecommendations{Dishes: []models.PersonalDish{}}
+	personal, ok := s.m.personal[userID]
+	if !ok {
+		return result, nil
+	}
+	computedAt := *personal.ComputedAt
+	result.ComputedAt = &computedAt
+
+	// 保存时已按得分排序
+	for _, saved := range personal.Dishes {
+		if len(result.Dishes) == limit {
+			break
+		}
+		dish, ok := s.m.dishes[saved.Dish.ID]
+		if !ok || !dish.IsActive {
+			continue
+		}
+		result.Dishes = append(result.Dishes, models.PersonalDish{
+			Dish:    s.m.dishView(dish),
+			Score:   saved.Score,
+			Reasons: append([]string{}, saved.Reasons...),
+		})
+	}
+	return result, nil
+}
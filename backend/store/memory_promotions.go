@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/promotion"
+)
+
+type memoryPromotions struct{ m *Memory }
+
+func (s memoryPromotions) List(ctx context.Context, limit, offset int) ([]models.Promotion, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var promotions []models.Promotion
+	for _, p := range s.m.promotions {
+		promotions = append(promotions, p)
+	}
+	sort.Slice(promotions, func(i, j int) bool {
+		if !promotions[i].CreatedAt.Equal(promotions[j].CreatedAt) {
+			return promotions[i].CreatedAt.After(promotions[j].CreatedAt)
+		}
+		return promotions[i].ID > promotions[j].ID
+	})
+	return page(promotions, limit, offset), len(promotions), nil
+}
+
+func (s memoryPromotions) Get(ctx context.Context, id int) (*models.Promotion, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.promotions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &p, nil
+}
+
+func (s memoryPromotions) Create(ctx context.Context, req models.PromotionRequest) (*models.Promotion, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.codeTaken(req.Code, 0) {
+		return nil, ErrConflict
+	}
+	p := promotionFromRequest(req)
+	p.ID = s.m.nextID("promotions")
+	p.CreatedAt = now()
+	p.UpdatedAt = p.CreatedAt
+	s.m.promotions[p.ID] = p
+	return &p, nil
+}
+
+func (s memoryPromotions) Update(ctx context.Context, id int, req models.PromotionRequest) (*models.Promotion, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	existing, ok := s.m.promotions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if s.m.codeTaken(req.Code, id) {
+		return nil, ErrConflict
+	}
+	p := promotionFromRequest(req)
+	p.ID = id
+	p.CreatedAt = existing.CreatedAt
+	p.UpdatedAt = now()
+	s.m.promotions[id] = p
+	return &p, nil
+}
+
+func (s memoryPromotions) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.promotions[id]; !ok {
+		return ErrNotFound
+	}
+	for _, order := range s.m.orders {
+		for _, adjustment := range order.Adjustments {
+			if adjustment.PromotionID != nil && *adjustment.PromotionID == id {
+				return ErrInUse
+			}
+		}
+	}
+	delete(s.m.promotions, id)
+	return nil
+}
+
+func promotionFromRequest(req models.PromotionRequest) models.Promotion {
+	return models.Promotion{
+		Name:              req.Name,
+		Description:       req.Description,
+		Code:              req.Code,
+		Type:              req.Type,
+		PercentOff:        req.PercentOff,
+		AmountOff:         req.AmountOff,
+		BuyQuantity:       req.BuyQuantity,
+		DishID:            req.DishID,
+		CategoryID:        req.CategoryID,
+		MinSpend:          req.MinSpend,
+		UsageLimitPerUser: req.UsageLimitPerUser,
+		StartsAt:          req.StartsAt,
+		EndsAt:            req.EndsAt,
+		IsActive:          req.IsActive == nil || *req.IsActive,
+	}
+}
+
+// codeTaken 优惠券代码是否已被 exceptID 以外的优惠使用
+func (m *Memory) codeTaken(code string, exceptID int) bool {
+	if code == "" {
+		return false
+	}
+	for _, p := range m.promotions {
+		if p.Code == code && p.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// applicablePromotions 与 Postgres 实现的同名函数语义一致
+func (m *Memory) applicablePromotions(userID int, code string, at time.Time) ([]models.Promotion, *models.Promotion, error) {
+	var automatic []models.Promotion
+	var coupon *models.Promotion
+	for _, p := range m.promotions {
+		switch {
+		case p.Code == "" && promotion.Available(p, at) == nil:
+			automatic = append(automatic, p)
+		case p.Code != "" && p.Code == code:
+			p := p
+			coupon = &p
+		}
+	}
+	sort.Slice(automatic, func(i, j int) bool { return automatic[i].ID < automatic[j].ID })
+	if code != "" && coupon == nil {
+		return nil, nil, &CouponError{Code: code, Reason: "not found"}
+	}
+
+	available := automatic[:0]
+	for _, p := range automatic {
+		if !m.usageExhausted(p, userID) {
+			available = append(available, p)
+		}
+	}
+	if coupon != nil && m.usageExhausted(*coupon, userID) {
+		return nil, nil, &CouponError{Code: code, Reason: "usage limit reached"}
+	}
+	return available, coupon, nil
+}
+
+// usageExhausted 用户未取消的订单中使用该优惠的次数是否已达上限
+func (m *Memory) usageExhausted(p models.Promotion, userID int) bool {
+	if p.UsageLimitPerUser == 0 {
+		return false
+	}
+	count := 0
+	for _, order := range m.orders {
+		if order.UserID != userID || order.Status == models.OrderStatusCancelled {
+			continue
+		}
+		for _, adjustment := range order.Adjustments {
+			if adjustment.PromotionID != nil && *adjustment.PromotionID == p.ID {
+				count++
+				break
+			}
+		}
+	}
+	return count >= p.UsageLimitPerUser
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"food-ordering/models"
+)
+
+type memoryRecommendations struct{ m *Memory }
+
+func (s memoryRecommendations) List(ctx context.Context, activeOnly bool) ([]models.Recommendation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var recommendations []models.Recommendation
+	for id, rec := range s.m.recommendations {
+		if activeOnly && !rec.IsActive {
+			continue
+		}
+		recommendations = append(recommendations, s.m.recommendationView(id))
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		if !recommendations[i].CreatedAt.Equal(recommendations[j].CreatedAt) {
+			return recommendations[i].CreatedAt.Before(recommendations[j].CreatedAt)
+		}
+		return recommendations[i].ID < recommendations[j].ID
+	})
+	return recommendations, nil
+}
+
+func (s memoryRecommendations) Get(ctx context.Context, id int) (*models.Recommendation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.recommendations[id]; !ok {
+		return nil, ErrNotFound
+	}
+	rec := s.m.recommendationView(id)
+	return &rec, nil
+}
+
+func (s memoryRecommendations) Create(ctx context.Context, req models.RecommendationRequest) (*models.Recommendation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	rec := recommendationFromRequest(req)
+	rec.ID = s.m.nextID("recommendations")
+	rec.CreatedAt = now()
+	rec.UpdatedAt = rec.CreatedAt
+	s.m.recommendations[rec.ID] = rec
+	s.m.recommendationDishes[rec.ID] = append([]int(nil), req.DishIDs...)
+	view := s.m.recommendationView(rec.ID)
+	return &view, nil
+}
+
+func (s memoryRecommendations) Update(ctx context.Context, id int, req models.RecommendationRequest) (*models.Recommendation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	existing, ok := s.m.recommendations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rec := recommendationFromRequest(req)
+	rec.ID = id
+	rec.CreatedAt = existing.CreatedAt
+	rec.UpdatedAt = now()
+	s.m.recommendations[id] = rec
+	s.m.recommendationDishes[id] = append([]int(nil), req.DishIDs...)
+	view := s.m.recommendationView(id)
+	return &view, nil
+}
+
+func (s memoryRecommendations) SetDishes(ctx context.Context, id int, dishIDs []int) (*models.Recommendation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	rec, ok := s.m.recommendations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rec.UpdatedAt = now()
+	s.m.recommendations[id] = rec
+	s.m.recommendationDishes[id] = append([]int(nil), dishIDs...)
+	view := s.m.recommendationView(id)
+	return &view, nil
+}
+
+func (s memoryRecommendations) SetActive(ctx context.Context, id int, active bool) (*models.Recommendation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	rec, ok := s.m.recommendations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rec.IsActive = active
+	rec.UpdatedAt = now()
+	s.m.recommendations[id] = rec
+	view := s.m.recommendationView(id)
+	return &view, nil
+}
+
+func (s memoryRecommendations) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.recommendations[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.recommendations, id)
+	delete(s.m.recommendationDishes, id)
+	return nil
+}
+
+func recommendationFromRequest(req models.RecommendationRequest) models.Recommendation {
+	return models.Recommendation{
+		Name:           req.Name,
+		Description:    req.Description,
+		Type:           req.Type,
+		MeatCount:      req.MeatCount,
+		VegetableCount: req.VegetableCount,
+		IsActive:       req.IsActive == nil || *req.IsActive,
+	}
+}
+
+// recommendationView 复制推荐配置并按加入顺序填充固定菜单的菜品，调用方需持有锁
+func (m *Memory) recommendationView(id int) models.Recommendation {
+	rec := m.recommendations[id]
+	rec.Dishes = nil
+	for _, dishID := range m.recommendationDishes[id] {
+		if dish, ok := m.dishes[dishID]; ok {
+			rec.Dishes = append(rec.Dishes, m.dishView(dish))
+		}
+	}
+	return rec
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/related"
+)
+
+type memoryRelated struct{ m *Memory }
+
+func (s memoryRelated) Baskets(ctx context.Context, since time.Time) ([][]int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var orders []models.Order
+	for _, order := range s.m.orders {
+		if !order.CreatedAt.Before(since) && order.Status != models.OrderStatusCancelled {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+
+	var baskets [][]int
+	for _, order := range orders {
+		var basket []int
+		for _, item := range order.Items {
+			basket = append(basket, item.DishID)
+		}
+		baskets = append(baskets, basket)
+	}
+	return baskets, nil
+}
+
+func (s memoryRelated) Replace(ctx context.Context, stats *related.Stats) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	counts := make(map[int]int, len(stats.OrderCounts))
+	for dishID, orders := range stats.OrderCounts {
+		counts[dishID] = orders
+	}
+	s.m.similarities = &related.Stats{
+		Pairs:       append([]related.Pair(nil), stats.Pairs...),
+		OrderCounts: counts,
+	}
+	return nil
+}
+
+func (s memoryRelated) Related(ctx context.Context, dishID, limit int) ([]models.RelatedDish, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	dishes := []models.RelatedDish{}
+	if s.m.similarities == nil {
+		return dishes, nil
+	}
+	for _, pair := range s.m.similarities.Pairs {
+		dish, ok := s.m.dishes[pair.RelatedDishID]
+		if pair.DishID != dishID || !ok || !dish.IsActive {
+			continue
+		}
+		dishes = append(dishes, models.RelatedDish{Dish: s.m.dishView(dish), Score: pair.Score, CoOrders: pair.CoOrders})
+	}
+	sort.SliceStable(dishes, func(i, j int) bool {
+		if dishes[i].Score != dishes[j].Score {
+			return dishes[i].Score > dishes[j].Score
+		}
+		if dishes[i].CoOrders != dishes[j].CoOrders {
+			return dishes[i].CoOrders > dishes[j].CoOrders
+		}
+		return dishes[i].Dish.ID < dishes[j].Dish.ID
+	})
+	if len(dishes) > limit {
+		dishes = dishes[:limit]
+	}
+	return dishes, nil
+}
+
+func (s memoryRelated) OrderCounts(ctx context.Context, dishIDs []int) (map[int]int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	counts := make(map[int]int)
+	if s.m.similarities == nil {
+		return counts, nil
+	}
+	for _, dishID := range dishIDs {
+		if orders, ok := s.m.similarities.OrderCounts[dishID]; ok {
+			counts[dishID] = orders
+		}
+	}
+	return counts, nil
+}
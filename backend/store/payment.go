@@ -0,0 +1,18 @@
+package store
+
+import "food-ordering/models"
+
+// refundStatus 校验退款金额并返回退款后的支付状态
+func refundStatus(current models.Payment, refund models.PaymentRefund) (string, error) {
+	if current.Status != models.PaymentStatusCaptured && current.Status != models.PaymentStatusPartiallyRefunded {
+		return "", &PaymentTransitionError{From: current.Status, To: models.PaymentStatusRefunded}
+	}
+	remaining := current.Amount.Sub(current.RefundedAmount)
+	if !refund.Amount.IsPositive() || refund.Amount.Cmp(remaining) > 0 {
+		return "", ErrConflict
+	}
+	if refund.Amount.Cmp(remaining) == 0 {
+		return models.PaymentStatusRefunded, nil
+	}
+	return models.PaymentStatusPartiallyRefunded, nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"food-ordering/models"
+
+	"github.com/lib/pq"
+)
+
+// NewPostgres 基于 PostgreSQL 的实现
+func NewPostgres(db *sql.DB) *Store {
+	return &Store{
+		Dishes:          &pgDishes{db: db},
+		Categories:      &pgCategories{db: db},
+		Tags:            &pgTags{db: db},
+		Orders:          &pgOrders{db: db},
+		Promotions:      &pgPromotions{db: db},
+		Carts:           &pgCarts{db: db},
+		Payments:        &pgPayments{db: db},
+		Recommendations: &pgRecommendations{db: db},
+		Personalization: &pgPersonalization{db: db},
+		Related:         &pgRelated{db: db},
+		Favorites:       &pgFavorites{db: db},
+		Config:          &pgConfig{db: db},
+		Users:           &pgUsers{db: db},
+		LoginStates:     &pgLoginStates{db: db},
+	}
+}
+
+// 菜品查询的公共列，需配合 dishFrom 使用
+const dishColumns = `
+	d.id, d.name, COALESCE(d.description, ''), d.category_id, c.name,
+	d.price, COALESCE(d.image_url, ''), COALESCE(d.video_url, ''), COALESCE(d.cooking_steps, ''),
+	d.is_seasonal, d.is_active, d.created_at, d.updated_at,
+	ARRAY(SELECT t.slug FROM dish_tags dt JOIN tags t ON t.id = dt.tag_id WHERE dt.dish_id = d.id ORDER BY t.slug)
+`
+
+const dishFrom = `
+	FROM dishes d
+	LEFT JOIN categories c ON d.category_id = c.id
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDish 按 dishColumns 的顺序扫描一行菜品
+func scanDish(row rowScanner) (models.Dish, error) {
+	var dish models.Dish
+	var categoryID sql.NullInt64
+	var categoryName sql.NullString
+
+	err := row.Scan(
+		&dish.ID, &dish.Name, &dish.Description, &categoryID, &categoryName,
+		&dish.Price, &dish.ImageURL, &dish.VideoURL, &dish.CookingSteps,
+		&dish.IsSeasonal, &dish.IsActive, &dish.CreatedAt, &dish.UpdatedAt, pq.Array(&dish.Tags),
+	)
+	if err != nil {
+		return dish, err
+	}
+
+	dish.CategoryID = int(categoryID.Int64)
+	if categoryName.Valid {
+		dish.Category = &models.Category{
+			ID:   dish.CategoryID,
+			Name: categoryName.String,
+		}
+	}
+	return dish, nil
+}
+
+// updateBuilder 拼接 UPDATE 语句的 SET 子句
+type updateBuilder struct {
+	sets []string
+	args []interface{}
+}
+
+func (b *updateBuilder) set(column string, value interface{}) {
+	b.args = append(b.args, value)
+	b.sets = append(b.sets, column+" = $"+strconv.Itoa(len(b.args)))
+}
+
+func (b *updateBuilder) empty() bool {
+	return len(b.sets) == 0
+}
+
+// query 生成按 id 更新的语句，extra 为不需要参数的附加赋值，例如 updated_at = NOW()
+func (b *updateBuilder) query(table string, id int, extra ...string) (string, []interface{}) {
+	sets := append(append([]string{}, b.sets...), extra...)
+	args := append(b.args, id)
+	return "UPDATE " + table + " SET " + strings.Join(sets, ", ") + " WHERE id = $" + strconv.Itoa(len(args)), args
+}
+
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// conflict 把唯一约束冲突转换为 ErrConflict
+func conflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrConflict
+	}
+	return err
+}
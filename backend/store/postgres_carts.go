@@ -0,0 +1,231 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/money"
+)
+
+type pgCarts struct {
+	db *sql.DB
+}
+
+func (s *pgCarts) Get(ctx context.Context, userID int) (*models.Cart, error) {
+	var updatedAt time.Time
+	err := s.db.QueryRowContext(ctx, "SELECT updated_at FROM carts WHERE user_id = $1", userID).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		return summarizeCart(nil, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ci.dish_id, ci.quantity, ci.note, ci.added_price, ci.created_at, ci.updated_at,`+dishColumns+`
+		FROM cart_items ci
+		JOIN dishes d ON ci.dish_id = d.id
+		LEFT JOIN categories c ON d.category_id = c.id
+		WHERE ci.user_id = $1
+		ORDER BY ci.created_at, ci.dish_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.CartItem
+	for rows.Next() {
+		var item models.CartItem
+		dish, err := scanDish(scanPrefix{rows, []interface{}{
+			&item.DishID, &item.Quantity, &item.Note, &item.AddedPrice, &item.CreatedAt, &item.UpdatedAt,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		item.Dish = &dish
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return summarizeCart(items, &updatedAt), nil
+}
+
+func (s *pgCarts) AddItem(ctx context.Context, userID int, req models.AddCartItemRequest) (*models.Cart, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var price money.Money
+	err = tx.QueryRowContext(ctx, "SELECT price FROM dishes WHERE id = $1 AND is_active = true", req.DishID).Scan(&price)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	at := now()
+	if err := touchCart(ctx, tx, userID, at); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO cart_items (user_id, dish_id, quantity, note, added_price, created_at, updated_at)
+		VALUES ($1, $2, LEAST($3, $7), $4, $5, $6, $6)
+		ON CONFLICT (user_id, dish_id) DO UPDATE SET
+			quantity = LEAST(cart_items.quantity + EXCLUDED.quantity, $7),
+			note = CASE WHEN EXCLUDED.note = '' THEN cart_items.note ELSE EXCLUDED.note END,
+			added_price = EXCLUDED.added_price,
+			updated_at = EXCLUDED.updated_at
+	`, userID, req.DishID, req.Quantity, req.Note, price, at, models.MaxCartItemQuantity)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, userID)
+}
+
+func (s *pgCarts) UpdateItem(ctx context.Context, userID, dishID int, req models.UpdateCartItemRequest) (*models.Cart, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 修改后按当前价格重新记录 added_price，视为用户已确认价格变动
+	at := now()
+	result, err := tx.ExecContext(ctx, `
+		UPDATE cart_items SET
+			quantity = COALESCE($3, quantity),
+			note = COALESCE($4, note),
+			added_price = (SELECT price FROM dishes WHERE id = $2),
+			updated_at = $5
+		WHERE user_id = $1 AND dish_id = $2
+	`, userID, dishID, req.Quantity, req.Note, at)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	if err := touchCart(ctx, tx, userID, at); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, userID)
+}
+
+func (s *pgCarts) RemoveItem(ctx context.Context, userID, dishID int) (*models.Cart, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM cart_items WHERE user_id = $1 AND dish_id = $2", userID, dishID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	if err := touchCart(ctx, tx, userID, now()); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, userID)
+}
+
+func (s *pgCarts) Clear(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM carts WHERE user_id = $1", userID)
+	return err
+}
+
+func (s *pgCarts) Checkout(ctx context.Context, userID int, req models.CheckoutRequest) (*models.Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 锁住购物车，避免结算期间并发修改或重复结算
+	var locked int
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM carts WHERE user_id = $1 FOR UPDATE", userID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return nil, ErrCartEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT dish_id, quantity, note FROM cart_items
+		WHERE user_id = $1
+		ORDER BY created_at, dish_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var items []models.CartItem
+	for rows.Next() {
+		var item models.CartItem
+		if err := rows.Scan(&item.DishID, &item.Quantity, &item.Note); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	orderID, err := createOrder(ctx, tx, userID, checkoutRequest(items, req))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM carts WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return (&pgOrders{db: s.db}).Get(ctx, orderID)
+}
+
+func (s *pgCarts) ExpireBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM carts WHERE updated_at < $1", cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// touchCart 创建购物车或更新其最后修改时间，同时锁住购物车行，使同一用户的修改串行执行
+func touchCart(ctx context.Context, tx *sql.Tx, userID int, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO carts (user_id, created_at, updated_at) VALUES ($1, $2, $2)
+		ON CONFLICT (user_id) DO UPDATE SET updated_at = EXCLUDED.updated_at
+	`, userID, at)
+	return err
+}
@@ -0,0 +1,497 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"food-ordering/models"
+
+	"github.com/lib/pq"
+)
+
+type pgDishes struct {
+	db *sql.DB
+}
+
+func (s *pgDishes) List(ctx context.Context, filter DishFilter) ([]models.Dish, int, error) {
+	where := " WHERE d.is_active = true"
+	args := []interface{}{}
+
+	if filter.CategoryID > 0 {
+		args = append(args, filter.CategoryID)
+		where += fmt.Sprintf(" AND d.category_id = $%d", len(args))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		where += fmt.Sprintf(" AND (d.name ILIKE $%d OR d.description ILIKE $%d)", len(args), len(args))
+	}
+	if len(filter.Tags) > 0 {
+		tags := distinctStrings(filter.Tags)
+		args = append(args, pq.Array(tags))
+		where += fmt.Sprintf(` AND d.id IN (
+			SELECT dt.dish_id FROM dish_tags dt JOIN tags t ON t.id = dt.tag_id
+			WHERE t.slug = ANY($%d) GROUP BY dt.dish_id HAVING COUNT(*) = %d)`, len(args), len(tags))
+	}
+	if filter.SeasonalOnly {
+		where += " AND d.is_seasonal = true"
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM dishes d"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT" + dishColumns + dishFrom + where +
+		fmt.Sprintf(" ORDER BY d.created_at DESC, d.id DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	rows, err := s.db.QueryContext(ctx, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var dishes []models.Dish
+	for rows.Next() {
+		dish, err := scanDish(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		dishes = append(dishes, dish)
+	}
+	return dishes, total, rows.Err()
+}
+
+// distinctStrings 去重并保留首次出现的顺序
+func distinctStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func (s *pgDishes) Get(ctx context.Context, id int) (*models.Dish, error) {
+	dish, err := scanDish(s.db.QueryRowContext(ctx, "SELECT"+dishColumns+dishFrom+" WHERE d.id = $1", id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &dish, nil
+}
+
+func (s *pgDishes) Create(ctx context.Context, req models.CreateDishRequest) (*models.Dish, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO dishes (name, description, category_id, price, image_url, video_url,
+			cooking_steps, is_seasonal, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, true, NOW(), NOW())
+		RETURNING id
+	`, req.Name, req.Description, req.CategoryID, req.Price, req.ImageURL,
+		req.VideoURL, req.CookingSteps, req.IsSeasonal).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	if err := replaceDishTags(ctx, tx, id, req.Tags); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *pgDishes) Update(ctx context.Context, id int, req models.UpdateDishRequest) (*models.Dish, error) {
+	var b updateBuilder
+	if req.Name != nil {
+		b.set("name", *req.Name)
+	}
+	if req.Description != nil {
+		b.set("description", *req.Description)
+	}
+	if req.CategoryID != nil {
+		b.set("category_id", *req.CategoryID)
+	}
+	if req.Price != nil {
+		b.set("price", *req.Price)
+	}
+	if req.ImageURL != nil {
+		b.set("image_url", *req.ImageURL)
+	}
+	if req.VideoURL != nil {
+		b.set("video_url", *req.VideoURL)
+	}
+	if req.CookingSteps != nil {
+		b.set("cooking_steps", *req.CookingSteps)
+	}
+	if req.IsSeasonal != nil {
+		b.set("is_seasonal", *req.IsSeasonal)
+	}
+	if req.IsActive != nil {
+		b.set("is_active", *req.IsActive)
+	}
+
+	if b.empty() && req.Tags == nil {
+		return s.Get(ctx, id)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 只改标签时也更新 updated_at
+	query, args := b.query("dishes", id, "updated_at = NOW()")
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	if req.Tags != nil {
+		if err := replaceDishTags(ctx, tx, id, *req.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+// replaceDishTags 用 slugs 替换菜品的全部标签，不存在的标签被忽略
+func replaceDishTags(ctx context.Context, tx *sql.Tx, dishID int, slugs []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dish_tags WHERE dish_id = $1", dishID); err != nil {
+		return err
+	}
+	if len(slugs) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO dish_tags (dish_id, tag_id)
+		SELECT $1, id FROM tags WHERE slug = ANY($2)
+	`, dishID, pq.Array(slugs))
+	return err
+}
+
+func (s *pgDishes) Deactivate(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE dishes SET is_active = false, updated_at = NOW() WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgDishes) InCategories(ctx context.Context, categoryIDs []int) ([]models.Dish, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT"+dishColumns+dishFrom+`
+		WHERE d.is_active = true AND d.category_id = ANY($1)
+		ORDER BY d.id
+	`, pq.Array(categoryIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dishes []models.Dish
+	for rows.Next() {
+		dish, err := scanDish(rows)
+		if err != nil {
+			return nil, err
+		}
+		dishes = append(dishes, dish)
+	}
+	return dishes, rows.Err()
+}
+
+func (s *pgDishes) WithAnyTag(ctx context.Context, tags []string) ([]models.Dish, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT"+dishColumns+dishFrom+`
+		WHERE d.is_active = true AND EXISTS (
+			SELECT 1 FROM dish_tags dt JOIN tags t ON t.id = dt.tag_id
+			WHERE dt.dish_id = d.id AND t.slug = ANY($1))
+		ORDER BY d.id
+	`, pq.Array(tags))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dishes []models.Dish
+	for rows.Next() {
+		dish, err := scanDish(rows)
+		if err != nil {
+			return nil, err
+		}
+		dishes = append(dishes, dish)
+	}
+	return dishes, rows.Err()
+}
+
+type pgCategories struct {
+	db *sql.DB
+}
+
+const categoryColumns = "id, name, COALESCE(description, ''), created_at"
+
+func scanCategory(row rowScanner) (models.Category, error) {
+	var category models.Category
+	err := row.Scan(&category.ID, &category.Name, &category.Description, &category.CreatedAt)
+	return category, err
+}
+
+func (s *pgCategories) List(ctx context.Context) ([]models.Category, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+categoryColumns+" FROM categories ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+func (s *pgCategories) Get(ctx context.Context, id int) (*models.Category, error) {
+	category, err := scanCategory(s.db.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM categories WHERE id = $1", id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &category, nil
+}
+
+func (s *pgCategories) Exists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", id).Scan(&exists)
+	return exists, err
+}
+
+func (s *pgCategories) Create(ctx context.Context, req models.CreateCategoryRequest) (*models.Category, error) {
+	category, err := scanCategory(s.db.QueryRowContext(ctx, `
+		INSERT INTO categories (name, description, created_at)
+		VALUES ($1, $2, NOW())
+		RETURNING `+categoryColumns, req.Name, req.Description))
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (s *pgCategories) Update(ctx context.Context, id int, req models.UpdateCategoryRequest) (*models.Category, error) {
+	var b updateBuilder
+	if req.Name != nil {
+		b.set("name", *req.Name)
+	}
+	if req.Description != nil {
+		b.set("description", *req.Description)
+	}
+	if b.empty() {
+		return s.Get(ctx, id)
+	}
+
+	query, args := b.query("categories", id)
+	category, err := scanCategory(s.db.QueryRowContext(ctx, query+" RETURNING "+categoryColumns, args...))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &category, nil
+}
+
+func (s *pgCategories) Delete(ctx context.Context, id int) error {
+	var inUse bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM dishes WHERE category_id = $1 AND is_active = true)", id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrInUse
+	}
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM categories WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgTags struct {
+	db *sql.DB
+}
+
+const tagColumns = "id, slug, name, COALESCE(description, ''), created_at"
+
+func scanTag(row rowScanner) (models.Tag, error) {
+	var tag models.Tag
+	err := row.Scan(&tag.ID, &tag.Slug, &tag.Name, &tag.Description, &tag.CreatedAt)
+	return tag, err
+}
+
+func (s *pgTags) List(ctx context.Context) ([]models.Tag, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+tagColumns+" FROM tags ORDER BY slug")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (s *pgTags) Get(ctx context.Context, id int) (*models.Tag, error) {
+	tag, err := scanTag(s.db.QueryRowContext(ctx, "SELECT "+tagColumns+" FROM tags WHERE id = $1", id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &tag, nil
+}
+
+func (s *pgTags) Create(ctx context.Context, req models.CreateTagRequest) (*models.Tag, error) {
+	tag, err := scanTag(s.db.QueryRowContext(ctx, `
+		INSERT INTO tags (slug, name, description, created_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING `+tagColumns, req.Slug, req.Name, req.Description))
+	if err != nil {
+		return nil, conflict(err)
+	}
+	return &tag, nil
+}
+
+func (s *pgTags) Update(ctx context.Context, id int, req models.UpdateTagRequest) (*models.Tag, error) {
+	var b updateBuilder
+	if req.Name != nil {
+		b.set("name", *req.Name)
+	}
+	if req.Description != nil {
+		b.set("description", *req.Description)
+	}
+	if b.empty() {
+		return s.Get(ctx, id)
+	}
+
+	query, args := b.query("tags", id)
+	tag, err := scanTag(s.db.QueryRowContext(ctx, query+" RETURNING "+tagColumns, args...))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &tag, nil
+}
+
+func (s *pgTags) Delete(ctx context.Context, id int) error {
+	// dish_tags 随之级联删除
+	result, err := s.db.ExecContext(ctx, "DELETE FROM tags WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgTags) Missing(ctx context.Context, slugs []string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT slug FROM tags WHERE slug = ANY($1)", pq.Array(slugs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]bool)
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		found[slug] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, slug := range slugs {
+		if !found[slug] {
+			missing = append(missing, slug)
+		}
+	}
+	return missing, nil
+}
+
+type pgConfig struct {
+	db *sql.DB
+}
+
+func (s *pgConfig) List(ctx context.Context) ([]models.SystemConfig, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, config_key, COALESCE(config_value, ''), COALESCE(description, ''), updated_at
+		FROM system_config
+		ORDER BY config_key
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []models.SystemConfig
+	for rows.Next() {
+		var config models.SystemConfig
+		if err := rows.Scan(&config.ID, &config.ConfigKey, &config.ConfigValue, &config.Description, &config.UpdatedAt); err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, rows.Err()
+}
+
+func (s *pgConfig) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(config_value, '') FROM system_config WHERE config_key = $1", key).Scan(&value)
+	return value, notFound(err)
+}
+
+func (s *pgConfig) Update(ctx context.Context, values map[string]string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, value := range values {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE system_config
+			SET config_value = $1, updated_at = NOW()
+			WHERE config_key = $2
+		`, value, key)
+		if err != nil {
+			return fmt.Errorf("update config %s: %w", key, err)
+		}
+	}
+	return tx.Commit()
+}
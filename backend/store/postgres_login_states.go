@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type pgLoginStates struct {
+	db *sql.DB
+}
+
+func (s *pgLoginStates) Save(ctx context.Context, stateHash string, state LoginState) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM oidc_login_states WHERE expires_at < $1", time.Now().UTC()); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at) VALUES ($1, $2, $3, $4)",
+		stateHash, state.Nonce, state.CodeVerifier, state.ExpiresAt,
+	)
+	return conflict(err)
+}
+
+func (s *pgLoginStates) Take(ctx context.Context, stateHash string) (*LoginState, error) {
+	var state LoginState
+	err := s.db.QueryRowContext(ctx,
+		"DELETE FROM oidc_login_states WHERE state_hash = $1 RETURNING nonce, code_verifier, expires_at",
+		stateHash,
+	).Scan(&state.Nonce, &state.CodeVerifier, &state.ExpiresAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &state, nil
+}
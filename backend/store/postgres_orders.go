@@ -0,0 +1,607 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/money"
+	"food-ordering/promotion"
+	"food-ordering/schedule"
+
+	"github.com/lib/pq"
+)
+
+type pgOrders struct {
+	db *sql.DB
+}
+
+// 订单查询的公共列，需配合 orderFrom 使用
+const orderColumns = "o.id, o.user_id, COALESCE(u.username, ''), o.subtotal, o.discount_amount, o.total_amount, o.status, " +
+	"o.requested_for, COALESCE(o.meal_slot, ''), " +
+	"COALESCE((SELECT p.status FROM payments p WHERE p.order_id = o.id ORDER BY p.id DESC LIMIT 1), ''), o.created_at, o.updated_at"
+
+const orderFrom = " FROM orders o LEFT JOIN users u ON u.id = o.user_id"
+
+// 可排序的字段与对应的列，排序字段只能从这里取，不能拼接用户输入
+var orderSortColumns = map[string]string{
+	OrderSortCreatedAt:   "o.created_at",
+	OrderSortTotalAmount: "o.total_amount",
+	OrderSortStatus:      "o.status",
+}
+
+// scanOrder 用户被删除后订单的 user_id 为 NULL，此时 UserID 为 0
+func scanOrder(row rowScanner) (models.Order, error) {
+	var order models.Order
+	var userID sql.NullInt64
+	var requestedFor sql.NullTime
+	err := row.Scan(&order.ID, &userID, &order.Username, &order.Subtotal, &order.DiscountAmount, &order.TotalAmount,
+		&order.Status, &requestedFor, &order.MealSlot, &order.PaymentStatus, &order.CreatedAt, &order.UpdatedAt)
+	order.UserID = int(userID.Int64)
+	if requestedFor.Valid {
+		order.RequestedFor = &requestedFor.Time
+	}
+	return order, err
+}
+
+func (s *pgOrders) Create(ctx context.Context, userID int, req models.CreateOrderRequest) (*models.Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	orderID, err := createOrder(ctx, tx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, orderID)
+}
+
+// createOrder 在事务中校验菜品、计算优惠并写入订单，返回订单 ID；下单和购物车结算共用
+func createOrder(ctx context.Context, tx *sql.Tx, userID int, req models.CreateOrderRequest) (int, error) {
+	// 验证菜品并取出价格，明细和优惠都使用同一次查到的价格
+	lines := make([]promotion.Line, len(req.Items))
+	for i, item := range req.Items {
+		if item.Quantity < 1 {
+			return 0, &InvalidQuantityError{DishID: item.DishID, Quantity: item.Quantity}
+		}
+		var categoryID sql.NullInt64
+		err := tx.QueryRowContext(ctx, "SELECT price, category_id FROM dishes WHERE id = $1 AND is_active = true", item.DishID).
+			Scan(&lines[i].Price, &categoryID)
+		if err == sql.ErrNoRows {
+			return 0, &DishUnavailableError{DishID: item.DishID}
+		}
+		if err != nil {
+			return 0, err
+		}
+		lines[i].DishID = item.DishID
+		lines[i].CategoryID = int(categoryID.Int64)
+		lines[i].Quantity = item.Quantity
+	}
+
+	createdAt := now()
+	booking, err := reserveSlot(ctx, tx, req, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	automatic, coupon, err := applicablePromotions(ctx, tx, userID, req.CouponCode, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	adjustments, err := priceOrder(automatic, coupon, lines, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	subtotal := promotion.Subtotal(lines)
+	total := promotion.Total(subtotal, adjustments)
+
+	var requestedFor *time.Time
+	var mealSlot string
+	if booking != nil {
+		requestedFor, mealSlot = &booking.RequestedFor, booking.Slot
+	}
+
+	var orderID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO orders (user_id, subtotal, discount_amount, total_amount, status, requested_for, meal_slot, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 'pending', $5, NULLIF($6, ''), $7, $7)
+		RETURNING id
+	`, userID, subtotal, subtotal.Sub(total), total, requestedFor, mealSlot, createdAt).Scan(&orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := recordStatus(ctx, tx, orderID, "", models.OrderStatusPending, userID, ""); err != nil {
+		return 0, err
+	}
+
+	for i, line := range lines {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO order_items (order_id, dish_id, quantity, price, note)
+			VALUES ($1, $2, $3, $4, $5)
+		`, orderID, line.DishID, line.Quantity, line.Price, req.Items[i].Note)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, adjustment := range adjustments {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO order_adjustments (order_id, promotion_id, code, description, amount, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, orderID, adjustment.PromotionID, adjustment.Code, adjustment.Description, adjustment.Amount, createdAt)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return orderID, nil
+}
+
+// reserveSlot 校验预约时间并检查时段容量，未预约时返回 nil
+// 同一时段同一天的下单通过 advisory lock 串行执行，避免并发下单超出容量
+func reserveSlot(ctx context.Context, tx *sql.Tx, req models.CreateOrderRequest, at time.Time) (*schedule.Booking, error) {
+	if req.RequestedFor == nil && req.MealSlot == "" {
+		return nil, nil
+	}
+
+	values := map[string]string{}
+	rows, err := tx.QueryContext(ctx, "SELECT config_key, COALESCE(config_value, '') FROM system_config")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		values[key] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	booking, err := bookSlot(values, req, at)
+	if err != nil || booking.Capacity == 0 {
+		return booking, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "meal_slot:"+booking.Slot+":"+booking.Date); err != nil {
+		return nil, err
+	}
+	var booked int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM orders
+		WHERE meal_slot = $1 AND requested_for >= $2 AND requested_for < $3 AND status <> 'cancelled'
+	`, booking.Slot, booking.Start, booking.End).Scan(&booked)
+	if err != nil {
+		return nil, err
+	}
+	if booked >= booking.Capacity {
+		return nil, &SlotFullError{Slot: booking.Slot, Date: booking.Date}
+	}
+	return booking, nil
+}
+
+func (s *pgOrders) Get(ctx context.Context, id int) (*models.Order, error) {
+	order, err := scanOrder(s.db.QueryRowContext(ctx, "SELECT "+orderColumns+orderFrom+" WHERE o.id = $1", id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	orders := []models.Order{order}
+	if err := s.attachDetails(ctx, orders); err != nil {
+		return nil, err
+	}
+	return &orders[0], nil
+}
+
+func (s *pgOrders) List(ctx context.Context, filter OrderFilter) ([]models.Order, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID > 0 {
+		add("o.user_id = $%d", filter.UserID)
+	}
+	if filter.Status != "" {
+		add("o.status = $%d", filter.Status)
+	}
+	if filter.DishID > 0 {
+		add("EXISTS (SELECT 1 FROM order_items oi WHERE oi.order_id = o.id AND oi.dish_id = $%d)", filter.DishID)
+	}
+	if filter.From != nil {
+		add("o.created_at >= $%d", filter.From.UTC())
+	}
+	if filter.To != nil {
+		add("o.created_at < $%d", filter.To.UTC())
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders o"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := orderSortColumns[filter.Sort]
+	if !ok {
+		column = orderSortColumns[OrderSortCreatedAt]
+	}
+	direction := "DESC"
+	if filter.Asc {
+		direction = "ASC"
+	}
+
+	query := "SELECT " + orderColumns + orderFrom + where +
+		fmt.Sprintf(" ORDER BY %s %s, o.id %s LIMIT $%d OFFSET $%d", column, direction, direction, len(args)+1, len(args)+2)
+	rows, err := s.db.QueryContext(ctx, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if err := s.attachDetails(ctx, orders); err != nil {
+		return nil, 0, err
+	}
+	return orders, total, nil
+}
+
+func (s *pgOrders) Scheduled(ctx context.Context, from, to time.Time) ([]models.Order, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+orderColumns+orderFrom+`
+		WHERE o.requested_for >= $1 AND o.requested_for < $2 AND o.status <> 'cancelled'
+		ORDER BY o.requested_for, o.id
+	`, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachDetails(ctx, orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// attachDetails 取出这些订单的明细和调整项
+func (s *pgOrders) attachDetails(ctx context.Context, orders []models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(orders))
+	index := make(map[int]int, len(orders))
+	for i, order := range orders {
+		ids[i] = int64(order.ID)
+		index[order.ID] = i
+	}
+	if err := s.attachItems(ctx, orders, ids, index); err != nil {
+		return err
+	}
+	return s.attachAdjustments(ctx, orders, ids, index)
+}
+
+// attachItems 用一次查询取出这些订单的全部明细及菜品信息
+func (s *pgOrders) attachItems(ctx context.Context, orders []models.Order, ids []int64, index map[int]int) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT oi.id, oi.order_id, oi.dish_id, oi.quantity, oi.price, oi.note, oi.created_at,
+			   d.name, d.image_url, d.price, d.category_id, c.name, d.is_seasonal, d.is_active
+		FROM order_items oi
+		LEFT JOIN dishes d ON oi.dish_id = d.id
+		LEFT JOIN categories c ON d.category_id = c.id
+		WHERE oi.order_id = ANY($1)
+		ORDER BY oi.order_id, oi.id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		var dishID, categoryID sql.NullInt64
+		var dishName, dishImageURL, categoryName sql.NullString
+		var dishPrice money.Money // 菜品已删除时为 NULL，读作 0
+		var isSeasonal, isActive sql.NullBool
+		err := rows.Scan(&item.ID, &item.OrderID, &dishID, &item.Quantity, &item.Price, &item.Note, &item.CreatedAt,
+			&dishName, &dishImageURL, &dishPrice, &categoryID, &categoryName, &isSeasonal, &isActive)
+		if err != nil {
+			return err
+		}
+
+		item.DishID = int(dishID.Int64)
+		if dishName.Valid {
+			item.Dish = &models.Dish{
+				ID:         item.DishID,
+				Name:       dishName.String,
+				ImageURL:   dishImageURL.String,
+				Price:      dishPrice,
+				CategoryID: int(categoryID.Int64),
+				IsSeasonal: isSeasonal.Bool,
+				IsActive:   isActive.Bool,
+			}
+			if categoryName.Valid {
+				item.Dish.Category = &models.Category{ID: item.Dish.CategoryID, Name: categoryName.String}
+			}
+		}
+
+		order := &orders[index[item.OrderID]]
+		order.Items = append(order.Items, item)
+	}
+	return rows.Err()
+}
+
+// attachAdjustments 用一次查询取出这些订单的全部调整项
+func (s *pgOrders) attachAdjustments(ctx context.Context, orders []models.Order, ids []int64, index map[int]int) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, order_id, promotion_id, code, description, amount, created_at
+		FROM order_adjustments
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var adjustment models.OrderAdjustment
+		var promotionID sql.NullInt64
+		err := rows.Scan(&adjustment.ID, &adjustment.OrderID, &promotionID, &adjustment.Code,
+			&adjustment.Description, &adjustment.Amount, &adjustment.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if promotionID.Valid {
+			id := int(promotionID.Int64)
+			adjustment.PromotionID = &id
+		}
+
+		order := &orders[index[adjustment.OrderID]]
+		order.Adjustments = append(order.Adjustments, adjustment)
+	}
+	return rows.Err()
+}
+
+func (s *pgOrders) ChangeStatus(ctx context.Context, change StatusChange) (*models.Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 锁住订单行，避免并发的状态变更基于过期的当前状态
+	var ownerID sql.NullInt64
+	var current string
+	err = tx.QueryRowContext(ctx, "SELECT user_id, status FROM orders WHERE id = $1 FOR UPDATE", change.OrderID).Scan(&ownerID, &current)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if change.OwnerID != 0 && int(ownerID.Int64) != change.OwnerID {
+		return nil, ErrNotFound
+	}
+	if err := CheckTransition(current, change); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3", change.To, now(), change.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordStatus(ctx, tx, change.OrderID, current, change.To, change.ChangedBy, change.Note); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, change.OrderID)
+}
+
+func (s *pgOrders) History(ctx context.Context, orderID int) ([]models.OrderStatusChange, error) {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE id = $1)", orderID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT h.id, h.order_id, h.from_status, h.to_status, h.changed_by, COALESCE(u.username, ''), h.note, h.created_at
+		FROM order_status_history h
+		LEFT JOIN users u ON u.id = h.changed_by
+		WHERE h.order_id = $1
+		ORDER BY h.created_at, h.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.OrderStatusChange{}
+	for rows.Next() {
+		var change models.OrderStatusChange
+		var fromStatus sql.NullString
+		var changedBy sql.NullInt64
+		err := rows.Scan(&change.ID, &change.OrderID, &fromStatus, &change.ToStatus, &changedBy,
+			&change.ChangedByUsername, &change.Note, &change.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if fromStatus.Valid {
+			change.FromStatus = &fromStatus.String
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			change.ChangedBy = &id
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// CheckTransition 校验状态机以及变更请求中额外要求的当前状态
+func CheckTransition(current string, change StatusChange) error {
+	if len(change.From) > 0 {
+		allowed := false
+		for _, status := range change.From {
+			allowed = allowed || status == current
+		}
+		if !allowed {
+			return &InvalidTransitionError{From: current, To: change.To}
+		}
+	}
+	if !models.CanTransitionOrder(current, change.To) {
+		return &InvalidTransitionError{From: current, To: change.To}
+	}
+	return nil
+}
+
+// recordStatus 写入一条状态变更记录，from 为空表示订单创建，changedBy 为 0 表示系统操作
+func recordStatus(ctx context.Context, tx *sql.Tx, orderID int, from, to string, changedBy int, note string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, note, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, 0), $5, $6)
+	`, orderID, from, to, changedBy, note, now())
+	return err
+}
+
+type pgFavorites struct {
+	db *sql.DB
+}
+
+func (s *pgFavorites) Add(ctx context.Context, userID, dishID int) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM dishes WHERE id = $1 AND is_active = true)", dishID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	// 依靠 UNIQUE(user_id, dish_id) 判断重复收藏，避免先查后插的竞态
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_favorites (user_id, dish_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, dish_id) DO NOTHING
+	`, userID, dishID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *pgFavorites) Remove(ctx context.Context, userID, dishID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM user_favorites WHERE user_id = $1 AND dish_id = $2", userID, dishID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	// 删除的收藏不会出现在 user_favorites 中，记下时间使个性化推荐重新计算
+	_, err = tx.ExecContext(ctx, "UPDATE personal_recommendation_runs SET favorites_changed_at = NOW() WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *pgFavorites) List(ctx context.Context, userID, limit, offset int) ([]models.UserFavorite, int, error) {
+	var total int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_favorites uf
+		JOIN dishes d ON uf.dish_id = d.id
+		WHERE uf.user_id = $1 AND d.is_active = true
+	`, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT uf.id, uf.user_id, uf.created_at,`+dishColumns+`
+		FROM user_favorites uf
+		JOIN dishes d ON uf.dish_id = d.id
+		LEFT JOIN categories c ON d.category_id = c.id
+		WHERE uf.user_id = $1 AND d.is_active = true
+		ORDER BY uf.created_at DESC, uf.id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var favorites []models.UserFavorite
+	for rows.Next() {
+		var fav models.UserFavorite
+		dish, err := scanDish(scanPrefix{rows, []interface{}{&fav.ID, &fav.UserID, &fav.CreatedAt}})
+		if err != nil {
+			return nil, 0, err
+		}
+		fav.DishID = dish.ID
+		fav.Dish = &dish
+		favorites = append(favorites, fav)
+	}
+	return favorites, total, rows.Err()
+}
+
+// scanPrefix 在 scanDish 的目标前插入额外的列
+type scanPrefix struct {
+	row    rowScanner
+	prefix []interface{}
+}
+
+func (s scanPrefix) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(s.prefix, dest...)...)
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"food-ordering/models"
+)
+
+type pgPayments struct {
+	db *sql.DB
+}
+
+const paymentColumns = "id, order_id, provider, intent_id, client_secret, status, amount, refunded_amount, created_at, updated_at"
+
+func scanPayment(row rowScanner) (*models.Payment, error) {
+	var p models.Payment
+	err := row.Scan(&p.ID, &p.OrderID, &p.Provider, &p.IntentID, &p.ClientSecret, &p.Status,
+		&p.Amount, &p.RefundedAmount, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &p, nil
+}
+
+func (s *pgPayments) Create(ctx context.Context, payment models.Payment) (*models.Payment, error) {
+	at := now()
+	row := s.db.QueryRowContext(ctx, `
+		INSERT INTO payments (order_id, provider, intent_id, client_secret, status, amount, refunded_amount, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $7)
+		RETURNING `+paymentColumns,
+		payment.OrderID, payment.Provider, payment.IntentID, payment.ClientSecret, models.PaymentStatusPending, payment.Amount, at)
+	p, err := scanPayment(row)
+	if err != nil {
+		return nil, conflict(err)
+	}
+	return p, nil
+}
+
+func (s *pgPayments) Latest(ctx context.Context, orderID int) (*models.Payment, error) {
+	p, err := scanPayment(s.db.QueryRowContext(ctx,
+		"SELECT "+paymentColumns+" FROM payments WHERE order_id = $1 ORDER BY id DESC LIMIT 1", orderID))
+	if err != nil {
+		return nil, err
+	}
+	return p, s.attachRefunds(ctx, p)
+}
+
+func (s *pgPayments) GetByIntent(ctx context.Context, provider, intentID string) (*models.Payment, error) {
+	p, err := scanPayment(s.db.QueryRowContext(ctx,
+		"SELECT "+paymentColumns+" FROM payments WHERE provider = $1 AND intent_id = $2", provider, intentID))
+	if err != nil {
+		return nil, err
+	}
+	return p, s.attachRefunds(ctx, p)
+}
+
+func (s *pgPayments) attachRefunds(ctx context.Context, p *models.Payment) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, payment_id, provider_refund_id, amount, reason, created_by, created_at
+		FROM payment_refunds
+		WHERE payment_id = $1
+		ORDER BY created_at, id
+	`, p.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var refund models.PaymentRefund
+		var createdBy sql.NullInt64
+		err := rows.Scan(&refund.ID, &refund.PaymentID, &refund.ProviderRefundID, &refund.Amount, &refund.Reason, &createdBy, &refund.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			refund.CreatedBy = &id
+		}
+		p.Refunds = append(p.Refunds, refund)
+	}
+	return rows.Err()
+}
+
+func (s *pgPayments) Transition(ctx context.Context, id int, to string) (*models.Payment, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 锁住支付行，回调和接单、取消可能同时修改同一笔支付
+	var current string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM payments WHERE id = $1 FOR UPDATE", id).Scan(&current); err != nil {
+		return nil, notFound(err)
+	}
+	if !models.CanTransitionPayment(current, to) {
+		return nil, &PaymentTransitionError{From: current, To: to}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE payments SET status = $1, updated_at = $2 WHERE id = $3", to, now(), id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, id)
+}
+
+func (s *pgPayments) Refund(ctx context.Context, id int, refund models.PaymentRefund) (*models.Payment, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current models.Payment
+	err = tx.QueryRowContext(ctx, "SELECT status, amount, refunded_amount FROM payments WHERE id = $1 FOR UPDATE", id).
+		Scan(&current.Status, &current.Amount, &current.RefundedAmount)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	to, err := refundStatus(current, refund)
+	if err != nil {
+		return nil, err
+	}
+
+	at := now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE payments SET status = $1, refunded_amount = refunded_amount + $2, updated_at = $3 WHERE id = $4
+	`, to, refund.Amount, at, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO payment_refunds (payment_id, provider_refund_id, amount, reason, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, id, refund.ProviderRefundID, refund.Amount, refund.Reason, refund.CreatedBy, at)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, id)
+}
+
+func (s *pgPayments) RecordEvent(ctx context.Context, event models.PaymentEvent) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO payment_events (provider, event_id, type, intent_id, payload, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, event.Provider, event.EventID, event.Type, event.IntentID, string(event.Payload), now())
+	return conflict(err)
+}
+
+func (s *pgPayments) get(ctx context.Context, id int) (*models.Payment, error) {
+	p, err := scanPayment(s.db.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+	return p, s.attachRefunds(ctx, p)
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/personalize"
+
+	"github.com/lib/pq"
+)
+
+type pgPersonalization struct {
+	db *sql.DB
+}
+
+func (s *pgPersonalization) StaleUsers(ctx context.Context, refreshBefore time.Time, limit int) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.id
+		FROM users u
+		LEFT JOIN personal_recommendation_runs r ON r.user_id = u.id
+		WHERE (r.computed_at IS NULL AND (
+				EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id)
+				OR EXISTS (SELECT 1 FROM user_favorites f WHERE f.user_id = u.id)))
+			OR r.computed_at < $1
+			OR EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.updated_at > r.computed_at)
+			OR EXISTS (SELECT 1 FROM user_favorites f WHERE f.user_id = u.id AND f.created_at > r.computed_at)
+			OR r.favorites_changed_at > r.computed_at
+		ORDER BY r.computed_at NULLS FIRST, u.id
+		LIMIT $2
+	`, refreshBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *pgPersonalization) History(ctx context.Context, userID int) (*personalize.History, error) {
+	history := &personalize.History{}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT oi.dish_id, COALESCE(d.category_id, 0), oi.quantity, COALESCE(o.requested_for, o.created_at)
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN dishes d ON d.id = oi.dish_id
+		WHERE o.user_id = $1 AND o.status <> $2
+		ORDER BY o.id, oi.id
+	`, userID, models.OrderStatusCancelled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var purchase personalize.Purchase
+		if err := rows.Scan(&purchase.DishID, &purchase.CategoryID, &purchase.Quantity, &purchase.EatenAt); err != nil {
+			return nil, err
+		}
+		history.Purchases = append(history.Purchases, purchase)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT f.dish_id, COALESCE(d.category_id, 0)
+		FROM user_favorites f
+		JOIN dishes d ON d.id = f.dish_id
+		WHERE f.user_id = $1
+		ORDER BY f.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var favorite personalize.Favorite
+		if err := rows.Scan(&favorite.DishID, &favorite.CategoryID); err != nil {
+			return nil, err
+		}
+		history.Favorites = append(history.Favorites, favorite)
+	}
+	return history, rows.Err()
+}
+
+func (s *pgPersonalization) Save(ctx context.Context, userID int, dishes []models.PersonalDish, computedAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM personal_recommendations WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, dish := range dishes {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO personal_recommendations (user_id, dish_id, score, reasons)
+			VALUES ($1, $2, $3, $4)
+		`, userID, dish.Dish.ID, dish.Score, pq.Array(dish.Reasons))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO personal_recommendation_runs (user_id, computed_at)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET computed_at = EXCLUDED.computed_at
+	`, userID, computedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *pgPersonalization) Get(ctx context.Context, userID, limit int) (*models.PersonalRecommendations, error) {
+	result := &models.PersonalRecommendations{Dishes: []models.PersonalDish{}}
+	var computedAt time.Time
+	err := s.db.QueryRowContext(ctx, "SELECT computed_at FROM personal_recommendation_runs WHERE user_id = $1", userID).Scan(&computedAt)
+	if err == sql.ErrNoRows {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.ComputedAt = &computedAt
+
+	rows, err := s.db.QueryContext(ctx, "SELECT pr.score, pr.reasons,"+dishColumns+dishFrom+`
+		JOIN personal_recommendations pr ON pr.dish_id = d.id
+		WHERE pr.user_id = $1 AND d.is_active = true
+		ORDER BY pr.score DESC, d.id
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var personal models.PersonalDish
+		dish, err := scanDish(scanPrefix{rows, []interface{}{&personal.Score, pq.Array(&personal.Reasons)}})
+		if err != nil {
+			return nil, err
+		}
+		personal.Dish = dish
+		result.Dishes = append(result.Dishes, personal)
+	}
+	return result, rows.Err()
+}
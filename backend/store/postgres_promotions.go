@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"food-ordering/models"
+)
+
+type pgPromotions struct {
+	db *sql.DB
+}
+
+const promotionColumns = `id, name, description, COALESCE(code, ''), type, percent_off, amount_off, buy_quantity,
+	dish_id, category_id, min_spend, usage_limit_per_user, starts_at, ends_at, is_active, created_at, updated_at`
+
+func scanPromotion(row rowScanner) (models.Promotion, error) {
+	var p models.Promotion
+	var dishID, categoryID sql.NullInt64
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Code, &p.Type, &p.PercentOff, &p.AmountOff, &p.BuyQuantity,
+		&dishID, &categoryID, &p.MinSpend, &p.UsageLimitPerUser, &startsAt, &endsAt, &p.IsActive, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return p, err
+	}
+	if dishID.Valid {
+		id := int(dishID.Int64)
+		p.DishID = &id
+	}
+	if categoryID.Valid {
+		id := int(categoryID.Int64)
+		p.CategoryID = &id
+	}
+	if startsAt.Valid {
+		p.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		p.EndsAt = &endsAt.Time
+	}
+	return p, nil
+}
+
+// promotionArgs 按 INSERT/UPDATE 语句中 $1-$14 的顺序排列请求的字段，空的优惠券代码写为 NULL
+func promotionArgs(req models.PromotionRequest) []interface{} {
+	isActive := req.IsActive == nil || *req.IsActive
+	return []interface{}{
+		req.Name, req.Description, sql.NullString{String: req.Code, Valid: req.Code != ""}, req.Type,
+		req.PercentOff, req.AmountOff, req.BuyQuantity, req.DishID, req.CategoryID, req.MinSpend,
+		req.UsageLimitPerUser, utcOrNil(req.StartsAt), utcOrNil(req.EndsAt), isActive,
+	}
+}
+
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func (s *pgPromotions) List(ctx context.Context, limit, offset int) ([]models.Promotion, int, error) {
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM promotions").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+promotionColumns+" FROM promotions ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var promotions []models.Promotion
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		promotions = append(promotions, p)
+	}
+	return promotions, total, rows.Err()
+}
+
+func (s *pgPromotions) Get(ctx context.Context, id int) (*models.Promotion, error) {
+	p, err := scanPromotion(s.db.QueryRowContext(ctx, "SELECT "+promotionColumns+" FROM promotions WHERE id = $1", id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &p, nil
+}
+
+func (s *pgPromotions) Create(ctx context.Context, req models.PromotionRequest) (*models.Promotion, error) {
+	p, err := scanPromotion(s.db.QueryRowContext(ctx, `
+		INSERT INTO promotions (name, description, code, type, percent_off, amount_off, buy_quantity,
+			dish_id, category_id, min_spend, usage_limit_per_user, starts_at, ends_at, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $15)
+		RETURNING `+promotionColumns, append(promotionArgs(req), now())...))
+	if err != nil {
+		return nil, conflict(err)
+	}
+	return &p, nil
+}
+
+func (s *pgPromotions) Update(ctx context.Context, id int, req models.PromotionRequest) (*models.Promotion, error) {
+	p, err := scanPromotion(s.db.QueryRowContext(ctx, `
+		UPDATE promotions SET name = $1, description = $2, code = $3, type = $4, percent_off = $5, amount_off = $6,
+			buy_quantity = $7, dish_id = $8, category_id = $9, min_spend = $10, usage_limit_per_user = $11,
+			starts_at = $12, ends_at = $13, is_active = $14, updated_at = $15
+		WHERE id = $16
+		RETURNING `+promotionColumns, append(promotionArgs(req), now(), id)...))
+	if err != nil {
+		return nil, conflict(notFound(err))
+	}
+	return &p, nil
+}
+
+func (s *pgPromotions) Delete(ctx context.Context, id int) error {
+	var inUse bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM order_adjustments WHERE promotion_id = $1)", id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrInUse
+	}
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM promotions WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// applicablePromotions 在下单事务中取出当前有效的自动优惠和填写的优惠券，并剔除用户已用完次数的优惠
+// 有使用次数限制时锁住用户行，同一用户的并发下单依次计数
+func applicablePromotions(ctx context.Context, tx *sql.Tx, userID int, code string, at time.Time) ([]models.Promotion, *models.Promotion, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+promotionColumns+` FROM promotions
+		WHERE code IS NULL AND is_active = true
+		  AND (starts_at IS NULL OR starts_at <= $1) AND (ends_at IS NULL OR ends_at > $1)
+		ORDER BY id
+	`, at)
+	if err != nil {
+		return nil, nil, err
+	}
+	var automatic []models.Promotion
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		automatic = append(automatic, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var coupon *models.Promotion
+	if code != "" {
+		p, err := scanPromotion(tx.QueryRowContext(ctx, "SELECT "+promotionColumns+" FROM promotions WHERE code = $1", code))
+		if err == sql.ErrNoRows {
+			return nil, nil, &CouponError{Code: code, Reason: "not found"}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		coupon = &p
+	}
+
+	limited := coupon != nil && coupon.UsageLimitPerUser > 0
+	for _, p := range automatic {
+		limited = limited || p.UsageLimitPerUser > 0
+	}
+	if !limited {
+		return automatic, coupon, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return nil, nil, err
+	}
+	used := func(p models.Promotion) (bool, error) {
+		if p.UsageLimitPerUser == 0 {
+			return false, nil
+		}
+		var count int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(DISTINCT a.order_id)
+			FROM order_adjustments a
+			JOIN orders o ON o.id = a.order_id
+			WHERE a.promotion_id = $1 AND o.user_id = $2 AND o.status <> 'cancelled'
+		`, p.ID, userID).Scan(&count)
+		return count >= p.UsageLimitPerUser, err
+	}
+
+	available := automatic[:0]
+	for _, p := range automatic {
+		exhausted, err := used(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !exhausted {
+			available = append(available, p)
+		}
+	}
+	if coupon != nil {
+		exhausted, err := used(*coupon)
+		if err != nil {
+			return nil, nil, err
+		}
+		if exhausted {
+			return nil, nil, &CouponError{Code: code, Reason: "usage limit reached"}
+		}
+	}
+	return available, coupon, nil
+}
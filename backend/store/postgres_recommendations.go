@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"food-ordering/models"
+
+	"github.com/lib/pq"
+)
+
+type pgRecommendations struct {
+	db *sql.DB
+}
+
+const recommendationColumns = "id, name, COALESCE(description, ''), type, meat_count, vegetable_count, is_active, created_at, updated_at"
+
+func scanRecommendation(row rowScanner) (models.Recommendation, error) {
+	var rec models.Recommendation
+	err := row.Scan(&rec.ID, &rec.Name, &rec.Description, &rec.Type, &rec.MeatCount, &rec.VegetableCount,
+		&rec.IsActive, &rec.CreatedAt, &rec.UpdatedAt)
+	return rec, err
+}
+
+func (s *pgRecommendations) List(ctx context.Context, activeOnly bool) ([]models.Recommendation, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+recommendationColumns+`
+		FROM recommendations
+		WHERE is_active = true OR NOT $1
+		ORDER BY created_at, id
+	`, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recommendations []models.Recommendation
+	for rows.Next() {
+		rec, err := scanRecommendation(rows)
+		if err != nil {
+			return nil, err
+		}
+		recommendations = append(recommendations, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.loadDishes(ctx, recommendations); err != nil {
+		return nil, err
+	}
+	return recommendations, nil
+}
+
+func (s *pgRecommendations) Get(ctx context.Context, id int) (*models.Recommendation, error) {
+	rec, err := scanRecommendation(s.db.QueryRowContext(ctx, "SELECT "+recommendationColumns+" FROM recommendations WHERE id = $1", id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	recommendations := []models.Recommendation{rec}
+	if err := s.loadDishes(ctx, recommendations); err != nil {
+		return nil, err
+	}
+	return &recommendations[0], nil
+}
+
+func (s *pgRecommendations) Create(ctx context.Context, req models.RecommendationRequest) (*models.Recommendation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO recommendations (name, description, type, meat_count, vegetable_count, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING id
+	`, req.Name, req.Description, req.Type, req.MeatCount, req.VegetableCount, req.IsActive == nil || *req.IsActive, now()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	if err := replaceRecommendationDishes(ctx, tx, id, req.DishIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *pgRecommendations) Update(ctx context.Context, id int, req models.RecommendationRequest) (*models.Recommendation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE recommendations SET name = $1, description = $2, type = $3, meat_count = $4, vegetable_count = $5,
+			is_active = $6, updated_at = $7
+		WHERE id = $8
+	`, req.Name, req.Description, req.Type, req.MeatCount, req.VegetableCount, req.IsActive == nil || *req.IsActive, now(), id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	if err := replaceRecommendationDishes(ctx, tx, id, req.DishIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *pgRecommendations) SetDishes(ctx context.Context, id int, dishIDs []int) (*models.Recommendation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE recommendations SET updated_at = $1 WHERE id = $2", now(), id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	if err := replaceRecommendationDishes(ctx, tx, id, dishIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *pgRecommendations) SetActive(ctx context.Context, id int, active bool) (*models.Recommendation, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE recommendations SET is_active = $1, updated_at = $2 WHERE id = $3", active, now(), id)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *pgRecommendations) Delete(ctx context.Context, id int) error {
+	// recommendation_dishes 随之级联删除
+	result, err := s.db.ExecContext(ctx, "DELETE FROM recommendations WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// loadDishes 按加入顺序填充固定菜单的菜品
+func (s *pgRecommendations) loadDishes(ctx context.Context, recommendations []models.Recommendation) error {
+	if len(recommendations) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(recommendations))
+	ids := make([]int, len(recommendations))
+	for i, rec := range recommendations {
+		index[rec.ID] = i
+		ids[i] = rec.ID
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT rd.recommendation_id,"+dishColumns+dishFrom+`
+		JOIN recommendation_dishes rd ON rd.dish_id = d.id
+		WHERE rd.recommendation_id = ANY($1)
+		ORDER BY rd.recommendation_id, rd.id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var recommendationID int
+		dish, err := scanDish(scanPrefix{rows, []interface{}{&recommendationID}})
+		if err != nil {
+			return err
+		}
+		rec := &recommendations[index[recommendationID]]
+		rec.Dishes = append(rec.Dishes, dish)
+	}
+	return rows.Err()
+}
+
+// replaceRecommendationDishes 用 dishIDs 替换推荐配置的固定菜单，保留给定的顺序
+func replaceRecommendationDishes(ctx context.Context, tx *sql.Tx, id int, dishIDs []int) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recommendation_dishes WHERE recommendation_id = $1", id); err != nil {
+		return err
+	}
+	for _, dishID := range dishIDs {
+		_, err := tx.ExecContext(ctx, "INSERT INTO recommendation_dishes (recommendation_id, dish_id) VALUES ($1, $2)", id, dishID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/related"
+
+	"github.com/lib/pq"
+)
+
+type pgRelated struct {
+	db *sql.DB
+}
+
+func (s *pgRelated) Baskets(ctx context.Context, since time.Time) ([][]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT array_agg(DISTINCT oi.dish_id)
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		WHERE o.created_at >= $1 AND o.status <> $2
+		GROUP BY o.id
+		ORDER BY o.id
+	`, since, models.OrderStatusCancelled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var baskets [][]int
+	for rows.Next() {
+		var ids pq.Int64Array
+		if err := rows.Scan(&ids); err != nil {
+			return nil, err
+		}
+		basket := make([]int, len(ids))
+		for i, id := range ids {
+			basket[i] = int(id)
+		}
+		baskets = append(baskets, basket)
+	}
+	return baskets, rows.Err()
+}
+
+func (s *pgRelated) Replace(ctx context.Context, stats *related.Stats) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dish_similarities"); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dish_order_counts"); err != nil {
+		return err
+	}
+	// 统计期间被删除的菜品跳过，避免外键错误
+	for _, pair := range stats.Pairs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO dish_similarities (dish_id, related_dish_id, co_orders, score)
+			SELECT $1, $2, $3, $4
+			WHERE EXISTS (SELECT 1 FROM dishes WHERE id = $1) AND EXISTS (SELECT 1 FROM dishes WHERE id = $2)
+		`, pair.DishID, pair.RelatedDishID, pair.CoOrders, pair.Score)
+		if err != nil {
+			return err
+		}
+	}
+	for dishID, orders := range stats.OrderCounts {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO dish_order_counts (dish_id, orders)
+			SELECT $1, $2
+			WHERE EXISTS (SELECT 1 FROM dishes WHERE id = $1)
+		`, dishID, orders)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *pgRelated) Related(ctx context.Context, dishID, limit int) ([]models.RelatedDish, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT ds.score, ds.co_orders,"+dishColumns+dishFrom+`
+		JOIN dish_similarities ds ON ds.related_dish_id = d.id
+		WHERE ds.dish_id = $1 AND d.is_active = true
+		ORDER BY ds.score DESC, ds.co_orders DESC, d.id
+		LIMIT $2
+	`, dishID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dishes := []models.RelatedDish{}
+	for rows.Next() {
+		var rel models.RelatedDish
+		dish, err := scanDish(scanPrefix{rows, []interface{}{&rel.Score, &rel.CoOrders}})
+		if err != nil {
+			return nil, err
+		}
+		rel.Dish = dish
+		dishes = append(dishes, rel)
+	}
+	return dishes, rows.Err()
+}
+
+func (s *pgRelated) OrderCounts(ctx context.Context, dishIDs []int) (map[int]int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT dish_id, orders FROM dish_order_counts WHERE dish_id = ANY($1)", pq.Array(dishIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var dishID, orders int
+		if err := rows.Scan(&dishID, &orders); err != nil {
+			return nil, err
+		}
+		counts[dishID] = orders
+	}
+	return counts, rows.Err()
+}
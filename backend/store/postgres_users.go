@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"food-ordering/models"
+)
+
+type pgUsers struct {
+	db *sql.DB
+}
+
+const userColumns = "id, username, COALESCE(email, ''), role, status, must_change_password, totp_enabled, created_at, updated_at"
+
+func userDest(user *models.User) []interface{} {
+	return []interface{}{
+		&user.ID, &user.Username, &user.Email, &user.Role, &user.Status,
+		&user.MustChangePassword, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt,
+	}
+}
+
+func (s *pgUsers) Get(ctx context.Context, id int) (*models.User, error) {
+	var user models.User
+	err := s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id).Scan(userDest(&user)...)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *pgUsers) GetByUsername(ctx context.Context, username string) (*models.User, string, error) {
+	var user models.User
+	var passwordHash string
+	err := s.db.QueryRowContext(ctx, "SELECT "+userColumns+", password_hash FROM users WHERE username = $1", username).
+		Scan(append(userDest(&user), &passwordHash)...)
+	if err != nil {
+		return nil, "", notFound(err)
+	}
+	return &user, passwordHash, nil
+}
+
+func (s *pgUsers) List(ctx context.Context, search string, limit, offset int) ([]models.User, int, error) {
+	where := ""
+	args := []interface{}{}
+	if search != "" {
+		where = " WHERE username ILIKE $1 OR email ILIKE $1"
+		args = append(args, "%"+search+"%")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + userColumns + " FROM users" + where + " ORDER BY created_at DESC, id DESC LIMIT $" +
+		strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2)
+	rows, err := s.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(userDest(&user)...); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
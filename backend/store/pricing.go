@@ -0,0 +1,24 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/promotion"
+)
+
+// priceOrder 检查优惠券是否可用并计算订单的调整项，Postgres 和内存实现共用
+func priceOrder(automatic []models.Promotion, coupon *models.Promotion, lines []promotion.Line, at time.Time) ([]models.OrderAdjustment, error) {
+	if coupon != nil {
+		if err := promotion.Available(*coupon, at); err != nil {
+			return nil, &CouponError{Code: coupon.Code, Reason: err.Error()}
+		}
+	}
+	adjustments, err := promotion.Apply(automatic, coupon, lines)
+	var ineligible *promotion.IneligibleError
+	if errors.As(err, &ineligible) {
+		return nil, &CouponError{Code: coupon.Code, Reason: ineligible.Reason}
+	}
+	return adjustments, err
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/schedule"
+)
+
+// bookSlot 按预约设置校验订单的预约时间，Postgres 和内存实现共用
+// 只在请求填写了 requested_for 或 meal_slot 时调用，容量由调用方在事务中检查
+func bookSlot(values map[string]string, req models.CreateOrderRequest, at time.Time) (*schedule.Booking, error) {
+	if req.RequestedFor == nil {
+		return nil, &ScheduleError{Reason: "requested_for is required when meal_slot is set"}
+	}
+	config, err := schedule.Load(values)
+	if err != nil {
+		return nil, err
+	}
+	booking, err := config.Book(*req.RequestedFor, req.MealSlot, at)
+	var invalid *schedule.Error
+	if errors.As(err, &invalid) {
+		return nil, &ScheduleError{Reason: invalid.Reason}
+	}
+	return booking, err
+}
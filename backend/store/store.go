@@ -0,0 +1,327 @@
+// Package store 封装菜品、分类、标签、订单、优惠、购物车、支付、推荐、个性化推荐、相关菜品、收藏、配置和用户的数据访问
+//
+// 处理器只依赖这里的接口：生产环境使用 NewPostgres，测试时使用 NewMemory，
+// 不需要数据库就能用 httptest 跑处理器。
+// 登录、令牌、两步验证、单点登录等需要跨表事务的账号流程仍直接使用 *sql.DB，
+// 单点登录发起到回调之间的 state 保存在 LoginStates 中。
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"food-ordering/models"
+	"food-ordering/personalize"
+	"food-ordering/related"
+)
+
+var (
+	// ErrNotFound 记录不存在
+	ErrNotFound = errors.New("store: not found")
+	// ErrConflict 记录已存在
+	ErrConflict = errors.New("store: already exists")
+	// ErrInUse 记录仍被引用，不能删除
+	ErrInUse = errors.New("store: in use")
+	// ErrCartEmpty 结算时购物车为空
+	ErrCartEmpty = errors.New("store: cart is empty")
+)
+
+// DishUnavailableError 下单时菜品不存在或已下架
+type DishUnavailableError struct {
+	DishID int
+}
+
+func (e *DishUnavailableError) Error() string {
+	return fmt.Sprintf("Dish %d not found", e.DishID)
+}
+
+// InvalidQuantityError 下单时菜品数量小于 1
+type InvalidQuantityError struct {
+	DishID   int
+	Quantity int
+}
+
+func (e *InvalidQuantityError) Error() string {
+	return fmt.Sprintf("Invalid quantity %d for dish %d", e.Quantity, e.DishID)
+}
+
+// CouponError 下单时填写的优惠券不能使用
+type CouponError struct {
+	Code   string
+	Reason string
+}
+
+func (e *CouponError) Error() string {
+	return fmt.Sprintf("Coupon %s cannot be used: %s", e.Code, e.Reason)
+}
+
+// ScheduleError 预约时间不可用
+type ScheduleError struct {
+	Reason string
+}
+
+func (e *ScheduleError) Error() string {
+	return fmt.Sprintf("Cannot schedule order: %s", e.Reason)
+}
+
+// SlotFullError 预约的用餐时段已约满
+type SlotFullError struct {
+	Slot string
+	Date string
+}
+
+func (e *SlotFullError) Error() string {
+	return fmt.Sprintf("Meal slot %s on %s is fully booked", e.Slot, e.Date)
+}
+
+// InvalidTransitionError 订单状态不允许这样流转
+type InvalidTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("Cannot change order status from %s to %s", e.From, e.To)
+}
+
+// PaymentTransitionError 支付状态不允许这样流转
+type PaymentTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *PaymentTransitionError) Error() string {
+	return fmt.Sprintf("Cannot change payment status from %s to %s", e.From, e.To)
+}
+
+// StatusChange 一次订单状态变更
+type StatusChange struct {
+	OrderID   int
+	To        string
+	ChangedBy int
+	Note      string
+	OwnerID   int      // 非 0 时只能修改该用户自己的订单，其他用户的订单视为不存在
+	From      []string // 非空时还要求当前状态在其中，用于比状态机更严格的场景
+}
+
+// 订单列表可用的排序字段
+const (
+	OrderSortCreatedAt   = "created_at"
+	OrderSortTotalAmount = "total_amount"
+	OrderSortStatus      = "status"
+)
+
+// OrderFilter 订单列表的筛选、排序和分页条件，零值表示不限
+type OrderFilter struct {
+	UserID int
+	Status string
+	DishID int        // 只返回包含该菜品的订单
+	From   *time.Time // 下单时间 >= From
+	To     *time.Time // 下单时间 < To
+	Sort   string     // 默认按下单时间
+	Asc    bool       // 默认降序
+	Limit  int
+	Offset int
+}
+
+// DishFilter 菜品列表的筛选条件，只返回上架的菜品
+type DishFilter struct {
+	CategoryID   int
+	Search       string   // 按名称或描述模糊匹配
+	Tags         []string // 同时带有这些标签
+	SeasonalOnly bool
+	Limit        int
+	Offset       int
+}
+
+type DishStore interface {
+	// List 返回当前页的菜品和符合条件的总数
+	List(ctx context.Context, filter DishFilter) ([]models.Dish, int, error)
+	Get(ctx context.Context, id int) (*models.Dish, error)
+	// Create 不存在的标签会被忽略，处理器需先用 TagStore.Missing 校验
+	Create(ctx context.Context, req models.CreateDishRequest) (*models.Dish, error)
+	// Update 只更新请求中非 nil 的字段，Tags 非 nil 时替换全部标签
+	Update(ctx context.Context, id int, req models.UpdateDishRequest) (*models.Dish, error)
+	// Deactivate 软删除：下架菜品，保留历史订单引用
+	Deactivate(ctx context.Context, id int) error
+	// InCategories 按 ID 顺序返回这些分类下全部上架的菜品
+	InCategories(ctx context.Context, categoryIDs []int) ([]models.Dish, error)
+	// WithAnyTag 按 ID 顺序返回带有其中任一标签的全部上架菜品
+	WithAnyTag(ctx context.Context, tags []string) ([]models.Dish, error)
+}
+
+type TagStore interface {
+	List(ctx context.Context) ([]models.Tag, error)
+	Get(ctx context.Context, id int) (*models.Tag, error)
+	// Create slug 已存在时返回 ErrConflict
+	Create(ctx context.Context, req models.CreateTagRequest) (*models.Tag, error)
+	Update(ctx context.Context, id int, req models.UpdateTagRequest) (*models.Tag, error)
+	// Delete 同时去掉菜品上的这个标签
+	Delete(ctx context.Context, id int) error
+	// Missing 返回 slugs 中不存在的标签，按给定的顺序
+	Missing(ctx context.Context, slugs []string) ([]string, error)
+}
+
+type CategoryStore interface {
+	List(ctx context.Context) ([]models.Category, error)
+	Get(ctx context.Context, id int) (*models.Category, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	Create(ctx context.Context, req models.CreateCategoryRequest) (*models.Category, error)
+	Update(ctx context.Context, id int, req models.UpdateCategoryRequest) (*models.Category, error)
+	// Delete 分类下仍有上架菜品时返回 ErrInUse
+	Delete(ctx context.Context, id int) error
+}
+
+type OrderStore interface {
+	// Create 按菜品当前价格创建订单并应用优惠，菜品不可用时返回 *DishUnavailableError，数量小于 1 时返回 *InvalidQuantityError，
+	// 优惠券不能使用时返回 *CouponError；预约时间不可用时返回 *ScheduleError，时段约满时返回 *SlotFullError
+	Create(ctx context.Context, userID int, req models.CreateOrderRequest) (*models.Order, error)
+	// Get 返回订单及其明细
+	Get(ctx context.Context, id int) (*models.Order, error)
+	// List 返回当前页的订单（含明细）和符合条件的总数
+	List(ctx context.Context, filter OrderFilter) ([]models.Order, int, error)
+	// ChangeStatus 按状态机修改订单状态并记录历史，不允许的流转返回 *InvalidTransitionError
+	ChangeStatus(ctx context.Context, change StatusChange) (*models.Order, error)
+	// History 按时间顺序返回订单的状态变更记录
+	History(ctx context.Context, orderID int) ([]models.OrderStatusChange, error)
+	// Scheduled 按预约时间顺序返回 requested_for 在 [from, to) 内且未取消的预约订单（含明细）
+	Scheduled(ctx context.Context, from, to time.Time) ([]models.Order, error)
+}
+
+type PromotionStore interface {
+	List(ctx context.Context, limit, offset int) ([]models.Promotion, int, error)
+	Get(ctx context.Context, id int) (*models.Promotion, error)
+	// Create 优惠券代码已存在时返回 ErrConflict
+	Create(ctx context.Context, req models.PromotionRequest) (*models.Promotion, error)
+	Update(ctx context.Context, id int, req models.PromotionRequest) (*models.Promotion, error)
+	// Delete 已被订单使用的优惠返回 ErrInUse，这种情况应改为停用
+	Delete(ctx context.Context, id int) error
+}
+
+type CartStore interface {
+	// Get 返回用户的购物车，菜品下架或价格变动时在明细和 Warnings 中提示
+	Get(ctx context.Context, userID int) (*models.Cart, error)
+	// AddItem 菜品不存在或已下架时返回 ErrNotFound；菜品已在购物车中时累加数量，
+	// 最多 models.MaxCartItemQuantity 份，备注非空时替换原备注
+	AddItem(ctx context.Context, userID int, req models.AddCartItemRequest) (*models.Cart, error)
+	// UpdateItem 只修改请求中非 nil 的字段，菜品不在购物车中时返回 ErrNotFound
+	UpdateItem(ctx context.Context, userID, dishID int, req models.UpdateCartItemRequest) (*models.Cart, error)
+	// RemoveItem 菜品不在购物车中时返回 ErrNotFound
+	RemoveItem(ctx context.Context, userID, dishID int) (*models.Cart, error)
+	Clear(ctx context.Context, userID int) error
+	// Checkout 在一个事务中用购物车下单并清空购物车，校验和计价与 OrderStore.Create 相同；
+	// 购物车为空时返回 ErrCartEmpty
+	Checkout(ctx context.Context, userID int, req models.CheckoutRequest) (*models.Order, error)
+	// ExpireBefore 删除最后修改时间早于 cutoff 的购物车，返回删除的数量
+	ExpireBefore(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+type PaymentStore interface {
+	// Create 订单已有未失败、未撤销的支付时返回 ErrConflict
+	Create(ctx context.Context, payment models.Payment) (*models.Payment, error)
+	// Latest 返回订单最近一次支付及其退款记录，没有支付时返回 ErrNotFound
+	Latest(ctx context.Context, orderID int) (*models.Payment, error)
+	// GetByIntent 按支付渠道和支付意图查找
+	GetByIntent(ctx context.Context, provider, intentID string) (*models.Payment, error)
+	// Transition 按支付状态机修改状态，不允许的流转返回 *PaymentTransitionError
+	Transition(ctx context.Context, id int, to string) (*models.Payment, error)
+	// Refund 记录一笔退款并累加已退金额，退完全部金额时状态变为 refunded，否则为 partially_refunded；
+	// 支付未扣款时返回 *PaymentTransitionError，退款金额超过剩余金额时返回 ErrConflict
+	Refund(ctx context.Context, id int, refund models.PaymentRefund) (*models.Payment, error)
+	// RecordEvent 保存渠道的回调事件，同一事件已保存过时返回 ErrConflict
+	RecordEvent(ctx context.Context, event models.PaymentEvent) error
+}
+
+type RecommendationStore interface {
+	// List 按创建时间返回推荐配置及固定菜单的菜品，activeOnly 为 true 时只返回启用的
+	List(ctx context.Context, activeOnly bool) ([]models.Recommendation, error)
+	Get(ctx context.Context, id int) (*models.Recommendation, error)
+	// Create 菜品按 DishIDs 的顺序保存，菜品是否符合配置由调用方校验
+	Create(ctx context.Context, req models.RecommendationRequest) (*models.Recommendation, error)
+	// Update 整体替换推荐配置和固定菜单的菜品
+	Update(ctx context.Context, id int, req models.RecommendationRequest) (*models.Recommendation, error)
+	// SetDishes 只替换固定菜单的菜品
+	SetDishes(ctx context.Context, id int, dishIDs []int) (*models.Recommendation, error)
+	SetActive(ctx context.Context, id int, active bool) (*models.Recommendation, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type PersonalizationStore interface {
+	// StaleUsers 返回需要重新计算个性化推荐的用户：上次计算后有新的订单、订单状态变化、新的收藏或取消了收藏，
+	// 或上次计算早于 refreshBefore（让时间衰减生效）；从未计算过的用户优先
+	StaleUsers(ctx context.Context, refreshBefore time.Time, limit int) ([]int, error)
+	// History 返回用户未取消订单中的菜品和收藏
+	History(ctx context.Context, userID int) (*personalize.History, error)
+	// Save 替换用户的个性化推荐，并记录计算时间 computedAt
+	Save(ctx context.Context, userID int, dishes []models.PersonalDish, computedAt time.Time) error
+	// Get 按得分返回用户的个性化推荐，只包含仍上架的菜品
+	Get(ctx context.Context, userID, limit int) (*models.PersonalRecommendations, error)
+}
+
+type RelatedStore interface {
+	// Baskets 返回 since 之后下单且未取消的订单中各自包含的菜品 ID
+	Baskets(ctx context.Context, since time.Time) ([][]int, error)
+	// Replace 用新的统计结果整体替换菜品相似度和点单数
+	Replace(ctx context.Context, stats *related.Stats) error
+	// Related 按相似度返回经常和这道菜一起点的上架菜品
+	Related(ctx context.Context, dishID, limit int) ([]models.RelatedDish, error)
+	// OrderCounts 返回这些菜品在统计中的点单数，没有点过的菜品不在结果中
+	OrderCounts(ctx context.Context, dishIDs []int) (map[int]int, error)
+}
+
+type FavoriteStore interface {
+	// Add 菜品不存在或已下架时返回 ErrNotFound，已收藏时返回 ErrConflict
+	Add(ctx context.Context, userID, dishID int) error
+	Remove(ctx context.Context, userID, dishID int) error
+	// List 只包含仍上架的菜品
+	List(ctx context.Context, userID, limit, offset int) ([]models.UserFavorite, int, error)
+}
+
+type ConfigStore interface {
+	List(ctx context.Context) ([]models.SystemConfig, error)
+	Get(ctx context.Context, key string) (string, error)
+	// Update 在一个事务中更新多个配置项，不存在的配置项忽略
+	Update(ctx context.Context, values map[string]string) error
+}
+
+type UserStore interface {
+	Get(ctx context.Context, id int) (*models.User, error)
+	// GetByUsername 同时返回密码哈希，供登录校验使用
+	GetByUsername(ctx context.Context, username string) (*models.User, string, error)
+	// List 按用户名或邮箱模糊搜索，返回当前页的用户和总数
+	List(ctx context.Context, search string, limit, offset int) ([]models.User, int, error)
+}
+
+// LoginState 单点登录发起时保存、回调时取回的参数
+type LoginState struct {
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+type LoginStateStore interface {
+	// Save 按 state 的哈希保存登录参数，同时清理已过期的记录
+	Save(ctx context.Context, stateHash string, state LoginState) error
+	// Take 取出并删除登录参数，保证每个 state 只能使用一次；不存在时返回 ErrNotFound，过期与否由调用方判断
+	Take(ctx context.Context, stateHash string) (*LoginState, error)
+}
+
+// Store 处理器使用的全部数据访问接口
+type Store struct {
+	Dishes          DishStore
+	Categories      CategoryStore
+	Tags            TagStore
+	Orders          OrderStore
+	Promotions      PromotionStore
+	Carts           CartStore
+	Payments        PaymentStore
+	Recommendations RecommendationStore
+	Personalization PersonalizationStore
+	Related         RelatedStore
+	Favorites       FavoriteStore
+	Config          ConfigStore
+	Users           UserStore
+	LoginStates     LoginStateStore
+}
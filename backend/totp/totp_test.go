@@ -0,0 +1,109 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录 B 中 SHA1 的密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// 附录 B 给出 8 位验证码，6 位验证码取其后 6 位
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if got, _ := Code(" "+strings.ToLower(rfcSecret)+" ", 1); got != "287082" {
+		t.Errorf("Code with a lower-case secret = %s, want 287082", got)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with an invalid secret succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+		step   int64
+	}{
+		{"current step", rfcSecret, code(current), true, current},
+		{"one step behind", rfcSecret, code(current - 1), true, current - 1},
+		{"one step ahead", rfcSecret, code(current + 1), true, current + 1},
+		{"two steps behind", rfcSecret, code(current - 2), false, 0},
+		{"two steps ahead", rfcSecret, code(current + 2), false, 0},
+		{"spaces are ignored", rfcSecret, " " + code(current)[:3] + " " + code(current)[3:], true, current},
+		{"too short", rfcSecret, code(current)[:5], false, 0},
+		{"too long", rfcSecret, code(current) + "0", false, 0},
+		{"invalid secret", "not base32!", code(current), false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, now)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("Validate(%q) = %d, %v; want %d, %v", tt.code, step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret %q has %d characters, want 32", secret, len(secret))
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("generated secret cannot be used: %v", err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("two generated secrets are equal")
+	}
+}
+
+func TestURL(t *testing.T) {
+	u, err := url.Parse(URL("Food Ordering", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Food Ordering:alice@example.com" ||
+		query.Get("secret") != rfcSecret || query.Get("issuer") != "Food Ordering" ||
+		query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("URL() = %s", u)
+	}
+}
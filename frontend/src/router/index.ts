@@ -14,6 +14,11 @@ const router = createRouter({
       name: 'Login',
       component: () => import('@/views/Login.vue'),
     },
+    {
+      path: '/auth/callback',
+      name: 'SSOCallback',
+      component: () => import('@/views/SSOCallback.vue'),
+    },
     {
       path: '/dish/:id',
       name: 'DishDetail',
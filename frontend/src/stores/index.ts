@@ -1,11 +1,12 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
-import type { User, Dish, Category, Order, Recommendation } from '@/types'
+import type { User, Dish, Category, Order, Recommendation, LoginResponse, TwoFactorChallenge } from '@/types'
 import { api } from '@/utils/api'
 
 export const useUserStore = defineStore('user', () => {
   const user = ref<User | null>(null)
   const token = ref<string | null>(null)
+  const challenge = ref<TwoFactorChallenge | null>(null)
   const isLoading = ref(false)
 
   const isAuthenticated = computed(() => !!token.value && !!user.value)
@@ -23,17 +24,18 @@ export const useUserStore = defineStore('user', () => {
   }
 
   // 登录
-  async function login(username: string, password: string) {
+  // 返回 'two_factor' 表示还需要两步验证，挑战信息保存在 challenge 中
+  async function login(username: string, password: string): Promise<boolean | 'two_factor'> {
     try {
       isLoading.value = true
       const response = await api.login({ username, password })
-      
-      token.value = response.token
-      user.value = response.user
-      
-      localStorage.setItem('token', response.token)
-      localStorage.setItem('user', JSON.stringify(response.user))
-      
+
+      if ('challenge_token' in response) {
+        challenge.value = response
+        return 'two_factor'
+      }
+
+      setSession(response)
       return true
     } catch (error) {
       console.error('Login failed:', error)
@@ -43,11 +45,66 @@ export const useUserStore = defineStore('user', () => {
     }
   }
 
+  // 完成单点登录，返回值与 login 相同
+  async function loginWithSSO(code: string, state: string): Promise<boolean | 'two_factor'> {
+    try {
+      isLoading.value = true
+      const response = await api.ssoCallback(code, state)
+
+      if ('challenge_token' in response) {
+        challenge.value = response
+        return 'two_factor'
+      }
+
+      setSession(response)
+      return true
+    } catch (error) {
+      console.error('SSO login failed:', error)
+      return false
+    } finally {
+      isLoading.value = false
+    }
+  }
+
+  // 提交两步验证码或恢复码，首次绑定时返回恢复码
+  async function verifyTwoFactor(code: string, useRecoveryCode = false): Promise<string[] | null> {
+    if (!challenge.value) return null
+    try {
+      isLoading.value = true
+      const response = await api.loginTwoFactor({
+        challenge_token: challenge.value.challenge_token,
+        ...(useRecoveryCode ? { recovery_code: code } : { code }),
+      })
+
+      challenge.value = null
+      setSession(response)
+      return response.recovery_codes || []
+    } catch (error) {
+      console.error('Two-factor verification failed:', error)
+      return null
+    } finally {
+      isLoading.value = false
+    }
+  }
+
+  function setSession(response: LoginResponse) {
+    token.value = response.token
+    user.value = response.user
+
+    localStorage.setItem('token', response.token)
+    localStorage.setItem('refresh_token', response.refresh_token)
+    localStorage.setItem('user', JSON.stringify(response.user))
+  }
+
   // 登出
   function logout() {
+    if (token.value) {
+      api.logout().catch(() => {})
+    }
     user.value = null
     token.value = null
     localStorage.removeItem('token')
+    localStorage.removeItem('refresh_token')
     localStorage.removeItem('user')
   }
 
@@ -66,11 +123,14 @@ export const useUserStore = defineStore('user', () => {
   return {
     user,
     token,
+    challenge,
     isLoading,
     isAuthenticated,
     isAdmin,
     initAuth,
     login,
+    loginWithSSO,
+    verifyTwoFactor,
     logout,
     fetchProfile,
   }
@@ -162,10 +222,10 @@ export const useOrderStore = defineStore('order', () => {
   const total = ref(0)
 
   // 创建订单
-  async function createOrder(items: { dish_id: number; quantity: number }[]) {
+  async function createOrder(items: { dish_id: number; quantity: number }[], idempotencyKey?: string, couponCode?: string) {
     try {
       isLoading.value = true
-      const order = await api.createOrder({ items })
+      const order = await api.createOrder({ items, coupon_code: couponCode || undefined }, idempotencyKey)
       orders.value.unshift(order)
       return order
     } catch (error) {
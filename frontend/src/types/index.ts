@@ -3,6 +3,10 @@ export interface User {
   username: string
   email: string
   role: string
+  status: 'active' | 'disabled'
+  must_change_password: boolean
+  two_factor_enabled?: boolean
+  permissions?: string[]
   created_at: string
   updated_at: string
 }
@@ -26,18 +30,111 @@ export interface Dish {
   cooking_steps: string
   is_seasonal: boolean
   is_active: boolean
+  tags: string[]
   created_at: string
   updated_at: string
 }
 
+// 菜品标签，meat、vegetable 决定生成推荐菜单时的荤素
+export interface Tag {
+  id: number
+  slug: string
+  name: string
+  description: string
+  created_at: string
+}
+
 export interface Order {
   id: number
   user_id: number
+  username?: string
+  subtotal: number
+  discount_amount: number
   total_amount: number
   status: 'pending' | 'confirmed' | 'preparing' | 'ready' | 'completed' | 'cancelled'
+  requested_for?: string
+  meal_slot?: MealSlot
+  payment_status?: PaymentStatus
   created_at: string
   updated_at: string
   items?: OrderItem[]
+  adjustments?: OrderAdjustment[]
+}
+
+export type MealSlot = 'breakfast' | 'lunch' | 'dinner'
+
+export type PaymentStatus =
+  | 'pending'
+  | 'authorized'
+  | 'captured'
+  | 'partially_refunded'
+  | 'refunded'
+  | 'failed'
+  | 'cancelled'
+
+// 订单的一次支付，client_secret 用于在支付渠道完成支付
+export interface Payment {
+  id: number
+  order_id: number
+  provider: string
+  intent_id: string
+  client_secret?: string
+  status: PaymentStatus
+  amount: number
+  refunded_amount: number
+  created_at: string
+  updated_at: string
+  refunds?: PaymentRefund[]
+}
+
+export interface PaymentRefund {
+  id: number
+  payment_id: number
+  provider_refund_id: string
+  amount: number
+  reason: string
+  created_by?: number
+  created_at: string
+}
+
+// 厨房排期中某一天的一个用餐时段，capacity 为 0 表示不限
+export interface ScheduleSlot {
+  date: string
+  meal_slot: MealSlot
+  starts_at: string
+  ends_at: string
+  cutoff_at: string
+  capacity: number
+  booked: number
+  orders: Order[]
+}
+
+export interface ScheduleResponse {
+  timezone: string
+  date: string
+  days: number
+  slots: ScheduleSlot[]
+}
+
+// 订单优惠明细，amount 为负数
+export interface OrderAdjustment {
+  id: number
+  promotion_id?: number
+  code?: string
+  description: string
+  amount: number
+}
+
+export interface AdminOrderQuery {
+  page?: number
+  limit?: number
+  status?: Order['status']
+  user_id?: number
+  dish_id?: number
+  from?: string
+  to?: string
+  sort?: 'created_at' | 'total_amount' | 'status'
+  order?: 'asc' | 'desc'
 }
 
 export interface OrderItem {
@@ -47,20 +144,91 @@ export interface OrderItem {
   dish?: Dish
   quantity: number
   price: number
+  note?: string
+  created_at: string
+}
+
+// 服务端购物车，price 为菜品当前价格，added_price 为加入时的价格
+export interface Cart {
+  items: CartItem[]
+  subtotal: number
+  warnings: string[]
+  updated_at: string | null
+  expires_at: string | null
+}
+
+export interface CartItem {
+  dish_id: number
+  dish?: Dish
+  quantity: number
+  note: string
+  added_price: number
+  price: number
+  line_total: number
+  available: boolean
+  warning?: string
   created_at: string
+  updated_at: string
 }
 
+// template 按荤素数量随机挑选菜品，curated 为管理员选定的固定菜单
+export type RecommendationType = 'template' | 'curated'
+
 export interface Recommendation {
   id: number
   name: string
   description: string
+  type: RecommendationType
   meat_count: number
   vegetable_count: number
   is_active: boolean
   created_at: string
+  updated_at: string
   dishes?: Dish[]
 }
 
+// 个性化推荐，由后台任务定期计算，computed_at 为 null 表示还没有计算过
+export interface PersonalDish {
+  dish: Dish
+  score: number
+  reasons: Array<'frequently_ordered' | 'recently_ordered' | 'favorite' | 'category_affinity'>
+}
+
+export interface PersonalRecommendations {
+  dishes: PersonalDish[]
+  computed_at: string | null
+}
+
+export interface RelatedDish {
+  dish: Dish
+  score: number
+  co_orders: number
+}
+
+export interface CartSuggestion {
+  dish: Dish
+  score: number
+  reason: 'often_ordered_together' | 'complements_cart'
+}
+
+export interface RecommendationRequest {
+  name: string
+  description?: string
+  type?: RecommendationType
+  meat_count: number
+  vegetable_count: number
+  dish_ids?: number[]
+  is_active?: boolean
+}
+
+// 按推荐配置生成的菜单，用响应中的 seed 可以重新得到同一份菜单
+export interface GeneratedMenu extends Recommendation {
+  dishes: Dish[]
+  seed: number
+  total: number
+  budget?: number
+}
+
 export interface UserFavorite {
   id: number
   user_id: number
@@ -76,16 +244,37 @@ export interface LoginRequest {
 
 export interface LoginResponse {
   token: string
+  refresh_token: string
+  expires_in: number
   user: User
+  recovery_codes?: string[]
+}
+
+// 密码正确但还需要两步验证
+export interface TwoFactorChallenge {
+  two_factor_required: true
+  enrollment_required: boolean
+  challenge_token: string
+  expires_in: number
+}
+
+export interface TOTPSetup {
+  secret: string
+  otpauth_url: string
 }
 
+// requested_for 为空时立即下单，meal_slot 为空时按 requested_for 推断
 export interface CreateOrderRequest {
   items: CreateOrderItemRequest[]
+  coupon_code?: string
+  requested_for?: string
+  meal_slot?: MealSlot
 }
 
 export interface CreateOrderItemRequest {
   dish_id: number
   quantity: number
+  note?: string
 }
 
 export interface CreateDishRequest {
@@ -97,6 +286,7 @@ export interface CreateDishRequest {
   video_url: string
   cooking_steps: string
   is_seasonal: boolean
+  tags?: string[]
 }
 
 export interface UpdateDishRequest {
@@ -109,6 +299,7 @@ export interface UpdateDishRequest {
   cooking_steps?: string
   is_seasonal?: boolean
   is_active?: boolean
+  tags?: string[]
 }
 
 export interface CreateCategoryRequest {
@@ -121,6 +312,17 @@ export interface UpdateCategoryRequest {
   description?: string
 }
 
+export interface CreateTagRequest {
+  slug: string
+  name: string
+  description?: string
+}
+
+export interface UpdateTagRequest {
+  name?: string
+  description?: string
+}
+
 export interface SystemConfig {
   id: number
   config_key: string
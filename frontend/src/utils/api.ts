@@ -3,16 +3,31 @@ import type {
   User, 
   Dish, 
   Category, 
+  Tag,
   Order, 
   Recommendation, 
+  GeneratedMenu,
+  RecommendationRequest,
+  PersonalRecommendations,
+  RelatedDish,
   UserFavorite,
   LoginRequest,
   LoginResponse,
+  TwoFactorChallenge,
+  TOTPSetup,
   CreateOrderRequest,
+  Cart,
+  CartSuggestion,
+  MealSlot,
+  ScheduleResponse,
+  Payment,
+  AdminOrderQuery,
   CreateDishRequest,
   UpdateDishRequest,
   CreateCategoryRequest,
   UpdateCategoryRequest,
+  CreateTagRequest,
+  UpdateTagRequest,
   SystemConfig,
   ApiResponse,
   PaginatedResponse
@@ -20,6 +35,7 @@ import type {
 
 class ApiClient {
   private client: AxiosInstance
+  private refreshing: Promise<string> | null = null
 
   constructor() {
     this.client = axios.create({
@@ -46,9 +62,37 @@ class ApiClient {
       (response: AxiosResponse) => {
         return response
       },
-      (error) => {
-        if (error.response?.status === 401) {
+      async (error) => {
+        const original = error.config
+        const refreshToken = localStorage.getItem('refresh_token')
+
+        // 访问令牌过期时用刷新令牌换取新令牌后重试一次
+        if (error.response?.status === 401 && refreshToken && original && !original._retried
+          && !original.url?.includes('/token/refresh')) {
+          original._retried = true
+          try {
+            this.refreshing ??= this.client
+              .post<LoginResponse>('/token/refresh', { refresh_token: refreshToken })
+              .then((response) => {
+                localStorage.setItem('token', response.data.token)
+                localStorage.setItem('refresh_token', response.data.refresh_token)
+                return response.data.token
+              })
+              .finally(() => {
+                this.refreshing = null
+              })
+            const token = await this.refreshing
+            original.headers.Authorization = `Bearer ${token}`
+            return this.client(original)
+          } catch {
+            // 刷新失败时走下面的登出逻辑
+          }
+        }
+
+        // 登录接口的401是凭据或验证码错误，交给调用方处理
+        if (error.response?.status === 401 && !original?.url?.startsWith('/login')) {
           localStorage.removeItem('token')
+          localStorage.removeItem('refresh_token')
           localStorage.removeItem('user')
           window.location.href = '/login'
         }
@@ -58,11 +102,40 @@ class ApiClient {
   }
 
   // 认证相关
-  async login(credentials: LoginRequest): Promise<LoginResponse> {
-    const response = await this.client.post<LoginResponse>('/login', credentials)
+  async login(credentials: LoginRequest): Promise<LoginResponse | TwoFactorChallenge> {
+    const response = await this.client.post<LoginResponse | TwoFactorChallenge>('/login', credentials)
+    return response.data
+  }
+
+  async loginTwoFactor(data: { challenge_token: string; code?: string; recovery_code?: string }): Promise<LoginResponse> {
+    const response = await this.client.post<LoginResponse>('/login/2fa', data)
+    return response.data
+  }
+
+  async enrollTwoFactor(challengeToken: string): Promise<TOTPSetup> {
+    const response = await this.client.post<TOTPSetup>('/login/2fa/enroll', { challenge_token: challengeToken })
+    return response.data
+  }
+
+  async getSSOConfig(): Promise<{ enabled: boolean; provider: string }> {
+    const response = await this.client.get<{ enabled: boolean; provider: string }>('/auth/sso')
     return response.data
   }
 
+  async startSSOLogin(): Promise<{ authorization_url: string; state: string }> {
+    const response = await this.client.post<{ authorization_url: string; state: string }>('/auth/sso/login')
+    return response.data
+  }
+
+  async ssoCallback(code: string, state: string): Promise<LoginResponse | TwoFactorChallenge> {
+    const response = await this.client.post<LoginResponse | TwoFactorChallenge>('/auth/sso/callback', { code, state })
+    return response.data
+  }
+
+  async logout(): Promise<void> {
+    await this.client.post('/logout')
+  }
+
   async getProfile(): Promise<User> {
     const response = await this.client.get<User>('/profile')
     return response.data
@@ -74,6 +147,7 @@ class ApiClient {
     limit?: number
     category_id?: number
     search?: string
+    tag?: string
   }): Promise<PaginatedResponse<Dish>> {
     const response = await this.client.get<PaginatedResponse<Dish>>('/dishes', { params })
     return response.data
@@ -84,6 +158,11 @@ class ApiClient {
     return response.data
   }
 
+  async getRelatedDishes(id: number, limit?: number): Promise<RelatedDish[]> {
+    const response = await this.client.get<RelatedDish[]>(`/dishes/${id}/related`, { params: { limit } })
+    return response.data
+  }
+
   async createDish(dish: CreateDishRequest): Promise<Dish> {
     const response = await this.client.post<Dish>('/admin/dishes', dish)
     return response.data
@@ -118,20 +197,57 @@ class ApiClient {
     await this.client.delete(`/admin/categories/${id}`)
   }
 
+  // 标签相关
+  async getTags(): Promise<Tag[]> {
+    const response = await this.client.get<Tag[]>('/tags')
+    return response.data
+  }
+
+  async createTag(tag: CreateTagRequest): Promise<Tag> {
+    const response = await this.client.post<Tag>('/admin/tags', tag)
+    return response.data
+  }
+
+  async updateTag(id: number, tag: UpdateTagRequest): Promise<Tag> {
+    const response = await this.client.put<Tag>(`/admin/tags/${id}`, tag)
+    return response.data
+  }
+
+  async deleteTag(id: number): Promise<void> {
+    await this.client.delete(`/admin/tags/${id}`)
+  }
+
   // 推荐相关
   async getRecommendations(): Promise<Recommendation[]> {
     const response = await this.client.get<Recommendation[]>('/recommendations')
     return response.data
   }
 
+  async generateRecommendation(id: number, params?: {
+    seed?: number
+    budget?: number
+    exclude?: number[]
+  }): Promise<GeneratedMenu> {
+    const query = { ...params, exclude: params?.exclude?.join(',') }
+    const response = await this.client.get<GeneratedMenu>(`/recommendations/${id}/generate`, { params: query })
+    return response.data
+  }
+
+  async getPersonalRecommendations(limit?: number): Promise<PersonalRecommendations> {
+    const response = await this.client.get<PersonalRecommendations>('/recommendations/personal', { params: { limit } })
+    return response.data
+  }
+
   async getSeasonalDishes(): Promise<Dish[]> {
     const response = await this.client.get<Dish[]>('/seasonal-dishes')
     return response.data
   }
 
   // 订单相关
-  async createOrder(order: CreateOrderRequest): Promise<Order> {
-    const response = await this.client.post<Order>('/orders', order)
+  // 重试时传入同一个 idempotencyKey，服务端只会创建一次订单
+  async createOrder(order: CreateOrderRequest, idempotencyKey?: string): Promise<Order> {
+    const headers = idempotencyKey ? { 'Idempotency-Key': idempotencyKey } : undefined
+    const response = await this.client.post<Order>('/orders', order, { headers })
     return response.data
   }
 
@@ -140,6 +256,77 @@ class ApiClient {
     return response.data
   }
 
+  async getOrder(orderId: number): Promise<Order> {
+    const response = await this.client.get<Order>(`/orders/${orderId}`)
+    return response.data
+  }
+
+  async cancelOrder(orderId: number, reason?: string): Promise<Order> {
+    const response = await this.client.post<Order>(`/orders/${orderId}/cancel`, { reason })
+    return response.data
+  }
+
+  // 支付相关
+  async payOrder(orderId: number): Promise<Payment> {
+    const response = await this.client.post<Payment>(`/orders/${orderId}/pay`)
+    return response.data
+  }
+
+  async getPayment(orderId: number): Promise<Payment> {
+    const response = await this.client.get<Payment>(`/orders/${orderId}/payment`)
+    return response.data
+  }
+
+  // 模拟支付渠道的支付页面，仅后端 PAYMENT_PROVIDER=fake 时可用
+  async fakePay(clientSecret: string, outcome: 'succeed' | 'fail' = 'succeed'): Promise<void> {
+    await this.client.post('/payments/fake/pay', { client_secret: clientSecret, outcome })
+  }
+
+  // 购物车相关
+  async getCart(): Promise<Cart> {
+    const response = await this.client.get<Cart>('/cart')
+    return response.data
+  }
+
+  async addToCart(dishId: number, quantity = 1, note?: string): Promise<Cart> {
+    const response = await this.client.post<Cart>('/cart/items', { dish_id: dishId, quantity, note })
+    return response.data
+  }
+
+  async updateCartItem(dishId: number, changes: { quantity?: number; note?: string }): Promise<Cart> {
+    const response = await this.client.put<Cart>(`/cart/items/${dishId}`, changes)
+    return response.data
+  }
+
+  async removeFromCart(dishId: number): Promise<Cart> {
+    const response = await this.client.delete<Cart>(`/cart/items/${dishId}`)
+    return response.data
+  }
+
+  async clearCart(): Promise<void> {
+    await this.client.delete('/cart')
+  }
+
+  async checkout(
+    options: { coupon_code?: string; requested_for?: string; meal_slot?: MealSlot } = {},
+    idempotencyKey?: string
+  ): Promise<Order> {
+    const headers = idempotencyKey ? { 'Idempotency-Key': idempotencyKey } : undefined
+    const response = await this.client.post<Order>('/cart/checkout', options, { headers })
+    return response.data
+  }
+
+  async getCartSuggestions(limit?: number): Promise<CartSuggestion[]> {
+    const response = await this.client.get<CartSuggestion[]>('/cart/suggestions', { params: { limit } })
+    return response.data
+  }
+
+  // 厨房排期
+  async getSchedule(params?: { date?: string; days?: number }): Promise<ScheduleResponse> {
+    const response = await this.client.get<ScheduleResponse>('/schedule', { params })
+    return response.data
+  }
+
   // 收藏相关
   async addToFavorites(dishId: number): Promise<void> {
     await this.client.post(`/favorites/${dishId}`)
@@ -160,6 +347,50 @@ class ApiClient {
     return response.data
   }
 
+  async updateUserRole(id: number, data: { role: string }): Promise<User> {
+    const response = await this.client.put<User>(`/admin/users/${id}/role`, data)
+    return response.data
+  }
+
+  async getAdminOrders(params?: AdminOrderQuery): Promise<PaginatedResponse<Order>> {
+    const response = await this.client.get<PaginatedResponse<Order>>('/admin/orders', { params })
+    return response.data
+  }
+
+  async updateOrderStatus(orderId: number, data: { status: Order['status']; note?: string }): Promise<Order> {
+    const response = await this.client.put<Order>(`/admin/orders/${orderId}/status`, data)
+    return response.data
+  }
+
+  async getAdminRecommendations(): Promise<Recommendation[]> {
+    const response = await this.client.get<Recommendation[]>('/admin/recommendations')
+    return response.data
+  }
+
+  async createRecommendation(recommendation: RecommendationRequest): Promise<Recommendation> {
+    const response = await this.client.post<Recommendation>('/admin/recommendations', recommendation)
+    return response.data
+  }
+
+  async updateRecommendation(id: number, recommendation: RecommendationRequest): Promise<Recommendation> {
+    const response = await this.client.put<Recommendation>(`/admin/recommendations/${id}`, recommendation)
+    return response.data
+  }
+
+  async updateRecommendationDishes(id: number, dishIds: number[]): Promise<Recommendation> {
+    const response = await this.client.put<Recommendation>(`/admin/recommendations/${id}/dishes`, { dish_ids: dishIds })
+    return response.data
+  }
+
+  async setRecommendationActive(id: number, active: boolean): Promise<Recommendation> {
+    const response = await this.client.post<Recommendation>(`/admin/recommendations/${id}/${active ? 'activate' : 'deactivate'}`)
+    return response.data
+  }
+
+  async deleteRecommendation(id: number): Promise<void> {
+    await this.client.delete(`/admin/recommendations/${id}`)
+  }
+
   async getConfig(): Promise<SystemConfig[]> {
     const response = await this.client.get<SystemConfig[]>('/admin/config')
     return response.data
@@ -65,14 +65,8 @@ setup_database() {
         fi
     fi
     
-    # 初始化数据库表
-    if [ -f "database/schema.sql" ]; then
-        echo "📝 初始化数据库表..."
-        PGPASSWORD=password psql -h localhost -U postgres -d food_ordering -f database/schema.sql
-        echo "✅ 数据库表初始化完成"
-    else
-        echo "⚠️  数据库脚本文件不存在: database/schema.sql"
-    fi
+    # 数据库表由后端启动时自动迁移（backend/database/migrations）
+    echo "📝 数据库表将在后端启动时自动迁移"
 }
 
 # 启动后端
@@ -101,7 +95,7 @@ start_backend() {
     
     # 启动后端
     echo "🌟 启动Go服务器..."
-    go run main.go &
+    go run . &
     BACKEND_PID=$!
     echo "✅ 后端服务已启动 (PID: $BACKEND_PID)"
     